@@ -0,0 +1,150 @@
+// Copyright © 2023 Weald Technology Trading.
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package main
+
+import (
+	"context"
+	"fmt"
+	"strings"
+	"time"
+
+	"github.com/pkg/errors"
+	"github.com/spf13/viper"
+	"github.com/wealdtech/go-majordomo"
+	nullmetrics "github.com/wealdtech/probed/services/metrics/null"
+	"github.com/wealdtech/probed/services/probedb"
+	"github.com/wealdtech/probed/util"
+)
+
+// runCommand runs a one-shot command, returning the exit code.
+func runCommand(ctx context.Context, majordomo majordomo.Service, args []string) int {
+	switch args[0] {
+	case "db":
+		if len(args) < 2 {
+			log.Error().Msg("No database command supplied")
+			return 1
+		}
+		if err := runDBCommand(ctx, majordomo, args[1]); err != nil {
+			log.Error().Err(err).Str("command", args[1]).Msg("Failed to run database command")
+			return 1
+		}
+		return 0
+	case "prune":
+		if err := prune(ctx, majordomo); err != nil {
+			log.Error().Err(err).Msg("Failed to prune probe database")
+			return 1
+		}
+		return 0
+	default:
+		log.Error().Str("command", args[0]).Msg("Unknown command")
+		return 1
+	}
+}
+
+// prune removes all data older than its retention period from the probe database.
+func prune(ctx context.Context, majordomo majordomo.Service) error {
+	probeDB, err := util.InitProbeDB(ctx, nullmetrics.New(), majordomo)
+	if err != nil {
+		return errors.Wrap(err, "failed to set up probe DB service")
+	}
+	if err := upgradeProbeDB(ctx, probeDB); err != nil {
+		return err
+	}
+
+	pruner, err := util.InitPruner(ctx, nullmetrics.New(), probeDB, false)
+	if err != nil {
+		return errors.Wrap(err, "failed to set up pruner")
+	}
+
+	started := time.Now()
+	if err := pruner.Prune(ctx); err != nil {
+		return err
+	}
+	log.Info().Dur("elapsed", time.Since(started)).Msg("Pruned probe database")
+
+	return nil
+}
+
+// runDBCommand runs a command against the schema of the probe database.
+// The schema is not upgraded before the command is run.
+func runDBCommand(ctx context.Context, majordomo majordomo.Service, command string) error {
+	probeDB, err := util.InitProbeDB(ctx, nullmetrics.New(), majordomo)
+	if err != nil {
+		return errors.Wrap(err, "failed to set up probe DB service")
+	}
+	migrator, isMigrator := probeDB.(probedb.SchemaMigrator)
+	if !isMigrator {
+		return errors.New("database does not support schema migrations")
+	}
+
+	switch command {
+	case "status":
+		status, err := migrator.MigrationStatus(ctx)
+		if err != nil {
+			return err
+		}
+		printMigrationStatus(status)
+	case "migrate":
+		statements, err := migrator.Migrate(ctx, viper.GetBool("dry-run"))
+		if err != nil {
+			return err
+		}
+		if viper.GetBool("dry-run") {
+			printStatements(statements)
+		}
+	case "rollback":
+		if !viper.IsSet("to") {
+			return errors.New("schema version to which to roll back must be supplied with --to")
+		}
+		statements, err := migrator.Rollback(ctx, viper.GetUint64("to"), viper.GetBool("dry-run"))
+		if err != nil {
+			return err
+		}
+		if viper.GetBool("dry-run") {
+			printStatements(statements)
+		}
+	default:
+		return errors.Errorf("unknown database command %q", command)
+	}
+
+	return nil
+}
+
+// printMigrationStatus prints the status of the schema of the probe database.
+func printMigrationStatus(status *probedb.MigrationStatus) {
+	fmt.Printf("Schema version: %d\n", status.Version)
+	fmt.Printf("Latest schema version: %d\n", status.LatestVersion)
+	if len(status.Pending) == 0 {
+		fmt.Println("Pending migrations: none")
+	} else {
+		pending := make([]string, len(status.Pending))
+		for i := range status.Pending {
+			pending[i] = fmt.Sprintf("%d", status.Pending[i])
+		}
+		fmt.Printf("Pending migrations: %s\n", strings.Join(pending, ", "))
+	}
+	if len(status.History) > 0 {
+		fmt.Println("History:")
+		for _, migration := range status.History {
+			fmt.Printf("  %s: %d -> %d\n", migration.Timestamp.Format(time.RFC3339), migration.From, migration.To)
+		}
+	}
+}
+
+// printStatements prints the SQL statements run by a migration.
+func printStatements(statements []string) {
+	for _, statement := range statements {
+		fmt.Printf("%s;\n", strings.TrimSuffix(strings.TrimSpace(statement), ";"))
+	}
+}
@@ -41,6 +41,7 @@ import (
 	prometheusmetrics "github.com/wealdtech/probed/services/metrics/prometheus"
 	"github.com/wealdtech/probed/services/probedb"
 	postgresqlprobedb "github.com/wealdtech/probed/services/probedb/postgresql"
+	sqliteprobedb "github.com/wealdtech/probed/services/probedb/sqlite"
 	"github.com/wealdtech/probed/util"
 )
 
@@ -75,6 +76,11 @@ func main2() int {
 	}
 
 	logModules()
+
+	if pflag.NArg() > 0 {
+		return runCommand(ctx, majordomo, pflag.Args())
+	}
+
 	log.Info().Str("version", ReleaseVersion).Msg("Starting probed")
 
 	if err := initProfiling(); err != nil {
@@ -130,6 +136,12 @@ func fetchConfig() error {
 	pflag.Int32("probedb.port", 5432, "port of the probe database")
 	pflag.String("probedb.user", "", "user of the probe database")
 	pflag.String("probedb.password", "", "password of the probe database")
+	pflag.String("probedb.database", "", "name of the probe database")
+	if commandName(os.Args[1:]) == "db" {
+		// Flags for the db command are not accepted elsewhere.
+		pflag.Bool("dry-run", false, "print the statements of database migrations without running them")
+		pflag.Uint64("to", 0, "schema version to which to roll back the database")
+	}
 	pflag.Parse()
 	if err := viper.BindPFlags(pflag.CommandLine); err != nil {
 		return errors.Wrap(err, "failed to bind pflags to viper")
@@ -166,6 +178,32 @@ func fetchConfig() error {
 	return nil
 }
 
+// commandName returns the name of the command in the arguments, if any.
+// Flags that take a value are expected to have been registered.
+func commandName(args []string) string {
+	for i := 0; i < len(args); i++ {
+		switch {
+		case args[i] == "--":
+			if i+1 < len(args) {
+				return args[i+1]
+			}
+			return ""
+		case !strings.HasPrefix(args[i], "-"):
+			return args[i]
+		case strings.Contains(args[i], "="):
+			// Value supplied with the flag.
+		default:
+			flag := pflag.Lookup(strings.TrimLeft(args[i], "-"))
+			if flag != nil && flag.NoOptDefVal == "" {
+				// Value supplied as the next argument.
+				i++
+			}
+		}
+	}
+
+	return ""
+}
+
 // initProfiling initialises the profiling server.
 func initProfiling() error {
 	profileAddress := viper.GetString("profile-address")
@@ -186,38 +224,82 @@ func initProfiling() error {
 }
 
 func startServices(ctx context.Context, monitor metrics.Service, majordomo majordomo.Service) error {
-	probeDB, err := util.InitProbeDB(ctx, majordomo)
+	probeDB, err := util.InitProbeDB(ctx, monitor, majordomo)
 	if err != nil {
 		return errors.Wrap(err, "failed to set up probe DB service")
 	}
-	if postgresqlProbeDB, isPostgresqlDB := probeDB.(*postgresqlprobedb.Service); isPostgresqlDB {
-		log.Trace().Msg("Checking for schema upgrades")
-		if err := postgresqlProbeDB.Upgrade(ctx); err != nil {
-			return errors.Wrap(err, "failed to upgrade probe database")
+	if err := upgradeProbeDB(ctx, probeDB); err != nil {
+		return err
+	}
+
+	if viper.GetBool("pruner.enable") {
+		log.Trace().Msg("Starting pruner")
+		if _, err := util.InitPruner(ctx, monitor, probeDB, true); err != nil {
+			return errors.Wrap(err, "failed to start pruner")
 		}
+	} else if _, isPartitioner := probeDB.(probedb.Partitioner); isPartitioner {
+		log.Warn().Msg("Pruner is not enabled; partitions will not be created ahead of the chain")
+	}
+
+	// Writes are subject to timeouts, retries and a circuit breaker.
+	setterDB, err := util.InitResilientProbeDB(ctx, monitor, probeDB)
+	if err != nil {
+		return errors.Wrap(err, "failed to set up resilient probe DB service")
 	}
 
-	blockDelaysSetter, isBlockDelaysSetter := probeDB.(probedb.BlockDelaysSetter)
+	// Writes can optionally be spooled to disk if the database fails.
+	if viper.GetBool("probedb.spool.enable") {
+		log.Trace().Msg("Spooling failed probe database writes")
+		setterDB, err = util.InitSpooledProbeDB(ctx, monitor, setterDB)
+		if err != nil {
+			return errors.Wrap(err, "failed to set up spooled probe DB service")
+		}
+	}
+
+	// Batches are written in a single transaction, so cannot be buffered.
+	batchSetter, isBatchSetter := setterDB.(restdaemon.BatchSetter)
+	if !isBatchSetter {
+		return errors.New("database does not support setting batch data")
+	}
+
+	// Writes can optionally be buffered and flushed to the database in bulk.
+	if viper.GetBool("probedb.buffered.enable") {
+		log.Trace().Msg("Buffering probe database writes")
+		setterDB, err = util.InitBufferedProbeDB(ctx, monitor, setterDB)
+		if err != nil {
+			return errors.Wrap(err, "failed to set up buffered probe DB service")
+		}
+	}
+
+	blockDelaysSetter, isBlockDelaysSetter := setterDB.(probedb.BlockDelaysSetter)
 	if !isBlockDelaysSetter {
 		return errors.New("database does not support setting block delay data")
 	}
 
-	headDelaysSetter, isHeadDelaysSetter := probeDB.(probedb.HeadDelaysSetter)
+	headDelaysSetter, isHeadDelaysSetter := setterDB.(probedb.HeadDelaysSetter)
 	if !isHeadDelaysSetter {
 		return errors.New("database does not support setting head delay data")
 	}
 
-	aggregateAttestationsSetter, isAggregateAttestationsSetter := probeDB.(probedb.AggregateAttestationsSetter)
+	aggregateAttestationsSetter, isAggregateAttestationsSetter := setterDB.(probedb.AggregateAttestationsSetter)
 	if !isAggregateAttestationsSetter {
 		return errors.New("database does not support setting aggregate attestation data")
 	}
 
-	attestationSummariesSetter, isAttestationSummariesSetter := probeDB.(probedb.AttestationSummariesSetter)
+	attestationSummariesSetter, isAttestationSummariesSetter := setterDB.(probedb.AttestationSummariesSetter)
 	if !isAttestationSummariesSetter {
 		return errors.New("database does not support setting attestation summary data")
 	}
 
-	_, err = restdaemon.New(ctx,
+	apiKeys, err := util.FetchAPIKeys(ctx, majordomo, "daemon.rest.api-keys")
+	if err != nil {
+		return errors.Wrap(err, "failed to obtain API keys")
+	}
+	if len(apiKeys) == 0 && viper.GetString("daemon.rest.client-ca-cert") == "" {
+		log.Warn().Msg("No API keys or client certificate authority configured; submissions will not be authenticated")
+	}
+
+	restParams := []restdaemon.Parameter{
 		restdaemon.WithLogLevel(util.LogLevel("daemon.rest")),
 		restdaemon.WithServerName(viper.GetString("daemon.rest.server-name")),
 		restdaemon.WithListenAddress(viper.GetString("daemon.rest.listen-address")),
@@ -225,7 +307,39 @@ func startServices(ctx context.Context, monitor metrics.Service, majordomo major
 		restdaemon.WithHeadDelaysSetter(headDelaysSetter),
 		restdaemon.WithAggregateAttestationsSetter(aggregateAttestationsSetter),
 		restdaemon.WithAttestationSummariesSetter(attestationSummariesSetter),
-	)
+		restdaemon.WithBatchSetter(batchSetter),
+		restdaemon.WithAPIKeys(apiKeys),
+		restdaemon.WithTrustedProxies(viper.GetStringSlice("daemon.rest.trusted-proxies")),
+		restdaemon.WithSlotsPerEpoch(viper.GetUint32("chain.slots-per-epoch")),
+	}
+
+	// Providers are optional; if present they are exposed through the API.
+	if blockDelaysProvider, isProvider := probeDB.(probedb.BlockDelaysProvider); isProvider {
+		restParams = append(restParams, restdaemon.WithBlockDelaysProvider(blockDelaysProvider))
+	}
+	if headDelaysProvider, isProvider := probeDB.(probedb.HeadDelaysProvider); isProvider {
+		restParams = append(restParams, restdaemon.WithHeadDelaysProvider(headDelaysProvider))
+	}
+	if blockDelayStatisticsProvider, isProvider := probeDB.(probedb.BlockDelayStatisticsProvider); isProvider {
+		restParams = append(restParams, restdaemon.WithBlockDelayStatisticsProvider(blockDelayStatisticsProvider))
+	}
+	if headDelayStatisticsProvider, isProvider := probeDB.(probedb.HeadDelayStatisticsProvider); isProvider {
+		restParams = append(restParams, restdaemon.WithHeadDelayStatisticsProvider(headDelayStatisticsProvider))
+	}
+	if aggregateAttestationsProvider, isProvider := probeDB.(probedb.AggregateAttestationsProvider); isProvider {
+		restParams = append(restParams, restdaemon.WithAggregateAttestationsProvider(aggregateAttestationsProvider))
+	}
+	if attestationSummariesProvider, isProvider := probeDB.(probedb.AttestationSummariesProvider); isProvider {
+		restParams = append(restParams, restdaemon.WithAttestationSummariesProvider(attestationSummariesProvider))
+	}
+
+	tlsParams, err := restTLSParams(ctx, majordomo)
+	if err != nil {
+		return err
+	}
+	restParams = append(restParams, tlsParams...)
+
+	_, err = restdaemon.New(ctx, restParams...)
 	if err != nil {
 		return errors.Wrap(err, "failed to start REST daemon")
 	}
@@ -233,6 +347,67 @@ func startServices(ctx context.Context, monitor metrics.Service, majordomo major
 	return nil
 }
 
+// upgradeProbeDB upgrades the schema of the probe database if required.
+func upgradeProbeDB(ctx context.Context, probeDB probedb.Service) error {
+	if postgresqlProbeDB, isPostgresqlDB := probeDB.(*postgresqlprobedb.Service); isPostgresqlDB {
+		log.Trace().Msg("Checking for schema upgrades")
+		if err := postgresqlProbeDB.Upgrade(ctx); err != nil {
+			return errors.Wrap(err, "failed to upgrade probe database")
+		}
+	}
+	if sqliteProbeDB, isSQLiteDB := probeDB.(*sqliteprobedb.Service); isSQLiteDB {
+		log.Trace().Msg("Checking for schema upgrades")
+		if err := sqliteProbeDB.Upgrade(ctx); err != nil {
+			return errors.Wrap(err, "failed to upgrade probe database")
+		}
+	}
+
+	return nil
+}
+
+// restTLSParams returns the parameters for the REST daemon's TLS configuration.
+func restTLSParams(ctx context.Context, majordomo majordomo.Service) ([]restdaemon.Parameter, error) {
+	tlsMode, err := restdaemon.ParseTLSMode(viper.GetString("daemon.rest.tls-mode"))
+	if err != nil {
+		return nil, errors.Wrap(err, "invalid REST daemon TLS mode")
+	}
+	params := []restdaemon.Parameter{
+		restdaemon.WithTLSMode(tlsMode),
+	}
+
+	switch tlsMode {
+	case restdaemon.TLSModeAutocert:
+		if viper.GetString("daemon.rest.autocert.cache-dir") != "" {
+			params = append(params, restdaemon.WithAutocertCacheDir(util.ResolvePath(viper.GetString("daemon.rest.autocert.cache-dir"))))
+		}
+	case restdaemon.TLSModeStatic:
+		serverCert, err := majordomo.Fetch(ctx, viper.GetString("daemon.rest.server-cert"))
+		if err != nil {
+			return nil, errors.Wrap(err, "failed to read REST daemon server certificate")
+		}
+		serverKey, err := majordomo.Fetch(ctx, viper.GetString("daemon.rest.server-key"))
+		if err != nil {
+			return nil, errors.Wrap(err, "failed to read REST daemon server key")
+		}
+		params = append(params,
+			restdaemon.WithServerCert(serverCert),
+			restdaemon.WithServerKey(serverKey),
+		)
+	case restdaemon.TLSModePlain:
+		log.Warn().Msg("REST daemon serving plain HTTP; ensure that it is behind a TLS-terminating proxy")
+	}
+
+	if viper.GetString("daemon.rest.client-ca-cert") != "" {
+		clientCACert, err := majordomo.Fetch(ctx, viper.GetString("daemon.rest.client-ca-cert"))
+		if err != nil {
+			return nil, errors.Wrap(err, "failed to read REST daemon client certificate authority certificate")
+		}
+		params = append(params, restdaemon.WithClientCACert(clientCACert))
+	}
+
+	return params, nil
+}
+
 func logModules() {
 	buildInfo, ok := debug.ReadBuildInfo()
 	if ok {
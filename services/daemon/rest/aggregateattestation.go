@@ -32,7 +32,7 @@ func (s *Service) postAggregateAttestation(w http.ResponseWriter, r *http.Reques
 		return
 	}
 
-	sourceIP, err := sourceIP(r)
+	sourceIP, err := s.sourceIP(r)
 	if err != nil {
 		log.Debug().Err(err).Msg("Failed to obtain source IP")
 		w.WriteHeader(http.StatusInternalServerError)
@@ -40,8 +40,9 @@ func (s *Service) postAggregateAttestation(w http.ResponseWriter, r *http.Reques
 		return
 	}
 
-	if err := s.aggregateAttestationsSetter.SetAggregateAttestation(context.Background(), &probedb.AggregateAttestation{
+	action, err := s.aggregateAttestationsSetter.SetAggregateAttestation(context.Background(), &probedb.AggregateAttestation{
 		IPAddr:          sourceIP,
+		Prober:          proberFromRequest(r),
 		Source:          aggregateAttestation.Source,
 		Method:          aggregateAttestation.Method,
 		Slot:            aggregateAttestation.Slot,
@@ -51,9 +52,10 @@ func (s *Service) postAggregateAttestation(w http.ResponseWriter, r *http.Reques
 		SourceRoot:      aggregateAttestation.SourceRoot,
 		TargetRoot:      aggregateAttestation.TargetRoot,
 		DelayMS:         aggregateAttestation.DelayMS,
-	}); err != nil {
+	})
+	if err != nil {
 		log.Warn().Err(err).Msg("Failed to set aggregate attestation")
-		w.WriteHeader(http.StatusInternalServerError)
+		writeStorageError(w, err)
 		requestHandled("aggregate attestation", "failed")
 		return
 	}
@@ -65,6 +67,6 @@ func (s *Service) postAggregateAttestation(w http.ResponseWriter, r *http.Reques
 	//		Uint32("slot", blockDelay.Slot).
 	//		Uint32("delay_ms", blockDelay.DelayMS).
 	//		Msg("Metric accepted")
-	w.WriteHeader(http.StatusCreated)
+	w.WriteHeader(actionStatusCode(action))
 	requestHandled("aggregate attestation", "succeeded")
 }
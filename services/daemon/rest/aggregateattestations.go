@@ -0,0 +1,60 @@
+// Copyright © 2023 Weald Technology Trading.
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package rest
+
+import (
+	"net/http"
+
+	"github.com/wealdtech/probed/services/daemon/rest/types"
+	"github.com/wealdtech/probed/services/probedb"
+)
+
+func (s *Service) getAggregateAttestations(w http.ResponseWriter, r *http.Request) {
+	filter, err := parseAggregateAttestationFilter(r.URL.Query())
+	if err != nil {
+		log.Debug().Err(err).Msg("Supplied with invalid filter")
+		w.WriteHeader(http.StatusBadRequest)
+		requestHandled("aggregate attestations", "failed")
+		return
+	}
+
+	aggregateAttestations, err := s.aggregateAttestationsProvider.AggregateAttestations(r.Context(), filter)
+	if err != nil {
+		log.Warn().Err(err).Msg("Failed to obtain aggregate attestations")
+		w.WriteHeader(http.StatusInternalServerError)
+		requestHandled("aggregate attestations", "failed")
+		return
+	}
+
+	res := make([]*types.AggregateAttestation, 0, len(aggregateAttestations))
+	for _, aggregateAttestation := range aggregateAttestations {
+		res = append(res, &types.AggregateAttestation{
+			Source:          aggregateAttestation.Source,
+			Method:          aggregateAttestation.Method,
+			Slot:            aggregateAttestation.Slot,
+			CommitteeIndex:  aggregateAttestation.CommitteeIndex,
+			AggregationBits: aggregateAttestation.AggregationBits,
+			BeaconBlockRoot: aggregateAttestation.BeaconBlockRoot,
+			SourceRoot:      aggregateAttestation.SourceRoot,
+			TargetRoot:      aggregateAttestation.TargetRoot,
+			DelayMS:         aggregateAttestation.DelayMS,
+		})
+	}
+
+	setNextCursor(w, filter.Limit, len(aggregateAttestations), func() *probedb.Position {
+		return probedb.AggregateAttestationPosition(aggregateAttestations[len(aggregateAttestations)-1])
+	})
+	writeJSON(w, res)
+	requestHandled("aggregate attestations", "succeeded")
+}
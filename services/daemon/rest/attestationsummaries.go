@@ -0,0 +1,135 @@
+// Copyright © 2023 Weald Technology Trading.
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package rest
+
+import (
+	"fmt"
+	"net/http"
+
+	"github.com/attestantio/go-eth2-client/spec/phase0"
+	bitfield "github.com/prysmaticlabs/go-bitfield"
+	"github.com/wealdtech/probed/services/daemon/rest/types"
+	"github.com/wealdtech/probed/services/probedb"
+)
+
+func (s *Service) getAttestationSummaries(w http.ResponseWriter, r *http.Request) {
+	filter, err := parseAttestationSummaryFilter(r.URL.Query())
+	if err != nil {
+		log.Debug().Err(err).Msg("Supplied with invalid filter")
+		w.WriteHeader(http.StatusBadRequest)
+		requestHandled("attestation summaries", "failed")
+		return
+	}
+
+	summaries, err := s.attestationSummariesProvider.AttestationSummaries(r.Context(), filter)
+	if err != nil {
+		log.Warn().Err(err).Msg("Failed to obtain attestation summaries")
+		w.WriteHeader(http.StatusInternalServerError)
+		requestHandled("attestation summaries", "failed")
+		return
+	}
+
+	if filter.Limit > 0 && len(summaries) == int(filter.Limit) {
+		// The page ends part way through the rows of its final summary, so fetch
+		// the remaining rows to avoid splitting the summary across pages.
+		remaining, err := s.attestationSummariesProvider.AttestationSummaries(r.Context(), remainingSummaryFilter(filter, summaries[len(summaries)-1]))
+		if err != nil {
+			log.Warn().Err(err).Msg("Failed to obtain remaining attestation summaries")
+			w.WriteHeader(http.StatusInternalServerError)
+			requestHandled("attestation summaries", "failed")
+			return
+		}
+		summaries = append(summaries, remaining...)
+	}
+
+	setNextCursor(w, filter.Limit, len(summaries), func() *probedb.Position {
+		return probedb.AttestationSummaryPosition(summaries[len(summaries)-1])
+	})
+	writeJSON(w, attestationSummariesToAPI(summaries))
+	requestHandled("attestation summaries", "succeeded")
+}
+
+// remainingSummaryFilter returns a filter for the rows after the given row
+// with the same slot and method, which together make up a single API summary.
+func remainingSummaryFilter(filter *probedb.AttestationSummaryFilter,
+	last *probedb.AttestationSummary,
+) *probedb.AttestationSummaryFilter {
+	slot := phase0.Slot(last.Slot)
+
+	return &probedb.AttestationSummaryFilter{
+		IPAddr:  filter.IPAddr,
+		Prober:  filter.Prober,
+		Sources: filter.Sources,
+		Methods: []string{last.Method},
+		From:    &slot,
+		To:      &slot,
+		Order:   filter.Order,
+		Cursor:  probedb.AttestationSummaryPosition(last).Cursor(),
+	}
+}
+
+// attestationSummariesToAPI converts the per-source database summaries
+// in to the per-slot summaries used by the API.
+// The order of the database summaries is retained.
+func attestationSummariesToAPI(summaries []*probedb.AttestationSummary) []*types.AttestationSummary {
+	res := make([]*types.AttestationSummary, 0)
+	apiSummaries := make(map[string]*types.AttestationSummary)
+	apiAttestations := make(map[string]*types.Attestation)
+	for _, summary := range summaries {
+		summaryKey := fmt.Sprintf("%d:%s", summary.Slot, summary.Method)
+		apiSummary, exists := apiSummaries[summaryKey]
+		if !exists {
+			apiSummary = &types.AttestationSummary{
+				Method:       summary.Method,
+				Slot:         summary.Slot,
+				Attestations: make([]*types.Attestation, 0),
+			}
+			apiSummaries[summaryKey] = apiSummary
+			res = append(res, apiSummary)
+		}
+
+		attestationKey := fmt.Sprintf("%s:%d:%#x:%#x:%#x",
+			summaryKey,
+			summary.CommitteeIndex,
+			summary.BeaconBlockRoot,
+			summary.SourceRoot,
+			summary.TargetRoot,
+		)
+		apiAttestation, exists := apiAttestations[attestationKey]
+		if !exists {
+			apiAttestation = &types.Attestation{
+				CommitteeIndex:  summary.CommitteeIndex,
+				BeaconBlockRoot: summary.BeaconBlockRoot,
+				SourceRoot:      summary.SourceRoot,
+				TargetRoot:      summary.TargetRoot,
+				Buckets:         make(map[string]*[120]bitfield.Bitlist),
+			}
+			apiAttestations[attestationKey] = apiAttestation
+			apiSummary.Attestations = append(apiSummary.Attestations, apiAttestation)
+		}
+
+		// Summaries with more buckets than the API supports are rejected when
+		// written, so this only drops buckets from data written by other means.
+		buckets := &[120]bitfield.Bitlist{}
+		for i, bucket := range summary.AttesterBuckets {
+			if i >= len(buckets) {
+				break
+			}
+			buckets[i] = bucket
+		}
+		apiAttestation.Buckets[summary.Source] = buckets
+	}
+
+	return res
+}
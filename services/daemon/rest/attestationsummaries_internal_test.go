@@ -0,0 +1,95 @@
+// Copyright © 2023 Weald Technology Trading.
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package rest
+
+import (
+	"context"
+	"encoding/json"
+	"net"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+
+	"github.com/rs/zerolog"
+	"github.com/stretchr/testify/require"
+	"github.com/wealdtech/probed/services/daemon/rest/types"
+	nullmetrics "github.com/wealdtech/probed/services/metrics/null"
+	"github.com/wealdtech/probed/services/probedb"
+	memoryprobedb "github.com/wealdtech/probed/services/probedb/memory"
+)
+
+func TestGetAttestationSummariesPages(t *testing.T) {
+	ctx := context.Background()
+	probeDB, err := memoryprobedb.New(ctx, memoryprobedb.WithLogLevel(zerolog.Disabled))
+	require.NoError(t, err)
+
+	service, err := New(ctx,
+		WithLogLevel(zerolog.Disabled),
+		WithMonitor(nullmetrics.New()),
+		WithServerName("server.wealdtech.com"),
+		WithListenAddress(":14734"),
+		WithBlockDelaysSetter(probeDB),
+		WithHeadDelaysSetter(probeDB),
+		WithAggregateAttestationsSetter(probeDB),
+		WithAttestationSummariesSetter(probeDB),
+		WithAttestationSummariesProvider(probeDB),
+	)
+	require.NoError(t, err)
+
+	// Slot 1 has a summary from three sources, slot 2 from one.
+	for _, row := range []struct {
+		slot   uint32
+		source string
+	}{
+		{slot: 1, source: "a"},
+		{slot: 1, source: "b"},
+		{slot: 1, source: "c"},
+		{slot: 2, source: "a"},
+	} {
+		_, err := probeDB.SetAttestationSummary(ctx, &probedb.AttestationSummary{
+			IPAddr:          net.ParseIP("1.2.3.4"),
+			Source:          row.source,
+			Method:          "attestation event",
+			Slot:            row.slot,
+			BeaconBlockRoot: []byte{0x01},
+			SourceRoot:      []byte{0x02},
+			TargetRoot:      []byte{0x03},
+			AttesterBuckets: [][]byte{{0x01}},
+		})
+		require.NoError(t, err)
+	}
+
+	// The first page is extended to complete the summary for slot 1.
+	writer := httptest.NewRecorder()
+	service.getAttestationSummaries(writer, httptest.NewRequest(http.MethodGet, "/v1/attestationsummaries?limit=2", nil))
+	require.Equal(t, http.StatusOK, writer.Result().StatusCode)
+	var summaries []*types.AttestationSummary
+	require.NoError(t, json.Unmarshal(writer.Body.Bytes(), &summaries))
+	require.Len(t, summaries, 1)
+	require.Equal(t, uint32(1), summaries[0].Slot)
+	require.Len(t, summaries[0].Attestations, 1)
+	require.Len(t, summaries[0].Attestations[0].Buckets, 3)
+	cursor := writer.Result().Header.Get(nextCursorHeader)
+	require.NotEmpty(t, cursor)
+
+	// The second page starts with the summary for slot 2.
+	writer = httptest.NewRecorder()
+	service.getAttestationSummaries(writer, httptest.NewRequest(http.MethodGet, "/v1/attestationsummaries?limit=2&cursor="+cursor, nil))
+	require.Equal(t, http.StatusOK, writer.Result().StatusCode)
+	summaries = nil
+	require.NoError(t, json.Unmarshal(writer.Body.Bytes(), &summaries))
+	require.Len(t, summaries, 1)
+	require.Equal(t, uint32(2), summaries[0].Slot)
+	require.Empty(t, writer.Result().Header.Get(nextCursorHeader))
+}
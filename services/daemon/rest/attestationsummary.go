@@ -30,7 +30,7 @@ func (s *Service) postAttestationSummary(w http.ResponseWriter, r *http.Request)
 		return
 	}
 
-	sourceIP, err := sourceIP(r)
+	sourceIP, err := s.sourceIP(r)
 	if err != nil {
 		log.Debug().Err(err).Msg("Failed to obtain source IP")
 		w.WriteHeader(http.StatusInternalServerError)
@@ -38,6 +38,8 @@ func (s *Service) postAttestationSummary(w http.ResponseWriter, r *http.Request)
 	}
 
 	// Need to store attestations on a pre-source basis.
+	// The response reflects the record with the most significant action.
+	action := probedb.ActionIgnored
 	for _, attestation := range summary.Attestations {
 		for source, buckets := range attestation.Buckets {
 			dbBuckets := make([][]byte, 0, len(buckets))
@@ -45,8 +47,9 @@ func (s *Service) postAttestationSummary(w http.ResponseWriter, r *http.Request)
 				dbBuckets = append(dbBuckets, bucket)
 			}
 
-			if err := s.attestationSummariesSetter.SetAttestationSummary(context.Background(), &probedb.AttestationSummary{
+			recordAction, err := s.attestationSummariesSetter.SetAttestationSummary(context.Background(), &probedb.AttestationSummary{
 				IPAddr:          sourceIP,
+				Prober:          proberFromRequest(r),
 				Source:          source,
 				Method:          summary.Method,
 				Slot:            summary.Slot,
@@ -55,13 +58,20 @@ func (s *Service) postAttestationSummary(w http.ResponseWriter, r *http.Request)
 				SourceRoot:      attestation.SourceRoot,
 				TargetRoot:      attestation.TargetRoot,
 				AttesterBuckets: dbBuckets,
-			}); err != nil {
+			})
+			if err != nil {
 				log.Warn().Err(err).Msg("Failed to set attestation summary")
-				w.WriteHeader(http.StatusInternalServerError)
+				writeStorageError(w, err)
 				return
 			}
+			switch {
+			case recordAction == probedb.ActionCreated, action == probedb.ActionIgnored:
+				action = recordAction
+			case recordAction == probedb.ActionQueued && action != probedb.ActionCreated:
+				action = recordAction
+			}
 		}
 	}
 
-	w.WriteHeader(http.StatusCreated)
+	w.WriteHeader(actionStatusCode(action))
 }
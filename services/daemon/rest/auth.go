@@ -0,0 +1,115 @@
+// Copyright © 2023 Weald Technology Trading.
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package rest
+
+import (
+	"context"
+	"crypto/subtle"
+	"net/http"
+	"strings"
+)
+
+type proberContextKey struct{}
+
+// apiKey is an API key and the prober to which it belongs.
+type apiKey struct {
+	key    []byte
+	prober string
+}
+
+// authenticate is middleware that requires a valid API key if any are configured,
+// and adds the identity of the authenticated prober to the request context.
+// A verified client certificate takes precedence over an API key.
+func (s *Service) authenticate(next http.Handler) http.Handler {
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if prober := clientCertProber(r); prober != "" {
+			log.Trace().Str("prober", prober).Msg("Authenticated with client certificate")
+			next.ServeHTTP(w, r.WithContext(context.WithValue(r.Context(), proberContextKey{}, prober)))
+			return
+		}
+
+		if len(s.apiKeys) == 0 {
+			// Authentication is not enabled.
+			next.ServeHTTP(w, r)
+			return
+		}
+
+		prober, authenticated := s.prober(r.Header.Get("Authorization"))
+		if !authenticated {
+			log.Debug().Str("path", r.URL.Path).Msg("Request not authenticated")
+			w.Header().Set("WWW-Authenticate", "Bearer")
+			w.WriteHeader(http.StatusUnauthorized)
+			requestHandled("authentication", "failed")
+			return
+		}
+
+		next.ServeHTTP(w, r.WithContext(context.WithValue(r.Context(), proberContextKey{}, prober)))
+	})
+}
+
+// prober returns the prober for the bearer token in the supplied authorization header.
+func (s *Service) prober(authorization string) (string, bool) {
+	scheme, token, found := strings.Cut(authorization, " ")
+	if !found || !strings.EqualFold(scheme, "Bearer") {
+		return "", false
+	}
+	token = strings.TrimSpace(token)
+	if token == "" {
+		return "", false
+	}
+
+	// Check all keys, to avoid leaking information through timing.
+	prober := ""
+	authenticated := false
+	for _, apiKey := range s.apiKeys {
+		if subtle.ConstantTimeCompare(apiKey.key, []byte(token)) == 1 {
+			prober = apiKey.prober
+			authenticated = true
+		}
+	}
+
+	return prober, authenticated
+}
+
+// clientCertProber returns the prober identity from the verified client certificate of the request.
+// The first DNS, URI or email subject alternative name is used, falling back to the subject common name.
+// It returns an empty string if there is no verified client certificate.
+func clientCertProber(r *http.Request) string {
+	if r.TLS == nil || len(r.TLS.VerifiedChains) == 0 || len(r.TLS.VerifiedChains[0]) == 0 {
+		return ""
+	}
+	cert := r.TLS.VerifiedChains[0][0]
+
+	switch {
+	case len(cert.DNSNames) > 0:
+		return cert.DNSNames[0]
+	case len(cert.URIs) > 0:
+		return cert.URIs[0].String()
+	case len(cert.EmailAddresses) > 0:
+		return cert.EmailAddresses[0]
+	default:
+		return cert.Subject.CommonName
+	}
+}
+
+// proberFromRequest returns the authenticated prober for the request.
+// It returns an empty string if the request was not authenticated.
+func proberFromRequest(r *http.Request) string {
+	prober, ok := r.Context().Value(proberContextKey{}).(string)
+	if !ok {
+		return ""
+	}
+
+	return prober
+}
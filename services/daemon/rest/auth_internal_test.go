@@ -0,0 +1,169 @@
+// Copyright © 2023 Weald Technology Trading.
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package rest
+
+import (
+	"context"
+	"crypto/tls"
+	"crypto/x509"
+	"crypto/x509/pkix"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+
+	"github.com/rs/zerolog"
+	"github.com/stretchr/testify/require"
+	nullmetrics "github.com/wealdtech/probed/services/metrics/null"
+	mockprobedb "github.com/wealdtech/probed/services/probedb/mock"
+)
+
+func TestAuthenticate(t *testing.T) {
+	ctx := context.Background()
+	probeDB := mockprobedb.New()
+	monitor := nullmetrics.New()
+
+	service, err := New(ctx,
+		WithLogLevel(zerolog.Disabled),
+		WithMonitor(monitor),
+		WithServerName("server.wealdtech.com"),
+		WithListenAddress(":14734"),
+		WithBlockDelaysSetter(probeDB),
+		WithHeadDelaysSetter(probeDB),
+		WithAggregateAttestationsSetter(probeDB),
+		WithAttestationSummariesSetter(probeDB),
+		WithAPIKeys(map[string]string{
+			"key1": "prober1",
+			"key2": "prober2",
+		}),
+	)
+	require.NoError(t, err)
+
+	unauthenticatedService, err := New(ctx,
+		WithLogLevel(zerolog.Disabled),
+		WithMonitor(monitor),
+		WithServerName("server.wealdtech.com"),
+		WithListenAddress(":14735"),
+		WithBlockDelaysSetter(probeDB),
+		WithHeadDelaysSetter(probeDB),
+		WithAggregateAttestationsSetter(probeDB),
+		WithAttestationSummariesSetter(probeDB),
+	)
+	require.NoError(t, err)
+
+	tests := []struct {
+		name          string
+		service       *Service
+		authorization string
+		clientCert    *x509.Certificate
+		statusCode    int
+		prober        string
+	}{
+		{
+			name:       "NotRequired",
+			service:    unauthenticatedService,
+			statusCode: http.StatusOK,
+		},
+		{
+			name:          "NotRequiredSupplied",
+			service:       unauthenticatedService,
+			authorization: "Bearer key1",
+			statusCode:    http.StatusOK,
+		},
+		{
+			name:       "Missing",
+			service:    service,
+			statusCode: http.StatusUnauthorized,
+		},
+		{
+			name:          "SchemeInvalid",
+			service:       service,
+			authorization: "Basic key1",
+			statusCode:    http.StatusUnauthorized,
+		},
+		{
+			name:          "TokenMissing",
+			service:       service,
+			authorization: "Bearer ",
+			statusCode:    http.StatusUnauthorized,
+		},
+		{
+			name:          "TokenUnknown",
+			service:       service,
+			authorization: "Bearer key3",
+			statusCode:    http.StatusUnauthorized,
+		},
+		{
+			name:          "Good",
+			service:       service,
+			authorization: "Bearer key1",
+			statusCode:    http.StatusOK,
+			prober:        "prober1",
+		},
+		{
+			name:          "GoodSchemeCase",
+			service:       service,
+			authorization: "bearer key2",
+			statusCode:    http.StatusOK,
+			prober:        "prober2",
+		},
+		{
+			name:       "ClientCertDNSName",
+			service:    service,
+			clientCert: &x509.Certificate{Subject: pkix.Name{CommonName: "cn"}, DNSNames: []string{"prober3.example.com"}},
+			statusCode: http.StatusOK,
+			prober:     "prober3.example.com",
+		},
+		{
+			name:       "ClientCertCommonName",
+			service:    unauthenticatedService,
+			clientCert: &x509.Certificate{Subject: pkix.Name{CommonName: "prober4"}},
+			statusCode: http.StatusOK,
+			prober:     "prober4",
+		},
+		{
+			name:          "ClientCertPrecedence",
+			service:       service,
+			authorization: "Bearer key1",
+			clientCert:    &x509.Certificate{EmailAddresses: []string{"prober5@example.com"}},
+			statusCode:    http.StatusOK,
+			prober:        "prober5@example.com",
+		},
+	}
+
+	for _, test := range tests {
+		t.Run(test.name, func(t *testing.T) {
+			prober := ""
+			handler := test.service.authenticate(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+				prober = proberFromRequest(r)
+				w.WriteHeader(http.StatusOK)
+			}))
+			request := httptest.NewRequest(http.MethodPost, "/v1/blockdelay", nil)
+			if test.authorization != "" {
+				request.Header.Set("Authorization", test.authorization)
+			}
+			if test.clientCert != nil {
+				request.TLS = &tls.ConnectionState{
+					VerifiedChains: [][]*x509.Certificate{{test.clientCert}},
+				}
+			}
+			writer := httptest.NewRecorder()
+			handler.ServeHTTP(writer, request)
+			require.Equal(t, test.statusCode, writer.Result().StatusCode)
+			require.Equal(t, test.prober, prober)
+			if test.statusCode == http.StatusUnauthorized {
+				require.Equal(t, "Bearer", writer.Result().Header.Get("WWW-Authenticate"))
+			}
+		})
+	}
+}
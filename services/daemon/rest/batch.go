@@ -0,0 +1,240 @@
+// Copyright © 2023 Weald Technology Trading.
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package rest
+
+import (
+	"context"
+	"encoding/json"
+	"net"
+	"net/http"
+
+	"github.com/pkg/errors"
+	"github.com/wealdtech/probed/services/daemon/rest/types"
+	"github.com/wealdtech/probed/services/probedb"
+)
+
+// maxBatchItems is the maximum number of items accepted in a single batch.
+const maxBatchItems = 1024
+
+// batchWriter writes a validated batch item to the database.
+type batchWriter func(ctx context.Context) (probedb.Action, error)
+
+func (s *Service) postBatch(w http.ResponseWriter, r *http.Request) {
+	// Items are decoded individually, so that a malformed item is rejected
+	// without failing the batch.
+	var items []json.RawMessage
+	if err := json.NewDecoder(r.Body).Decode(&items); err != nil {
+		log.Debug().Err(err).Msg("Supplied with invalid data")
+		w.WriteHeader(http.StatusBadRequest)
+		requestHandled("batch", "failed")
+		return
+	}
+	if len(items) > maxBatchItems {
+		log.Debug().Int("items", len(items)).Msg("Batch too large")
+		w.WriteHeader(http.StatusRequestEntityTooLarge)
+		requestHandled("batch", "failed")
+		return
+	}
+
+	sourceIP, err := s.sourceIP(r)
+	if err != nil {
+		log.Debug().Err(err).Msg("Failed to obtain source IP")
+		w.WriteHeader(http.StatusInternalServerError)
+		requestHandled("batch", "failed")
+		return
+	}
+
+	prober := proberFromRequest(r)
+
+	// Validate all items before touching the database, so that
+	// individual bad items can be rejected without failing the batch.
+	results := make([]*types.BatchResult, len(items))
+	writers := make([]batchWriter, len(items))
+	for i, item := range items {
+		results[i] = &types.BatchResult{Index: i}
+		writers[i], err = s.batchItemWriter(sourceIP, prober, item)
+		if err != nil {
+			results[i].Result = types.BatchResultRejected
+			results[i].Reason = err.Error()
+		}
+	}
+
+	// All items are written in a single transaction, so the batch setter
+	// must write within the transaction rather than queueing.
+	ctx, cancel, err := s.batchSetter.BeginTx(context.Background())
+	if err != nil {
+		log.Warn().Err(err).Msg("Failed to begin transaction")
+		writeStorageError(w, err)
+		requestHandled("batch", "failed")
+		return
+	}
+	defer cancel()
+
+	for i, writer := range writers {
+		if writer == nil {
+			continue
+		}
+		action, err := writer(ctx)
+		if err != nil {
+			log.Warn().Err(err).Int("index", i).Msg("Failed to set batch item")
+			writeStorageError(w, err)
+			requestHandled("batch", "failed")
+			return
+		}
+		switch action {
+		case probedb.ActionIgnored:
+			results[i].Result = types.BatchResultDuplicate
+		case probedb.ActionUpdated:
+			results[i].Result = types.BatchResultUpdated
+		case probedb.ActionQueued:
+			results[i].Result = types.BatchResultQueued
+		default:
+			results[i].Result = types.BatchResultAccepted
+		}
+	}
+
+	if err := s.batchSetter.CommitTx(ctx); err != nil {
+		log.Warn().Err(err).Msg("Failed to commit transaction")
+		writeStorageError(w, err)
+		requestHandled("batch", "failed")
+		return
+	}
+
+	log.Trace().Str("ip_addr", sourceIP.String()).Int("items", len(items)).Msg("Batch processed")
+	writeJSON(w, results)
+	requestHandled("batch", "succeeded")
+}
+
+// batchItemWriter decodes and validates a batch item, returning a function
+// that will write it to the database.
+func (s *Service) batchItemWriter(sourceIP net.IP, prober string, input json.RawMessage) (batchWriter, error) {
+	var item *types.BatchItem
+	if err := json.Unmarshal(input, &item); err != nil {
+		return nil, err
+	}
+	if item == nil {
+		return nil, errors.New("item missing")
+	}
+
+	switch item.Type {
+	case types.BatchItemBlockDelay:
+		var delay types.Delay
+		if err := json.Unmarshal(item.Data, &delay); err != nil {
+			return nil, err
+		}
+		if delay.DelayMS > 24000 {
+			return nil, errors.New("delay too long")
+		}
+		return func(ctx context.Context) (probedb.Action, error) {
+			return s.batchSetter.SetBlockDelay(ctx, &probedb.Delay{
+				IPAddr:  sourceIP,
+				Prober:  prober,
+				Source:  delay.Source,
+				Method:  delay.Method,
+				Slot:    delay.Slot,
+				DelayMS: delay.DelayMS,
+			})
+		}, nil
+	case types.BatchItemHeadDelay:
+		var delay types.Delay
+		if err := json.Unmarshal(item.Data, &delay); err != nil {
+			return nil, err
+		}
+		if delay.DelayMS > 24000 {
+			return nil, errors.New("delay too long")
+		}
+		return func(ctx context.Context) (probedb.Action, error) {
+			return s.batchSetter.SetHeadDelay(ctx, &probedb.Delay{
+				IPAddr:  sourceIP,
+				Prober:  prober,
+				Source:  delay.Source,
+				Method:  delay.Method,
+				Slot:    delay.Slot,
+				DelayMS: delay.DelayMS,
+			})
+		}, nil
+	case types.BatchItemAggregateAttestation:
+		var aggregateAttestation types.AggregateAttestation
+		if err := json.Unmarshal(item.Data, &aggregateAttestation); err != nil {
+			return nil, err
+		}
+		return func(ctx context.Context) (probedb.Action, error) {
+			return s.batchSetter.SetAggregateAttestation(ctx, &probedb.AggregateAttestation{
+				IPAddr:          sourceIP,
+				Prober:          prober,
+				Source:          aggregateAttestation.Source,
+				Method:          aggregateAttestation.Method,
+				Slot:            aggregateAttestation.Slot,
+				CommitteeIndex:  aggregateAttestation.CommitteeIndex,
+				AggregationBits: aggregateAttestation.AggregationBits,
+				BeaconBlockRoot: aggregateAttestation.BeaconBlockRoot,
+				SourceRoot:      aggregateAttestation.SourceRoot,
+				TargetRoot:      aggregateAttestation.TargetRoot,
+				DelayMS:         aggregateAttestation.DelayMS,
+			})
+		}, nil
+	case types.BatchItemAttestationSummary:
+		var summary types.AttestationSummary
+		if err := json.Unmarshal(item.Data, &summary); err != nil {
+			return nil, err
+		}
+		return func(ctx context.Context) (probedb.Action, error) {
+			// A summary is stored as multiple records; it is a duplicate only if all of them are,
+			// and an update only if none of them were created.
+			res := probedb.ActionCreated
+			ignored := 0
+			updated := 0
+			total := 0
+			for _, attestation := range summary.Attestations {
+				for source, buckets := range attestation.Buckets {
+					dbBuckets := make([][]byte, 0, len(buckets))
+					for _, bucket := range buckets {
+						dbBuckets = append(dbBuckets, bucket)
+					}
+					action, err := s.batchSetter.SetAttestationSummary(ctx, &probedb.AttestationSummary{
+						IPAddr:          sourceIP,
+						Prober:          prober,
+						Source:          source,
+						Method:          summary.Method,
+						Slot:            summary.Slot,
+						CommitteeIndex:  attestation.CommitteeIndex,
+						BeaconBlockRoot: attestation.BeaconBlockRoot,
+						SourceRoot:      attestation.SourceRoot,
+						TargetRoot:      attestation.TargetRoot,
+						AttesterBuckets: dbBuckets,
+					})
+					if err != nil {
+						return probedb.ActionCreated, err
+					}
+					total++
+					switch action {
+					case probedb.ActionIgnored:
+						ignored++
+					case probedb.ActionUpdated:
+						updated++
+					}
+				}
+			}
+			switch {
+			case total > 0 && ignored == total:
+				res = probedb.ActionIgnored
+			case updated > 0 && ignored+updated == total:
+				res = probedb.ActionUpdated
+			}
+			return res, nil
+		}, nil
+	default:
+		return nil, errors.Errorf("unknown type %q", item.Type)
+	}
+}
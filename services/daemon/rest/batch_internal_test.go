@@ -0,0 +1,221 @@
+// Copyright © 2023 Weald Technology Trading.
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package rest
+
+import (
+	"context"
+	"io"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+
+	"github.com/rs/zerolog"
+	"github.com/stretchr/testify/require"
+	nullmetrics "github.com/wealdtech/probed/services/metrics/null"
+	"github.com/wealdtech/probed/services/probedb"
+	memoryprobedb "github.com/wealdtech/probed/services/probedb/memory"
+	mockprobedb "github.com/wealdtech/probed/services/probedb/mock"
+)
+
+func TestPostBatch(t *testing.T) {
+	ctx := context.Background()
+	probeDB := mockprobedb.New()
+	monitor := nullmetrics.New()
+
+	service, err := New(ctx,
+		WithLogLevel(zerolog.Disabled),
+		WithMonitor(monitor),
+		WithServerName("server.wealdtech.com"),
+		WithListenAddress(":14734"),
+		WithBlockDelaysSetter(probeDB),
+		WithHeadDelaysSetter(probeDB),
+		WithAggregateAttestationsSetter(probeDB),
+		WithAttestationSummariesSetter(probeDB),
+	)
+	require.NoError(t, err)
+
+	erroringProbeDB := mockprobedb.NewErroring()
+	erroringService, err := New(ctx,
+		WithLogLevel(zerolog.Disabled),
+		WithMonitor(monitor),
+		WithServerName("server.wealdtech.com"),
+		WithListenAddress(":14735"),
+		WithBlockDelaysSetter(erroringProbeDB),
+		WithHeadDelaysSetter(erroringProbeDB),
+		WithAggregateAttestationsSetter(erroringProbeDB),
+		WithAttestationSummariesSetter(erroringProbeDB),
+	)
+	require.NoError(t, err)
+
+	tests := []struct {
+		name       string
+		service    *Service
+		request    *http.Request
+		writer     *httptest.ResponseRecorder
+		statusCode int
+		body       string
+	}{
+		{
+			name:    "BodyEmpty",
+			service: service,
+			request: &http.Request{
+				Body: io.NopCloser(strings.NewReader(``)),
+			},
+			writer:     httptest.NewRecorder(),
+			statusCode: http.StatusBadRequest,
+		},
+		{
+			name:    "BodyInvalid",
+			service: service,
+			request: &http.Request{
+				Body: io.NopCloser(strings.NewReader(`{}`)),
+			},
+			writer:     httptest.NewRecorder(),
+			statusCode: http.StatusBadRequest,
+		},
+		{
+			name:    "Empty",
+			service: service,
+			request: &http.Request{
+				Body: io.NopCloser(strings.NewReader(`[]`)),
+			},
+			writer:     httptest.NewRecorder(),
+			statusCode: http.StatusOK,
+			body:       "[]\n",
+		},
+		{
+			name:    "Mixed",
+			service: service,
+			request: &http.Request{
+				Body: io.NopCloser(strings.NewReader(`[{"type":"block_delay","data":{"source":"client","method":"block event","slot":"123","delay_ms":"12345"}},{"type":"head_delay","data":{"source":"client","method":"head event","slot":"123","delay_ms":"99999"}},{"type":"unknown","data":{}},{"type":"head_delay","data":{"source":"client","slot":"123","delay_ms":"1"}},{"type":"aggregate_attestation","data":{"source":"client","method":"aggregate","slot":"123","committee_index":"1","aggregation_bits":"0x01","beacon_block_root":"0x01","source_root":"0x02","target_root":"0x03","delay_ms":"100"}}]`)),
+			},
+			writer:     httptest.NewRecorder(),
+			statusCode: http.StatusOK,
+			body:       `[{"index":"0","result":"accepted"},{"index":"1","result":"rejected","reason":"delay too long"},{"index":"2","result":"rejected","reason":"unknown type \"unknown\""},{"index":"3","result":"rejected","reason":"method missing"},{"index":"4","result":"accepted"}]` + "\n",
+		},
+		{
+			name:    "Malformed",
+			service: service,
+			request: &http.Request{
+				Body: io.NopCloser(strings.NewReader(`[{"type":"block_delay","data":{"source":"client","method":"block event","slot":"124","delay_ms":"12345"}},{"data":{"source":"client"}},{"type":"block_delay"},null,"item",{"type":"head_delay","data":{"source":"client","method":"head event","slot":"124","delay_ms":"100"}}]`)),
+			},
+			writer:     httptest.NewRecorder(),
+			statusCode: http.StatusOK,
+			body:       `[{"index":"0","result":"accepted"},{"index":"1","result":"rejected","reason":"type missing"},{"index":"2","result":"rejected","reason":"data missing"},{"index":"3","result":"rejected","reason":"item missing"},{"index":"4","result":"rejected","reason":"json: cannot unmarshal string into Go value of type types.batchItemJSON"},{"index":"5","result":"accepted"}]` + "\n",
+		},
+		{
+			name:    "Erroring",
+			service: erroringService,
+			request: &http.Request{
+				Body: io.NopCloser(strings.NewReader(`[{"type":"block_delay","data":{"source":"client","method":"block event","slot":"123","delay_ms":"12345"}}]`)),
+			},
+			writer:     httptest.NewRecorder(),
+			statusCode: http.StatusInternalServerError,
+		},
+	}
+
+	for _, test := range tests {
+		t.Run(test.name, func(t *testing.T) {
+			test.service.postBatch(test.writer, test.request)
+			require.Equal(t, test.statusCode, test.writer.Result().StatusCode)
+			if test.body != "" {
+				require.Equal(t, test.body, test.writer.Body.String())
+			}
+		})
+	}
+}
+
+func TestPostBatchRecorded(t *testing.T) {
+	ctx := context.Background()
+	probeDB, err := memoryprobedb.New(ctx, memoryprobedb.WithLogLevel(zerolog.Disabled))
+	require.NoError(t, err)
+
+	service, err := New(ctx,
+		WithLogLevel(zerolog.Disabled),
+		WithMonitor(nullmetrics.New()),
+		WithServerName("server.wealdtech.com"),
+		WithListenAddress(":14734"),
+		WithBlockDelaysSetter(probeDB),
+		WithHeadDelaysSetter(probeDB),
+		WithAggregateAttestationsSetter(probeDB),
+		WithAttestationSummariesSetter(probeDB),
+		WithBlockDelaysProvider(probeDB),
+	)
+	require.NoError(t, err)
+
+	// Second block delay for the same slot is a duplicate.
+	writer := httptest.NewRecorder()
+	service.postBatch(writer, httptest.NewRequest(http.MethodPost, "/v1/batch", strings.NewReader(`[{"type":"block_delay","data":{"source":"client","method":"block event","slot":"123","delay_ms":"1234"}},{"type":"block_delay","data":{"source":"client","method":"block event","slot":"123","delay_ms":"2345"}}]`)))
+	require.Equal(t, http.StatusOK, writer.Result().StatusCode)
+	require.Equal(t, `[{"index":"0","result":"accepted"},{"index":"1","result":"duplicate"}]`+"\n", writer.Body.String())
+
+	// Only the first block delay is recorded.
+	writer = httptest.NewRecorder()
+	service.getBlockDelays(writer, httptest.NewRequest(http.MethodGet, "/v1/blockdelays?selection=all", nil))
+	require.Equal(t, http.StatusOK, writer.Result().StatusCode)
+	require.Contains(t, writer.Body.String(), `"delay_ms":"1234"`)
+	require.NotContains(t, writer.Body.String(), `"delay_ms":"2345"`)
+}
+
+// queueingProbeDB queues block delays rather than writing them.
+type queueingProbeDB struct {
+	*memoryprobedb.Service
+}
+
+func (q *queueingProbeDB) SetBlockDelay(_ context.Context, _ *probedb.Delay) (probedb.Action, error) {
+	return probedb.ActionQueued, nil
+}
+
+func TestPostBatchSetter(t *testing.T) {
+	ctx := context.Background()
+	probeDB, err := memoryprobedb.New(ctx, memoryprobedb.WithLogLevel(zerolog.Disabled))
+	require.NoError(t, err)
+	queueingDB := &queueingProbeDB{Service: probeDB}
+
+	// Batches are written with the batch setter rather than the individual setters.
+	service, err := New(ctx,
+		WithLogLevel(zerolog.Disabled),
+		WithMonitor(nullmetrics.New()),
+		WithServerName("server.wealdtech.com"),
+		WithListenAddress(":14734"),
+		WithBlockDelaysSetter(queueingDB),
+		WithHeadDelaysSetter(queueingDB),
+		WithAggregateAttestationsSetter(queueingDB),
+		WithAttestationSummariesSetter(queueingDB),
+		WithBatchSetter(probeDB),
+	)
+	require.NoError(t, err)
+	writer := httptest.NewRecorder()
+	service.postBatch(writer, httptest.NewRequest(http.MethodPost, "/v1/batch", strings.NewReader(`[{"type":"block_delay","data":{"source":"client","method":"block event","slot":"123","delay_ms":"1234"}}]`)))
+	require.Equal(t, http.StatusOK, writer.Result().StatusCode)
+	require.Equal(t, `[{"index":"0","result":"accepted"}]`+"\n", writer.Body.String())
+
+	// Queued items are reported as such.
+	service, err = New(ctx,
+		WithLogLevel(zerolog.Disabled),
+		WithMonitor(nullmetrics.New()),
+		WithServerName("server.wealdtech.com"),
+		WithListenAddress(":14734"),
+		WithBlockDelaysSetter(queueingDB),
+		WithHeadDelaysSetter(queueingDB),
+		WithAggregateAttestationsSetter(queueingDB),
+		WithAttestationSummariesSetter(queueingDB),
+	)
+	require.NoError(t, err)
+	writer = httptest.NewRecorder()
+	service.postBatch(writer, httptest.NewRequest(http.MethodPost, "/v1/batch", strings.NewReader(`[{"type":"block_delay","data":{"source":"client","method":"block event","slot":"123","delay_ms":"1234"}}]`)))
+	require.Equal(t, http.StatusOK, writer.Result().StatusCode)
+	require.Equal(t, `[{"index":"0","result":"queued"}]`+"\n", writer.Body.String())
+}
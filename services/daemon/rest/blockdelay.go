@@ -39,7 +39,7 @@ func (s *Service) postBlockDelay(w http.ResponseWriter, r *http.Request) {
 		return
 	}
 
-	sourceIP, err := sourceIP(r)
+	sourceIP, err := s.sourceIP(r)
 	if err != nil {
 		log.Debug().Err(err).Msg("Failed to obtain source IP")
 		w.WriteHeader(http.StatusInternalServerError)
@@ -47,15 +47,17 @@ func (s *Service) postBlockDelay(w http.ResponseWriter, r *http.Request) {
 		return
 	}
 
-	if err := s.blockDelaysSetter.SetBlockDelay(context.Background(), &probedb.Delay{
+	action, err := s.blockDelaysSetter.SetBlockDelay(context.Background(), &probedb.Delay{
 		IPAddr:  sourceIP,
+		Prober:  proberFromRequest(r),
 		Source:  blockDelay.Source,
 		Method:  blockDelay.Method,
 		Slot:    blockDelay.Slot,
 		DelayMS: blockDelay.DelayMS,
-	}); err != nil {
+	})
+	if err != nil {
 		log.Warn().Err(err).Msg("Failed to set block delay")
-		w.WriteHeader(http.StatusInternalServerError)
+		writeStorageError(w, err)
 		requestHandled("block delay", "failed")
 		return
 	}
@@ -66,7 +68,8 @@ func (s *Service) postBlockDelay(w http.ResponseWriter, r *http.Request) {
 		Str("method", blockDelay.Method).
 		Uint32("slot", blockDelay.Slot).
 		Uint32("delay_ms", blockDelay.DelayMS).
+		Stringer("action", action).
 		Msg("Metric accepted")
-	w.WriteHeader(http.StatusCreated)
+	w.WriteHeader(actionStatusCode(action))
 	requestHandled("block delay", "succeeded")
 }
@@ -24,6 +24,7 @@ import (
 	"github.com/rs/zerolog"
 	"github.com/stretchr/testify/require"
 	nullmetrics "github.com/wealdtech/probed/services/metrics/null"
+	memoryprobedb "github.com/wealdtech/probed/services/probedb/memory"
 	mockprobedb "github.com/wealdtech/probed/services/probedb/mock"
 )
 
@@ -57,6 +58,21 @@ func TestSetBlockDelay(t *testing.T) {
 	)
 	require.NoError(t, err)
 
+	memoryDB, err := memoryprobedb.New(ctx, memoryprobedb.WithLogLevel(zerolog.Disabled))
+	require.NoError(t, err)
+	queueingDB := &queueingProbeDB{Service: memoryDB}
+	queueingService, err := New(ctx,
+		WithLogLevel(zerolog.Disabled),
+		WithMonitor(monitor),
+		WithServerName("server.wealdtech.com"),
+		WithListenAddress(":14736"),
+		WithBlockDelaysSetter(queueingDB),
+		WithHeadDelaysSetter(queueingDB),
+		WithAggregateAttestationsSetter(queueingDB),
+		WithAttestationSummariesSetter(queueingDB),
+	)
+	require.NoError(t, err)
+
 	tests := []struct {
 		name       string
 		service    *Service
@@ -91,6 +107,15 @@ func TestSetBlockDelay(t *testing.T) {
 			writer:     httptest.NewRecorder(),
 			statusCode: http.StatusCreated,
 		},
+		{
+			name:    "Queued",
+			service: queueingService,
+			request: &http.Request{
+				Body: io.NopCloser(strings.NewReader(`{"source":"client","method":"block event","slot":"123","delay_ms":"12345"}`)),
+			},
+			writer:     httptest.NewRecorder(),
+			statusCode: http.StatusAccepted,
+		},
 		{
 			name:    "Erroring",
 			service: erroringService,
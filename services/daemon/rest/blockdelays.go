@@ -0,0 +1,55 @@
+// Copyright © 2023 Weald Technology Trading.
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package rest
+
+import (
+	"net/http"
+
+	"github.com/wealdtech/probed/services/daemon/rest/types"
+	"github.com/wealdtech/probed/services/probedb"
+)
+
+func (s *Service) getBlockDelays(w http.ResponseWriter, r *http.Request) {
+	filter, err := parseDelayFilter(r.URL.Query())
+	if err != nil {
+		log.Debug().Err(err).Msg("Supplied with invalid filter")
+		w.WriteHeader(http.StatusBadRequest)
+		requestHandled("block delays", "failed")
+		return
+	}
+
+	delays, err := s.blockDelaysProvider.BlockDelays(r.Context(), filter)
+	if err != nil {
+		log.Warn().Err(err).Msg("Failed to obtain block delays")
+		w.WriteHeader(http.StatusInternalServerError)
+		requestHandled("block delays", "failed")
+		return
+	}
+
+	res := make([]*types.Delay, 0, len(delays))
+	for _, delay := range delays {
+		res = append(res, &types.Delay{
+			Source:  delay.Source,
+			Method:  delay.Method,
+			Slot:    delay.Slot,
+			DelayMS: delay.DelayMS,
+		})
+	}
+
+	setNextCursor(w, filter.Limit, len(delays), func() *probedb.Position {
+		return probedb.DelayPosition(delays[len(delays)-1])
+	})
+	writeJSON(w, res)
+	requestHandled("block delays", "succeeded")
+}
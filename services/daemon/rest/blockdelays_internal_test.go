@@ -0,0 +1,160 @@
+// Copyright © 2023 Weald Technology Trading.
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package rest
+
+import (
+	"context"
+	"net"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+
+	"github.com/rs/zerolog"
+	"github.com/stretchr/testify/require"
+	nullmetrics "github.com/wealdtech/probed/services/metrics/null"
+	"github.com/wealdtech/probed/services/probedb"
+	mockprobedb "github.com/wealdtech/probed/services/probedb/mock"
+)
+
+func TestGetBlockDelays(t *testing.T) {
+	ctx := context.Background()
+	probeDB := mockprobedb.New()
+	monitor := nullmetrics.New()
+
+	service, err := New(ctx,
+		WithLogLevel(zerolog.Disabled),
+		WithMonitor(monitor),
+		WithServerName("server.wealdtech.com"),
+		WithListenAddress(":14734"),
+		WithBlockDelaysSetter(probeDB),
+		WithHeadDelaysSetter(probeDB),
+		WithAggregateAttestationsSetter(probeDB),
+		WithAttestationSummariesSetter(probeDB),
+		WithBlockDelaysProvider(probeDB),
+	)
+	require.NoError(t, err)
+
+	erroringProbeDB := mockprobedb.NewErroring()
+	erroringService, err := New(ctx,
+		WithLogLevel(zerolog.Disabled),
+		WithMonitor(monitor),
+		WithServerName("server.wealdtech.com"),
+		WithListenAddress(":14735"),
+		WithBlockDelaysSetter(erroringProbeDB),
+		WithHeadDelaysSetter(erroringProbeDB),
+		WithAggregateAttestationsSetter(erroringProbeDB),
+		WithAttestationSummariesSetter(erroringProbeDB),
+		WithBlockDelaysProvider(erroringProbeDB),
+	)
+	require.NoError(t, err)
+
+	tests := []struct {
+		name       string
+		service    *Service
+		request    *http.Request
+		writer     *httptest.ResponseRecorder
+		statusCode int
+		body       string
+	}{
+		{
+			name:       "SlotInvalid",
+			service:    service,
+			request:    httptest.NewRequest(http.MethodGet, "/v1/blockdelays?from=bad", nil),
+			writer:     httptest.NewRecorder(),
+			statusCode: http.StatusBadRequest,
+		},
+		{
+			name:       "SelectionInvalid",
+			service:    service,
+			request:    httptest.NewRequest(http.MethodGet, "/v1/blockdelays?selection=bad", nil),
+			writer:     httptest.NewRecorder(),
+			statusCode: http.StatusBadRequest,
+		},
+		{
+			name:       "Good",
+			service:    service,
+			request:    httptest.NewRequest(http.MethodGet, "/v1/blockdelays?from=1&to=2&source=a&source=b&selection=median", nil),
+			writer:     httptest.NewRecorder(),
+			statusCode: http.StatusOK,
+			body:       "[]\n",
+		},
+		{
+			name:       "Erroring",
+			service:    erroringService,
+			request:    httptest.NewRequest(http.MethodGet, "/v1/blockdelays", nil),
+			writer:     httptest.NewRecorder(),
+			statusCode: http.StatusInternalServerError,
+		},
+	}
+
+	for _, test := range tests {
+		t.Run(test.name, func(t *testing.T) {
+			test.service.getBlockDelays(test.writer, test.request)
+			require.Equal(t, test.statusCode, test.writer.Result().StatusCode)
+			if test.body != "" {
+				require.Equal(t, test.body, test.writer.Body.String())
+			}
+		})
+	}
+}
+
+func TestGetBlockDelaysPaged(t *testing.T) {
+	ctx := context.Background()
+	probeDB := mockprobedb.New()
+	for slot := uint32(1); slot <= 3; slot++ {
+		for _, source := range []string{"a", "b"} {
+			_, err := probeDB.SetBlockDelay(ctx, &probedb.Delay{
+				IPAddr:  net.ParseIP("10.0.0.1"),
+				Source:  source,
+				Method:  "m",
+				Slot:    slot,
+				DelayMS: 100 * slot,
+			})
+			require.NoError(t, err)
+		}
+	}
+
+	service, err := New(ctx,
+		WithLogLevel(zerolog.Disabled),
+		WithMonitor(nullmetrics.New()),
+		WithServerName("server.wealdtech.com"),
+		WithListenAddress(":14736"),
+		WithBlockDelaysSetter(probeDB),
+		WithHeadDelaysSetter(probeDB),
+		WithAggregateAttestationsSetter(probeDB),
+		WithAttestationSummariesSetter(probeDB),
+		WithBlockDelaysProvider(probeDB),
+	)
+	require.NoError(t, err)
+
+	// Pages of four results are returned, with a cursor for the next page
+	// only when a page is full.
+	pages := []string{
+		`[{"source":"a","method":"m","slot":"1","delay_ms":"100"},{"source":"b","method":"m","slot":"1","delay_ms":"100"},{"source":"a","method":"m","slot":"2","delay_ms":"200"},{"source":"b","method":"m","slot":"2","delay_ms":"200"}]`,
+		`[{"source":"a","method":"m","slot":"3","delay_ms":"300"},{"source":"b","method":"m","slot":"3","delay_ms":"300"}]`,
+	}
+	cursor := ""
+	for i, page := range pages {
+		writer := httptest.NewRecorder()
+		service.getBlockDelays(writer, httptest.NewRequest(http.MethodGet, "/v1/blockdelays?selection=all&limit=4&cursor="+cursor, nil))
+		require.Equal(t, http.StatusOK, writer.Result().StatusCode)
+		require.JSONEq(t, page, writer.Body.String())
+		cursor = writer.Result().Header.Get(nextCursorHeader)
+		if i < len(pages)-1 {
+			require.NotEmpty(t, cursor)
+		} else {
+			require.Empty(t, cursor)
+		}
+	}
+}
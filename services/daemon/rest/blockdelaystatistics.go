@@ -0,0 +1,45 @@
+// Copyright © 2023 Weald Technology Trading.
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package rest
+
+import (
+	"net/http"
+
+	"github.com/wealdtech/probed/services/probedb"
+)
+
+func (s *Service) getBlockDelayStatistics(w http.ResponseWriter, r *http.Request) {
+	filter, err := parseDelayStatisticsFilter(r.URL.Query())
+	if err != nil {
+		log.Debug().Err(err).Msg("Supplied with invalid filter")
+		w.WriteHeader(http.StatusBadRequest)
+		requestHandled("block delay statistics", "failed")
+		return
+	}
+	filter.SlotsPerEpoch = s.slotsPerEpoch
+
+	statistics, err := s.blockDelayStatisticsProvider.BlockDelayStatistics(r.Context(), filter)
+	if err != nil {
+		log.Warn().Err(err).Msg("Failed to obtain block delay statistics")
+		w.WriteHeader(http.StatusInternalServerError)
+		requestHandled("block delay statistics", "failed")
+		return
+	}
+
+	setNextCursor(w, filter.Limit, len(statistics), func() *probedb.Position {
+		return probedb.DelayStatisticsPosition(statistics[len(statistics)-1])
+	})
+	writeJSON(w, delayStatisticsResponse(filter, statistics))
+	requestHandled("block delay statistics", "succeeded")
+}
@@ -0,0 +1,137 @@
+// Copyright © 2023 Weald Technology Trading.
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package rest
+
+import (
+	"context"
+	"net"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+
+	"github.com/rs/zerolog"
+	"github.com/stretchr/testify/require"
+	nullmetrics "github.com/wealdtech/probed/services/metrics/null"
+	"github.com/wealdtech/probed/services/probedb"
+	mockprobedb "github.com/wealdtech/probed/services/probedb/mock"
+)
+
+func TestGetBlockDelayStatistics(t *testing.T) {
+	ctx := context.Background()
+	probeDB := mockprobedb.New()
+	monitor := nullmetrics.New()
+
+	for i, delay := range []uint32{100, 200, 300, 400} {
+		_, err := probeDB.SetBlockDelay(ctx, &probedb.Delay{
+			IPAddr:  net.IPv4(10, 0, 0, byte(i)).To4(),
+			Source:  "client",
+			Method:  "head event",
+			Slot:    5,
+			DelayMS: delay,
+		})
+		require.NoError(t, err)
+	}
+
+	service, err := New(ctx,
+		WithLogLevel(zerolog.Disabled),
+		WithMonitor(monitor),
+		WithServerName("server.wealdtech.com"),
+		WithListenAddress(":14734"),
+		WithBlockDelaysSetter(probeDB),
+		WithHeadDelaysSetter(probeDB),
+		WithAggregateAttestationsSetter(probeDB),
+		WithAttestationSummariesSetter(probeDB),
+		WithBlockDelayStatisticsProvider(probeDB),
+	)
+	require.NoError(t, err)
+
+	erroringProbeDB := mockprobedb.NewErroring()
+	erroringService, err := New(ctx,
+		WithLogLevel(zerolog.Disabled),
+		WithMonitor(monitor),
+		WithServerName("server.wealdtech.com"),
+		WithListenAddress(":14735"),
+		WithBlockDelaysSetter(erroringProbeDB),
+		WithHeadDelaysSetter(erroringProbeDB),
+		WithAggregateAttestationsSetter(erroringProbeDB),
+		WithAttestationSummariesSetter(erroringProbeDB),
+		WithBlockDelayStatisticsProvider(erroringProbeDB),
+	)
+	require.NoError(t, err)
+
+	tests := []struct {
+		name       string
+		service    *Service
+		request    *http.Request
+		writer     *httptest.ResponseRecorder
+		statusCode int
+		body       string
+	}{
+		{
+			name:       "StatisticMissing",
+			service:    service,
+			request:    httptest.NewRequest(http.MethodGet, "/v1/blockdelaystatistics", nil),
+			writer:     httptest.NewRecorder(),
+			statusCode: http.StatusBadRequest,
+		},
+		{
+			name:       "StatisticInvalid",
+			service:    service,
+			request:    httptest.NewRequest(http.MethodGet, "/v1/blockdelaystatistics?statistic=bad", nil),
+			writer:     httptest.NewRecorder(),
+			statusCode: http.StatusBadRequest,
+		},
+		{
+			name:       "Good",
+			service:    service,
+			request:    httptest.NewRequest(http.MethodGet, "/v1/blockdelaystatistics?statistic=count&statistic=mean&statistic=p75", nil),
+			writer:     httptest.NewRecorder(),
+			statusCode: http.StatusOK,
+			body:       `[{"slot":"5","statistics":{"count":4,"mean":250,"p75":325}}]` + "\n",
+		},
+		{
+			name:       "Grouped",
+			service:    service,
+			request:    httptest.NewRequest(http.MethodGet, "/v1/blockdelaystatistics?statistic=count&group_by=epoch&group_by=source", nil),
+			writer:     httptest.NewRecorder(),
+			statusCode: http.StatusOK,
+			body:       `[{"epoch":"0","source":"client","statistics":{"count":4}}]` + "\n",
+		},
+		{
+			name:       "GroupedByIPAddr",
+			service:    service,
+			request:    httptest.NewRequest(http.MethodGet, "/v1/blockdelaystatistics?statistic=maximum&group_by=ip_addr&from=5&to=5", nil),
+			writer:     httptest.NewRecorder(),
+			statusCode: http.StatusOK,
+			body:       `[{"ip_addr":"10.0.0.0","statistics":{"maximum":100}},{"ip_addr":"10.0.0.1","statistics":{"maximum":200}},{"ip_addr":"10.0.0.2","statistics":{"maximum":300}},{"ip_addr":"10.0.0.3","statistics":{"maximum":400}}]` + "\n",
+		},
+		{
+			name:       "Erroring",
+			service:    erroringService,
+			request:    httptest.NewRequest(http.MethodGet, "/v1/blockdelaystatistics?statistic=count", nil),
+			writer:     httptest.NewRecorder(),
+			statusCode: http.StatusInternalServerError,
+		},
+	}
+
+	for _, test := range tests {
+		t.Run(test.name, func(t *testing.T) {
+			test.service.getBlockDelayStatistics(test.writer, test.request)
+			require.Equal(t, test.statusCode, test.writer.Result().StatusCode)
+			if test.body != "" {
+				require.Equal(t, test.body, test.writer.Body.String())
+			}
+		})
+	}
+}
@@ -0,0 +1,340 @@
+// Copyright © 2023 Weald Technology Trading.
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package rest
+
+import (
+	"encoding/json"
+	"math"
+	"net"
+	"net/http"
+	"net/url"
+	"strconv"
+	"strings"
+
+	"github.com/attestantio/go-eth2-client/spec/phase0"
+	"github.com/pkg/errors"
+	"github.com/wealdtech/probed/services/daemon/rest/types"
+	"github.com/wealdtech/probed/services/probedb"
+)
+
+// nextCursorHeader is the response header that holds the cursor for the next page of results.
+const nextCursorHeader = "X-Next-Cursor"
+
+// parseDelayFilter parses a delay filter from query parameters.
+func parseDelayFilter(values url.Values) (*probedb.DelayFilter, error) {
+	filter := &probedb.DelayFilter{
+		Prober:  values.Get("prober"),
+		Sources: values["source"],
+		Methods: values["method"],
+	}
+
+	var err error
+	filter.IPAddr, err = parseIPAddr(values)
+	if err != nil {
+		return nil, err
+	}
+	filter.From, err = parseSlot(values, "from")
+	if err != nil {
+		return nil, err
+	}
+	filter.To, err = parseSlot(values, "to")
+	if err != nil {
+		return nil, err
+	}
+	filter.Order, err = parseOrder(values)
+	if err != nil {
+		return nil, err
+	}
+
+	filter.Limit, err = parseLimit(values)
+	if err != nil {
+		return nil, err
+	}
+	filter.Cursor, err = parseCursor(values, probedb.ParseDelayCursor)
+	if err != nil {
+		return nil, err
+	}
+
+	switch strings.ToLower(values.Get("selection")) {
+	case "", "minimum":
+		filter.Selection = probedb.SelectionMinimum
+	case "maximum":
+		filter.Selection = probedb.SelectionMaximum
+	case "median":
+		filter.Selection = probedb.SelectionMedian
+	case "all":
+		filter.Selection = probedb.SelectionAll
+	default:
+		return nil, errors.New("invalid value for selection")
+	}
+
+	return filter, nil
+}
+
+// parseDelayStatisticsFilter parses a delay filter with statistics from query parameters.
+func parseDelayStatisticsFilter(values url.Values) (*probedb.DelayFilter, error) {
+	filter, err := parseDelayFilter(values)
+	if err != nil {
+		return nil, err
+	}
+
+	if len(values["statistic"]) == 0 {
+		return nil, errors.New("no statistic specified")
+	}
+	filter.Statistics = make([]probedb.Statistic, 0, len(values["statistic"]))
+	for _, input := range values["statistic"] {
+		statistic, err := parseStatistic(input)
+		if err != nil {
+			return nil, err
+		}
+		filter.Statistics = append(filter.Statistics, statistic)
+	}
+
+	for _, input := range values["group_by"] {
+		switch strings.ToLower(input) {
+		case "slot":
+			filter.GroupBy = append(filter.GroupBy, probedb.DimensionSlot)
+		case "epoch":
+			filter.GroupBy = append(filter.GroupBy, probedb.DimensionEpoch)
+		case "source":
+			filter.GroupBy = append(filter.GroupBy, probedb.DimensionSource)
+		case "method":
+			filter.GroupBy = append(filter.GroupBy, probedb.DimensionMethod)
+		case "ip_addr":
+			filter.GroupBy = append(filter.GroupBy, probedb.DimensionIPAddr)
+		default:
+			return nil, errors.New("invalid value for group_by")
+		}
+	}
+
+	return filter, nil
+}
+
+// parseStatistic parses a statistic, which is one of "count", "minimum", "maximum",
+// "mean", "stddev", "median" or a percentile such as "p95" or "p99.9".
+func parseStatistic(input string) (probedb.Statistic, error) {
+	switch strings.ToLower(input) {
+	case "count":
+		return probedb.Statistic{Type: probedb.StatisticCount}, nil
+	case "minimum":
+		return probedb.Statistic{Type: probedb.StatisticMinimum}, nil
+	case "maximum":
+		return probedb.Statistic{Type: probedb.StatisticMaximum}, nil
+	case "mean":
+		return probedb.Statistic{Type: probedb.StatisticMean}, nil
+	case "stddev":
+		return probedb.Statistic{Type: probedb.StatisticStdDev}, nil
+	case "median":
+		return probedb.Statistic{Type: probedb.StatisticPercentile, Percentile: 50}, nil
+	}
+
+	if !strings.HasPrefix(strings.ToLower(input), "p") {
+		return probedb.Statistic{}, errors.New("invalid value for statistic")
+	}
+	percentile, err := strconv.ParseFloat(input[1:], 64)
+	if err != nil || math.IsNaN(percentile) || percentile < 0 || percentile > 100 {
+		return probedb.Statistic{}, errors.New("invalid value for statistic")
+	}
+
+	return probedb.Statistic{Type: probedb.StatisticPercentile, Percentile: percentile}, nil
+}
+
+// delayStatisticsResponse converts delay statistics to their API representation,
+// keyed by the grouping dimensions and naming each value with the statistic as requested.
+func delayStatisticsResponse(filter *probedb.DelayFilter, statistics []*probedb.DelayStatistics) []*types.DelayStatistics {
+	dimensions := probedb.GroupingDimensions(filter)
+
+	res := make([]*types.DelayStatistics, 0, len(statistics))
+	for _, groupStatistics := range statistics {
+		group := &types.DelayStatistics{
+			Statistics: make(map[string]float64, len(filter.Statistics)),
+		}
+		for _, dimension := range dimensions {
+			switch dimension {
+			case probedb.DimensionSlot:
+				group.Slot = &groupStatistics.Slot
+			case probedb.DimensionEpoch:
+				group.Epoch = &groupStatistics.Epoch
+			case probedb.DimensionSource:
+				group.Source = &groupStatistics.Source
+			case probedb.DimensionMethod:
+				group.Method = &groupStatistics.Method
+			case probedb.DimensionIPAddr:
+				group.IPAddr = groupStatistics.IPAddr
+			}
+		}
+		for i, statistic := range filter.Statistics {
+			group.Statistics[statistic.String()] = groupStatistics.Values[i]
+		}
+		res = append(res, group)
+	}
+
+	return res
+}
+
+// parseAggregateAttestationFilter parses an aggregate attestation filter from query parameters.
+func parseAggregateAttestationFilter(values url.Values) (*probedb.AggregateAttestationFilter, error) {
+	filter := &probedb.AggregateAttestationFilter{
+		Prober:  values.Get("prober"),
+		Sources: values["source"],
+		Methods: values["method"],
+	}
+
+	var err error
+	filter.IPAddr, err = parseIPAddr(values)
+	if err != nil {
+		return nil, err
+	}
+	filter.From, err = parseSlot(values, "from")
+	if err != nil {
+		return nil, err
+	}
+	filter.To, err = parseSlot(values, "to")
+	if err != nil {
+		return nil, err
+	}
+	filter.Order, err = parseOrder(values)
+	if err != nil {
+		return nil, err
+	}
+	filter.Limit, err = parseLimit(values)
+	if err != nil {
+		return nil, err
+	}
+	filter.Cursor, err = parseCursor(values, probedb.ParseAggregateAttestationCursor)
+	if err != nil {
+		return nil, err
+	}
+
+	return filter, nil
+}
+
+// parseAttestationSummaryFilter parses an attestation summary filter from query parameters.
+func parseAttestationSummaryFilter(values url.Values) (*probedb.AttestationSummaryFilter, error) {
+	filter := &probedb.AttestationSummaryFilter{
+		Prober:  values.Get("prober"),
+		Sources: values["source"],
+		Methods: values["method"],
+	}
+
+	var err error
+	filter.IPAddr, err = parseIPAddr(values)
+	if err != nil {
+		return nil, err
+	}
+	filter.From, err = parseSlot(values, "from")
+	if err != nil {
+		return nil, err
+	}
+	filter.To, err = parseSlot(values, "to")
+	if err != nil {
+		return nil, err
+	}
+	filter.Order, err = parseOrder(values)
+	if err != nil {
+		return nil, err
+	}
+	filter.Limit, err = parseLimit(values)
+	if err != nil {
+		return nil, err
+	}
+	filter.Cursor, err = parseCursor(values, probedb.ParseAttestationSummaryCursor)
+	if err != nil {
+		return nil, err
+	}
+
+	return filter, nil
+}
+
+// parseIPAddr parses the IP address query parameter.
+func parseIPAddr(values url.Values) (string, error) {
+	ipAddr := values.Get("ip_addr")
+	if ipAddr == "" {
+		return "", nil
+	}
+	if net.ParseIP(ipAddr) == nil {
+		return "", errors.New("invalid value for ip_addr")
+	}
+
+	return ipAddr, nil
+}
+
+// parseSlot parses a slot query parameter.
+func parseSlot(values url.Values, name string) (*phase0.Slot, error) {
+	input := values.Get(name)
+	if input == "" {
+		return nil, nil
+	}
+	tmp, err := strconv.ParseUint(input, 10, 32)
+	if err != nil {
+		return nil, errors.Wrap(err, "invalid value for "+name)
+	}
+	slot := phase0.Slot(tmp)
+
+	return &slot, nil
+}
+
+// parseOrder parses the order query parameter.
+func parseOrder(values url.Values) (probedb.Order, error) {
+	switch strings.ToLower(values.Get("order")) {
+	case "", "earliest":
+		return probedb.OrderEarliest, nil
+	case "latest":
+		return probedb.OrderLatest, nil
+	default:
+		return 0, errors.New("invalid value for order")
+	}
+}
+
+// parseLimit parses the limit query parameter.
+func parseLimit(values url.Values) (uint32, error) {
+	input := values.Get("limit")
+	if input == "" {
+		return 0, nil
+	}
+	limit, err := strconv.ParseUint(input, 10, 32)
+	if err != nil {
+		return 0, errors.Wrap(err, "invalid value for limit")
+	}
+
+	return uint32(limit), nil
+}
+
+// parseCursor parses the cursor query parameter, checking it with the supplied parser.
+func parseCursor(values url.Values, parse func(string) (*probedb.Position, error)) (string, error) {
+	cursor := values.Get("cursor")
+	if _, err := parse(cursor); err != nil {
+		return "", errors.New("invalid value for cursor")
+	}
+
+	return cursor, nil
+}
+
+// setNextCursor sets the header that holds the cursor for the next page of
+// results, if the results filled the page.
+func setNextCursor(w http.ResponseWriter, limit uint32, results int, last func() *probedb.Position) {
+	if limit == 0 || results < int(limit) {
+		return
+	}
+	w.Header().Set(nextCursorHeader, last().Cursor())
+}
+
+// writeJSON writes the supplied data as a JSON response.
+func writeJSON(w http.ResponseWriter, data interface{}) {
+	w.Header().Set("Content-Type", "application/json")
+	w.WriteHeader(http.StatusOK)
+	if err := json.NewEncoder(w).Encode(data); err != nil {
+		log.Warn().Err(err).Msg("Failed to write response")
+	}
+}
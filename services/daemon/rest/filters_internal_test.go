@@ -0,0 +1,264 @@
+// Copyright © 2023 Weald Technology Trading.
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package rest
+
+import (
+	"net/url"
+	"testing"
+
+	"github.com/attestantio/go-eth2-client/spec/phase0"
+	"github.com/stretchr/testify/require"
+	"github.com/wealdtech/probed/services/probedb"
+)
+
+func slotPtr(in phase0.Slot) *phase0.Slot {
+	return &in
+}
+
+func TestParseDelayFilter(t *testing.T) {
+	cursor := probedb.DelayPosition(&probedb.Delay{Slot: 5}).Cursor()
+
+	tests := []struct {
+		name  string
+		query string
+		res   *probedb.DelayFilter
+		err   string
+	}{
+		{
+			name:  "Empty",
+			query: "",
+			res: &probedb.DelayFilter{
+				Selection: probedb.SelectionMinimum,
+			},
+		},
+		{
+			name:  "IPAddrInvalid",
+			query: "ip_addr=bad",
+			err:   "invalid value for ip_addr",
+		},
+		{
+			name:  "FromInvalid",
+			query: "from=-1",
+			err:   "invalid value for from: strconv.ParseUint: parsing \"-1\": invalid syntax",
+		},
+		{
+			name:  "ToInvalid",
+			query: "to=x",
+			err:   "invalid value for to: strconv.ParseUint: parsing \"x\": invalid syntax",
+		},
+		{
+			name:  "OrderInvalid",
+			query: "order=sideways",
+			err:   "invalid value for order",
+		},
+		{
+			name:  "SelectionInvalid",
+			query: "selection=mode",
+			err:   "invalid value for selection",
+		},
+		{
+			name:  "LimitInvalid",
+			query: "limit=x",
+			err:   "invalid value for limit: strconv.ParseUint: parsing \"x\": invalid syntax",
+		},
+		{
+			name:  "CursorInvalid",
+			query: "cursor=bad",
+			err:   "invalid value for cursor",
+		},
+		{
+			name:  "Full",
+			query: "ip_addr=1.2.3.4&prober=prober1&source=a&source=b&method=m&from=10&to=20&order=latest&selection=all",
+			res: &probedb.DelayFilter{
+				IPAddr:    "1.2.3.4",
+				Prober:    "prober1",
+				Sources:   []string{"a", "b"},
+				Methods:   []string{"m"},
+				From:      slotPtr(10),
+				To:        slotPtr(20),
+				Order:     probedb.OrderLatest,
+				Selection: probedb.SelectionAll,
+			},
+		},
+		{
+			name:  "Paged",
+			query: "limit=10&cursor=" + cursor,
+			res: &probedb.DelayFilter{
+				Selection: probedb.SelectionMinimum,
+				Limit:     10,
+				Cursor:    cursor,
+			},
+		},
+	}
+
+	for _, test := range tests {
+		t.Run(test.name, func(t *testing.T) {
+			values, err := url.ParseQuery(test.query)
+			require.NoError(t, err)
+			res, err := parseDelayFilter(values)
+			if test.err != "" {
+				require.EqualError(t, err, test.err)
+			} else {
+				require.NoError(t, err)
+				require.Equal(t, test.res, res)
+			}
+		})
+	}
+}
+
+func TestParseDelayStatisticsFilter(t *testing.T) {
+	tests := []struct {
+		name  string
+		query string
+		res   *probedb.DelayFilter
+		err   string
+	}{
+		{
+			name:  "Empty",
+			query: "",
+			err:   "no statistic specified",
+		},
+		{
+			name:  "FilterInvalid",
+			query: "statistic=count&from=bad",
+			err:   "invalid value for from: strconv.ParseUint: parsing \"bad\": invalid syntax",
+		},
+		{
+			name:  "StatisticInvalid",
+			query: "statistic=mode",
+			err:   "invalid value for statistic",
+		},
+		{
+			name:  "GroupByInvalid",
+			query: "statistic=count&group_by=day",
+			err:   "invalid value for group_by",
+		},
+		{
+			name:  "PercentileMissing",
+			query: "statistic=p",
+			err:   "invalid value for statistic",
+		},
+		{
+			name:  "PercentileTooHigh",
+			query: "statistic=p101",
+			err:   "invalid value for statistic",
+		},
+		{
+			name:  "PercentileNaN",
+			query: "statistic=pNaN",
+			err:   "invalid value for statistic",
+		},
+		{
+			name:  "Full",
+			query: "from=10&statistic=count&statistic=minimum&statistic=maximum&statistic=mean&statistic=stddev&statistic=median&statistic=P99.9",
+			res: &probedb.DelayFilter{
+				From:      slotPtr(10),
+				Selection: probedb.SelectionMinimum,
+				Statistics: []probedb.Statistic{
+					{Type: probedb.StatisticCount},
+					{Type: probedb.StatisticMinimum},
+					{Type: probedb.StatisticMaximum},
+					{Type: probedb.StatisticMean},
+					{Type: probedb.StatisticStdDev},
+					{Type: probedb.StatisticPercentile, Percentile: 50},
+					{Type: probedb.StatisticPercentile, Percentile: 99.9},
+				},
+			},
+		},
+		{
+			name:  "Grouped",
+			query: "statistic=median&group_by=epoch&group_by=SOURCE&group_by=method&group_by=ip_addr&group_by=slot",
+			res: &probedb.DelayFilter{
+				Selection:  probedb.SelectionMinimum,
+				Statistics: []probedb.Statistic{{Type: probedb.StatisticPercentile, Percentile: 50}},
+				GroupBy: []probedb.Dimension{
+					probedb.DimensionEpoch,
+					probedb.DimensionSource,
+					probedb.DimensionMethod,
+					probedb.DimensionIPAddr,
+					probedb.DimensionSlot,
+				},
+			},
+		},
+	}
+
+	for _, test := range tests {
+		t.Run(test.name, func(t *testing.T) {
+			values, err := url.ParseQuery(test.query)
+			require.NoError(t, err)
+			res, err := parseDelayStatisticsFilter(values)
+			if test.err != "" {
+				require.EqualError(t, err, test.err)
+			} else {
+				require.NoError(t, err)
+				require.Equal(t, test.res, res)
+			}
+		})
+	}
+}
+
+func TestParseAggregateAttestationFilter(t *testing.T) {
+	cursor := probedb.AggregateAttestationPosition(&probedb.AggregateAttestation{Slot: 5, AggregationBits: []byte{0x01}}).Cursor()
+
+	tests := []struct {
+		name  string
+		query string
+		res   *probedb.AggregateAttestationFilter
+		err   string
+	}{
+		{
+			name:  "Empty",
+			query: "",
+			res:   &probedb.AggregateAttestationFilter{},
+		},
+		{
+			name:  "LimitInvalid",
+			query: "limit=-5",
+			err:   "invalid value for limit: strconv.ParseUint: parsing \"-5\": invalid syntax",
+		},
+		{
+			name:  "CursorWrongType",
+			query: "cursor=" + probedb.DelayPosition(&probedb.Delay{Slot: 5}).Cursor(),
+			err:   "invalid value for cursor",
+		},
+		{
+			name:  "Full",
+			query: "ip_addr=::1&source=a&method=m&from=10&to=20&order=earliest&limit=5&cursor=" + cursor,
+			res: &probedb.AggregateAttestationFilter{
+				IPAddr:  "::1",
+				Sources: []string{"a"},
+				Methods: []string{"m"},
+				From:    slotPtr(10),
+				To:      slotPtr(20),
+				Order:   probedb.OrderEarliest,
+				Limit:   5,
+				Cursor:  cursor,
+			},
+		},
+	}
+
+	for _, test := range tests {
+		t.Run(test.name, func(t *testing.T) {
+			values, err := url.ParseQuery(test.query)
+			require.NoError(t, err)
+			res, err := parseAggregateAttestationFilter(values)
+			if test.err != "" {
+				require.EqualError(t, err, test.err)
+			} else {
+				require.NoError(t, err)
+				require.Equal(t, test.res, res)
+			}
+		})
+	}
+}
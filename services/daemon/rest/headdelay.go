@@ -39,7 +39,7 @@ func (s *Service) postHeadDelay(w http.ResponseWriter, r *http.Request) {
 		return
 	}
 
-	sourceIP, err := sourceIP(r)
+	sourceIP, err := s.sourceIP(r)
 	if err != nil {
 		log.Debug().Err(err).Msg("Failed to obtain source IP")
 		w.WriteHeader(http.StatusInternalServerError)
@@ -47,15 +47,17 @@ func (s *Service) postHeadDelay(w http.ResponseWriter, r *http.Request) {
 		return
 	}
 
-	if err := s.headDelaysSetter.SetHeadDelay(context.Background(), &probedb.Delay{
+	action, err := s.headDelaysSetter.SetHeadDelay(context.Background(), &probedb.Delay{
 		IPAddr:  sourceIP,
+		Prober:  proberFromRequest(r),
 		Source:  headDelay.Source,
 		Method:  headDelay.Method,
 		Slot:    headDelay.Slot,
 		DelayMS: headDelay.DelayMS,
-	}); err != nil {
+	})
+	if err != nil {
 		log.Warn().Err(err).Msg("Failed to set head delay")
-		w.WriteHeader(http.StatusInternalServerError)
+		writeStorageError(w, err)
 		requestHandled("head delay", "failed")
 		return
 	}
@@ -66,8 +68,9 @@ func (s *Service) postHeadDelay(w http.ResponseWriter, r *http.Request) {
 		Str("method", headDelay.Method).
 		Uint32("slot", headDelay.Slot).
 		Uint32("delay_ms", headDelay.DelayMS).
+		Stringer("action", action).
 		Msg("Metric accepted")
-	w.WriteHeader(http.StatusCreated)
+	w.WriteHeader(actionStatusCode(action))
 
 	requestHandled("head delay", "succeeded")
 }
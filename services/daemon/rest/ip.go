@@ -1,4 +1,4 @@
-// Copyright © 2022 Weald Technology Trading.
+// Copyright © 2022, 2023 Weald Technology Trading.
 // Licensed under the Apache License, Version 2.0 (the "License");
 // you may not use this file except in compliance with the License.
 // You may obtain a copy of the License at
@@ -22,41 +22,168 @@ import (
 )
 
 // sourceIP fetches the IP address of the request.
-func sourceIP(r *http.Request) (net.IP, error) {
-	// Attempt to obtain from the X-REAL-IP header.
-	// This is a single address that represents the source of the request.
-	ip := r.Header.Get("X-REAL-IP")
-	netIP := net.ParseIP(ip)
-	if netIP != nil {
-		return netIP, nil
+// Forwarding headers are only honoured if the immediate peer is a trusted proxy,
+// in which case the right-most untrusted address in the forwarding chain is used.
+func (s *Service) sourceIP(r *http.Request) (net.IP, error) {
+	peerIP, err := peerIP(r)
+	if err != nil {
+		return nil, err
+	}
+	if !s.trustedProxy(peerIP) {
+		log.Trace().Str("peer", peerIP.String()).Msg("Peer is not a trusted proxy; using peer address")
+		return peerIP, nil
+	}
+
+	// Attempt to obtain from the Forwarded header, as per RFC 7239.
+	if hops := forwardedHops(r.Header.Values("Forwarded")); len(hops) > 0 {
+		ip := s.rightmostUntrusted(peerIP, hops)
+		log.Trace().Str("peer", peerIP.String()).Strs("hops", hops).Str("ip", ip.String()).Msg("Using address from Forwarded header")
+		return ip, nil
 	}
 
 	// Attempt to obtain from the X-FORWARDED-FOR header.
 	// This is multiple addresses that represents the path taken by the request.
-	// Get IP from X-FORWARDED-FOR header.
-	ips := r.Header.Get("X-FORWARDED-FOR")
-	splitIps := strings.Split(ips, ",")
-	for _, ip := range splitIps {
-		netIP := net.ParseIP(ip)
-		if netIP != nil {
-			return netIP, nil
-		}
+	if hops := xForwardedForHops(r.Header.Values("X-FORWARDED-FOR")); len(hops) > 0 {
+		ip := s.rightmostUntrusted(peerIP, hops)
+		log.Trace().Str("peer", peerIP.String()).Strs("hops", hops).Str("ip", ip.String()).Msg("Using address from X-Forwarded-For header")
+		return ip, nil
+	}
+
+	// Attempt to obtain from the X-REAL-IP header.
+	// This is a single address that represents the source of the request.
+	if ip := parseNode(r.Header.Get("X-REAL-IP")); ip != nil {
+		log.Trace().Str("peer", peerIP.String()).Str("ip", ip.String()).Msg("Using address from X-Real-IP header")
+		return ip, nil
 	}
 
-	// Fetch from the internals of the request itself.
+	log.Trace().Str("peer", peerIP.String()).Msg("No forwarding headers from trusted proxy; using peer address")
+	return peerIP, nil
+}
+
+// peerIP fetches the IP address of the immediate peer of the request.
+func peerIP(r *http.Request) (net.IP, error) {
 	if r.RemoteAddr == "" {
 		// This suggests localhost.
 		return net.ParseIP("127.0.0.1"), nil
-
 	}
 	ip, _, err := net.SplitHostPort(r.RemoteAddr)
 	if err != nil {
 		return nil, errors.Wrap(err, "failed to split host/port from remote address")
 	}
-	netIP = net.ParseIP(ip)
-	if netIP != nil {
-		return netIP, nil
+	netIP := net.ParseIP(ip)
+	if netIP == nil {
+		return nil, errors.New("No valid ip found")
+	}
+
+	return netIP, nil
+}
+
+// rightmostUntrusted walks the hops from right to left, starting at the
+// trusted peer, and returns the first address that is not a trusted proxy.
+// If a hop cannot be parsed then the address of the hop to its right is
+// returned, as nothing further along the chain can be relied upon.
+func (s *Service) rightmostUntrusted(peerIP net.IP, hops []string) net.IP {
+	ip := peerIP
+	for i := len(hops) - 1; i >= 0; i-- {
+		hopIP := parseNode(hops[i])
+		if hopIP == nil {
+			log.Trace().Str("hop", hops[i]).Msg("Invalid hop; stopping")
+			return ip
+		}
+		ip = hopIP
+		if !s.trustedProxy(ip) {
+			return ip
+		}
+		log.Trace().Str("hop", ip.String()).Msg("Hop is a trusted proxy; continuing")
+	}
+
+	// All hops are trusted, so use the left-most.
+	return ip
+}
+
+// trustedProxy returns true if the address is that of a trusted proxy.
+func (s *Service) trustedProxy(ip net.IP) bool {
+	for _, trustedProxy := range s.trustedProxies {
+		if trustedProxy.Contains(ip) {
+			return true
+		}
+	}
+
+	return false
+}
+
+// forwardedHops returns the "for" nodes in a set of RFC 7239 Forwarded header values.
+func forwardedHops(values []string) []string {
+	hops := make([]string, 0)
+	for _, value := range values {
+		for _, element := range strings.Split(value, ",") {
+			for _, pair := range strings.Split(element, ";") {
+				key, val, found := strings.Cut(strings.TrimSpace(pair), "=")
+				if !found || !strings.EqualFold(key, "for") {
+					continue
+				}
+				hops = append(hops, strings.Trim(val, `"`))
+			}
+		}
+	}
+
+	return hops
+}
+
+// xForwardedForHops returns the nodes in a set of X-Forwarded-For header values.
+func xForwardedForHops(values []string) []string {
+	hops := make([]string, 0)
+	for _, value := range values {
+		for _, hop := range strings.Split(value, ",") {
+			hop = strings.TrimSpace(hop)
+			if hop != "" {
+				hops = append(hops, hop)
+			}
+		}
+	}
+
+	return hops
+}
+
+// parseNode parses a node, which may contain a port and may have its address
+// enclosed in brackets, in to an IP address.
+// It returns nil if the node does not contain an IP address.
+func parseNode(node string) net.IP {
+	node = strings.TrimSpace(node)
+	if ip := net.ParseIP(node); ip != nil {
+		return ip
+	}
+	if host, _, err := net.SplitHostPort(node); err == nil {
+		return net.ParseIP(host)
+	}
+
+	return net.ParseIP(strings.TrimSuffix(strings.TrimPrefix(node, "["), "]"))
+}
+
+// parseTrustedProxies parses a list of trusted proxies, each of which is
+// either a CIDR or a single IP address.
+func parseTrustedProxies(trustedProxies []string) ([]*net.IPNet, error) {
+	res := make([]*net.IPNet, 0, len(trustedProxies))
+	for _, trustedProxy := range trustedProxies {
+		if !strings.Contains(trustedProxy, "/") {
+			ip := net.ParseIP(trustedProxy)
+			if ip == nil {
+				return nil, errors.Errorf("invalid trusted proxy %q", trustedProxy)
+			}
+			bits := 8 * net.IPv6len
+			if ip.To4() != nil {
+				ip = ip.To4()
+				bits = 8 * net.IPv4len
+			}
+			res = append(res, &net.IPNet{IP: ip, Mask: net.CIDRMask(bits, bits)})
+			continue
+		}
+		_, ipNet, err := net.ParseCIDR(trustedProxy)
+		if err != nil {
+			return nil, errors.Errorf("invalid trusted proxy %q", trustedProxy)
+		}
+		res = append(res, ipNet)
 	}
 
-	return nil, errors.New("No valid ip found")
+	return res, nil
 }
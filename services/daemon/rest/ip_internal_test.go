@@ -0,0 +1,207 @@
+// Copyright © 2023 Weald Technology Trading.
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package rest
+
+import (
+	"context"
+	"net/http"
+	"testing"
+
+	"github.com/rs/zerolog"
+	"github.com/stretchr/testify/require"
+	nullmetrics "github.com/wealdtech/probed/services/metrics/null"
+	mockprobedb "github.com/wealdtech/probed/services/probedb/mock"
+)
+
+func TestSourceIP(t *testing.T) {
+	ctx := context.Background()
+	probeDB := mockprobedb.New()
+
+	service, err := New(ctx,
+		WithLogLevel(zerolog.Disabled),
+		WithMonitor(nullmetrics.New()),
+		WithServerName("server.wealdtech.com"),
+		WithListenAddress(":14734"),
+		WithBlockDelaysSetter(probeDB),
+		WithHeadDelaysSetter(probeDB),
+		WithAggregateAttestationsSetter(probeDB),
+		WithAttestationSummariesSetter(probeDB),
+		WithTrustedProxies([]string{"10.0.0.0/8", "192.168.1.1", "fd00::/8"}),
+	)
+	require.NoError(t, err)
+
+	tests := []struct {
+		name       string
+		remoteAddr string
+		headers    map[string][]string
+		ip         string
+		err        string
+	}{
+		{
+			name: "Localhost",
+			ip:   "127.0.0.1",
+		},
+		{
+			name:       "RemoteAddrInvalid",
+			remoteAddr: "1.2.3.4",
+			err:        "failed to split host/port from remote address: address 1.2.3.4: missing port in address",
+		},
+		{
+			name:       "Untrusted",
+			remoteAddr: "1.2.3.4:5678",
+			ip:         "1.2.3.4",
+		},
+		{
+			name:       "UntrustedIgnoresHeaders",
+			remoteAddr: "1.2.3.4:5678",
+			headers: map[string][]string{
+				"X-Real-Ip":       {"5.6.7.8"},
+				"X-Forwarded-For": {"5.6.7.8"},
+				"Forwarded":       {"for=5.6.7.8"},
+			},
+			ip: "1.2.3.4",
+		},
+		{
+			name:       "TrustedNoHeaders",
+			remoteAddr: "10.1.2.3:5678",
+			ip:         "10.1.2.3",
+		},
+		{
+			name:       "TrustedXRealIP",
+			remoteAddr: "10.1.2.3:5678",
+			headers: map[string][]string{
+				"X-Real-Ip": {"5.6.7.8"},
+			},
+			ip: "5.6.7.8",
+		},
+		{
+			name:       "TrustedXForwardedFor",
+			remoteAddr: "10.1.2.3:5678",
+			headers: map[string][]string{
+				"X-Forwarded-For": {"9.9.9.9, 5.6.7.8"},
+			},
+			ip: "5.6.7.8",
+		},
+		{
+			name:       "TrustedXForwardedForChain",
+			remoteAddr: "192.168.1.1:5678",
+			headers: map[string][]string{
+				"X-Forwarded-For": {"9.9.9.9, 5.6.7.8", "10.2.3.4"},
+			},
+			ip: "5.6.7.8",
+		},
+		{
+			name:       "TrustedXForwardedForAllTrusted",
+			remoteAddr: "10.1.2.3:5678",
+			headers: map[string][]string{
+				"X-Forwarded-For": {"10.3.4.5, 10.2.3.4"},
+			},
+			ip: "10.3.4.5",
+		},
+		{
+			name:       "TrustedXForwardedForInvalidHop",
+			remoteAddr: "10.1.2.3:5678",
+			headers: map[string][]string{
+				"X-Forwarded-For": {"5.6.7.8, bad, 10.2.3.4"},
+			},
+			ip: "10.2.3.4",
+		},
+		{
+			name:       "TrustedForwarded",
+			remoteAddr: "10.1.2.3:5678",
+			headers: map[string][]string{
+				"Forwarded":       {`for=9.9.9.9;proto=https, for="5.6.7.8:1234";by=10.1.2.3`},
+				"X-Forwarded-For": {"1.1.1.1"},
+			},
+			ip: "5.6.7.8",
+		},
+		{
+			name:       "TrustedForwardedIPv6",
+			remoteAddr: "[fd00::1]:5678",
+			headers: map[string][]string{
+				"Forwarded": {`For="[2001:db8:cafe::17]:4711"`},
+			},
+			ip: "2001:db8:cafe::17",
+		},
+		{
+			name:       "TrustedForwardedObfuscated",
+			remoteAddr: "10.1.2.3:5678",
+			headers: map[string][]string{
+				"Forwarded": {`for=_hidden`},
+			},
+			ip: "10.1.2.3",
+		},
+	}
+
+	for _, test := range tests {
+		t.Run(test.name, func(t *testing.T) {
+			request := &http.Request{
+				RemoteAddr: test.remoteAddr,
+				Header:     http.Header(test.headers),
+			}
+			ip, err := service.sourceIP(request)
+			if test.err != "" {
+				require.EqualError(t, err, test.err)
+			} else {
+				require.NoError(t, err)
+				require.Equal(t, test.ip, ip.String())
+			}
+		})
+	}
+}
+
+func TestParseTrustedProxies(t *testing.T) {
+	tests := []struct {
+		name           string
+		trustedProxies []string
+		res            []string
+		err            string
+	}{
+		{
+			name: "Nil",
+			res:  []string{},
+		},
+		{
+			name:           "Invalid",
+			trustedProxies: []string{"bad"},
+			err:            `invalid trusted proxy "bad"`,
+		},
+		{
+			name:           "CIDRInvalid",
+			trustedProxies: []string{"10.0.0.0/33"},
+			err:            `invalid trusted proxy "10.0.0.0/33"`,
+		},
+		{
+			name:           "Good",
+			trustedProxies: []string{"10.0.0.0/8", "192.168.1.1", "::1"},
+			res:            []string{"10.0.0.0/8", "192.168.1.1/32", "::1/128"},
+		},
+	}
+
+	for _, test := range tests {
+		t.Run(test.name, func(t *testing.T) {
+			res, err := parseTrustedProxies(test.trustedProxies)
+			if test.err != "" {
+				require.EqualError(t, err, test.err)
+			} else {
+				require.NoError(t, err)
+				nets := make([]string, 0, len(res))
+				for _, ipNet := range res {
+					nets = append(nets, ipNet.String())
+				}
+				require.Equal(t, test.res, nets)
+			}
+		})
+	}
+}
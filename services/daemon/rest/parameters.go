@@ -14,7 +14,10 @@
 package rest
 
 import (
+	"crypto/tls"
+	"crypto/x509"
 	"errors"
+	"net"
 
 	"github.com/rs/zerolog"
 	"github.com/wealdtech/probed/services/metrics"
@@ -22,15 +25,41 @@ import (
 	"github.com/wealdtech/probed/services/probedb"
 )
 
+// BatchSetter defines the functions required to write all types of record in a single transaction.
+type BatchSetter interface {
+	probedb.BlockDelaysSetter
+	probedb.HeadDelaysSetter
+	probedb.AggregateAttestationsSetter
+	probedb.AttestationSummariesSetter
+}
+
 type parameters struct {
 	logLevel                      zerolog.Level
 	monitor                       metrics.Service
 	serverName                    string
+	tlsMode                       TLSMode
+	autocertCacheDir              string
+	serverCert                    []byte
+	serverKey                     []byte
+	serverCertificate             *tls.Certificate
+	clientCACert                  []byte
+	clientCAs                     *x509.CertPool
 	listenAddress                 string
 	blockDelaysSetter             probedb.BlockDelaysSetter
 	headDelaysSetter              probedb.HeadDelaysSetter
 	aggregationAttestationsSetter probedb.AggregateAttestationsSetter
 	attestationSummariesSetter    probedb.AttestationSummariesSetter
+	batchSetter                   BatchSetter
+	blockDelaysProvider           probedb.BlockDelaysProvider
+	headDelaysProvider            probedb.HeadDelaysProvider
+	blockDelayStatisticsProvider  probedb.BlockDelayStatisticsProvider
+	headDelayStatisticsProvider   probedb.HeadDelayStatisticsProvider
+	aggregateAttestationsProvider probedb.AggregateAttestationsProvider
+	attestationSummariesProvider  probedb.AttestationSummariesProvider
+	apiKeys                       map[string]string
+	trustedProxies                []string
+	trustedProxyNets              []*net.IPNet
+	slotsPerEpoch                 uint32
 }
 
 // Parameter is the interface for service parameters.
@@ -65,6 +94,43 @@ func WithServerName(name string) Parameter {
 	})
 }
 
+// WithTLSMode sets the TLS mode for this module.
+func WithTLSMode(tlsMode TLSMode) Parameter {
+	return parameterFunc(func(p *parameters) {
+		p.tlsMode = tlsMode
+	})
+}
+
+// WithAutocertCacheDir sets the directory in which certificates are cached in autocert mode.
+func WithAutocertCacheDir(dir string) Parameter {
+	return parameterFunc(func(p *parameters) {
+		p.autocertCacheDir = dir
+	})
+}
+
+// WithServerCert sets the PEM-encoded server certificate for static mode.
+func WithServerCert(cert []byte) Parameter {
+	return parameterFunc(func(p *parameters) {
+		p.serverCert = cert
+	})
+}
+
+// WithServerKey sets the PEM-encoded server key for static mode.
+func WithServerKey(key []byte) Parameter {
+	return parameterFunc(func(p *parameters) {
+		p.serverKey = key
+	})
+}
+
+// WithClientCACert sets the PEM-encoded certificate authority for client certificates.
+// If supplied then clients must present a certificate signed by the authority, and the
+// identity in the certificate is used as the prober identity.
+func WithClientCACert(cert []byte) Parameter {
+	return parameterFunc(func(p *parameters) {
+		p.clientCACert = cert
+	})
+}
+
 // WithListenAddress sets the listen address for this module.
 func WithListenAddress(listenAddress string) Parameter {
 	return parameterFunc(func(p *parameters) {
@@ -100,11 +166,94 @@ func WithAttestationSummariesSetter(setter probedb.AttestationSummariesSetter) P
 	})
 }
 
+// WithBatchSetter sets the setter for batches, which must write records within the
+// transactions that it begins rather than queueing them.
+// If not supplied then the block delays setter is used, if it can set all types of record.
+func WithBatchSetter(setter BatchSetter) Parameter {
+	return parameterFunc(func(p *parameters) {
+		p.batchSetter = setter
+	})
+}
+
+// WithBlockDelaysProvider sets the block delays provider for this module.
+// If not supplied then block delays cannot be read through the API.
+func WithBlockDelaysProvider(provider probedb.BlockDelaysProvider) Parameter {
+	return parameterFunc(func(p *parameters) {
+		p.blockDelaysProvider = provider
+	})
+}
+
+// WithHeadDelaysProvider sets the head delays provider for this module.
+// If not supplied then head delays cannot be read through the API.
+func WithHeadDelaysProvider(provider probedb.HeadDelaysProvider) Parameter {
+	return parameterFunc(func(p *parameters) {
+		p.headDelaysProvider = provider
+	})
+}
+
+// WithBlockDelayStatisticsProvider sets the block delay statistics provider for this module.
+// If not supplied then block delay statistics cannot be read through the API.
+func WithBlockDelayStatisticsProvider(provider probedb.BlockDelayStatisticsProvider) Parameter {
+	return parameterFunc(func(p *parameters) {
+		p.blockDelayStatisticsProvider = provider
+	})
+}
+
+// WithHeadDelayStatisticsProvider sets the head delay statistics provider for this module.
+// If not supplied then head delay statistics cannot be read through the API.
+func WithHeadDelayStatisticsProvider(provider probedb.HeadDelayStatisticsProvider) Parameter {
+	return parameterFunc(func(p *parameters) {
+		p.headDelayStatisticsProvider = provider
+	})
+}
+
+// WithAggregateAttestationsProvider sets the aggregate attestations provider for this module.
+// If not supplied then aggregate attestations cannot be read through the API.
+func WithAggregateAttestationsProvider(provider probedb.AggregateAttestationsProvider) Parameter {
+	return parameterFunc(func(p *parameters) {
+		p.aggregateAttestationsProvider = provider
+	})
+}
+
+// WithAttestationSummariesProvider sets the attestation summaries provider for this module.
+// If not supplied then attestation summaries cannot be read through the API.
+func WithAttestationSummariesProvider(provider probedb.AttestationSummariesProvider) Parameter {
+	return parameterFunc(func(p *parameters) {
+		p.attestationSummariesProvider = provider
+	})
+}
+
+// WithAPIKeys sets the API keys for this module, as a map of key to prober name.
+// If not supplied then submissions are not authenticated.
+func WithAPIKeys(apiKeys map[string]string) Parameter {
+	return parameterFunc(func(p *parameters) {
+		p.apiKeys = apiKeys
+	})
+}
+
+// WithTrustedProxies sets the trusted proxies for this module, as a list of CIDRs or IP addresses.
+// Forwarding headers are only honoured for requests that arrive directly from a trusted proxy.
+func WithTrustedProxies(trustedProxies []string) Parameter {
+	return parameterFunc(func(p *parameters) {
+		p.trustedProxies = trustedProxies
+	})
+}
+
+// WithSlotsPerEpoch sets the number of slots in an epoch of the chain, used when
+// grouping delay statistics by epoch.
+// If not supplied then the mainnet value is used.
+func WithSlotsPerEpoch(slots uint32) Parameter {
+	return parameterFunc(func(p *parameters) {
+		p.slotsPerEpoch = slots
+	})
+}
+
 // parseAndCheckParameters parses and checks parameters to ensure that mandatory parameters are present and correct.
 func parseAndCheckParameters(params ...Parameter) (*parameters, error) {
 	parameters := parameters{
-		logLevel: zerolog.GlobalLevel(),
-		monitor:  nullmetrics.New(),
+		logLevel:         zerolog.GlobalLevel(),
+		monitor:          nullmetrics.New(),
+		autocertCacheDir: "./certs",
 	}
 	for _, p := range params {
 		if params != nil {
@@ -115,8 +264,38 @@ func parseAndCheckParameters(params ...Parameter) (*parameters, error) {
 	if parameters.monitor == nil {
 		return nil, errors.New("no monitor specified")
 	}
-	if parameters.serverName == "" {
-		return nil, errors.New("no server name specified")
+	switch parameters.tlsMode {
+	case TLSModeAutocert:
+		if parameters.serverName == "" {
+			return nil, errors.New("no server name specified")
+		}
+		if parameters.autocertCacheDir == "" {
+			return nil, errors.New("no autocert cache directory specified")
+		}
+	case TLSModeStatic:
+		if len(parameters.serverCert) == 0 {
+			return nil, errors.New("no server certificate specified")
+		}
+		if len(parameters.serverKey) == 0 {
+			return nil, errors.New("no server key specified")
+		}
+		serverCertificate, err := tls.X509KeyPair(parameters.serverCert, parameters.serverKey)
+		if err != nil {
+			return nil, errors.New("invalid server certificate or key")
+		}
+		parameters.serverCertificate = &serverCertificate
+	case TLSModePlain:
+		if len(parameters.clientCACert) > 0 {
+			return nil, errors.New("client certificates cannot be used without TLS")
+		}
+	default:
+		return nil, errors.New("unknown TLS mode specified")
+	}
+	if len(parameters.clientCACert) > 0 {
+		parameters.clientCAs = x509.NewCertPool()
+		if !parameters.clientCAs.AppendCertsFromPEM(parameters.clientCACert) {
+			return nil, errors.New("invalid client certificate authority certificate")
+		}
 	}
 	if parameters.listenAddress == "" {
 		return nil, errors.New("no listen address specified")
@@ -133,6 +312,27 @@ func parseAndCheckParameters(params ...Parameter) (*parameters, error) {
 	if parameters.attestationSummariesSetter == nil {
 		return nil, errors.New("no attestation summaries setter specified")
 	}
+	if parameters.batchSetter == nil {
+		batchSetter, isBatchSetter := parameters.blockDelaysSetter.(BatchSetter)
+		if !isBatchSetter {
+			return nil, errors.New("no batch setter specified")
+		}
+		parameters.batchSetter = batchSetter
+	}
+	for key, prober := range parameters.apiKeys {
+		if key == "" {
+			return nil, errors.New("empty API key specified")
+		}
+		if prober == "" {
+			return nil, errors.New("API key specified without prober")
+		}
+	}
+
+	var err error
+	parameters.trustedProxyNets, err = parseTrustedProxies(parameters.trustedProxies)
+	if err != nil {
+		return nil, err
+	}
 
 	return &parameters, nil
 }
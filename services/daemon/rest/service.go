@@ -16,6 +16,7 @@ package rest
 import (
 	"context"
 	"crypto/tls"
+	"net"
 	"net/http"
 	"os"
 	"os/signal"
@@ -34,11 +35,21 @@ import (
 
 // Service is the REST daemon service.
 type Service struct {
-	srv                         *http.Server
-	blockDelaysSetter           probedb.BlockDelaysSetter
-	headDelaysSetter            probedb.HeadDelaysSetter
-	aggregateAttestationsSetter probedb.AggregateAttestationsSetter
-	attestationSummariesSetter  probedb.AttestationSummariesSetter
+	srv                           *http.Server
+	blockDelaysSetter             probedb.BlockDelaysSetter
+	headDelaysSetter              probedb.HeadDelaysSetter
+	aggregateAttestationsSetter   probedb.AggregateAttestationsSetter
+	attestationSummariesSetter    probedb.AttestationSummariesSetter
+	batchSetter                   BatchSetter
+	blockDelaysProvider           probedb.BlockDelaysProvider
+	headDelaysProvider            probedb.HeadDelaysProvider
+	blockDelayStatisticsProvider  probedb.BlockDelayStatisticsProvider
+	headDelayStatisticsProvider   probedb.HeadDelayStatisticsProvider
+	aggregateAttestationsProvider probedb.AggregateAttestationsProvider
+	attestationSummariesProvider  probedb.AttestationSummariesProvider
+	apiKeys                       []*apiKey
+	trustedProxies                []*net.IPNet
+	slotsPerEpoch                 uint32
 }
 
 // module-wide log.
@@ -62,10 +73,26 @@ func New(ctx context.Context, params ...Parameter) (*Service, error) {
 	}
 
 	s := &Service{
-		blockDelaysSetter:           parameters.blockDelaysSetter,
-		headDelaysSetter:            parameters.headDelaysSetter,
-		aggregateAttestationsSetter: parameters.aggregationAttestationsSetter,
-		attestationSummariesSetter:  parameters.attestationSummariesSetter,
+		blockDelaysSetter:             parameters.blockDelaysSetter,
+		headDelaysSetter:              parameters.headDelaysSetter,
+		aggregateAttestationsSetter:   parameters.aggregationAttestationsSetter,
+		attestationSummariesSetter:    parameters.attestationSummariesSetter,
+		batchSetter:                   parameters.batchSetter,
+		blockDelaysProvider:           parameters.blockDelaysProvider,
+		headDelaysProvider:            parameters.headDelaysProvider,
+		blockDelayStatisticsProvider:  parameters.blockDelayStatisticsProvider,
+		headDelayStatisticsProvider:   parameters.headDelayStatisticsProvider,
+		aggregateAttestationsProvider: parameters.aggregateAttestationsProvider,
+		attestationSummariesProvider:  parameters.attestationSummariesProvider,
+		apiKeys:                       make([]*apiKey, 0, len(parameters.apiKeys)),
+		trustedProxies:                parameters.trustedProxyNets,
+		slotsPerEpoch:                 parameters.slotsPerEpoch,
+	}
+	for key, prober := range parameters.apiKeys {
+		s.apiKeys = append(s.apiKeys, &apiKey{
+			key:    []byte(key),
+			prober: prober,
+		})
 	}
 
 	// Set to release mode to remove debug logging.
@@ -79,40 +106,58 @@ func New(ctx context.Context, params ...Parameter) (*Service, error) {
 	}
 	r.Use(loggers.NewGinLogger(log))
 
-	certManager := autocert.Manager{
-		Prompt:     autocert.AcceptTOS,
-		HostPolicy: autocert.HostWhitelist(parameters.serverName),
-		Cache:      autocert.DirCache("./certs"),
-	}
-
 	router := mux.NewRouter()
-	router.HandleFunc("/v1/blockdelay", s.postBlockDelay).Methods("POST")
-	router.HandleFunc("/v1/headdelay", s.postHeadDelay).Methods("POST")
-	router.HandleFunc("/v1/aggregateattestation", s.postAggregateAttestation).Methods("POST")
-	router.HandleFunc("/v1/attestationsummary", s.postAttestationSummary).Methods("POST")
+	submitRouter := router.Methods("POST").Subrouter()
+	submitRouter.Use(s.authenticate)
+	submitRouter.HandleFunc("/v1/blockdelay", s.postBlockDelay)
+	submitRouter.HandleFunc("/v1/headdelay", s.postHeadDelay)
+	submitRouter.HandleFunc("/v1/aggregateattestation", s.postAggregateAttestation)
+	submitRouter.HandleFunc("/v1/attestationsummary", s.postAttestationSummary)
+	submitRouter.HandleFunc("/v1/batch", s.postBatch)
+	if s.blockDelaysProvider != nil {
+		router.HandleFunc("/v1/blockdelays", s.getBlockDelays).Methods("GET")
+	}
+	if s.headDelaysProvider != nil {
+		router.HandleFunc("/v1/headdelays", s.getHeadDelays).Methods("GET")
+	}
+	if s.blockDelayStatisticsProvider != nil {
+		router.HandleFunc("/v1/blockdelaystatistics", s.getBlockDelayStatistics).Methods("GET")
+	}
+	if s.headDelayStatisticsProvider != nil {
+		router.HandleFunc("/v1/headdelaystatistics", s.getHeadDelayStatistics).Methods("GET")
+	}
+	if s.aggregateAttestationsProvider != nil {
+		router.HandleFunc("/v1/aggregateattestations", s.getAggregateAttestations).Methods("GET")
+	}
+	if s.attestationSummariesProvider != nil {
+		router.HandleFunc("/v1/attestationsummaries", s.getAttestationSummaries).Methods("GET")
+	}
 
 	s.srv = &http.Server{
 		Addr:              parameters.listenAddress,
 		Handler:           router,
 		ReadHeaderTimeout: 20 * time.Second,
-		TLSConfig: &tls.Config{
-			MinVersion:               tls.VersionTLS13,
-			CurvePreferences:         []tls.CurveID{tls.CurveP521, tls.CurveP384, tls.CurveP256},
-			GetCertificate:           certManager.GetCertificate,
-			PreferServerCipherSuites: true,
-			CipherSuites: []uint16{
-				tls.TLS_AES_128_GCM_SHA256,
-				tls.TLS_CHACHA20_POLY1305_SHA256,
-				tls.TLS_AES_256_GCM_SHA384,
-				tls.TLS_ECDHE_ECDSA_WITH_AES_128_GCM_SHA256,
-				tls.TLS_ECDHE_ECDSA_WITH_AES_256_GCM_SHA384,
-				tls.TLS_ECDHE_ECDSA_WITH_CHACHA20_POLY1305_SHA256,
-				tls.TLS_ECDHE_RSA_WITH_AES_128_GCM_SHA256,
-				tls.TLS_ECDHE_RSA_WITH_AES_256_GCM_SHA384,
-				tls.TLS_ECDHE_RSA_WITH_CHACHA20_POLY1305_SHA256,
-			},
-		},
-		TLSNextProto: make(map[string]func(*http.Server, *tls.Conn, http.Handler)),
+	}
+
+	switch parameters.tlsMode {
+	case TLSModeAutocert:
+		certManager := &autocert.Manager{
+			Prompt:     autocert.AcceptTOS,
+			HostPolicy: autocert.HostWhitelist(parameters.serverName),
+			Cache:      autocert.DirCache(parameters.autocertCacheDir),
+		}
+		s.srv.TLSConfig = tlsConfig()
+		s.srv.TLSConfig.GetCertificate = certManager.GetCertificate
+		s.srv.TLSNextProto = make(map[string]func(*http.Server, *tls.Conn, http.Handler))
+		startCertificateUpdates(certManager)
+	case TLSModeStatic:
+		s.srv.TLSConfig = tlsConfig()
+		s.srv.TLSConfig.Certificates = []tls.Certificate{*parameters.serverCertificate}
+		s.srv.TLSNextProto = make(map[string]func(*http.Server, *tls.Conn, http.Handler))
+	}
+	if s.srv.TLSConfig != nil && parameters.clientCAs != nil {
+		s.srv.TLSConfig.ClientCAs = parameters.clientCAs
+		s.srv.TLSConfig.ClientAuth = tls.RequireAndVerifyClientCert
 	}
 
 	go func() {
@@ -129,9 +174,46 @@ func New(ctx context.Context, params ...Parameter) (*Service, error) {
 		}
 	}()
 
-	// Listen on HTTP port for certificate updates.
 	go func() {
-		log.Trace().Str("listen_address", parameters.listenAddress).Msg("Starting certificate update service")
+		log.Trace().Str("listen_address", parameters.listenAddress).Stringer("tls_mode", parameters.tlsMode).Msg("Starting daemon")
+		var err error
+		if s.srv.TLSConfig == nil {
+			err = s.srv.ListenAndServe()
+		} else {
+			err = s.srv.ListenAndServeTLS("", "")
+		}
+		if err != http.ErrServerClosed {
+			log.Error().Err(err).Msg("Server shut down unexpectedly")
+		}
+	}()
+
+	return s, nil
+}
+
+// tlsConfig returns the base TLS configuration for the server.
+func tlsConfig() *tls.Config {
+	return &tls.Config{
+		MinVersion:               tls.VersionTLS13,
+		CurvePreferences:         []tls.CurveID{tls.CurveP521, tls.CurveP384, tls.CurveP256},
+		PreferServerCipherSuites: true,
+		CipherSuites: []uint16{
+			tls.TLS_AES_128_GCM_SHA256,
+			tls.TLS_CHACHA20_POLY1305_SHA256,
+			tls.TLS_AES_256_GCM_SHA384,
+			tls.TLS_ECDHE_ECDSA_WITH_AES_128_GCM_SHA256,
+			tls.TLS_ECDHE_ECDSA_WITH_AES_256_GCM_SHA384,
+			tls.TLS_ECDHE_ECDSA_WITH_CHACHA20_POLY1305_SHA256,
+			tls.TLS_ECDHE_RSA_WITH_AES_128_GCM_SHA256,
+			tls.TLS_ECDHE_RSA_WITH_AES_256_GCM_SHA384,
+			tls.TLS_ECDHE_RSA_WITH_CHACHA20_POLY1305_SHA256,
+		},
+	}
+}
+
+// startCertificateUpdates listens on the HTTP port for ACME challenges.
+func startCertificateUpdates(certManager *autocert.Manager) {
+	go func() {
+		log.Trace().Msg("Starting certificate update service")
 		server := &http.Server{
 			Addr:              ":http",
 			Handler:           certManager.HTTPHandler(nil),
@@ -141,13 +223,4 @@ func New(ctx context.Context, params ...Parameter) (*Service, error) {
 			log.Error().Err(err).Msg("Certificate update service stopped")
 		}
 	}()
-
-	go func() {
-		log.Trace().Str("listen_address", parameters.listenAddress).Msg("Starting daemon")
-		if err := s.srv.ListenAndServeTLS("", ""); err != http.ErrServerClosed {
-			log.Error().Err(err).Msg("Server shut down unexpectedly")
-		}
-	}()
-
-	return s, nil
 }
@@ -15,7 +15,15 @@ package rest_test
 
 import (
 	"context"
+	"crypto/ecdsa"
+	"crypto/elliptic"
+	"crypto/rand"
+	"crypto/x509"
+	"crypto/x509/pkix"
+	"encoding/pem"
+	"math/big"
 	"testing"
+	"time"
 
 	"github.com/rs/zerolog"
 	"github.com/stretchr/testify/require"
@@ -28,6 +36,7 @@ func TestService(t *testing.T) {
 	ctx := context.Background()
 	probeDB := mockprobedb.New()
 	monitor := nullmetrics.New()
+	serverCert, serverKey := generateServerCert(t)
 
 	tests := []struct {
 		name   string
@@ -126,6 +135,202 @@ func TestService(t *testing.T) {
 			},
 			err: "problem with parameters: no attestation summaries setter specified",
 		},
+		{
+			name: "APIKeyEmpty",
+			params: []restdaemon.Parameter{
+				restdaemon.WithLogLevel(zerolog.Disabled),
+				restdaemon.WithMonitor(monitor),
+				restdaemon.WithServerName("server.wealdtech.com"),
+				restdaemon.WithListenAddress(":14734"),
+				restdaemon.WithBlockDelaysSetter(probeDB),
+				restdaemon.WithHeadDelaysSetter(probeDB),
+				restdaemon.WithAggregateAttestationsSetter(probeDB),
+				restdaemon.WithAttestationSummariesSetter(probeDB),
+				restdaemon.WithAPIKeys(map[string]string{"": "prober1"}),
+			},
+			err: "problem with parameters: empty API key specified",
+		},
+		{
+			name: "APIKeyProberMissing",
+			params: []restdaemon.Parameter{
+				restdaemon.WithLogLevel(zerolog.Disabled),
+				restdaemon.WithMonitor(monitor),
+				restdaemon.WithServerName("server.wealdtech.com"),
+				restdaemon.WithListenAddress(":14734"),
+				restdaemon.WithBlockDelaysSetter(probeDB),
+				restdaemon.WithHeadDelaysSetter(probeDB),
+				restdaemon.WithAggregateAttestationsSetter(probeDB),
+				restdaemon.WithAttestationSummariesSetter(probeDB),
+				restdaemon.WithAPIKeys(map[string]string{"key1": ""}),
+			},
+			err: "problem with parameters: API key specified without prober",
+		},
+		{
+			name: "TrustedProxiesInvalid",
+			params: []restdaemon.Parameter{
+				restdaemon.WithLogLevel(zerolog.Disabled),
+				restdaemon.WithMonitor(monitor),
+				restdaemon.WithServerName("server.wealdtech.com"),
+				restdaemon.WithListenAddress(":14734"),
+				restdaemon.WithBlockDelaysSetter(probeDB),
+				restdaemon.WithHeadDelaysSetter(probeDB),
+				restdaemon.WithAggregateAttestationsSetter(probeDB),
+				restdaemon.WithAttestationSummariesSetter(probeDB),
+				restdaemon.WithTrustedProxies([]string{"bad"}),
+			},
+			err: "problem with parameters: invalid trusted proxy \"bad\"",
+		},
+		{
+			name: "AutocertCacheDirMissing",
+			params: []restdaemon.Parameter{
+				restdaemon.WithLogLevel(zerolog.Disabled),
+				restdaemon.WithMonitor(monitor),
+				restdaemon.WithListenAddress(":14734"),
+				restdaemon.WithBlockDelaysSetter(probeDB),
+				restdaemon.WithHeadDelaysSetter(probeDB),
+				restdaemon.WithAggregateAttestationsSetter(probeDB),
+				restdaemon.WithAttestationSummariesSetter(probeDB),
+				restdaemon.WithServerName("server.wealdtech.com"),
+				restdaemon.WithAutocertCacheDir(""),
+			},
+			err: "problem with parameters: no autocert cache directory specified",
+		},
+		{
+			name: "TLSModeUnknown",
+			params: []restdaemon.Parameter{
+				restdaemon.WithLogLevel(zerolog.Disabled),
+				restdaemon.WithMonitor(monitor),
+				restdaemon.WithListenAddress(":14734"),
+				restdaemon.WithBlockDelaysSetter(probeDB),
+				restdaemon.WithHeadDelaysSetter(probeDB),
+				restdaemon.WithAggregateAttestationsSetter(probeDB),
+				restdaemon.WithAttestationSummariesSetter(probeDB),
+				restdaemon.WithTLSMode(restdaemon.TLSMode(99)),
+			},
+			err: "problem with parameters: unknown TLS mode specified",
+		},
+		{
+			name: "StaticServerCertMissing",
+			params: []restdaemon.Parameter{
+				restdaemon.WithLogLevel(zerolog.Disabled),
+				restdaemon.WithMonitor(monitor),
+				restdaemon.WithListenAddress(":14734"),
+				restdaemon.WithBlockDelaysSetter(probeDB),
+				restdaemon.WithHeadDelaysSetter(probeDB),
+				restdaemon.WithAggregateAttestationsSetter(probeDB),
+				restdaemon.WithAttestationSummariesSetter(probeDB),
+				restdaemon.WithTLSMode(restdaemon.TLSModeStatic),
+				restdaemon.WithServerKey(serverKey),
+			},
+			err: "problem with parameters: no server certificate specified",
+		},
+		{
+			name: "StaticServerKeyMissing",
+			params: []restdaemon.Parameter{
+				restdaemon.WithLogLevel(zerolog.Disabled),
+				restdaemon.WithMonitor(monitor),
+				restdaemon.WithListenAddress(":14734"),
+				restdaemon.WithBlockDelaysSetter(probeDB),
+				restdaemon.WithHeadDelaysSetter(probeDB),
+				restdaemon.WithAggregateAttestationsSetter(probeDB),
+				restdaemon.WithAttestationSummariesSetter(probeDB),
+				restdaemon.WithTLSMode(restdaemon.TLSModeStatic),
+				restdaemon.WithServerCert(serverCert),
+			},
+			err: "problem with parameters: no server key specified",
+		},
+		{
+			name: "StaticServerKeyInvalid",
+			params: []restdaemon.Parameter{
+				restdaemon.WithLogLevel(zerolog.Disabled),
+				restdaemon.WithMonitor(monitor),
+				restdaemon.WithListenAddress(":14734"),
+				restdaemon.WithBlockDelaysSetter(probeDB),
+				restdaemon.WithHeadDelaysSetter(probeDB),
+				restdaemon.WithAggregateAttestationsSetter(probeDB),
+				restdaemon.WithAttestationSummariesSetter(probeDB),
+				restdaemon.WithTLSMode(restdaemon.TLSModeStatic),
+				restdaemon.WithServerCert(serverCert),
+				restdaemon.WithServerKey([]byte("bad")),
+			},
+			err: "problem with parameters: invalid server certificate or key",
+		},
+		{
+			name: "Static",
+			params: []restdaemon.Parameter{
+				restdaemon.WithLogLevel(zerolog.Disabled),
+				restdaemon.WithMonitor(monitor),
+				restdaemon.WithListenAddress(":14734"),
+				restdaemon.WithBlockDelaysSetter(probeDB),
+				restdaemon.WithHeadDelaysSetter(probeDB),
+				restdaemon.WithAggregateAttestationsSetter(probeDB),
+				restdaemon.WithAttestationSummariesSetter(probeDB),
+				restdaemon.WithTLSMode(restdaemon.TLSModeStatic),
+				restdaemon.WithServerCert(serverCert),
+				restdaemon.WithServerKey(serverKey),
+			},
+		},
+		{
+			name: "Plain",
+			params: []restdaemon.Parameter{
+				restdaemon.WithLogLevel(zerolog.Disabled),
+				restdaemon.WithMonitor(monitor),
+				restdaemon.WithListenAddress(":14734"),
+				restdaemon.WithBlockDelaysSetter(probeDB),
+				restdaemon.WithHeadDelaysSetter(probeDB),
+				restdaemon.WithAggregateAttestationsSetter(probeDB),
+				restdaemon.WithAttestationSummariesSetter(probeDB),
+				restdaemon.WithTLSMode(restdaemon.TLSModePlain),
+			},
+		},
+		{
+			name: "PlainClientCACert",
+			params: []restdaemon.Parameter{
+				restdaemon.WithLogLevel(zerolog.Disabled),
+				restdaemon.WithMonitor(monitor),
+				restdaemon.WithListenAddress(":14734"),
+				restdaemon.WithBlockDelaysSetter(probeDB),
+				restdaemon.WithHeadDelaysSetter(probeDB),
+				restdaemon.WithAggregateAttestationsSetter(probeDB),
+				restdaemon.WithAttestationSummariesSetter(probeDB),
+				restdaemon.WithTLSMode(restdaemon.TLSModePlain),
+				restdaemon.WithClientCACert(serverCert),
+			},
+			err: "problem with parameters: client certificates cannot be used without TLS",
+		},
+		{
+			name: "ClientCACertInvalid",
+			params: []restdaemon.Parameter{
+				restdaemon.WithLogLevel(zerolog.Disabled),
+				restdaemon.WithMonitor(monitor),
+				restdaemon.WithListenAddress(":14734"),
+				restdaemon.WithBlockDelaysSetter(probeDB),
+				restdaemon.WithHeadDelaysSetter(probeDB),
+				restdaemon.WithAggregateAttestationsSetter(probeDB),
+				restdaemon.WithAttestationSummariesSetter(probeDB),
+				restdaemon.WithTLSMode(restdaemon.TLSModeStatic),
+				restdaemon.WithServerCert(serverCert),
+				restdaemon.WithServerKey(serverKey),
+				restdaemon.WithClientCACert([]byte("bad")),
+			},
+			err: "problem with parameters: invalid client certificate authority certificate",
+		},
+		{
+			name: "StaticClientCACert",
+			params: []restdaemon.Parameter{
+				restdaemon.WithLogLevel(zerolog.Disabled),
+				restdaemon.WithMonitor(monitor),
+				restdaemon.WithListenAddress(":14734"),
+				restdaemon.WithBlockDelaysSetter(probeDB),
+				restdaemon.WithHeadDelaysSetter(probeDB),
+				restdaemon.WithAggregateAttestationsSetter(probeDB),
+				restdaemon.WithAttestationSummariesSetter(probeDB),
+				restdaemon.WithTLSMode(restdaemon.TLSModeStatic),
+				restdaemon.WithServerCert(serverCert),
+				restdaemon.WithServerKey(serverKey),
+				restdaemon.WithClientCACert(serverCert),
+			},
+		},
 		{
 			name: "Good",
 			params: []restdaemon.Parameter{
@@ -152,3 +357,27 @@ func TestService(t *testing.T) {
 		})
 	}
 }
+
+// generateServerCert generates a self-signed PEM-encoded certificate and key.
+func generateServerCert(t *testing.T) ([]byte, []byte) {
+	t.Helper()
+
+	key, err := ecdsa.GenerateKey(elliptic.P256(), rand.Reader)
+	require.NoError(t, err)
+	template := &x509.Certificate{
+		SerialNumber: big.NewInt(1),
+		Subject:      pkix.Name{CommonName: "server.wealdtech.com"},
+		DNSNames:     []string{"server.wealdtech.com"},
+		NotBefore:    time.Now().Add(-time.Hour),
+		NotAfter:     time.Now().Add(time.Hour),
+		KeyUsage:     x509.KeyUsageDigitalSignature,
+		ExtKeyUsage:  []x509.ExtKeyUsage{x509.ExtKeyUsageServerAuth},
+	}
+	der, err := x509.CreateCertificate(rand.Reader, template, template, &key.PublicKey, key)
+	require.NoError(t, err)
+	keyDER, err := x509.MarshalECPrivateKey(key)
+	require.NoError(t, err)
+
+	return pem.EncodeToMemory(&pem.Block{Type: "CERTIFICATE", Bytes: der}),
+		pem.EncodeToMemory(&pem.Block{Type: "EC PRIVATE KEY", Bytes: keyDER})
+}
@@ -0,0 +1,56 @@
+// Copyright © 2023 Weald Technology Trading.
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package rest
+
+import (
+	"math"
+	"net/http"
+	"strconv"
+
+	"github.com/pkg/errors"
+	"github.com/wealdtech/probed/services/probedb"
+)
+
+// writeStorageError writes the response for a failure to store data.
+// If the database is temporarily unavailable then the response tells the
+// client when to retry, otherwise it is an internal server error.
+func writeStorageError(w http.ResponseWriter, err error) {
+	var unavailableErr *probedb.UnavailableError
+	if !errors.As(err, &unavailableErr) {
+		w.WriteHeader(http.StatusInternalServerError)
+		return
+	}
+
+	retryAfter := int(math.Ceil(unavailableErr.RetryAfter.Seconds()))
+	if retryAfter < 1 {
+		retryAfter = 1
+	}
+	w.Header().Set("Retry-After", strconv.Itoa(retryAfter))
+	w.WriteHeader(http.StatusServiceUnavailable)
+}
+
+// actionStatusCode returns the status code of the response for a record that
+// was stored with the given action.
+// A record that was created returns 201, one that duplicated an existing record
+// returns 200, and one that was queued to be written later returns 202.
+func actionStatusCode(action probedb.Action) int {
+	switch action {
+	case probedb.ActionIgnored, probedb.ActionUpdated:
+		return http.StatusOK
+	case probedb.ActionQueued:
+		return http.StatusAccepted
+	default:
+		return http.StatusCreated
+	}
+}
@@ -0,0 +1,102 @@
+// Copyright © 2023 Weald Technology Trading.
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package rest
+
+import (
+	"net/http"
+	"net/http/httptest"
+	"testing"
+	"time"
+
+	"github.com/pkg/errors"
+	"github.com/stretchr/testify/require"
+	"github.com/wealdtech/probed/services/probedb"
+)
+
+func TestWriteStorageError(t *testing.T) {
+	tests := []struct {
+		name       string
+		err        error
+		status     int
+		retryAfter string
+	}{
+		{
+			name:   "Internal",
+			err:    errors.New("failed"),
+			status: http.StatusInternalServerError,
+		},
+		{
+			name:       "Unavailable",
+			err:        &probedb.UnavailableError{RetryAfter: 29500 * time.Millisecond},
+			status:     http.StatusServiceUnavailable,
+			retryAfter: "30",
+		},
+		{
+			name:       "UnavailableWrapped",
+			err:        errors.Wrap(&probedb.UnavailableError{RetryAfter: 5 * time.Second}, "failed"),
+			status:     http.StatusServiceUnavailable,
+			retryAfter: "5",
+		},
+		{
+			name:       "UnavailableImminent",
+			err:        &probedb.UnavailableError{RetryAfter: time.Millisecond},
+			status:     http.StatusServiceUnavailable,
+			retryAfter: "1",
+		},
+	}
+
+	for _, test := range tests {
+		t.Run(test.name, func(t *testing.T) {
+			w := httptest.NewRecorder()
+			writeStorageError(w, test.err)
+			require.Equal(t, test.status, w.Code)
+			require.Equal(t, test.retryAfter, w.Header().Get("Retry-After"))
+		})
+	}
+}
+
+func TestActionStatusCode(t *testing.T) {
+	tests := []struct {
+		name   string
+		action probedb.Action
+		status int
+	}{
+		{
+			name:   "Created",
+			action: probedb.ActionCreated,
+			status: http.StatusCreated,
+		},
+		{
+			name:   "Ignored",
+			action: probedb.ActionIgnored,
+			status: http.StatusOK,
+		},
+		{
+			name:   "Queued",
+			action: probedb.ActionQueued,
+			status: http.StatusAccepted,
+		},
+		{
+			name:   "Updated",
+			action: probedb.ActionUpdated,
+			status: http.StatusOK,
+		},
+	}
+
+	for _, test := range tests {
+		t.Run(test.name, func(t *testing.T) {
+			require.Equal(t, test.status, actionStatusCode(test.action))
+		})
+	}
+}
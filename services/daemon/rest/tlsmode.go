@@ -0,0 +1,62 @@
+// Copyright © 2023 Weald Technology Trading.
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package rest
+
+import (
+	"strings"
+
+	"github.com/pkg/errors"
+)
+
+// TLSMode is the mode in which the daemon serves requests.
+type TLSMode uint8
+
+const (
+	// TLSModeAutocert serves TLS with certificates obtained automatically from Let's Encrypt.
+	TLSModeAutocert TLSMode = iota
+	// TLSModeStatic serves TLS with a supplied certificate and key.
+	TLSModeStatic
+	// TLSModePlain serves plain HTTP, for example behind a TLS-terminating load balancer.
+	TLSModePlain
+)
+
+var tlsModeStrings = [...]string{
+	"autocert",
+	"static",
+	"plain",
+}
+
+// String returns the string representation of the TLS mode.
+func (m TLSMode) String() string {
+	if int(m) >= len(tlsModeStrings) {
+		return "unknown"
+	}
+
+	return tlsModeStrings[m]
+}
+
+// ParseTLSMode parses a TLS mode from a string.
+// An empty string is treated as autocert.
+func ParseTLSMode(input string) (TLSMode, error) {
+	switch strings.ToLower(input) {
+	case "", "autocert":
+		return TLSModeAutocert, nil
+	case "static":
+		return TLSModeStatic, nil
+	case "plain":
+		return TLSModePlain, nil
+	default:
+		return 0, errors.Errorf("unknown TLS mode %q", input)
+	}
+}
@@ -0,0 +1,67 @@
+// Copyright © 2023 Weald Technology Trading.
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package rest_test
+
+import (
+	"testing"
+
+	"github.com/stretchr/testify/require"
+	restdaemon "github.com/wealdtech/probed/services/daemon/rest"
+)
+
+func TestParseTLSMode(t *testing.T) {
+	tests := []struct {
+		name  string
+		input string
+		res   restdaemon.TLSMode
+		err   string
+	}{
+		{
+			name: "Empty",
+			res:  restdaemon.TLSModeAutocert,
+		},
+		{
+			name:  "Autocert",
+			input: "autocert",
+			res:   restdaemon.TLSModeAutocert,
+		},
+		{
+			name:  "Static",
+			input: "Static",
+			res:   restdaemon.TLSModeStatic,
+		},
+		{
+			name:  "Plain",
+			input: "plain",
+			res:   restdaemon.TLSModePlain,
+		},
+		{
+			name:  "Unknown",
+			input: "mutual",
+			err:   `unknown TLS mode "mutual"`,
+		},
+	}
+
+	for _, test := range tests {
+		t.Run(test.name, func(t *testing.T) {
+			res, err := restdaemon.ParseTLSMode(test.input)
+			if test.err != "" {
+				require.EqualError(t, err, test.err)
+			} else {
+				require.NoError(t, err)
+				require.Equal(t, test.res, res)
+			}
+		})
+	}
+}
@@ -162,6 +162,9 @@ func (a *Attestation) UnmarshalJSON(input []byte) error {
 	a.Buckets = make(map[string]*[120]bitfield.Bitlist)
 	for source, buckets := range data.Buckets {
 		a.Buckets[source] = &[120]bitfield.Bitlist{}
+		if len(buckets) > len(a.Buckets[source]) {
+			return errors.Errorf("too many buckets for %s; maximum is %d", source, len(a.Buckets[source]))
+		}
 		for i, bucket := range buckets {
 			if bucket != "" {
 				a.Buckets[source][i], err = hex.DecodeString(strings.TrimPrefix(bucket, "0x"))
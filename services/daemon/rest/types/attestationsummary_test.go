@@ -0,0 +1,69 @@
+// Copyright © 2023 Weald Technology Trading.
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package types_test
+
+import (
+	"encoding/json"
+	"fmt"
+	"strings"
+	"testing"
+
+	"github.com/stretchr/testify/require"
+	"github.com/wealdtech/probed/services/daemon/rest/types"
+)
+
+func bucketsJSON(count int) string {
+	buckets := make([]string, count)
+	for i := range buckets {
+		buckets[i] = `"0x01"`
+	}
+
+	return fmt.Sprintf(`{"committee_index":"1","beacon_block_root":"0x01","source_root":"0x02","target_root":"0x03","buckets":{"client":[%s]}}`, strings.Join(buckets, ","))
+}
+
+func TestAttestationJSON(t *testing.T) {
+	tests := []struct {
+		name  string
+		input []byte
+		err   string
+	}{
+		{
+			name:  "BucketsMissing",
+			input: []byte(`{"committee_index":"1","beacon_block_root":"0x01","source_root":"0x02","target_root":"0x03","buckets":{}}`),
+			err:   "buckets missing",
+		},
+		{
+			name:  "BucketsTooMany",
+			input: []byte(bucketsJSON(121)),
+			err:   "too many buckets for client; maximum is 120",
+		},
+		{
+			name:  "Good",
+			input: []byte(bucketsJSON(120)),
+		},
+	}
+
+	for _, test := range tests {
+		t.Run(test.name, func(t *testing.T) {
+			var res types.Attestation
+			err := json.Unmarshal(test.input, &res)
+			if test.err != "" {
+				require.EqualError(t, err, test.err)
+			} else {
+				require.NoError(t, err)
+				require.Len(t, res.Buckets["client"], 120)
+			}
+		})
+	}
+}
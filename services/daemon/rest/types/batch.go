@@ -0,0 +1,140 @@
+// Copyright © 2023 Weald Technology Trading.
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package types
+
+import (
+	"encoding/json"
+	"fmt"
+	"strconv"
+
+	"github.com/pkg/errors"
+)
+
+const (
+	// BatchItemBlockDelay is the type of a block delay batch item.
+	BatchItemBlockDelay = "block_delay"
+	// BatchItemHeadDelay is the type of a head delay batch item.
+	BatchItemHeadDelay = "head_delay"
+	// BatchItemAggregateAttestation is the type of an aggregate attestation batch item.
+	BatchItemAggregateAttestation = "aggregate_attestation"
+	// BatchItemAttestationSummary is the type of an attestation summary batch item.
+	BatchItemAttestationSummary = "attestation_summary"
+)
+
+const (
+	// BatchResultAccepted is the result for an item that was stored.
+	BatchResultAccepted = "accepted"
+	// BatchResultDuplicate is the result for an item that was already stored.
+	BatchResultDuplicate = "duplicate"
+	// BatchResultUpdated is the result for an item that was already stored, and
+	// that updated the stored item according to the conflict policy.
+	BatchResultUpdated = "updated"
+	// BatchResultQueued is the result for an item that was queued to be stored later.
+	BatchResultQueued = "queued"
+	// BatchResultRejected is the result for an item that could not be stored.
+	BatchResultRejected = "rejected"
+)
+
+// BatchItem holds a single item of a batch submission.
+// The data is held in its raw form, to allow each item to be
+// decoded and validated independently of the others.
+type BatchItem struct {
+	Type string
+	Data json.RawMessage
+}
+
+// batchItemJSON is a raw representation of the struct.
+type batchItemJSON struct {
+	Type string          `json:"type"`
+	Data json.RawMessage `json:"data"`
+}
+
+// MarshalJSON implements json.Marshaler.
+func (b *BatchItem) MarshalJSON() ([]byte, error) {
+	return json.Marshal(&batchItemJSON{
+		Type: b.Type,
+		Data: b.Data,
+	})
+}
+
+// UnmarshalJSON implements json.Unmarshaler.
+func (b *BatchItem) UnmarshalJSON(input []byte) error {
+	var data batchItemJSON
+	err := json.Unmarshal(input, &data)
+	if err != nil {
+		return err
+	}
+
+	if data.Type == "" {
+		return errors.New("type missing")
+	}
+	b.Type = data.Type
+
+	if len(data.Data) == 0 {
+		return errors.New("data missing")
+	}
+	b.Data = data.Data
+
+	return nil
+}
+
+// BatchResult holds the result of storing a single item of a batch submission.
+type BatchResult struct {
+	Index  int
+	Result string
+	Reason string
+}
+
+// batchResultJSON is a raw representation of the struct.
+type batchResultJSON struct {
+	Index  string `json:"index"`
+	Result string `json:"result"`
+	Reason string `json:"reason,omitempty"`
+}
+
+// MarshalJSON implements json.Marshaler.
+func (b *BatchResult) MarshalJSON() ([]byte, error) {
+	return json.Marshal(&batchResultJSON{
+		Index:  fmt.Sprintf("%d", b.Index),
+		Result: b.Result,
+		Reason: b.Reason,
+	})
+}
+
+// UnmarshalJSON implements json.Unmarshaler.
+func (b *BatchResult) UnmarshalJSON(input []byte) error {
+	var data batchResultJSON
+	err := json.Unmarshal(input, &data)
+	if err != nil {
+		return err
+	}
+
+	if data.Index == "" {
+		return errors.New("index missing")
+	}
+	index, err := strconv.ParseUint(data.Index, 10, 32)
+	if err != nil {
+		return errors.Wrap(err, "invalid value for index")
+	}
+	b.Index = int(index)
+
+	if data.Result == "" {
+		return errors.New("result missing")
+	}
+	b.Result = data.Result
+
+	b.Reason = data.Reason
+
+	return nil
+}
@@ -0,0 +1,62 @@
+// Copyright © 2023 Weald Technology Trading.
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package types
+
+import (
+	"encoding/json"
+	"fmt"
+	"net"
+)
+
+// DelayStatistics holds statistics about a group of delays.
+// Only the fields for the dimensions by which the delays were grouped are set.
+type DelayStatistics struct {
+	Slot   *uint32
+	Epoch  *uint32
+	Source *string
+	Method *string
+	IPAddr net.IP
+	// Statistics are the values of the statistics, keyed by name.
+	Statistics map[string]float64
+}
+
+// delayStatisticsJSON is a raw representation of the struct.
+type delayStatisticsJSON struct {
+	Slot       string             `json:"slot,omitempty"`
+	Epoch      string             `json:"epoch,omitempty"`
+	Source     *string            `json:"source,omitempty"`
+	Method     *string            `json:"method,omitempty"`
+	IPAddr     string             `json:"ip_addr,omitempty"`
+	Statistics map[string]float64 `json:"statistics"`
+}
+
+// MarshalJSON implements json.Marshaler.
+func (d *DelayStatistics) MarshalJSON() ([]byte, error) {
+	data := &delayStatisticsJSON{
+		Source:     d.Source,
+		Method:     d.Method,
+		Statistics: d.Statistics,
+	}
+	if d.Slot != nil {
+		data.Slot = fmt.Sprintf("%d", *d.Slot)
+	}
+	if d.Epoch != nil {
+		data.Epoch = fmt.Sprintf("%d", *d.Epoch)
+	}
+	if d.IPAddr != nil {
+		data.IPAddr = d.IPAddr.String()
+	}
+
+	return json.Marshal(data)
+}
@@ -0,0 +1,45 @@
+// Copyright © 2023 Weald Technology Trading.
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package probedb
+
+// Action is the action taken by the database when setting a record.
+type Action uint8
+
+const (
+	// ActionCreated is returned when the record was created.
+	ActionCreated Action = iota
+	// ActionIgnored is returned when the record duplicated an existing record and was ignored.
+	ActionIgnored
+	// ActionQueued is returned when the record was queued to be written later,
+	// in which case it is not known if it duplicates an existing record.
+	ActionQueued
+	// ActionUpdated is returned when the record duplicated an existing record,
+	// which was updated according to the conflict policy for the record.
+	ActionUpdated
+)
+
+var actionStrings = [...]string{
+	"created",
+	"ignored",
+	"queued",
+	"updated",
+}
+
+// String returns a string representation of the action.
+func (a Action) String() string {
+	if int(a) >= len(actionStrings) {
+		return "unknown"
+	}
+	return actionStrings[a]
+}
@@ -0,0 +1,143 @@
+// Copyright © 2023 Weald Technology Trading.
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package buffered
+
+import (
+	"context"
+	"time"
+
+	"github.com/wealdtech/probed/services/probedb"
+)
+
+// batch is a set of records to be flushed together.
+type batch struct {
+	blockDelays           []*probedb.Delay
+	headDelays            []*probedb.Delay
+	aggregateAttestations []*probedb.AggregateAttestation
+	attestationSummaries  []*probedb.AttestationSummary
+}
+
+func (b *batch) add(item *item) {
+	switch {
+	case item.blockDelay != nil:
+		b.blockDelays = append(b.blockDelays, item.blockDelay)
+	case item.headDelay != nil:
+		b.headDelays = append(b.headDelays, item.headDelay)
+	case item.aggregateAttestation != nil:
+		b.aggregateAttestations = append(b.aggregateAttestations, item.aggregateAttestation)
+	case item.attestationSummary != nil:
+		b.attestationSummaries = append(b.attestationSummaries, item.attestationSummary)
+	}
+}
+
+func (b *batch) size() int {
+	return len(b.blockDelays) + len(b.headDelays) + len(b.aggregateAttestations) + len(b.attestationSummaries)
+}
+
+// run reads the queue, flushing records when enough have built up
+// or the flush interval has passed.
+// Records that fail to be written are retried with backoff.
+func (s *Service) run(ctx context.Context) {
+	ticker := time.NewTicker(s.flushInterval)
+	defer ticker.Stop()
+
+	pending := &batch{}
+	retries := make([]*retry, 0)
+	for {
+		select {
+		case <-ctx.Done():
+			// Drain anything remaining in the queue before exiting.
+			for drained := false; !drained; {
+				select {
+				case item := <-s.queue:
+					pending.add(item)
+				default:
+					drained = true
+				}
+			}
+			log.Trace().Int("records", pending.size()).Msg("Context done; flushing remaining records")
+			retries = s.addRetry(retries, s.flush(context.Background(), pending))
+			s.finalRetry(context.Background(), retries)
+			return
+		case item := <-s.queue:
+			pending.add(item)
+			if pending.size() >= s.flushSize {
+				retries = s.addRetry(retries, s.flush(ctx, pending))
+				pending = &batch{}
+			}
+		case <-ticker.C:
+			retries = s.addRetry(retries, s.flush(ctx, pending))
+			pending = &batch{}
+			retries = s.retryDue(ctx, retries)
+		}
+		setQueueDepth(len(s.queue))
+	}
+}
+
+// flush writes a batch to the underlying database, returning the records that
+// could not be written.
+func (s *Service) flush(ctx context.Context, pending *batch) *batch {
+	failed := &batch{}
+	if pending.size() == 0 {
+		return failed
+	}
+	started := time.Now()
+
+	result := "succeeded"
+	if len(pending.blockDelays) > 0 {
+		if err := s.blockDelaysSetter.SetBlockDelays(ctx, pending.blockDelays); err != nil {
+			log.Error().Err(err).Int("records", len(pending.blockDelays)).Msg("Failed to write block delays")
+			recordsFlushed("block delay", "failed", len(pending.blockDelays))
+			failed.blockDelays = pending.blockDelays
+			result = "failed"
+		} else {
+			recordsFlushed("block delay", "succeeded", len(pending.blockDelays))
+		}
+	}
+	if len(pending.headDelays) > 0 {
+		if err := s.headDelaysSetter.SetHeadDelays(ctx, pending.headDelays); err != nil {
+			log.Error().Err(err).Int("records", len(pending.headDelays)).Msg("Failed to write head delays")
+			recordsFlushed("head delay", "failed", len(pending.headDelays))
+			failed.headDelays = pending.headDelays
+			result = "failed"
+		} else {
+			recordsFlushed("head delay", "succeeded", len(pending.headDelays))
+		}
+	}
+	if len(pending.aggregateAttestations) > 0 {
+		if err := s.aggregateAttestationsSetter.SetAggregateAttestations(ctx, pending.aggregateAttestations); err != nil {
+			log.Error().Err(err).Int("records", len(pending.aggregateAttestations)).Msg("Failed to write aggregate attestations")
+			recordsFlushed("aggregate attestation", "failed", len(pending.aggregateAttestations))
+			failed.aggregateAttestations = pending.aggregateAttestations
+			result = "failed"
+		} else {
+			recordsFlushed("aggregate attestation", "succeeded", len(pending.aggregateAttestations))
+		}
+	}
+	if len(pending.attestationSummaries) > 0 {
+		if err := s.attestationSummariesSetter.SetAttestationSummaries(ctx, pending.attestationSummaries); err != nil {
+			log.Error().Err(err).Int("records", len(pending.attestationSummaries)).Msg("Failed to write attestation summaries")
+			recordsFlushed("attestation summary", "failed", len(pending.attestationSummaries))
+			failed.attestationSummaries = pending.attestationSummaries
+			result = "failed"
+		} else {
+			recordsFlushed("attestation summary", "succeeded", len(pending.attestationSummaries))
+		}
+	}
+
+	flushCompleted(started, result)
+	log.Trace().Int("records", pending.size()).Dur("elapsed", time.Since(started)).Str("result", result).Msg("Flush complete")
+
+	return failed
+}
@@ -0,0 +1,117 @@
+// Copyright © 2023 Weald Technology Trading.
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package buffered
+
+import (
+	"context"
+	"time"
+
+	"github.com/pkg/errors"
+	"github.com/prometheus/client_golang/prometheus"
+	"github.com/wealdtech/probed/services/metrics"
+)
+
+var metricsNamespace = "probed_buffered"
+
+var (
+	queueDepth     prometheus.Gauge
+	retryDepth     prometheus.Gauge
+	flushDuration  *prometheus.HistogramVec
+	flushedRecords *prometheus.CounterVec
+)
+
+func registerMetrics(ctx context.Context, monitor metrics.Service) error {
+	if queueDepth != nil {
+		// Already registered.
+		return nil
+	}
+	if monitor == nil {
+		// No monitor.
+		return nil
+	}
+	if monitor.Presenter() == "prometheus" {
+		return registerPrometheusMetrics(ctx)
+	}
+	return nil
+}
+
+func registerPrometheusMetrics(ctx context.Context) error {
+	queueDepth = prometheus.NewGauge(prometheus.GaugeOpts{
+		Namespace: metricsNamespace,
+		Name:      "queue_depth",
+		Help:      "The number of records waiting to be written.",
+	})
+	if err := prometheus.Register(queueDepth); err != nil {
+		return errors.Wrap(err, "failed to register queue_depth")
+	}
+
+	retryDepth = prometheus.NewGauge(prometheus.GaugeOpts{
+		Namespace: metricsNamespace,
+		Name:      "retry_depth",
+		Help:      "The number of records waiting to be retried after failing to be written.",
+	})
+	if err := prometheus.Register(retryDepth); err != nil {
+		return errors.Wrap(err, "failed to register retry_depth")
+	}
+
+	flushDuration = prometheus.NewHistogramVec(prometheus.HistogramOpts{
+		Namespace: metricsNamespace,
+		Name:      "flush_duration_seconds",
+		Help:      "The time taken to write records to the database.",
+		Buckets: []float64{
+			0.01, 0.02, 0.05,
+			0.1, 0.2, 0.5,
+			1.0, 2.0, 5.0,
+			10.0,
+		},
+	}, []string{"result"})
+	if err := prometheus.Register(flushDuration); err != nil {
+		return errors.Wrap(err, "failed to register flush_duration_seconds")
+	}
+
+	flushedRecords = prometheus.NewCounterVec(prometheus.CounterOpts{
+		Namespace: metricsNamespace,
+		Name:      "flushed_records_total",
+		Help:      "The number of records flushed to the database, by result.",
+	}, []string{"type", "result"})
+	if err := prometheus.Register(flushedRecords); err != nil {
+		return errors.Wrap(err, "failed to register flushed_records_total")
+	}
+
+	return nil
+}
+
+func setQueueDepth(depth int) {
+	if queueDepth != nil {
+		queueDepth.Set(float64(depth))
+	}
+}
+
+func setRetryDepth(depth int) {
+	if retryDepth != nil {
+		retryDepth.Set(float64(depth))
+	}
+}
+
+func flushCompleted(started time.Time, result string) {
+	if flushDuration != nil {
+		flushDuration.WithLabelValues(result).Observe(time.Since(started).Seconds())
+	}
+}
+
+func recordsFlushed(recordType string, result string, count int) {
+	if flushedRecords != nil {
+		flushedRecords.WithLabelValues(recordType, result).Add(float64(count))
+	}
+}
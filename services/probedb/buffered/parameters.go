@@ -0,0 +1,175 @@
+// Copyright © 2023 Weald Technology Trading.
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package buffered
+
+import (
+	"errors"
+	"time"
+
+	"github.com/rs/zerolog"
+	"github.com/wealdtech/probed/services/metrics"
+	nullmetrics "github.com/wealdtech/probed/services/metrics/null"
+	"github.com/wealdtech/probed/services/probedb"
+)
+
+type parameters struct {
+	logLevel       zerolog.Level
+	monitor        metrics.Service
+	probeDB        probedb.Service
+	queueSize      int
+	flushSize      int
+	flushInterval  time.Duration
+	enqueueTimeout time.Duration
+	maxRetries     int
+	retryBackoff   time.Duration
+}
+
+// Parameter is the interface for service parameters.
+type Parameter interface {
+	apply(*parameters)
+}
+
+type parameterFunc func(*parameters)
+
+func (f parameterFunc) apply(p *parameters) {
+	f(p)
+}
+
+// WithLogLevel sets the log level for the module.
+func WithLogLevel(logLevel zerolog.Level) Parameter {
+	return parameterFunc(func(p *parameters) {
+		p.logLevel = logLevel
+	})
+}
+
+// WithMonitor sets the monitor for the module.
+func WithMonitor(monitor metrics.Service) Parameter {
+	return parameterFunc(func(p *parameters) {
+		p.monitor = monitor
+	})
+}
+
+// WithProbeDB sets the underlying probe database for the module.
+// This must support the bulk setter interfaces.
+func WithProbeDB(probeDB probedb.Service) Parameter {
+	return parameterFunc(func(p *parameters) {
+		p.probeDB = probeDB
+	})
+}
+
+// WithQueueSize sets the maximum number of records that can be queued.
+func WithQueueSize(size int) Parameter {
+	return parameterFunc(func(p *parameters) {
+		p.queueSize = size
+	})
+}
+
+// WithFlushSize sets the number of queued records that triggers a flush.
+func WithFlushSize(size int) Parameter {
+	return parameterFunc(func(p *parameters) {
+		p.flushSize = size
+	})
+}
+
+// WithFlushInterval sets the maximum time between flushes.
+func WithFlushInterval(interval time.Duration) Parameter {
+	return parameterFunc(func(p *parameters) {
+		p.flushInterval = interval
+	})
+}
+
+// WithEnqueueTimeout sets the maximum time to wait for space in a full queue.
+func WithEnqueueTimeout(timeout time.Duration) Parameter {
+	return parameterFunc(func(p *parameters) {
+		p.enqueueTimeout = timeout
+	})
+}
+
+// WithMaxRetries sets the maximum number of times records that fail to be
+// written are retried before they are dropped.
+func WithMaxRetries(retries int) Parameter {
+	return parameterFunc(func(p *parameters) {
+		p.maxRetries = retries
+	})
+}
+
+// WithRetryBackoff sets the time to wait before the first retry of records that
+// fail to be written; it doubles with each subsequent retry.
+// Retries take place at the first flush interval after the backoff has passed.
+func WithRetryBackoff(backoff time.Duration) Parameter {
+	return parameterFunc(func(p *parameters) {
+		p.retryBackoff = backoff
+	})
+}
+
+// parseAndCheckParameters parses and checks parameters to ensure that mandatory parameters are present and correct.
+func parseAndCheckParameters(params ...Parameter) (*parameters, error) {
+	parameters := parameters{
+		logLevel:       zerolog.GlobalLevel(),
+		monitor:        nullmetrics.New(),
+		queueSize:      16384,
+		flushSize:      1024,
+		flushInterval:  time.Second,
+		enqueueTimeout: 5 * time.Second,
+		maxRetries:     5,
+		retryBackoff:   time.Second,
+	}
+	for _, p := range params {
+		if params != nil {
+			p.apply(&parameters)
+		}
+	}
+
+	if parameters.monitor == nil {
+		return nil, errors.New("no monitor specified")
+	}
+	if parameters.probeDB == nil {
+		return nil, errors.New("no probe database specified")
+	}
+	if _, isSetter := parameters.probeDB.(probedb.BlockDelaysBulkSetter); !isSetter {
+		return nil, errors.New("probe database does not support bulk setting of block delays")
+	}
+	if _, isSetter := parameters.probeDB.(probedb.HeadDelaysBulkSetter); !isSetter {
+		return nil, errors.New("probe database does not support bulk setting of head delays")
+	}
+	if _, isSetter := parameters.probeDB.(probedb.AggregateAttestationsBulkSetter); !isSetter {
+		return nil, errors.New("probe database does not support bulk setting of aggregate attestations")
+	}
+	if _, isSetter := parameters.probeDB.(probedb.AttestationSummariesBulkSetter); !isSetter {
+		return nil, errors.New("probe database does not support bulk setting of attestation summaries")
+	}
+	if parameters.queueSize <= 0 {
+		return nil, errors.New("queue size must be positive")
+	}
+	if parameters.flushSize <= 0 {
+		return nil, errors.New("flush size must be positive")
+	}
+	if parameters.flushSize > parameters.queueSize {
+		return nil, errors.New("flush size cannot be larger than queue size")
+	}
+	if parameters.flushInterval <= 0 {
+		return nil, errors.New("flush interval must be positive")
+	}
+	if parameters.enqueueTimeout <= 0 {
+		return nil, errors.New("enqueue timeout must be positive")
+	}
+	if parameters.maxRetries < 0 {
+		return nil, errors.New("maximum retries cannot be negative")
+	}
+	if parameters.retryBackoff <= 0 {
+		return nil, errors.New("retry backoff must be positive")
+	}
+
+	return &parameters, nil
+}
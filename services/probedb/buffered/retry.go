@@ -0,0 +1,120 @@
+// Copyright © 2023 Weald Technology Trading.
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package buffered
+
+import (
+	"context"
+	"time"
+)
+
+// retry is a batch of records that failed to be written, waiting to be retried.
+type retry struct {
+	batch    *batch
+	attempts int
+	at       time.Time
+}
+
+// addRetry adds a batch of failed records to the retries, to be retried after
+// the retry backoff.
+// If this takes the number of records waiting to be retried above the queue
+// size then the oldest retries are dropped.
+func (s *Service) addRetry(retries []*retry, failed *batch) []*retry {
+	if failed.size() == 0 {
+		return retries
+	}
+	if s.maxRetries == 0 {
+		log.Error().Int("records", failed.size()).Msg("Failed to write records and retries are disabled; dropping")
+		dropRecords(failed)
+		return retries
+	}
+	retries = append(retries, &retry{
+		batch:    failed,
+		attempts: 1,
+		at:       time.Now().Add(s.retryBackoff),
+	})
+
+	records := 0
+	for _, retry := range retries {
+		records += retry.batch.size()
+	}
+	for len(retries) > 1 && records > s.queueSize {
+		log.Error().Int("records", retries[0].batch.size()).Msg("Too many records waiting to be retried; dropping oldest")
+		records -= retries[0].batch.size()
+		dropRecords(retries[0].batch)
+		retries = retries[1:]
+	}
+	setRetryDepth(records)
+
+	return retries
+}
+
+// retryDue retries the batches whose backoff has passed, returning the retries
+// that remain.
+// The backoff doubles with each failed attempt, and batches that have failed
+// more than the maximum number of retries are dropped.
+func (s *Service) retryDue(ctx context.Context, retries []*retry) []*retry {
+	if len(retries) == 0 {
+		return retries
+	}
+
+	now := time.Now()
+	remaining := make([]*retry, 0, len(retries))
+	records := 0
+	for _, retry := range retries {
+		if retry.at.After(now) {
+			remaining = append(remaining, retry)
+			records += retry.batch.size()
+			continue
+		}
+		log.Debug().Int("records", retry.batch.size()).Int("attempt", retry.attempts).Msg("Retrying failed records")
+		failed := s.flush(ctx, retry.batch)
+		if failed.size() == 0 {
+			continue
+		}
+		if retry.attempts >= s.maxRetries {
+			log.Error().Int("records", failed.size()).Int("attempts", retry.attempts+1).Msg("Failed to write records after retries; dropping")
+			dropRecords(failed)
+			continue
+		}
+		retry.batch = failed
+		retry.at = time.Now().Add(s.retryBackoff << retry.attempts)
+		retry.attempts++
+		remaining = append(remaining, retry)
+		records += failed.size()
+	}
+	setRetryDepth(records)
+
+	return remaining
+}
+
+// finalRetry makes a final attempt to write the failed records on shutdown,
+// regardless of their backoff, dropping those that still fail.
+func (s *Service) finalRetry(ctx context.Context, retries []*retry) {
+	for _, retry := range retries {
+		failed := s.flush(ctx, retry.batch)
+		if failed.size() > 0 {
+			log.Error().Int("records", failed.size()).Msg("Failed to write records on shutdown; dropping")
+			dropRecords(failed)
+		}
+	}
+	setRetryDepth(0)
+}
+
+// dropRecords records that the records in the batch have been dropped.
+func dropRecords(dropped *batch) {
+	recordsFlushed("block delay", "dropped", len(dropped.blockDelays))
+	recordsFlushed("head delay", "dropped", len(dropped.headDelays))
+	recordsFlushed("aggregate attestation", "dropped", len(dropped.aggregateAttestations))
+	recordsFlushed("attestation summary", "dropped", len(dropped.attestationSummaries))
+}
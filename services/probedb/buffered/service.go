@@ -0,0 +1,112 @@
+// Copyright © 2023 Weald Technology Trading.
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+// Package buffered provides a probe database that queues writes and
+// flushes them to an underlying probe database in bulk.
+// Records that fail to be written are retried with backoff, and are only
+// dropped once the retries are exhausted.
+package buffered
+
+import (
+	"context"
+	"time"
+
+	"github.com/pkg/errors"
+	"github.com/rs/zerolog"
+	zerologger "github.com/rs/zerolog/log"
+	"github.com/wealdtech/probed/services/probedb"
+)
+
+// ErrQueueFull is returned when a record cannot be queued in time.
+var ErrQueueFull = errors.New("queue full")
+
+// Service is a buffered probe database service.
+type Service struct {
+	probeDB                     probedb.Service
+	blockDelaysSetter           probedb.BlockDelaysBulkSetter
+	headDelaysSetter            probedb.HeadDelaysBulkSetter
+	aggregateAttestationsSetter probedb.AggregateAttestationsBulkSetter
+	attestationSummariesSetter  probedb.AttestationSummariesBulkSetter
+	queue                       chan *item
+	queueSize                   int
+	flushSize                   int
+	flushInterval               time.Duration
+	enqueueTimeout              time.Duration
+	maxRetries                  int
+	retryBackoff                time.Duration
+}
+
+// item is a single queued record; exactly one field is set.
+type item struct {
+	blockDelay           *probedb.Delay
+	headDelay            *probedb.Delay
+	aggregateAttestation *probedb.AggregateAttestation
+	attestationSummary   *probedb.AttestationSummary
+}
+
+// module-wide log.
+var log zerolog.Logger
+
+// New creates a new buffered probe database service.
+func New(ctx context.Context, params ...Parameter) (*Service, error) {
+	parameters, err := parseAndCheckParameters(params...)
+	if err != nil {
+		return nil, errors.Wrap(err, "problem with parameters")
+	}
+
+	// Set logging.
+	log = zerologger.With().Str("service", "probedb").Str("impl", "buffered").Logger().Level(parameters.logLevel)
+
+	if err := registerMetrics(ctx, parameters.monitor); err != nil {
+		return nil, errors.New("failed to register metrics")
+	}
+
+	s := &Service{
+		probeDB:                     parameters.probeDB,
+		blockDelaysSetter:           parameters.probeDB.(probedb.BlockDelaysBulkSetter),
+		headDelaysSetter:            parameters.probeDB.(probedb.HeadDelaysBulkSetter),
+		aggregateAttestationsSetter: parameters.probeDB.(probedb.AggregateAttestationsBulkSetter),
+		attestationSummariesSetter:  parameters.probeDB.(probedb.AttestationSummariesBulkSetter),
+		queue:                       make(chan *item, parameters.queueSize),
+		queueSize:                   parameters.queueSize,
+		flushSize:                   parameters.flushSize,
+		flushInterval:               parameters.flushInterval,
+		enqueueTimeout:              parameters.enqueueTimeout,
+		maxRetries:                  parameters.maxRetries,
+		retryBackoff:                parameters.retryBackoff,
+	}
+
+	go s.run(ctx)
+
+	return s, nil
+}
+
+// BeginTx begins a transaction.
+func (s *Service) BeginTx(ctx context.Context) (context.Context, context.CancelFunc, error) {
+	return s.probeDB.BeginTx(ctx)
+}
+
+// CommitTx commits a transaction.
+func (s *Service) CommitTx(ctx context.Context) error {
+	return s.probeDB.CommitTx(ctx)
+}
+
+// SetMetadata sets a metadata key to a JSON value.
+func (s *Service) SetMetadata(ctx context.Context, key string, value []byte) error {
+	return s.probeDB.SetMetadata(ctx, key, value)
+}
+
+// Metadata obtains the JSON value from a metadata key.
+func (s *Service) Metadata(ctx context.Context, key string) ([]byte, error) {
+	return s.probeDB.Metadata(ctx, key)
+}
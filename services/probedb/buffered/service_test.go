@@ -0,0 +1,354 @@
+// Copyright © 2023 Weald Technology Trading.
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package buffered_test
+
+import (
+	"context"
+	"sync"
+	"testing"
+	"time"
+
+	"github.com/pkg/errors"
+	"github.com/rs/zerolog"
+	"github.com/stretchr/testify/require"
+	"github.com/wealdtech/probed/services/probedb"
+	"github.com/wealdtech/probed/services/probedb/buffered"
+	mockprobedb "github.com/wealdtech/probed/services/probedb/mock"
+)
+
+// bulkProbeDB records the records written to it in bulk.
+type bulkProbeDB struct {
+	*mockprobedb.Service
+	mu                    sync.Mutex
+	flushes               int
+	blockDelays           []*probedb.Delay
+	headDelays            []*probedb.Delay
+	aggregateAttestations []*probedb.AggregateAttestation
+	attestationSummaries  []*probedb.AttestationSummary
+}
+
+func newBulkProbeDB() *bulkProbeDB {
+	return &bulkProbeDB{
+		Service: mockprobedb.New(),
+	}
+}
+
+func (s *bulkProbeDB) SetBlockDelays(ctx context.Context, delays []*probedb.Delay) error {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	s.flushes++
+	s.blockDelays = append(s.blockDelays, delays...)
+	return nil
+}
+
+func (s *bulkProbeDB) SetHeadDelays(ctx context.Context, delays []*probedb.Delay) error {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	s.flushes++
+	s.headDelays = append(s.headDelays, delays...)
+	return nil
+}
+
+func (s *bulkProbeDB) SetAggregateAttestations(ctx context.Context, aggregateAttestations []*probedb.AggregateAttestation) error {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	s.flushes++
+	s.aggregateAttestations = append(s.aggregateAttestations, aggregateAttestations...)
+	return nil
+}
+
+func (s *bulkProbeDB) SetAttestationSummaries(ctx context.Context, summaries []*probedb.AttestationSummary) error {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	s.flushes++
+	s.attestationSummaries = append(s.attestationSummaries, summaries...)
+	return nil
+}
+
+func (s *bulkProbeDB) counts() (int, int, int) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	return s.flushes, len(s.blockDelays), len(s.headDelays)
+}
+
+// singleProbeDB only supports setting block delays singly.
+type singleProbeDB struct {
+	probedb.BlockDelaysSetter
+}
+
+func TestService(t *testing.T) {
+	ctx := context.Background()
+
+	tests := []struct {
+		name   string
+		params []buffered.Parameter
+		err    string
+	}{
+		{
+			name: "MonitorMissing",
+			params: []buffered.Parameter{
+				buffered.WithLogLevel(zerolog.Disabled),
+				buffered.WithMonitor(nil),
+				buffered.WithProbeDB(newBulkProbeDB()),
+			},
+			err: "problem with parameters: no monitor specified",
+		},
+		{
+			name: "ProbeDBMissing",
+			params: []buffered.Parameter{
+				buffered.WithLogLevel(zerolog.Disabled),
+			},
+			err: "problem with parameters: no probe database specified",
+		},
+		{
+			name: "ProbeDBNotBulk",
+			params: []buffered.Parameter{
+				buffered.WithLogLevel(zerolog.Disabled),
+				buffered.WithProbeDB(&singleProbeDB{BlockDelaysSetter: mockprobedb.New()}),
+			},
+			err: "problem with parameters: probe database does not support bulk setting of block delays",
+		},
+		{
+			name: "FlushSizeTooLarge",
+			params: []buffered.Parameter{
+				buffered.WithLogLevel(zerolog.Disabled),
+				buffered.WithProbeDB(newBulkProbeDB()),
+				buffered.WithQueueSize(10),
+				buffered.WithFlushSize(20),
+			},
+			err: "problem with parameters: flush size cannot be larger than queue size",
+		},
+		{
+			name: "FlushIntervalZero",
+			params: []buffered.Parameter{
+				buffered.WithLogLevel(zerolog.Disabled),
+				buffered.WithProbeDB(newBulkProbeDB()),
+				buffered.WithFlushInterval(0),
+			},
+			err: "problem with parameters: flush interval must be positive",
+		},
+		{
+			name: "MaxRetriesNegative",
+			params: []buffered.Parameter{
+				buffered.WithLogLevel(zerolog.Disabled),
+				buffered.WithProbeDB(newBulkProbeDB()),
+				buffered.WithMaxRetries(-1),
+			},
+			err: "problem with parameters: maximum retries cannot be negative",
+		},
+		{
+			name: "RetryBackoffZero",
+			params: []buffered.Parameter{
+				buffered.WithLogLevel(zerolog.Disabled),
+				buffered.WithProbeDB(newBulkProbeDB()),
+				buffered.WithRetryBackoff(0),
+			},
+			err: "problem with parameters: retry backoff must be positive",
+		},
+		{
+			name: "Good",
+			params: []buffered.Parameter{
+				buffered.WithLogLevel(zerolog.Disabled),
+				buffered.WithProbeDB(newBulkProbeDB()),
+			},
+		},
+	}
+
+	for _, test := range tests {
+		t.Run(test.name, func(t *testing.T) {
+			_, err := buffered.New(ctx, test.params...)
+			if test.err != "" {
+				require.EqualError(t, err, test.err)
+			} else {
+				require.NoError(t, err)
+			}
+		})
+	}
+}
+
+func TestFlushOnSize(t *testing.T) {
+	ctx, cancel := context.WithCancel(context.Background())
+	defer cancel()
+
+	probeDB := newBulkProbeDB()
+	s, err := buffered.New(ctx,
+		buffered.WithLogLevel(zerolog.Disabled),
+		buffered.WithProbeDB(probeDB),
+		buffered.WithFlushSize(4),
+		buffered.WithFlushInterval(time.Hour),
+	)
+	require.NoError(t, err)
+
+	for i := 0; i < 4; i++ {
+		action, err := s.SetBlockDelay(ctx, &probedb.Delay{Slot: uint32(i)})
+		require.NoError(t, err)
+		require.Equal(t, probedb.ActionQueued, action)
+	}
+
+	require.Eventually(t, func() bool {
+		flushes, blockDelays, _ := probeDB.counts()
+		return flushes == 1 && blockDelays == 4
+	}, time.Second, 10*time.Millisecond)
+}
+
+func TestFlushOnInterval(t *testing.T) {
+	ctx, cancel := context.WithCancel(context.Background())
+	defer cancel()
+
+	probeDB := newBulkProbeDB()
+	s, err := buffered.New(ctx,
+		buffered.WithLogLevel(zerolog.Disabled),
+		buffered.WithProbeDB(probeDB),
+		buffered.WithFlushSize(100),
+		buffered.WithFlushInterval(50*time.Millisecond),
+	)
+	require.NoError(t, err)
+
+	_, err = s.SetBlockDelay(ctx, &probedb.Delay{Slot: 1})
+	require.NoError(t, err)
+	_, err = s.SetHeadDelay(ctx, &probedb.Delay{Slot: 1})
+	require.NoError(t, err)
+
+	require.Eventually(t, func() bool {
+		flushes, blockDelays, headDelays := probeDB.counts()
+		return flushes == 2 && blockDelays == 1 && headDelays == 1
+	}, time.Second, 10*time.Millisecond)
+}
+
+func TestFlushOnShutdown(t *testing.T) {
+	ctx, cancel := context.WithCancel(context.Background())
+
+	probeDB := newBulkProbeDB()
+	s, err := buffered.New(ctx,
+		buffered.WithLogLevel(zerolog.Disabled),
+		buffered.WithProbeDB(probeDB),
+		buffered.WithFlushSize(100),
+		buffered.WithFlushInterval(time.Hour),
+	)
+	require.NoError(t, err)
+
+	_, err = s.SetBlockDelay(ctx, &probedb.Delay{Slot: 1})
+	require.NoError(t, err)
+	cancel()
+
+	require.Eventually(t, func() bool {
+		_, blockDelays, _ := probeDB.counts()
+		return blockDelays == 1
+	}, time.Second, 10*time.Millisecond)
+}
+
+func TestQueueFull(t *testing.T) {
+	// Use a cancelled context so that the queue is never read.
+	ctx, cancel := context.WithCancel(context.Background())
+	cancel()
+
+	s, err := buffered.New(ctx,
+		buffered.WithLogLevel(zerolog.Disabled),
+		buffered.WithProbeDB(newBulkProbeDB()),
+		buffered.WithQueueSize(1),
+		buffered.WithFlushSize(1),
+		buffered.WithEnqueueTimeout(10*time.Millisecond),
+	)
+	require.NoError(t, err)
+
+	// Give the service time to shut down.
+	time.Sleep(50 * time.Millisecond)
+
+	_, err = s.SetBlockDelay(context.Background(), &probedb.Delay{Slot: 1})
+	require.NoError(t, err)
+	_, err = s.SetBlockDelay(context.Background(), &probedb.Delay{Slot: 2})
+	require.ErrorIs(t, err, buffered.ErrQueueFull)
+}
+
+// failingProbeDB fails to write block delays in bulk a given number of times.
+type failingProbeDB struct {
+	*bulkProbeDB
+	failures int
+}
+
+func (s *failingProbeDB) SetBlockDelays(ctx context.Context, delays []*probedb.Delay) error {
+	s.mu.Lock()
+	if s.failures > 0 {
+		s.failures--
+		s.mu.Unlock()
+		return errors.New("failed")
+	}
+	s.mu.Unlock()
+	return s.bulkProbeDB.SetBlockDelays(ctx, delays)
+}
+
+func TestFlushRetry(t *testing.T) {
+	ctx, cancel := context.WithCancel(context.Background())
+	defer cancel()
+
+	probeDB := &failingProbeDB{bulkProbeDB: newBulkProbeDB(), failures: 2}
+	s, err := buffered.New(ctx,
+		buffered.WithLogLevel(zerolog.Disabled),
+		buffered.WithProbeDB(probeDB),
+		buffered.WithFlushSize(2),
+		buffered.WithFlushInterval(10*time.Millisecond),
+		buffered.WithRetryBackoff(10*time.Millisecond),
+	)
+	require.NoError(t, err)
+
+	for i := 0; i < 2; i++ {
+		_, err := s.SetBlockDelay(ctx, &probedb.Delay{Slot: uint32(i)})
+		require.NoError(t, err)
+	}
+
+	// The records are written once the failures have passed.
+	require.Eventually(t, func() bool {
+		_, blockDelays, _ := probeDB.counts()
+		return blockDelays == 2
+	}, time.Second, 10*time.Millisecond)
+}
+
+func TestFlushRetriesExhausted(t *testing.T) {
+	ctx, cancel := context.WithCancel(context.Background())
+	defer cancel()
+
+	probeDB := &failingProbeDB{bulkProbeDB: newBulkProbeDB(), failures: 2}
+	s, err := buffered.New(ctx,
+		buffered.WithLogLevel(zerolog.Disabled),
+		buffered.WithProbeDB(probeDB),
+		buffered.WithFlushSize(1),
+		buffered.WithFlushInterval(10*time.Millisecond),
+		buffered.WithMaxRetries(1),
+		buffered.WithRetryBackoff(10*time.Millisecond),
+	)
+	require.NoError(t, err)
+
+	_, err = s.SetBlockDelay(ctx, &probedb.Delay{Slot: 1})
+	require.NoError(t, err)
+
+	// The record fails on its write and its single retry, so is dropped.
+	require.Eventually(t, func() bool {
+		probeDB.mu.Lock()
+		defer probeDB.mu.Unlock()
+		return probeDB.failures == 0
+	}, time.Second, 10*time.Millisecond)
+
+	// A later record is written, and the dropped record is not.
+	_, err = s.SetBlockDelay(ctx, &probedb.Delay{Slot: 2})
+	require.NoError(t, err)
+	require.Eventually(t, func() bool {
+		_, blockDelays, _ := probeDB.counts()
+		return blockDelays == 1
+	}, time.Second, 10*time.Millisecond)
+	time.Sleep(50 * time.Millisecond)
+	probeDB.mu.Lock()
+	defer probeDB.mu.Unlock()
+	require.Len(t, probeDB.blockDelays, 1)
+	require.Equal(t, uint32(2), probeDB.blockDelays[0].Slot)
+}
@@ -0,0 +1,65 @@
+// Copyright © 2023 Weald Technology Trading.
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package buffered
+
+import (
+	"context"
+	"time"
+
+	"github.com/wealdtech/probed/services/probedb"
+)
+
+// SetBlockDelay queues a block delay to be written.
+func (s *Service) SetBlockDelay(ctx context.Context, delay *probedb.Delay) (probedb.Action, error) {
+	return s.enqueue(ctx, &item{blockDelay: delay})
+}
+
+// SetHeadDelay queues a head delay to be written.
+func (s *Service) SetHeadDelay(ctx context.Context, delay *probedb.Delay) (probedb.Action, error) {
+	return s.enqueue(ctx, &item{headDelay: delay})
+}
+
+// SetAggregateAttestation queues an aggregate attestation to be written.
+func (s *Service) SetAggregateAttestation(ctx context.Context, aggregateAttestation *probedb.AggregateAttestation) (probedb.Action, error) {
+	return s.enqueue(ctx, &item{aggregateAttestation: aggregateAttestation})
+}
+
+// SetAttestationSummary queues an attestation summary to be written.
+func (s *Service) SetAttestationSummary(ctx context.Context, summary *probedb.AttestationSummary) (probedb.Action, error) {
+	return s.enqueue(ctx, &item{attestationSummary: summary})
+}
+
+// enqueue adds an item to the queue.
+// If the queue is full this waits for space, up to the enqueue timeout.
+func (s *Service) enqueue(ctx context.Context, item *item) (probedb.Action, error) {
+	select {
+	case s.queue <- item:
+		setQueueDepth(len(s.queue))
+		return probedb.ActionQueued, nil
+	default:
+	}
+
+	log.Trace().Msg("Queue full; waiting for space")
+	timer := time.NewTimer(s.enqueueTimeout)
+	defer timer.Stop()
+	select {
+	case s.queue <- item:
+		setQueueDepth(len(s.queue))
+		return probedb.ActionQueued, nil
+	case <-timer.C:
+		return probedb.ActionCreated, ErrQueueFull
+	case <-ctx.Done():
+		return probedb.ActionCreated, ctx.Err()
+	}
+}
@@ -0,0 +1,163 @@
+// Copyright © 2023 Weald Technology Trading.
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package probedb
+
+import (
+	"bytes"
+	"strings"
+
+	"github.com/pkg/errors"
+	bitfield "github.com/prysmaticlabs/go-bitfield"
+)
+
+// ConflictPolicy is the policy applied when a record has the same key as an existing record.
+type ConflictPolicy uint8
+
+const (
+	// ConflictKeepFirst keeps the existing record and ignores the new one.
+	ConflictKeepFirst ConflictPolicy = iota
+	// ConflictKeepLatest replaces the existing record with the new one.
+	ConflictKeepLatest
+	// ConflictKeepMinimumDelay keeps whichever of the records has the lower delay.
+	// It is only valid for records with a delay.
+	ConflictKeepMinimumDelay
+	// ConflictMerge merges the new record in to the existing one.
+	// It is only valid for attestation summaries, for which the attester buckets are merged.
+	ConflictMerge
+)
+
+var conflictPolicyStrings = [...]string{
+	"keep-first",
+	"keep-latest",
+	"keep-minimum-delay",
+	"merge",
+}
+
+// String returns a string representation of the policy.
+func (p ConflictPolicy) String() string {
+	if int(p) >= len(conflictPolicyStrings) {
+		return "unknown"
+	}
+	return conflictPolicyStrings[p]
+}
+
+// ParseConflictPolicy parses a conflict policy from its string representation.
+func ParseConflictPolicy(input string) (ConflictPolicy, error) {
+	for i, policy := range conflictPolicyStrings {
+		if strings.EqualFold(input, policy) {
+			return ConflictPolicy(i), nil
+		}
+	}
+
+	return ConflictKeepFirst, errors.Errorf("unknown conflict policy %q", input)
+}
+
+// ConflictPolicies are the conflict policies for each type of record.
+// The zero value keeps the first of each record.
+type ConflictPolicies struct {
+	BlockDelays           ConflictPolicy
+	HeadDelays            ConflictPolicy
+	AggregateAttestations ConflictPolicy
+	AttestationSummaries  ConflictPolicy
+}
+
+// Check checks that each policy is valid for its type of record.
+func (p *ConflictPolicies) Check() error {
+	if p.BlockDelays > ConflictKeepMinimumDelay {
+		return errors.Errorf("conflict policy %s is not valid for block delays", p.BlockDelays)
+	}
+	if p.HeadDelays > ConflictKeepMinimumDelay {
+		return errors.Errorf("conflict policy %s is not valid for head delays", p.HeadDelays)
+	}
+	if p.AggregateAttestations > ConflictKeepMinimumDelay {
+		return errors.Errorf("conflict policy %s is not valid for aggregate attestations", p.AggregateAttestations)
+	}
+	if p.AttestationSummaries == ConflictKeepMinimumDelay || p.AttestationSummaries > ConflictMerge {
+		return errors.Errorf("conflict policy %s is not valid for attestation summaries", p.AttestationSummaries)
+	}
+
+	return nil
+}
+
+// MergeAttesterBuckets merges new attester buckets in to existing attester
+// buckets, and returns the merged buckets along with a flag that is true if
+// they differ from the existing buckets.
+// Each attester is kept only in the earliest bucket in which it was seen in
+// either set of buckets, so that partial summaries of the same attestation
+// can be combined.
+// Buckets with a different bitlist length to that of the first non-empty
+// bucket are kept as they are.
+func MergeAttesterBuckets(existing [][]byte, update [][]byte) ([][]byte, bool) {
+	merged := make([][]byte, len(existing))
+	if len(update) > len(merged) {
+		merged = make([][]byte, len(update))
+	}
+	var seen bitfield.Bitlist
+	for i := range merged {
+		var bucket bitfield.Bitlist
+		if i < len(existing) {
+			bucket = existing[i]
+		}
+		if i < len(update) {
+			switch {
+			case bucket.Len() == 0:
+				if bitfield.Bitlist(update[i]).Len() > 0 {
+					bucket = update[i]
+				}
+			case bucket.Len() == bitfield.Bitlist(update[i]).Len():
+				// Lengths are known to match, so this cannot fail.
+				bucket, _ = bucket.Or(update[i])
+			}
+		}
+
+		switch {
+		case bucket.Len() == 0:
+			// Nothing to merge.
+		case seen == nil:
+			seen = bitfield.NewBitlist(bucket.Len())
+			fallthrough
+		case seen.Len() == bucket.Len():
+			bucket = append(bitfield.Bitlist{}, bucket...)
+			for j := uint64(0); j < bucket.Len(); j++ {
+				if !bucket.BitAt(j) {
+					continue
+				}
+				if seen.BitAt(j) {
+					// Seen in an earlier bucket.
+					bucket.SetBitAt(j, false)
+				} else {
+					seen.SetBitAt(j, true)
+				}
+			}
+		}
+		merged[i] = bucket
+	}
+
+	// Additional buckets are only kept if they contain attesters.
+	for len(merged) > len(existing) && attesterless(merged[len(merged)-1]) {
+		merged = merged[:len(merged)-1]
+	}
+
+	changed := len(merged) != len(existing)
+	for i := 0; !changed && i < len(existing); i++ {
+		changed = !bytes.Equal(merged[i], existing[i])
+	}
+
+	return merged, changed
+}
+
+// attesterless returns true if the bucket has no attesters.
+func attesterless(bucket bitfield.Bitlist) bool {
+	return bucket.Len() == 0 || bucket.Count() == 0
+}
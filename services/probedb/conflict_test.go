@@ -0,0 +1,188 @@
+// Copyright © 2023 Weald Technology Trading.
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package probedb_test
+
+import (
+	"testing"
+
+	"github.com/stretchr/testify/require"
+	"github.com/wealdtech/probed/services/probedb"
+)
+
+func TestParseConflictPolicy(t *testing.T) {
+	for _, policy := range []probedb.ConflictPolicy{
+		probedb.ConflictKeepFirst,
+		probedb.ConflictKeepLatest,
+		probedb.ConflictKeepMinimumDelay,
+		probedb.ConflictMerge,
+	} {
+		parsed, err := probedb.ParseConflictPolicy(policy.String())
+		require.NoError(t, err)
+		require.Equal(t, policy, parsed)
+	}
+
+	_, err := probedb.ParseConflictPolicy("keep-best")
+	require.EqualError(t, err, `unknown conflict policy "keep-best"`)
+}
+
+func TestConflictPoliciesCheck(t *testing.T) {
+	tests := []struct {
+		name     string
+		policies probedb.ConflictPolicies
+		err      string
+	}{
+		{
+			name: "Default",
+		},
+		{
+			name: "Good",
+			policies: probedb.ConflictPolicies{
+				BlockDelays:           probedb.ConflictKeepMinimumDelay,
+				HeadDelays:            probedb.ConflictKeepLatest,
+				AggregateAttestations: probedb.ConflictKeepMinimumDelay,
+				AttestationSummaries:  probedb.ConflictMerge,
+			},
+		},
+		{
+			name:     "BlockDelaysMerge",
+			policies: probedb.ConflictPolicies{BlockDelays: probedb.ConflictMerge},
+			err:      "conflict policy merge is not valid for block delays",
+		},
+		{
+			name:     "AggregateAttestationsMerge",
+			policies: probedb.ConflictPolicies{AggregateAttestations: probedb.ConflictMerge},
+			err:      "conflict policy merge is not valid for aggregate attestations",
+		},
+		{
+			name:     "AttestationSummariesKeepMinimumDelay",
+			policies: probedb.ConflictPolicies{AttestationSummaries: probedb.ConflictKeepMinimumDelay},
+			err:      "conflict policy keep-minimum-delay is not valid for attestation summaries",
+		},
+	}
+
+	for _, test := range tests {
+		t.Run(test.name, func(t *testing.T) {
+			err := test.policies.Check()
+			if test.err != "" {
+				require.EqualError(t, err, test.err)
+			} else {
+				require.NoError(t, err)
+			}
+		})
+	}
+}
+
+func TestMergeAttesterBuckets(t *testing.T) {
+	tests := []struct {
+		name     string
+		existing [][]byte
+		update   [][]byte
+		merged   [][]byte
+		changed  bool
+	}{
+		{
+			name:     "Empty",
+			existing: [][]byte{},
+			update:   [][]byte{},
+			merged:   [][]byte{},
+		},
+		{
+			name:     "Same",
+			existing: [][]byte{{0x01, 0x01}},
+			update:   [][]byte{{0x01, 0x01}},
+			merged:   [][]byte{{0x01, 0x01}},
+		},
+		{
+			name:     "Subset",
+			existing: [][]byte{{0x03, 0x01}},
+			update:   [][]byte{{0x01, 0x01}},
+			merged:   [][]byte{{0x03, 0x01}},
+		},
+		{
+			name:     "Or",
+			existing: [][]byte{{0x01, 0x01}, {}},
+			update:   [][]byte{{0x02, 0x01}, {0x04, 0x01}},
+			merged:   [][]byte{{0x03, 0x01}, {0x04, 0x01}},
+			changed:  true,
+		},
+		{
+			name:     "MoreBuckets",
+			existing: [][]byte{{0x01, 0x01}},
+			update:   [][]byte{nil, {0x04, 0x01}},
+			merged:   [][]byte{{0x01, 0x01}, {0x04, 0x01}},
+			changed:  true,
+		},
+		{
+			name:     "EmptyExtraBuckets",
+			existing: [][]byte{{0x01, 0x01}},
+			update:   [][]byte{{0x01, 0x01}, {}, nil},
+			merged:   [][]byte{{0x01, 0x01}},
+		},
+		{
+			name:     "EarlierInUpdate",
+			existing: [][]byte{{}, {0x06, 0x01}},
+			update:   [][]byte{{0x02, 0x01}},
+			merged:   [][]byte{{0x02, 0x01}, {0x04, 0x01}},
+			changed:  true,
+		},
+		{
+			name:     "LaterInUpdate",
+			existing: [][]byte{{0x02, 0x01}},
+			update:   [][]byte{{}, {0x06, 0x01}},
+			merged:   [][]byte{{0x02, 0x01}, {0x04, 0x01}},
+			changed:  true,
+		},
+		{
+			name:     "AllSeenEarlier",
+			existing: [][]byte{{0x03, 0x01}},
+			update:   [][]byte{{}, {0x03, 0x01}},
+			merged:   [][]byte{{0x03, 0x01}},
+		},
+		{
+			name:     "AllSeenEarlierExistingBucket",
+			existing: [][]byte{{0x01, 0x01}, {0x02, 0x01}},
+			update:   [][]byte{{0x02, 0x01}},
+			merged:   [][]byte{{0x03, 0x01}, {0x00, 0x01}},
+			changed:  true,
+		},
+		{
+			name:     "LengthBitInFirstByte",
+			existing: [][]byte{{0x11}},
+			update:   [][]byte{{0x12}, {0x17}},
+			merged:   [][]byte{{0x13}, {0x14}},
+			changed:  true,
+		},
+		{
+			name:     "DifferentLengths",
+			existing: [][]byte{{0x01, 0x01}},
+			update:   [][]byte{{0x02, 0x02}},
+			merged:   [][]byte{{0x01, 0x01}},
+		},
+		{
+			name:     "DifferentLengthsLaterBucket",
+			existing: [][]byte{{0x01, 0x01}},
+			update:   [][]byte{{}, {0x01, 0x02}},
+			merged:   [][]byte{{0x01, 0x01}, {0x01, 0x02}},
+			changed:  true,
+		},
+	}
+
+	for _, test := range tests {
+		t.Run(test.name, func(t *testing.T) {
+			merged, changed := probedb.MergeAttesterBuckets(test.existing, test.update)
+			require.Equal(t, test.merged, merged)
+			require.Equal(t, test.changed, changed)
+		})
+	}
+}
@@ -0,0 +1,220 @@
+// Copyright © 2023 Weald Technology Trading.
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package probedb
+
+import (
+	"bytes"
+	"encoding/base64"
+	"encoding/json"
+	"net"
+	"sort"
+	"strings"
+
+	"github.com/pkg/errors"
+)
+
+// Position is the position of a result in the order in which results are returned.
+// It contains the slot and the unique key of the result, and is encoded as an
+// opaque cursor that can be passed in a filter to continue fetching results
+// after the result.
+type Position struct {
+	Epoch          uint32   `json:"epoch,omitempty"`
+	Slot           uint32   `json:"slot,omitempty"`
+	Method         string   `json:"method,omitempty"`
+	IPAddr         net.IP   `json:"ip_addr,omitempty"`
+	Source         string   `json:"source,omitempty"`
+	CommitteeIndex uint16   `json:"committee_index,omitempty"`
+	Data           [][]byte `json:"data,omitempty"`
+}
+
+// DelayPosition returns the position of a delay.
+func DelayPosition(delay *Delay) *Position {
+	return &Position{
+		Slot:   delay.Slot,
+		Method: delay.Method,
+		IPAddr: forceIPv4(delay.IPAddr),
+		Source: delay.Source,
+	}
+}
+
+// DelayStatisticsPosition returns the position of a group of delay statistics.
+func DelayStatisticsPosition(statistics *DelayStatistics) *Position {
+	return &Position{
+		Epoch:  statistics.Epoch,
+		Slot:   statistics.Slot,
+		Method: statistics.Method,
+		IPAddr: forceIPv4(statistics.IPAddr),
+		Source: statistics.Source,
+	}
+}
+
+// AggregateAttestationPosition returns the position of an aggregate attestation.
+func AggregateAttestationPosition(aggregateAttestation *AggregateAttestation) *Position {
+	return &Position{
+		Slot:           aggregateAttestation.Slot,
+		Method:         aggregateAttestation.Method,
+		IPAddr:         forceIPv4(aggregateAttestation.IPAddr),
+		Source:         aggregateAttestation.Source,
+		CommitteeIndex: aggregateAttestation.CommitteeIndex,
+		Data:           [][]byte{aggregateAttestation.AggregationBits},
+	}
+}
+
+// AttestationSummaryPosition returns the position of an attestation summary.
+func AttestationSummaryPosition(summary *AttestationSummary) *Position {
+	return &Position{
+		Slot:           summary.Slot,
+		Method:         summary.Method,
+		IPAddr:         forceIPv4(summary.IPAddr),
+		Source:         summary.Source,
+		CommitteeIndex: summary.CommitteeIndex,
+		Data:           [][]byte{summary.BeaconBlockRoot, summary.SourceRoot, summary.TargetRoot},
+	}
+}
+
+// Cursor returns the opaque cursor for the position.
+func (p *Position) Cursor() string {
+	data, err := json.Marshal(p)
+	if err != nil {
+		// Cannot happen, as all fields can be marshalled.
+		panic(err)
+	}
+
+	return base64.RawURLEncoding.EncodeToString(data)
+}
+
+// ParseDelayCursor parses an opaque cursor for delays or delay statistics
+// in to a position.
+// It returns nil if the cursor is empty.
+func ParseDelayCursor(cursor string) (*Position, error) {
+	return parseCursor(cursor, 0)
+}
+
+// ParseAggregateAttestationCursor parses an opaque cursor for aggregate
+// attestations in to a position.
+// It returns nil if the cursor is empty.
+func ParseAggregateAttestationCursor(cursor string) (*Position, error) {
+	return parseCursor(cursor, 1)
+}
+
+// ParseAttestationSummaryCursor parses an opaque cursor for attestation
+// summaries in to a position.
+// It returns nil if the cursor is empty.
+func ParseAttestationSummaryCursor(cursor string) (*Position, error) {
+	return parseCursor(cursor, 3)
+}
+
+// parseCursor parses an opaque cursor in to a position, checking that it
+// has the expected number of data items.
+func parseCursor(cursor string, dataItems int) (*Position, error) {
+	if cursor == "" {
+		return nil, nil
+	}
+
+	data, err := base64.RawURLEncoding.DecodeString(cursor)
+	if err != nil {
+		return nil, errors.New("invalid cursor")
+	}
+	position := &Position{}
+	if err := json.Unmarshal(data, position); err != nil {
+		return nil, errors.New("invalid cursor")
+	}
+	if len(position.Data) != dataItems {
+		return nil, errors.New("invalid cursor")
+	}
+	if position.IPAddr != nil {
+		position.IPAddr = forceIPv4(position.IPAddr)
+	}
+
+	return position, nil
+}
+
+// ComparePositions compares two positions, returning -1 if a comes before b,
+// 0 if they are the same and 1 if a comes after b.
+// Epochs and slots are compared in the given order; all other fields are
+// compared in ascending order, with IP addresses compared in the same way as
+// PostgreSQL.
+func ComparePositions(order Order, a *Position, b *Position) int {
+	if a.Epoch != b.Epoch {
+		cmp := 1
+		if a.Epoch < b.Epoch {
+			cmp = -1
+		}
+		if order == OrderLatest {
+			cmp = -cmp
+		}
+		return cmp
+	}
+	if a.Slot != b.Slot {
+		cmp := 1
+		if a.Slot < b.Slot {
+			cmp = -1
+		}
+		if order == OrderLatest {
+			cmp = -cmp
+		}
+		return cmp
+	}
+	if cmp := strings.Compare(a.Method, b.Method); cmp != 0 {
+		return cmp
+	}
+	if cmp := compareIPAddrs(a.IPAddr, b.IPAddr); cmp != 0 {
+		return cmp
+	}
+	if cmp := strings.Compare(a.Source, b.Source); cmp != 0 {
+		return cmp
+	}
+	if a.CommitteeIndex != b.CommitteeIndex {
+		if a.CommitteeIndex < b.CommitteeIndex {
+			return -1
+		}
+		return 1
+	}
+	for i := 0; i < len(a.Data) && i < len(b.Data); i++ {
+		if cmp := bytes.Compare(a.Data[i], b.Data[i]); cmp != 0 {
+			return cmp
+		}
+	}
+	switch {
+	case len(a.Data) < len(b.Data):
+		return -1
+	case len(a.Data) > len(b.Data):
+		return 1
+	default:
+		return 0
+	}
+}
+
+// Page returns the range of indices of a set of results, sorted in to position
+// order, that follow the cursor, up to the limit.
+// It is for use by databases that cannot apply cursors natively.
+func Page(results int,
+	position func(int) *Position,
+	order Order,
+	cursor *Position,
+	limit uint32,
+) (int, int) {
+	start := 0
+	if cursor != nil {
+		start = sort.Search(results, func(i int) bool {
+			return ComparePositions(order, position(i), cursor) > 0
+		})
+	}
+	end := results
+	if limit != 0 && end-start > int(limit) {
+		end = start + int(limit)
+	}
+
+	return start, end
+}
@@ -0,0 +1,31 @@
+// Copyright © 2023 Weald Technology Trading.
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package probedb
+
+import (
+	"fmt"
+	"time"
+)
+
+// UnavailableError is returned when the database is temporarily unavailable
+// and the caller should not retry the operation until RetryAfter has passed.
+type UnavailableError struct {
+	// RetryAfter is the time after which the operation may succeed.
+	RetryAfter time.Duration
+}
+
+// Error returns a string representation of the error.
+func (e *UnavailableError) Error() string {
+	return fmt.Sprintf("database unavailable; retry after %s", e.RetryAfter)
+}
@@ -42,12 +42,19 @@ const (
 
 // DelayFilter defines a filter for fetching delays.
 // Filter elements are ANDed together.
-// Results are always returned in ascending slot/method/IP address/source order.
+// Results are returned in slot order, as given by Order, and then in ascending
+// method/IP address/source order.
+// Delay statistics are returned in epoch and slot order, as given by Order, and
+// then in ascending order of their remaining grouping dimensions.
 type DelayFilter struct {
 	// IPAddr is the IP address from which to fetch delays.
 	// If empty then there is no IP address filter.
 	IPAddr string
 
+	// Prober is the prober from which to fetch delays.
+	// If empty then there is no prober filter.
+	Prober string
+
 	// Sources are the beacon nodes from which to fetch results.
 	// If empty then there is no source filter.
 	Sources []string
@@ -72,17 +79,47 @@ type DelayFilter struct {
 
 	// Selection is the selection of the delay(s).
 	// The default is SelectionMinimum.
+	// It is ignored when fetching delay statistics.
 	Selection Selection
+
+	// Statistics are the statistics to calculate for each group when fetching
+	// delay statistics.
+	// It is ignored when fetching delays.
+	Statistics []Statistic
+
+	// GroupBy are the dimensions by which delays are grouped when fetching
+	// delay statistics.
+	// If empty then delays are grouped by slot.
+	// It is ignored when fetching delays.
+	GroupBy []Dimension
+
+	// SlotsPerEpoch is the number of slots in an epoch, used when grouping by epoch.
+	// If 0 then the mainnet value of 32 is used.
+	SlotsPerEpoch uint32
+
+	// Limit is the maximum number of results to return.
+	// If 0 then there is no limit.
+	Limit uint32
+
+	// Cursor is a cursor obtained from the position of a previously returned
+	// delay or group of delay statistics.
+	// If set then only results after that position are returned.
+	Cursor string
 }
 
 // AggregateAttestationFilter defines a filter for fetching aggregate attestations.
 // Filter elements are ANDed together.
-// Results are always returned in ascending slot/method/IP address/source order.
+// Results are returned in slot order, as given by Order, and then in ascending
+// method/IP address/source/committee index/aggregation bits order.
 type AggregateAttestationFilter struct {
 	// IPAddr is the IP address from which to fetch results.
 	// If empty then there is no IP address filter.
 	IPAddr string
 
+	// Prober is the prober from which to fetch results.
+	// If empty then there is no prober filter.
+	Prober string
+
 	// Sources are the beacon nodes from which to fetch results.
 	// If empty then there is no source filter.
 	Sources []string
@@ -108,16 +145,25 @@ type AggregateAttestationFilter struct {
 	// Limit is the maximum number of results to return.
 	// If 0 then there is no limit.
 	Limit uint32
+
+	// Cursor is a cursor obtained from the position of a previously returned result.
+	// If set then only results after that position are returned.
+	Cursor string
 }
 
 // AttestationSummaryFilter defines a filter for fetching attestation summaries.
 // Filter elements are ANDed together.
-// Results are always returned in ascending slot/method/IP address/source order.
+// Results are returned in slot order, as given by Order, and then in ascending
+// method/IP address/source/committee index/beacon block root/source root/target root order.
 type AttestationSummaryFilter struct {
 	// IPAddr is the IP address from which to fetch data.
 	// If empty then there is no IP address filter.
 	IPAddr string
 
+	// Prober is the prober from which to fetch data.
+	// If empty then there is no prober filter.
+	Prober string
+
 	// Sources are the beacon nodes from which to fetch results.
 	// If empty then there is no source filter.
 	Sources []string
@@ -143,4 +189,8 @@ type AttestationSummaryFilter struct {
 	// Limit is the maximum number of results to return.
 	// If 0 then there is no limit.
 	Limit uint32
+
+	// Cursor is a cursor obtained from the position of a previously returned result.
+	// If set then only results after that position are returned.
+	Cursor string
 }
@@ -0,0 +1,35 @@
+// Copyright © 2023 Weald Technology Trading.
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package memory_test
+
+import (
+	"context"
+	"testing"
+
+	"github.com/wealdtech/probed/services/probedb"
+	"github.com/wealdtech/probed/services/probedb/memory"
+	"github.com/wealdtech/probed/services/probedb/probedbtest"
+)
+
+func TestConformance(t *testing.T) {
+	probedbtest.Run(t, func(ctx context.Context, t *testing.T) probedbtest.Service {
+		return newService(ctx, t)
+	})
+}
+
+func TestConflictPolicyConformance(t *testing.T) {
+	probedbtest.RunConflictPolicies(t, func(ctx context.Context, t *testing.T, policies probedb.ConflictPolicies) probedbtest.Service {
+		return newService(ctx, t, memory.WithConflictPolicies(policies))
+	})
+}
@@ -0,0 +1,50 @@
+// Copyright © 2023 Weald Technology Trading.
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package memory
+
+import (
+	"context"
+)
+
+// SetMetadata sets a metadata key to a JSON value.
+func (s *Service) SetMetadata(ctx context.Context, key string, value []byte) error {
+	t := s.tx(ctx)
+	if t == nil {
+		return ErrNoTransaction
+	}
+
+	previous, exists := s.metadata[key]
+	s.metadata[key] = append([]byte{}, value...)
+	t.undo = append(t.undo, func() {
+		if exists {
+			s.metadata[key] = previous
+		} else {
+			delete(s.metadata, key)
+		}
+	})
+
+	return nil
+}
+
+// Metadata obtains the JSON value from a metadata key.
+func (s *Service) Metadata(ctx context.Context, key string) ([]byte, error) {
+	var res []byte
+	s.withTx(ctx, func(func(func())) {
+		if value, exists := s.metadata[key]; exists {
+			res = append([]byte{}, value...)
+		}
+	})
+
+	return res, nil
+}
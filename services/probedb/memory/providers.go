@@ -0,0 +1,219 @@
+// Copyright © 2023 Weald Technology Trading.
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package memory
+
+import (
+	"context"
+	"math"
+	"net"
+	"sort"
+
+	"github.com/attestantio/go-eth2-client/spec/phase0"
+	"github.com/pkg/errors"
+	"github.com/wealdtech/probed/services/probedb"
+)
+
+// BlockDelays obtains the block delays for a range of slots.
+func (s *Service) BlockDelays(ctx context.Context, filter *probedb.DelayFilter) ([]*probedb.Delay, error) {
+	return s.delays(ctx, &s.blockDelays, filter)
+}
+
+// HeadDelays obtains the head delays for a range of slots.
+func (s *Service) HeadDelays(ctx context.Context, filter *probedb.DelayFilter) ([]*probedb.Delay, error) {
+	return s.delays(ctx, &s.headDelays, filter)
+}
+
+// delays obtains delays from the given table.
+func (s *Service) delays(ctx context.Context, table *[]*probedb.Delay, filter *probedb.DelayFilter) ([]*probedb.Delay, error) {
+	if filter.Order > probedb.OrderLatest {
+		return nil, errors.New("no order specified")
+	}
+	if filter.Selection > probedb.SelectionMedian {
+		return nil, errors.New("unhandled selection criteria")
+	}
+	cursor, err := probedb.ParseDelayCursor(filter.Cursor)
+	if err != nil {
+		return nil, err
+	}
+	match := matcher(filter.IPAddr, filter.Prober, filter.Sources, filter.Methods, filter.From, filter.To)
+
+	delays := make([]*probedb.Delay, 0)
+	s.withTx(ctx, func(func(func())) {
+		for _, delay := range *table {
+			if match(delay.IPAddr, delay.Prober, delay.Source, delay.Method, delay.Slot) {
+				row := *delay
+				delays = append(delays, &row)
+			}
+		}
+	})
+
+	if filter.Selection == probedb.SelectionAll {
+		sort.SliceStable(delays, func(i, j int) bool {
+			return probedb.ComparePositions(filter.Order, probedb.DelayPosition(delays[i]), probedb.DelayPosition(delays[j])) < 0
+		})
+		start, end := probedb.Page(len(delays), func(i int) *probedb.Position { return probedb.DelayPosition(delays[i]) }, filter.Order, cursor, filter.Limit)
+		return delays[start:end], nil
+	}
+
+	// Group the delays by slot.
+	sort.SliceStable(delays, func(i, j int) bool {
+		if delays[i].Slot != delays[j].Slot {
+			if filter.Order == probedb.OrderLatest {
+				return delays[i].Slot > delays[j].Slot
+			}
+			return delays[i].Slot < delays[j].Slot
+		}
+		return delays[i].DelayMS < delays[j].DelayMS
+	})
+	res := make([]*probedb.Delay, 0)
+	for start := 0; start < len(delays); {
+		end := start
+		for end < len(delays) && delays[end].Slot == delays[start].Slot {
+			end++
+		}
+		slotDelays := delays[start:end]
+		var delayMS uint32
+		switch filter.Selection {
+		case probedb.SelectionMinimum:
+			delayMS = slotDelays[0].DelayMS
+		case probedb.SelectionMaximum:
+			delayMS = slotDelays[len(slotDelays)-1].DelayMS
+		case probedb.SelectionMedian:
+			// The median of an even number of delays is the mean of the middle two,
+			// rounded to the nearest integer in the same way as PostgreSQL.
+			delayMS = slotDelays[len(slotDelays)/2].DelayMS
+			if len(slotDelays)%2 == 0 {
+				delayMS = uint32(math.RoundToEven((float64(slotDelays[len(slotDelays)/2-1].DelayMS) + float64(delayMS)) / 2))
+			}
+		}
+		res = append(res, &probedb.Delay{
+			Slot:    slotDelays[0].Slot,
+			DelayMS: delayMS,
+		})
+		start = end
+	}
+	start, end := probedb.Page(len(res), func(i int) *probedb.Position { return probedb.DelayPosition(res[i]) }, filter.Order, cursor, filter.Limit)
+
+	return res[start:end], nil
+}
+
+// AggregateAttestations obtains the aggregate attestations for a filter.
+func (s *Service) AggregateAttestations(ctx context.Context, filter *probedb.AggregateAttestationFilter) ([]*probedb.AggregateAttestation, error) {
+	if filter.Order > probedb.OrderLatest {
+		return nil, errors.New("no order specified")
+	}
+	cursor, err := probedb.ParseAggregateAttestationCursor(filter.Cursor)
+	if err != nil {
+		return nil, err
+	}
+	match := matcher(filter.IPAddr, filter.Prober, filter.Sources, filter.Methods, filter.From, filter.To)
+
+	aggregateAttestations := make([]*probedb.AggregateAttestation, 0)
+	s.withTx(ctx, func(func(func())) {
+		for _, aggregateAttestation := range s.aggregateAttestations {
+			if match(aggregateAttestation.IPAddr, aggregateAttestation.Prober, aggregateAttestation.Source, aggregateAttestation.Method, aggregateAttestation.Slot) {
+				row := *aggregateAttestation
+				aggregateAttestations = append(aggregateAttestations, &row)
+			}
+		}
+	})
+
+	position := func(i int) *probedb.Position {
+		return probedb.AggregateAttestationPosition(aggregateAttestations[i])
+	}
+	sort.Slice(aggregateAttestations, func(i, j int) bool {
+		return probedb.ComparePositions(filter.Order, position(i), position(j)) < 0
+	})
+	start, end := probedb.Page(len(aggregateAttestations), position, filter.Order, cursor, filter.Limit)
+
+	return aggregateAttestations[start:end], nil
+}
+
+// AttestationSummaries obtains the attestation summaries for a filter.
+func (s *Service) AttestationSummaries(ctx context.Context, filter *probedb.AttestationSummaryFilter) ([]*probedb.AttestationSummary, error) {
+	if filter.Order > probedb.OrderLatest {
+		return nil, errors.New("no order specified")
+	}
+	cursor, err := probedb.ParseAttestationSummaryCursor(filter.Cursor)
+	if err != nil {
+		return nil, err
+	}
+	match := matcher(filter.IPAddr, filter.Prober, filter.Sources, filter.Methods, filter.From, filter.To)
+
+	summaries := make([]*probedb.AttestationSummary, 0)
+	s.withTx(ctx, func(func(func())) {
+		for _, summary := range s.attestationSummaries {
+			if match(summary.IPAddr, summary.Prober, summary.Source, summary.Method, summary.Slot) {
+				row := *summary
+				summaries = append(summaries, &row)
+			}
+		}
+	})
+
+	position := func(i int) *probedb.Position {
+		return probedb.AttestationSummaryPosition(summaries[i])
+	}
+	sort.Slice(summaries, func(i, j int) bool {
+		return probedb.ComparePositions(filter.Order, position(i), position(j)) < 0
+	})
+	start, end := probedb.Page(len(summaries), position, filter.Order, cursor, filter.Limit)
+
+	return summaries[start:end], nil
+}
+
+// matcher returns a function that matches records against the common filter fields.
+func matcher(ipAddr string,
+	prober string,
+	sources []string,
+	methods []string,
+	from *phase0.Slot,
+	to *phase0.Slot,
+) func(net.IP, string, string, string, uint32) bool {
+	var filterIP net.IP
+	if ipAddr != "" {
+		filterIP = forceIPv4(net.ParseIP(ipAddr))
+	}
+
+	return func(recordIP net.IP, recordProber string, recordSource string, recordMethod string, recordSlot uint32) bool {
+		if filterIP != nil && !filterIP.Equal(recordIP) {
+			return false
+		}
+		if prober != "" && prober != recordProber {
+			return false
+		}
+		if len(sources) > 0 && !contains(sources, recordSource) {
+			return false
+		}
+		if len(methods) > 0 && !contains(methods, recordMethod) {
+			return false
+		}
+		if from != nil && phase0.Slot(recordSlot) < *from {
+			return false
+		}
+		if to != nil && phase0.Slot(recordSlot) > *to {
+			return false
+		}
+		return true
+	}
+}
+
+// contains returns true if the value is present in the list.
+func contains(list []string, value string) bool {
+	for _, item := range list {
+		if item == value {
+			return true
+		}
+	}
+	return false
+}
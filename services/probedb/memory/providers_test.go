@@ -0,0 +1,286 @@
+// Copyright © 2023 Weald Technology Trading.
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package memory_test
+
+import (
+	"context"
+	"testing"
+
+	"github.com/attestantio/go-eth2-client/spec/phase0"
+	"github.com/stretchr/testify/require"
+	"github.com/wealdtech/probed/services/probedb"
+)
+
+func slotPtr(in phase0.Slot) *phase0.Slot {
+	return &in
+}
+
+func TestDelays(t *testing.T) {
+	ctx, cancel := context.WithCancel(context.Background())
+	defer cancel()
+	s := newService(ctx, t)
+
+	delays := []*probedb.Delay{
+		{IPAddr: parseIP("1.2.3.4"), Prober: "prober1", Source: "Source 1", Method: "Method 1", Slot: 1, DelayMS: 100},
+		{IPAddr: parseIP("1.2.3.4"), Prober: "prober1", Source: "Source 2", Method: "Method 1", Slot: 1, DelayMS: 200},
+		{IPAddr: parseIP("::1"), Prober: "prober2", Source: "Source 1", Method: "Method 2", Slot: 1, DelayMS: 400},
+		{IPAddr: parseIP("::1"), Prober: "prober2", Source: "Source 1", Method: "Method 2", Slot: 2, DelayMS: 50},
+		{IPAddr: parseIP("5.6.7.8"), Prober: "prober3", Source: "Source 1", Method: "Method 3", Slot: 3, DelayMS: 75},
+	}
+	for _, delay := range delays {
+		_, err := s.SetHeadDelay(ctx, delay)
+		require.NoError(t, err)
+	}
+
+	tests := []struct {
+		name   string
+		filter *probedb.DelayFilter
+		res    []*probedb.Delay
+		err    string
+	}{
+		{
+			name:   "SelectionInvalid",
+			filter: &probedb.DelayFilter{Selection: 99},
+			err:    "unhandled selection criteria",
+		},
+		{
+			name:   "All",
+			filter: &probedb.DelayFilter{Selection: probedb.SelectionAll},
+			res:    []*probedb.Delay{delays[0], delays[1], delays[2], delays[3], delays[4]},
+		},
+		{
+			name:   "Minimum",
+			filter: &probedb.DelayFilter{Selection: probedb.SelectionMinimum},
+			res:    []*probedb.Delay{{Slot: 1, DelayMS: 100}, {Slot: 2, DelayMS: 50}, {Slot: 3, DelayMS: 75}},
+		},
+		{
+			name:   "Maximum",
+			filter: &probedb.DelayFilter{Selection: probedb.SelectionMaximum},
+			res:    []*probedb.Delay{{Slot: 1, DelayMS: 400}, {Slot: 2, DelayMS: 50}, {Slot: 3, DelayMS: 75}},
+		},
+		{
+			name:   "Median",
+			filter: &probedb.DelayFilter{Selection: probedb.SelectionMedian},
+			res:    []*probedb.Delay{{Slot: 1, DelayMS: 200}, {Slot: 2, DelayMS: 50}, {Slot: 3, DelayMS: 75}},
+		},
+		{
+			name:   "MedianEven",
+			filter: &probedb.DelayFilter{Selection: probedb.SelectionMedian, Methods: []string{"Method 1"}},
+			res:    []*probedb.Delay{{Slot: 1, DelayMS: 150}},
+		},
+		{
+			name:   "IPAddr",
+			filter: &probedb.DelayFilter{Selection: probedb.SelectionAll, IPAddr: "::1"},
+			res:    []*probedb.Delay{delays[2], delays[3]},
+		},
+		{
+			name:   "Prober",
+			filter: &probedb.DelayFilter{Selection: probedb.SelectionAll, Prober: "prober1"},
+			res:    []*probedb.Delay{delays[0], delays[1]},
+		},
+		{
+			name:   "Sources",
+			filter: &probedb.DelayFilter{Selection: probedb.SelectionAll, Sources: []string{"Source 2"}},
+			res:    []*probedb.Delay{delays[1]},
+		},
+		{
+			name:   "Methods",
+			filter: &probedb.DelayFilter{Selection: probedb.SelectionAll, Methods: []string{"Method 2", "Method 3"}},
+			res:    []*probedb.Delay{delays[2], delays[3], delays[4]},
+		},
+		{
+			name:   "FromTo",
+			filter: &probedb.DelayFilter{Selection: probedb.SelectionAll, From: slotPtr(2), To: slotPtr(2)},
+			res:    []*probedb.Delay{delays[3]},
+		},
+		{
+			name:   "OrderInvalid",
+			filter: &probedb.DelayFilter{Selection: probedb.SelectionAll, Order: 99},
+			err:    "no order specified",
+		},
+		{
+			name:   "Latest",
+			filter: &probedb.DelayFilter{Selection: probedb.SelectionAll, Order: probedb.OrderLatest},
+			res:    []*probedb.Delay{delays[4], delays[3], delays[0], delays[1], delays[2]},
+		},
+		{
+			name:   "LatestLimit",
+			filter: &probedb.DelayFilter{Selection: probedb.SelectionAll, Order: probedb.OrderLatest, Limit: 2},
+			res:    []*probedb.Delay{delays[4], delays[3]},
+		},
+		{
+			name:   "LatestCursor",
+			filter: &probedb.DelayFilter{Selection: probedb.SelectionAll, Order: probedb.OrderLatest, Cursor: probedb.DelayPosition(delays[3]).Cursor()},
+			res:    []*probedb.Delay{delays[0], delays[1], delays[2]},
+		},
+		{
+			name:   "MinimumLatest",
+			filter: &probedb.DelayFilter{Selection: probedb.SelectionMinimum, Order: probedb.OrderLatest},
+			res:    []*probedb.Delay{{Slot: 3, DelayMS: 75}, {Slot: 2, DelayMS: 50}, {Slot: 1, DelayMS: 100}},
+		},
+	}
+
+	for _, test := range tests {
+		t.Run(test.name, func(t *testing.T) {
+			res, err := s.HeadDelays(ctx, test.filter)
+			if test.err != "" {
+				require.EqualError(t, err, test.err)
+			} else {
+				require.NoError(t, err)
+				require.Equal(t, test.res, res)
+			}
+		})
+	}
+}
+
+func TestAggregateAttestations(t *testing.T) {
+	ctx, cancel := context.WithCancel(context.Background())
+	defer cancel()
+	s := newService(ctx, t)
+
+	aggregateAttestations := []*probedb.AggregateAttestation{
+		{IPAddr: parseIP("1.2.3.4"), Prober: "prober1", Source: "Source 1", Method: "Method 1", Slot: 12345, CommitteeIndex: 1, AggregationBits: []byte{0x01, 0x10}, BeaconBlockRoot: []byte{0x01}, SourceRoot: []byte{0x02}, TargetRoot: []byte{0x03}, DelayMS: 1123},
+		{IPAddr: parseIP("1.2.3.4"), Prober: "prober1", Source: "Source 1", Method: "Method 1", Slot: 12346, CommitteeIndex: 1, AggregationBits: []byte{0x01, 0x10}, BeaconBlockRoot: []byte{0x01}, SourceRoot: []byte{0x02}, TargetRoot: []byte{0x03}, DelayMS: 1345},
+		{IPAddr: parseIP("5.6.7.8"), Source: "Source 2", Method: "Method 2", Slot: 12347, CommitteeIndex: 2, AggregationBits: []byte{0x03}, BeaconBlockRoot: []byte{0x04}, SourceRoot: []byte{0x05}, TargetRoot: []byte{0x06}, DelayMS: 1456},
+	}
+
+	for _, aggregateAttestation := range aggregateAttestations {
+		action, err := s.SetAggregateAttestation(ctx, aggregateAttestation)
+		require.NoError(t, err)
+		require.Equal(t, probedb.ActionCreated, action)
+	}
+	action, err := s.SetAggregateAttestation(ctx, aggregateAttestations[0])
+	require.NoError(t, err)
+	require.Equal(t, probedb.ActionIgnored, action)
+
+	tests := []struct {
+		name   string
+		filter *probedb.AggregateAttestationFilter
+		res    []*probedb.AggregateAttestation
+	}{
+		{
+			name:   "All",
+			filter: &probedb.AggregateAttestationFilter{},
+			res:    aggregateAttestations,
+		},
+		{
+			name: "SingleSource",
+			filter: &probedb.AggregateAttestationFilter{
+				Sources: []string{"Source 1"},
+			},
+			res: []*probedb.AggregateAttestation{
+				aggregateAttestations[0],
+				aggregateAttestations[1],
+			},
+		},
+		{
+			name: "MultipleMethods",
+			filter: &probedb.AggregateAttestationFilter{
+				Methods: []string{"Method 1", "Method 2"},
+				To:      slotPtr(12346),
+			},
+			res: []*probedb.AggregateAttestation{
+				aggregateAttestations[0],
+				aggregateAttestations[1],
+			},
+		},
+		{
+			name: "LatestLimit",
+			filter: &probedb.AggregateAttestationFilter{
+				Order: probedb.OrderLatest,
+				Limit: 2,
+			},
+			res: []*probedb.AggregateAttestation{
+				aggregateAttestations[2],
+				aggregateAttestations[1],
+			},
+		},
+	}
+
+	for _, test := range tests {
+		t.Run(test.name, func(t *testing.T) {
+			res, err := s.AggregateAttestations(ctx, test.filter)
+			require.NoError(t, err)
+			require.Equal(t, test.res, res)
+		})
+	}
+}
+
+func TestAttestationSummaries(t *testing.T) {
+	ctx, cancel := context.WithCancel(context.Background())
+	defer cancel()
+	s := newService(ctx, t)
+
+	summaries := []*probedb.AttestationSummary{
+		{IPAddr: parseIP("1.2.3.4"), Prober: "prober1", Source: "Source 1", Method: "Method 1", Slot: 12345, CommitteeIndex: 1, BeaconBlockRoot: []byte{0x01}, SourceRoot: []byte{0x02}, TargetRoot: []byte{0x03}, AttesterBuckets: [][]byte{{0x01, 0x02}, {0x03}}},
+		{IPAddr: parseIP("1.2.3.4"), Prober: "prober1", Source: "Source 2", Method: "Method 1", Slot: 12346, CommitteeIndex: 1, BeaconBlockRoot: []byte{0x01}, SourceRoot: []byte{0x02}, TargetRoot: []byte{0x03}, AttesterBuckets: [][]byte{{0x04}}},
+	}
+
+	for _, summary := range summaries {
+		action, err := s.SetAttestationSummary(ctx, summary)
+		require.NoError(t, err)
+		require.Equal(t, probedb.ActionCreated, action)
+	}
+	action, err := s.SetAttestationSummary(ctx, summaries[1])
+	require.NoError(t, err)
+	require.Equal(t, probedb.ActionIgnored, action)
+
+	tests := []struct {
+		name   string
+		filter *probedb.AttestationSummaryFilter
+		res    []*probedb.AttestationSummary
+	}{
+		{
+			name:   "All",
+			filter: &probedb.AttestationSummaryFilter{},
+			res:    summaries,
+		},
+		{
+			name: "Source",
+			filter: &probedb.AttestationSummaryFilter{
+				Sources: []string{"Source 2"},
+			},
+			res: []*probedb.AttestationSummary{
+				summaries[1],
+			},
+		},
+		{
+			name: "From",
+			filter: &probedb.AttestationSummaryFilter{
+				From: slotPtr(12346),
+			},
+			res: []*probedb.AttestationSummary{
+				summaries[1],
+			},
+		},
+		{
+			name: "Latest",
+			filter: &probedb.AttestationSummaryFilter{
+				Order: probedb.OrderLatest,
+				Limit: 1,
+			},
+			res: []*probedb.AttestationSummary{
+				summaries[1],
+			},
+		},
+	}
+
+	for _, test := range tests {
+		t.Run(test.name, func(t *testing.T) {
+			res, err := s.AttestationSummaries(ctx, test.filter)
+			require.NoError(t, err)
+			require.Equal(t, test.res, res)
+		})
+	}
+}
@@ -0,0 +1,105 @@
+// Copyright © 2023 Weald Technology Trading.
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package memory
+
+import (
+	"context"
+
+	"github.com/attestantio/go-eth2-client/spec/phase0"
+	"github.com/wealdtech/probed/services/probedb"
+)
+
+// PruneBlockDelays removes up to limit block delays for slots before the given slot,
+// returning the number of block delays removed.
+func (s *Service) PruneBlockDelays(ctx context.Context, before phase0.Slot, limit uint32) (uint32, error) {
+	return s.pruneDelays(ctx, "block_delays", &s.blockDelays, before, limit), nil
+}
+
+// PruneHeadDelays removes up to limit head delays for slots before the given slot,
+// returning the number of head delays removed.
+func (s *Service) PruneHeadDelays(ctx context.Context, before phase0.Slot, limit uint32) (uint32, error) {
+	return s.pruneDelays(ctx, "head_delays", &s.headDelays, before, limit), nil
+}
+
+// pruneDelays removes up to limit delays for slots before the given slot from the given table.
+func (s *Service) pruneDelays(ctx context.Context, table string, delays *[]*probedb.Delay, before phase0.Slot, limit uint32) uint32 {
+	removed := uint32(0)
+	s.withTx(ctx, func(addUndo func(func())) {
+		previous := *delays
+		kept := make([]*probedb.Delay, 0, len(previous))
+		for _, delay := range previous {
+			if removed < limit && phase0.Slot(delay.Slot) < before {
+				s.removeKey(delayKey(table, delay), addUndo)
+				removed++
+				continue
+			}
+			kept = append(kept, delay)
+		}
+		*delays = kept
+		addUndo(func() { *delays = previous })
+	})
+
+	return removed
+}
+
+// PruneAggregateAttestations removes up to limit aggregate attestations for slots before the given slot,
+// returning the number of aggregate attestations removed.
+func (s *Service) PruneAggregateAttestations(ctx context.Context, before phase0.Slot, limit uint32) (uint32, error) {
+	removed := uint32(0)
+	s.withTx(ctx, func(addUndo func(func())) {
+		previous := s.aggregateAttestations
+		kept := make([]*probedb.AggregateAttestation, 0, len(previous))
+		for _, aggregateAttestation := range previous {
+			if removed < limit && phase0.Slot(aggregateAttestation.Slot) < before {
+				s.removeKey(aggregateAttestationKey(aggregateAttestation), addUndo)
+				removed++
+				continue
+			}
+			kept = append(kept, aggregateAttestation)
+		}
+		s.aggregateAttestations = kept
+		addUndo(func() { s.aggregateAttestations = previous })
+	})
+
+	return removed, nil
+}
+
+// PruneAttestationSummaries removes up to limit attestation summaries for slots before the given slot,
+// returning the number of attestation summaries removed.
+func (s *Service) PruneAttestationSummaries(ctx context.Context, before phase0.Slot, limit uint32) (uint32, error) {
+	removed := uint32(0)
+	s.withTx(ctx, func(addUndo func(func())) {
+		previous := s.attestationSummaries
+		kept := make([]*probedb.AttestationSummary, 0, len(previous))
+		for _, summary := range previous {
+			if removed < limit && phase0.Slot(summary.Slot) < before {
+				s.removeKey(attestationSummaryKey(summary), addUndo)
+				removed++
+				continue
+			}
+			kept = append(kept, summary)
+		}
+		s.attestationSummaries = kept
+		addUndo(func() { s.attestationSummaries = previous })
+	})
+
+	return removed, nil
+}
+
+// removeKey removes a unique key.
+func (s *Service) removeKey(key string, addUndo func(func())) {
+	row := s.keys[key]
+	delete(s.keys, key)
+	addUndo(func() { s.keys[key] = row })
+}
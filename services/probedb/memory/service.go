@@ -0,0 +1,66 @@
+// Copyright © 2023 Weald Technology Trading.
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package memory
+
+import (
+	"context"
+	"sync"
+
+	"github.com/pkg/errors"
+	"github.com/rs/zerolog"
+	zerologger "github.com/rs/zerolog/log"
+	"github.com/wealdtech/probed/services/probedb"
+)
+
+// Service is a probe database service that holds its data in memory.
+// Data is lost when the process exits.
+type Service struct {
+	// mu serialises access to the data; it is held for the lifetime of a transaction.
+	mu                    sync.Mutex
+	metadata              map[string][]byte
+	blockDelays           []*probedb.Delay
+	headDelays            []*probedb.Delay
+	aggregateAttestations []*probedb.AggregateAttestation
+	attestationSummaries  []*probedb.AttestationSummary
+	// keys are the unique keys of the stored data, mirroring the unique indices of the SQL databases,
+	// mapped to the stored record.
+	keys             map[string]interface{}
+	conflictPolicies probedb.ConflictPolicies
+}
+
+// module-wide log.
+var log zerolog.Logger
+
+// New creates a new service.
+func New(_ context.Context, params ...Parameter) (*Service, error) {
+	parameters, err := parseAndCheckParameters(params...)
+	if err != nil {
+		return nil, errors.Wrap(err, "problem with parameters")
+	}
+
+	// Set logging.
+	log = zerologger.With().Str("service", "probedb").Str("impl", "memory").Logger().Level(parameters.logLevel)
+
+	s := &Service{
+		metadata:              make(map[string][]byte),
+		blockDelays:           make([]*probedb.Delay, 0),
+		headDelays:            make([]*probedb.Delay, 0),
+		aggregateAttestations: make([]*probedb.AggregateAttestation, 0),
+		attestationSummaries:  make([]*probedb.AttestationSummary, 0),
+		keys:                  make(map[string]interface{}),
+		conflictPolicies:      parameters.conflictPolicies,
+	}
+
+	return s, nil
+}
@@ -0,0 +1,141 @@
+// Copyright © 2023 Weald Technology Trading.
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package memory_test
+
+import (
+	"context"
+	"net"
+	"testing"
+
+	"github.com/rs/zerolog"
+	"github.com/stretchr/testify/require"
+	"github.com/wealdtech/probed/services/probedb"
+	"github.com/wealdtech/probed/services/probedb/memory"
+)
+
+// newService creates a new empty service.
+func newService(ctx context.Context, t *testing.T, params ...memory.Parameter) *memory.Service {
+	t.Helper()
+
+	s, err := memory.New(ctx, append([]memory.Parameter{
+		memory.WithLogLevel(zerolog.Disabled),
+	}, params...)...)
+	require.NoError(t, err)
+
+	return s
+}
+
+func parseIP(input string) net.IP {
+	ipAddr := net.ParseIP(input)
+	ip := ipAddr.To4()
+	if ip == nil {
+		ip = ipAddr
+	}
+	return ip
+}
+
+func TestService(t *testing.T) {
+	ctx, cancel := context.WithCancel(context.Background())
+	defer cancel()
+
+	_, err := memory.New(ctx,
+		memory.WithLogLevel(zerolog.Disabled),
+	)
+	require.NoError(t, err)
+}
+
+func TestInterfaces(t *testing.T) {
+	ctx, cancel := context.WithCancel(context.Background())
+	defer cancel()
+	s := newService(ctx, t)
+
+	require.Implements(t, (*probedb.Service)(nil), s)
+	require.Implements(t, (*probedb.BlockDelaysSetter)(nil), s)
+	require.Implements(t, (*probedb.BlockDelaysProvider)(nil), s)
+	require.Implements(t, (*probedb.BlockDelaysBulkSetter)(nil), s)
+	require.Implements(t, (*probedb.HeadDelaysSetter)(nil), s)
+	require.Implements(t, (*probedb.HeadDelaysProvider)(nil), s)
+	require.Implements(t, (*probedb.HeadDelaysBulkSetter)(nil), s)
+	require.Implements(t, (*probedb.AggregateAttestationsSetter)(nil), s)
+	require.Implements(t, (*probedb.AggregateAttestationsProvider)(nil), s)
+	require.Implements(t, (*probedb.AggregateAttestationsBulkSetter)(nil), s)
+	require.Implements(t, (*probedb.AttestationSummariesSetter)(nil), s)
+	require.Implements(t, (*probedb.AttestationSummariesProvider)(nil), s)
+	require.Implements(t, (*probedb.AttestationSummariesBulkSetter)(nil), s)
+	require.Implements(t, (*probedb.BlockDelaysPruner)(nil), s)
+	require.Implements(t, (*probedb.HeadDelaysPruner)(nil), s)
+	require.Implements(t, (*probedb.AggregateAttestationsPruner)(nil), s)
+	require.Implements(t, (*probedb.AttestationSummariesPruner)(nil), s)
+}
+
+func TestTransactions(t *testing.T) {
+	ctx, cancel := context.WithCancel(context.Background())
+	defer cancel()
+	s := newService(ctx, t)
+
+	delay := &probedb.Delay{IPAddr: parseIP("1.2.3.4"), Source: "Source 1", Method: "Method 1", Slot: 1, DelayMS: 100}
+
+	// Cancelled transaction should not store the delay.
+	txCtx, txCancel, err := s.BeginTx(ctx)
+	require.NoError(t, err)
+	_, err = s.SetBlockDelay(txCtx, delay)
+	require.NoError(t, err)
+	txCancel()
+	delays, err := s.BlockDelays(ctx, &probedb.DelayFilter{Selection: probedb.SelectionAll})
+	require.NoError(t, err)
+	require.Len(t, delays, 0)
+
+	// Committed transaction should store the delay.
+	txCtx, txCancel, err = s.BeginTx(ctx)
+	require.NoError(t, err)
+	_, err = s.SetBlockDelay(txCtx, delay)
+	require.NoError(t, err)
+	require.NoError(t, s.CommitTx(txCtx))
+	txCancel()
+	delays, err = s.BlockDelays(ctx, &probedb.DelayFilter{Selection: probedb.SelectionAll})
+	require.NoError(t, err)
+	require.Equal(t, []*probedb.Delay{delay}, delays)
+}
+
+func TestMetadata(t *testing.T) {
+	ctx, cancel := context.WithCancel(context.Background())
+	defer cancel()
+	s := newService(ctx, t)
+
+	// Setting metadata requires a transaction.
+	require.EqualError(t, s.SetMetadata(ctx, "key", []byte(`1`)), memory.ErrNoTransaction.Error())
+
+	txCtx, txCancel, err := s.BeginTx(ctx)
+	require.NoError(t, err)
+	require.NoError(t, s.SetMetadata(txCtx, "key", []byte(`1`)))
+	require.NoError(t, s.CommitTx(txCtx))
+	txCancel()
+
+	// Cancelled transaction should restore the previous value.
+	txCtx, txCancel, err = s.BeginTx(ctx)
+	require.NoError(t, err)
+	require.NoError(t, s.SetMetadata(txCtx, "key", []byte(`2`)))
+	value, err := s.Metadata(txCtx, "key")
+	require.NoError(t, err)
+	require.Equal(t, []byte(`2`), value)
+	txCancel()
+
+	value, err = s.Metadata(ctx, "key")
+	require.NoError(t, err)
+	require.Equal(t, []byte(`1`), value)
+
+	value, err = s.Metadata(ctx, "missing")
+	require.NoError(t, err)
+	require.Nil(t, value)
+}
@@ -0,0 +1,233 @@
+// Copyright © 2023 Weald Technology Trading.
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package memory
+
+import (
+	"context"
+	"fmt"
+	"net"
+
+	"github.com/wealdtech/probed/services/probedb"
+)
+
+// SetBlockDelay sets a block delay.
+// If a delay already exists for this block then the block delay conflict policy is applied.
+func (s *Service) SetBlockDelay(ctx context.Context, delay *probedb.Delay) (probedb.Action, error) {
+	return s.setDelay(ctx, "block_delays", &s.blockDelays, delay, s.conflictPolicies.BlockDelays), nil
+}
+
+// SetHeadDelay sets a head delay.
+// If a delay already exists for this head then the head delay conflict policy is applied.
+func (s *Service) SetHeadDelay(ctx context.Context, delay *probedb.Delay) (probedb.Action, error) {
+	return s.setDelay(ctx, "head_delays", &s.headDelays, delay, s.conflictPolicies.HeadDelays), nil
+}
+
+// setDelay sets a delay in the given table.
+func (s *Service) setDelay(ctx context.Context,
+	table string,
+	delays *[]*probedb.Delay,
+	delay *probedb.Delay,
+	policy probedb.ConflictPolicy,
+) probedb.Action {
+	key := delayKey(table, delay)
+	row := *delay
+	row.IPAddr = forceIPv4(delay.IPAddr)
+
+	action := probedb.ActionIgnored
+	s.withTx(ctx, func(addUndo func(func())) {
+		existing, inserted := s.insertKey(key, &row, addUndo)
+		if inserted {
+			*delays = append(*delays, &row)
+			addUndo(func() { *delays = (*delays)[:len(*delays)-1] })
+			action = probedb.ActionCreated
+			return
+		}
+
+		current := existing.(*probedb.Delay)
+		if policy == probedb.ConflictKeepLatest ||
+			(policy == probedb.ConflictKeepMinimumDelay && row.DelayMS < current.DelayMS) {
+			previous := *current
+			*current = row
+			addUndo(func() { *current = previous })
+			action = probedb.ActionUpdated
+		}
+	})
+
+	return action
+}
+
+// SetAggregateAttestation sets an aggregate attestation.
+// If the aggregate attestation already exists then the aggregate attestation conflict policy is applied.
+func (s *Service) SetAggregateAttestation(ctx context.Context, aggregateAttestation *probedb.AggregateAttestation) (probedb.Action, error) {
+	key := aggregateAttestationKey(aggregateAttestation)
+	row := *aggregateAttestation
+	row.IPAddr = forceIPv4(aggregateAttestation.IPAddr)
+	policy := s.conflictPolicies.AggregateAttestations
+
+	action := probedb.ActionIgnored
+	s.withTx(ctx, func(addUndo func(func())) {
+		existing, inserted := s.insertKey(key, &row, addUndo)
+		if inserted {
+			s.aggregateAttestations = append(s.aggregateAttestations, &row)
+			addUndo(func() { s.aggregateAttestations = s.aggregateAttestations[:len(s.aggregateAttestations)-1] })
+			action = probedb.ActionCreated
+			return
+		}
+
+		current := existing.(*probedb.AggregateAttestation)
+		if policy == probedb.ConflictKeepLatest ||
+			(policy == probedb.ConflictKeepMinimumDelay && row.DelayMS < current.DelayMS) {
+			previous := *current
+			*current = row
+			addUndo(func() { *current = previous })
+			action = probedb.ActionUpdated
+		}
+	})
+
+	return action, nil
+}
+
+// SetAttestationSummary sets an attestation summary.
+// If the attestation summary already exists then the attestation summary conflict policy is applied.
+func (s *Service) SetAttestationSummary(ctx context.Context, summary *probedb.AttestationSummary) (probedb.Action, error) {
+	key := attestationSummaryKey(summary)
+	row := *summary
+	row.IPAddr = forceIPv4(summary.IPAddr)
+	policy := s.conflictPolicies.AttestationSummaries
+
+	action := probedb.ActionIgnored
+	s.withTx(ctx, func(addUndo func(func())) {
+		existing, inserted := s.insertKey(key, &row, addUndo)
+		if inserted {
+			s.attestationSummaries = append(s.attestationSummaries, &row)
+			addUndo(func() { s.attestationSummaries = s.attestationSummaries[:len(s.attestationSummaries)-1] })
+			action = probedb.ActionCreated
+			return
+		}
+
+		current := existing.(*probedb.AttestationSummary)
+		previous := *current
+		switch policy {
+		case probedb.ConflictKeepLatest:
+			*current = row
+		case probedb.ConflictMerge:
+			merged, changed := probedb.MergeAttesterBuckets(current.AttesterBuckets, row.AttesterBuckets)
+			if !changed {
+				return
+			}
+			current.AttesterBuckets = merged
+		default:
+			return
+		}
+		addUndo(func() { *current = previous })
+		action = probedb.ActionUpdated
+	})
+
+	return action, nil
+}
+
+// SetBlockDelays sets multiple block delays.
+// Delays that already exist are subject to the conflict policy.
+func (s *Service) SetBlockDelays(ctx context.Context, delays []*probedb.Delay) error {
+	for _, delay := range delays {
+		if _, err := s.SetBlockDelay(ctx, delay); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+// SetHeadDelays sets multiple head delays.
+// Delays that already exist are subject to the conflict policy.
+func (s *Service) SetHeadDelays(ctx context.Context, delays []*probedb.Delay) error {
+	for _, delay := range delays {
+		if _, err := s.SetHeadDelay(ctx, delay); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+// SetAggregateAttestations sets multiple aggregate attestations.
+// Aggregate attestations that already exist are subject to the conflict policy.
+func (s *Service) SetAggregateAttestations(ctx context.Context, aggregateAttestations []*probedb.AggregateAttestation) error {
+	for _, aggregateAttestation := range aggregateAttestations {
+		if _, err := s.SetAggregateAttestation(ctx, aggregateAttestation); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+// SetAttestationSummaries sets multiple attestation summaries.
+// Attestation summaries that already exist are subject to the conflict policy.
+func (s *Service) SetAttestationSummaries(ctx context.Context, summaries []*probedb.AttestationSummary) error {
+	for _, summary := range summaries {
+		if _, err := s.SetAttestationSummary(ctx, summary); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+// insertKey inserts a unique key for a row, returning false and the existing row if it already exists.
+func (s *Service) insertKey(key string, row interface{}, addUndo func(func())) (interface{}, bool) {
+	if existing, exists := s.keys[key]; exists {
+		return existing, false
+	}
+	s.keys[key] = row
+	addUndo(func() { delete(s.keys, key) })
+
+	return nil, true
+}
+
+// delayKey returns the unique key for a delay in the given table.
+func delayKey(table string, delay *probedb.Delay) string {
+	return fmt.Sprintf("%s:%s:%q:%q:%d", table, forceIPv4(delay.IPAddr), delay.Source, delay.Method, delay.Slot)
+}
+
+// aggregateAttestationKey returns the unique key for an aggregate attestation.
+func aggregateAttestationKey(aggregateAttestation *probedb.AggregateAttestation) string {
+	return fmt.Sprintf("aggregate_attestations:%s:%q:%q:%d:%d:%#x",
+		forceIPv4(aggregateAttestation.IPAddr),
+		aggregateAttestation.Source,
+		aggregateAttestation.Method,
+		aggregateAttestation.Slot,
+		aggregateAttestation.CommitteeIndex,
+		aggregateAttestation.AggregationBits,
+	)
+}
+
+// attestationSummaryKey returns the unique key for an attestation summary.
+func attestationSummaryKey(summary *probedb.AttestationSummary) string {
+	return fmt.Sprintf("attestation_summaries:%s:%q:%q:%d:%d:%#x:%#x:%#x",
+		forceIPv4(summary.IPAddr),
+		summary.Source,
+		summary.Method,
+		summary.Slot,
+		summary.CommitteeIndex,
+		summary.BeaconBlockRoot,
+		summary.SourceRoot,
+		summary.TargetRoot,
+	)
+}
+
+// forceIPv4 forces the IP address to be a V4 if possible.
+func forceIPv4(ipAddr net.IP) net.IP {
+	ip := ipAddr.To4()
+	if ip == nil {
+		ip = ipAddr
+	}
+	return ip
+}
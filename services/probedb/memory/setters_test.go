@@ -0,0 +1,83 @@
+// Copyright © 2023 Weald Technology Trading.
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package memory_test
+
+import (
+	"context"
+	"testing"
+
+	"github.com/stretchr/testify/require"
+	"github.com/wealdtech/probed/services/probedb"
+)
+
+func TestSetBlockDelay(t *testing.T) {
+	ctx, cancel := context.WithCancel(context.Background())
+	defer cancel()
+	s := newService(ctx, t)
+
+	blockDelay := &probedb.Delay{
+		IPAddr:  parseIP("1.2.3.4"),
+		Source:  "Dummy client",
+		Method:  "test",
+		Slot:    12345,
+		DelayMS: 234,
+	}
+
+	// Set the block delay.
+	action, err := s.SetBlockDelay(ctx, blockDelay)
+	require.NoError(t, err)
+	require.Equal(t, probedb.ActionCreated, action)
+
+	// Attempt to overwrite; should be ignored but no error.
+	blockDelay.DelayMS = 345
+	action, err = s.SetBlockDelay(ctx, blockDelay)
+	require.NoError(t, err)
+	require.Equal(t, probedb.ActionIgnored, action)
+}
+
+func TestSetBlockDelays(t *testing.T) {
+	ctx, cancel := context.WithCancel(context.Background())
+	defer cancel()
+	s := newService(ctx, t)
+
+	delays := []*probedb.Delay{
+		{IPAddr: parseIP("1.2.3.4"), Source: "Source 1", Method: "Method 1", Slot: 1, DelayMS: 100},
+		{IPAddr: parseIP("1.2.3.4"), Source: "Source 1", Method: "Method 1", Slot: 2, DelayMS: 200},
+	}
+	require.NoError(t, s.SetBlockDelays(ctx, delays))
+
+	// Duplicates are ignored.
+	require.NoError(t, s.SetBlockDelays(ctx, append(delays, &probedb.Delay{IPAddr: parseIP("1.2.3.4"), Source: "Source 1", Method: "Method 1", Slot: 1, DelayMS: 300})))
+
+	res, err := s.BlockDelays(ctx, &probedb.DelayFilter{Selection: probedb.SelectionAll})
+	require.NoError(t, err)
+	require.Equal(t, delays, res)
+}
+
+func TestSetAggregateAttestations(t *testing.T) {
+	ctx, cancel := context.WithCancel(context.Background())
+	defer cancel()
+	s := newService(ctx, t)
+
+	aggregateAttestations := []*probedb.AggregateAttestation{
+		{IPAddr: parseIP("1.2.3.4"), Source: "Source 1", Method: "Method 1", Slot: 1, CommitteeIndex: 1, AggregationBits: []byte{0x01}, BeaconBlockRoot: []byte{0x01}, SourceRoot: []byte{0x02}, TargetRoot: []byte{0x03}, DelayMS: 100},
+		{IPAddr: parseIP("1.2.3.4"), Source: "Source 1", Method: "Method 1", Slot: 1, CommitteeIndex: 1, AggregationBits: []byte{0x02}, BeaconBlockRoot: []byte{0x01}, SourceRoot: []byte{0x02}, TargetRoot: []byte{0x03}, DelayMS: 200},
+	}
+	require.NoError(t, s.SetAggregateAttestations(ctx, aggregateAttestations))
+	require.NoError(t, s.SetAggregateAttestations(ctx, aggregateAttestations))
+
+	res, err := s.AggregateAttestations(ctx, &probedb.AggregateAttestationFilter{})
+	require.NoError(t, err)
+	require.Equal(t, aggregateAttestations, res)
+}
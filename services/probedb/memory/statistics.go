@@ -0,0 +1,63 @@
+// Copyright © 2023 Weald Technology Trading.
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package memory
+
+import (
+	"context"
+
+	"github.com/pkg/errors"
+	"github.com/wealdtech/probed/services/probedb"
+)
+
+// BlockDelayStatistics obtains the statistics of the block delays for each slot in a range.
+func (s *Service) BlockDelayStatistics(ctx context.Context, filter *probedb.DelayFilter) ([]*probedb.DelayStatistics, error) {
+	return s.delayStatistics(ctx, &s.blockDelays, filter)
+}
+
+// HeadDelayStatistics obtains the statistics of the head delays for each slot in a range.
+func (s *Service) HeadDelayStatistics(ctx context.Context, filter *probedb.DelayFilter) ([]*probedb.DelayStatistics, error) {
+	return s.delayStatistics(ctx, &s.headDelays, filter)
+}
+
+// delayStatistics obtains statistics of the delays from the given table.
+func (s *Service) delayStatistics(ctx context.Context, table *[]*probedb.Delay, filter *probedb.DelayFilter) ([]*probedb.DelayStatistics, error) {
+	if filter.Order > probedb.OrderLatest {
+		return nil, errors.New("no order specified")
+	}
+	if err := probedb.CheckStatistics(filter.Statistics); err != nil {
+		return nil, err
+	}
+	if err := probedb.CheckDimensions(filter.GroupBy); err != nil {
+		return nil, err
+	}
+	cursor, err := probedb.ParseDelayCursor(filter.Cursor)
+	if err != nil {
+		return nil, err
+	}
+	match := matcher(filter.IPAddr, filter.Prober, filter.Sources, filter.Methods, filter.From, filter.To)
+
+	delays := make([]*probedb.Delay, 0)
+	s.withTx(ctx, func(func(func())) {
+		for _, delay := range *table {
+			if match(delay.IPAddr, delay.Prober, delay.Source, delay.Method, delay.Slot) {
+				delays = append(delays, delay)
+			}
+		}
+	})
+
+	statistics := probedb.CalculateGroupedStatistics(delays, filter)
+	start, end := probedb.Page(len(statistics), func(i int) *probedb.Position { return probedb.DelayStatisticsPosition(statistics[i]) }, filter.Order, cursor, filter.Limit)
+
+	return statistics[start:end], nil
+}
@@ -0,0 +1,86 @@
+// Copyright © 2023 Weald Technology Trading.
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package memory
+
+import (
+	"context"
+
+	"github.com/wealdtech/probed/services/probedb"
+)
+
+// StreamBlockDelays calls the handler with each block delay for a filter.
+func (s *Service) StreamBlockDelays(ctx context.Context, filter *probedb.DelayFilter, handler func(*probedb.Delay) error) error {
+	return s.streamDelays(ctx, &s.blockDelays, filter, handler)
+}
+
+// StreamHeadDelays calls the handler with each head delay for a filter.
+func (s *Service) StreamHeadDelays(ctx context.Context, filter *probedb.DelayFilter, handler func(*probedb.Delay) error) error {
+	return s.streamDelays(ctx, &s.headDelays, filter, handler)
+}
+
+// streamDelays calls the handler with each delay from the given table.
+// The data is already held in memory, so streaming is provided for
+// compatibility with other databases rather than to reduce memory use.
+func (s *Service) streamDelays(ctx context.Context, table *[]*probedb.Delay, filter *probedb.DelayFilter, handler func(*probedb.Delay) error) error {
+	delays, err := s.delays(ctx, table, filter)
+	if err != nil {
+		return err
+	}
+	for _, delay := range delays {
+		if err := ctx.Err(); err != nil {
+			return err
+		}
+		if err := handler(delay); err != nil {
+			return err
+		}
+	}
+
+	return nil
+}
+
+// StreamAggregateAttestations calls the handler with each aggregate attestation for a filter.
+func (s *Service) StreamAggregateAttestations(ctx context.Context, filter *probedb.AggregateAttestationFilter, handler func(*probedb.AggregateAttestation) error) error {
+	aggregateAttestations, err := s.AggregateAttestations(ctx, filter)
+	if err != nil {
+		return err
+	}
+	for _, aggregateAttestation := range aggregateAttestations {
+		if err := ctx.Err(); err != nil {
+			return err
+		}
+		if err := handler(aggregateAttestation); err != nil {
+			return err
+		}
+	}
+
+	return nil
+}
+
+// StreamAttestationSummaries calls the handler with each attestation summary for a filter.
+func (s *Service) StreamAttestationSummaries(ctx context.Context, filter *probedb.AttestationSummaryFilter, handler func(*probedb.AttestationSummary) error) error {
+	summaries, err := s.AttestationSummaries(ctx, filter)
+	if err != nil {
+		return err
+	}
+	for _, summary := range summaries {
+		if err := ctx.Err(); err != nil {
+			return err
+		}
+		if err := handler(summary); err != nil {
+			return err
+		}
+	}
+
+	return nil
+}
@@ -0,0 +1,104 @@
+// Copyright © 2023 Weald Technology Trading.
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package memory
+
+import (
+	"context"
+
+	"github.com/pkg/errors"
+)
+
+var (
+	// ErrNoTransaction is returned when an attempt to carry out a mutation to the database
+	// is not inside a transaction.
+	ErrNoTransaction = errors.New("no transaction for action")
+)
+
+// Tx is a context tag for the database transaction.
+type Tx struct{}
+
+// tx is a transaction.
+// A transaction holds the service lock for its lifetime, and keeps a log
+// of the functions required to undo its changes should it be rolled back.
+type tx struct {
+	service *Service
+	undo    []func()
+	done    bool
+}
+
+// BeginTx begins a transaction on the database.
+// The transaction can be rolled back by invoking the cancel function.
+func (s *Service) BeginTx(ctx context.Context) (context.Context, context.CancelFunc, error) {
+	s.mu.Lock()
+	t := &tx{
+		service: s,
+		undo:    make([]func(), 0),
+	}
+	ctx, cancel := context.WithCancel(context.WithValue(ctx, &Tx{}, t))
+	return ctx, func() {
+		if !t.done {
+			for i := len(t.undo) - 1; i >= 0; i-- {
+				t.undo[i]()
+			}
+			t.done = true
+			s.mu.Unlock()
+		}
+		cancel()
+	}, nil
+}
+
+// tx returns the transaction; nil if no transaction
+func (s *Service) tx(ctx context.Context) *tx {
+	if ctx == nil {
+		return nil
+	}
+
+	if t, ok := ctx.Value(&Tx{}).(*tx); ok && t.service == s && !t.done {
+		return t
+	}
+	return nil
+}
+
+// CommitTx commits a transaction on the ops datastore.
+func (s *Service) CommitTx(ctx context.Context) error {
+	if ctx == nil {
+		return errors.New("no context")
+	}
+
+	t := s.tx(ctx)
+	if t == nil {
+		return errors.New("no transaction")
+	}
+	t.done = true
+	t.undo = nil
+	s.mu.Unlock()
+
+	return nil
+}
+
+// withTx runs the function inside the transaction in the context, or inside
+// a local transaction that is committed on return if there is no such transaction.
+// The function is supplied with a function to record how to undo its changes.
+func (s *Service) withTx(ctx context.Context, fn func(addUndo func(func()))) {
+	if t := s.tx(ctx); t != nil {
+		fn(func(undo func()) {
+			t.undo = append(t.undo, undo)
+		})
+		return
+	}
+
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	fn(func(func()) {})
+}
@@ -0,0 +1,40 @@
+// Copyright © 2023 Weald Technology Trading.
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package probedb
+
+import "time"
+
+// Migration is a record of a change to the schema version of a database.
+type Migration struct {
+	// From is the schema version before the migration.
+	// It is 0 if the migration initialised the database.
+	From uint64 `json:"from"`
+	// To is the schema version after the migration.
+	To uint64 `json:"to"`
+	// Timestamp is the time at which the migration was applied.
+	Timestamp time.Time `json:"timestamp"`
+}
+
+// MigrationStatus is the status of the schema of a database.
+type MigrationStatus struct {
+	// Version is the current schema version of the database.
+	// It is 0 if the database has not been initialised.
+	Version uint64
+	// LatestVersion is the latest schema version known to this release.
+	LatestVersion uint64
+	// Pending are the schema versions that have yet to be applied.
+	Pending []uint64
+	// History are the migrations that have been applied, oldest first.
+	History []*Migration
+}
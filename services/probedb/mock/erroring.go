@@ -30,22 +30,72 @@ func NewErroring() *ErroringService {
 }
 
 // SetBlockDelay sets a block delay.
-func (s *ErroringService) SetBlockDelay(ctx context.Context, delay *probedb.Delay) error {
-	return errors.New("mock")
+func (s *ErroringService) SetBlockDelay(ctx context.Context, delay *probedb.Delay) (probedb.Action, error) {
+	return probedb.ActionCreated, errors.New("mock")
 }
 
 // SetHeadDelay sets a head delay.
-func (s *ErroringService) SetHeadDelay(ctx context.Context, delay *probedb.Delay) error {
-	return errors.New("mock")
+func (s *ErroringService) SetHeadDelay(ctx context.Context, delay *probedb.Delay) (probedb.Action, error) {
+	return probedb.ActionCreated, errors.New("mock")
 }
 
 // SetAggregateAttestation sets an aggregate attestation.
-func (s *ErroringService) SetAggregateAttestation(ctx context.Context, aggregateAttestation *probedb.AggregateAttestation) error {
-	return errors.New("mock")
+func (s *ErroringService) SetAggregateAttestation(ctx context.Context, aggregateAttestation *probedb.AggregateAttestation) (probedb.Action, error) {
+	return probedb.ActionCreated, errors.New("mock")
 }
 
 // SetAttestationSummary sets an attestation summary.
-func (s *ErroringService) SetAttestationSummary(ctx context.Context, summary *probedb.AttestationSummary) error {
+func (s *ErroringService) SetAttestationSummary(ctx context.Context, summary *probedb.AttestationSummary) (probedb.Action, error) {
+	return probedb.ActionCreated, errors.New("mock")
+}
+
+// BlockDelays obtains the block delays for a range of slots.
+func (s *ErroringService) BlockDelays(ctx context.Context, filter *probedb.DelayFilter) ([]*probedb.Delay, error) {
+	return nil, errors.New("mock")
+}
+
+// HeadDelays obtains the head delays for a range of slots.
+func (s *ErroringService) HeadDelays(ctx context.Context, filter *probedb.DelayFilter) ([]*probedb.Delay, error) {
+	return nil, errors.New("mock")
+}
+
+// StreamBlockDelays calls the handler with each block delay for a filter.
+func (s *ErroringService) StreamBlockDelays(ctx context.Context, filter *probedb.DelayFilter, handler func(*probedb.Delay) error) error {
+	return errors.New("mock")
+}
+
+// StreamHeadDelays calls the handler with each head delay for a filter.
+func (s *ErroringService) StreamHeadDelays(ctx context.Context, filter *probedb.DelayFilter, handler func(*probedb.Delay) error) error {
+	return errors.New("mock")
+}
+
+// BlockDelayStatistics obtains the statistics of the block delays for each slot in a range.
+func (s *ErroringService) BlockDelayStatistics(ctx context.Context, filter *probedb.DelayFilter) ([]*probedb.DelayStatistics, error) {
+	return nil, errors.New("mock")
+}
+
+// HeadDelayStatistics obtains the statistics of the head delays for each slot in a range.
+func (s *ErroringService) HeadDelayStatistics(ctx context.Context, filter *probedb.DelayFilter) ([]*probedb.DelayStatistics, error) {
+	return nil, errors.New("mock")
+}
+
+// AggregateAttestations obtains the aggregate attestations for a filter.
+func (s *ErroringService) AggregateAttestations(ctx context.Context, filter *probedb.AggregateAttestationFilter) ([]*probedb.AggregateAttestation, error) {
+	return nil, errors.New("mock")
+}
+
+// AttestationSummaries obtains the attestation summaries for a filter.
+func (s *ErroringService) AttestationSummaries(ctx context.Context, filter *probedb.AttestationSummaryFilter) ([]*probedb.AttestationSummary, error) {
+	return nil, errors.New("mock")
+}
+
+// StreamAggregateAttestations calls the handler with each aggregate attestation for a filter.
+func (s *ErroringService) StreamAggregateAttestations(ctx context.Context, filter *probedb.AggregateAttestationFilter, handler func(*probedb.AggregateAttestation) error) error {
+	return errors.New("mock")
+}
+
+// StreamAttestationSummaries calls the handler with each attestation summary for a filter.
+func (s *ErroringService) StreamAttestationSummaries(ctx context.Context, filter *probedb.AttestationSummaryFilter, handler func(*probedb.AttestationSummary) error) error {
 	return errors.New("mock")
 }
 
@@ -1,4 +1,4 @@
-// Copyright © 2021 Weald Technology Trading.
+// Copyright © 2021, 2023 Weald Technology Trading.
 // Licensed under the Apache License, Version 2.0 (the "License");
 // you may not use this file except in compliance with the License.
 // You may obtain a copy of the License at
@@ -16,53 +16,27 @@ package mock
 import (
 	"context"
 
-	"github.com/wealdtech/probed/services/probedb"
+	"github.com/rs/zerolog"
+	"github.com/wealdtech/probed/services/probedb/memory"
 )
 
-// Service is a mock.
-type Service struct{}
+// Service is a mock that holds the data it is given in memory,
+// so that it can be queried.
+type Service struct {
+	*memory.Service
+}
 
 // New returns a mock probe database.
 func New() *Service {
-	return &Service{}
-}
-
-// SetBlockDelay sets a block delay.
-func (s *Service) SetBlockDelay(ctx context.Context, delay *probedb.Delay) error {
-	return nil
-}
-
-// SetHeadDelay sets a head delay.
-func (s *Service) SetHeadDelay(ctx context.Context, delay *probedb.Delay) error {
-	return nil
-}
-
-// SetAggregateAttestation sets an aggregate attestation.
-func (s *Service) SetAggregateAttestation(ctx context.Context, aggregateAttestation *probedb.AggregateAttestation) error {
-	return nil
-}
-
-// SetAttestationSummary sets an attestation summary.
-func (s *Service) SetAttestationSummary(ctx context.Context, summary *probedb.AttestationSummary) error {
-	return nil
-}
-
-// BeginTx begins a transaction.
-func (s *Service) BeginTx(ctx context.Context) (context.Context, context.CancelFunc, error) {
-	return nil, nil, nil
-}
-
-// CommitTx commits a transaction.
-func (s *Service) CommitTx(ctx context.Context) error {
-	return nil
-}
-
-// SetMetadata sets a metadata key to a JSON value.
-func (s *Service) SetMetadata(ctx context.Context, key string, value []byte) error {
-	return nil
-}
-
-// Metadata obtains the JSON value from a metadata key.
-func (s *Service) Metadata(ctx context.Context, key string) ([]byte, error) {
-	return nil, nil
+	s, err := memory.New(context.Background(),
+		memory.WithLogLevel(zerolog.Disabled),
+	)
+	if err != nil {
+		// Only possible with invalid parameters.
+		panic(err)
+	}
+
+	return &Service{
+		Service: s,
+	}
 }
@@ -16,24 +16,21 @@ package postgresql
 
 import (
 	"context"
-	"fmt"
-	"net"
-	"strings"
 
 	"github.com/pkg/errors"
 	"github.com/wealdtech/probed/services/probedb"
 )
 
 // SetAggregateAttestation sets an aggregate attestation.
-// If an aggregate attestation already exists then ignore it.
-func (s *Service) SetAggregateAttestation(ctx context.Context, aggregateAttestation *probedb.AggregateAttestation) error {
+// If the aggregate attestation already exists then the aggregate attestation conflict policy is applied.
+func (s *Service) SetAggregateAttestation(ctx context.Context, aggregateAttestation *probedb.AggregateAttestation) (probedb.Action, error) {
 	localTx := false
 	tx := s.tx(ctx)
 	if tx == nil {
 		var err error
 		tx, err = s.pool.Begin(ctx)
 		if err != nil {
-			return err
+			return probedb.ActionCreated, err
 		}
 		localTx = true
 	}
@@ -44,7 +41,7 @@ func (s *Service) SetAggregateAttestation(ctx context.Context, aggregateAttestat
 		ip = aggregateAttestation.IPAddr
 	}
 
-	_, err := tx.Exec(ctx, `
+	tag, err := tx.Exec(ctx, `
 INSERT INTO t_aggregate_attestations(f_ip_addr
                                     ,f_source
                                     ,f_method
@@ -55,8 +52,9 @@ INSERT INTO t_aggregate_attestations(f_ip_addr
                                     ,f_source_root
                                     ,f_target_root
                                     ,f_delay
+                                    ,f_prober
                           )
-VALUES($1,$2,$3,$4,$5,$6,$7,$8,$9,$10)
+VALUES($1,$2,$3,$4,$5,$6,$7,$8,$9,$10,$11)
 ON CONFLICT (f_ip_addr, f_source, f_method, f_slot, f_committee_index, f_aggregation_bits) DO NOTHING
 `,
 		ip,
@@ -69,8 +67,30 @@ ON CONFLICT (f_ip_addr, f_source, f_method, f_slot, f_committee_index, f_aggrega
 		aggregateAttestation.SourceRoot,
 		aggregateAttestation.TargetRoot,
 		aggregateAttestation.DelayMS,
+		aggregateAttestation.Prober,
 	)
 
+	action := probedb.ActionCreated
+	if err == nil && tag.RowsAffected() == 0 {
+		action, err = applyConflictPolicy(ctx, tx, "t_aggregate_attestations", s.conflictPolicies.AggregateAttestations,
+			[]*column{
+				{name: "f_ip_addr", value: ip},
+				{name: "f_source", value: aggregateAttestation.Source},
+				{name: "f_method", value: aggregateAttestation.Method},
+				{name: "f_slot", value: aggregateAttestation.Slot},
+				{name: "f_committee_index", value: aggregateAttestation.CommitteeIndex},
+				{name: "f_aggregation_bits", value: aggregateAttestation.AggregationBits},
+			},
+			[]*column{
+				{name: "f_beacon_block_root", value: aggregateAttestation.BeaconBlockRoot},
+				{name: "f_source_root", value: aggregateAttestation.SourceRoot},
+				{name: "f_target_root", value: aggregateAttestation.TargetRoot},
+				{name: "f_delay", value: aggregateAttestation.DelayMS},
+				{name: "f_prober", value: aggregateAttestation.Prober},
+			},
+		)
+	}
+
 	if localTx {
 		if err == nil {
 			if err := tx.Commit(ctx); err != nil {
@@ -83,126 +103,57 @@ ON CONFLICT (f_ip_addr, f_source, f_method, f_slot, f_committee_index, f_aggrega
 		}
 	}
 
-	return err
+	return action, err
+}
+
+// AggregateAttestations obtains the aggregate attestations for a filter.
+func (s *Service) AggregateAttestations(ctx context.Context, filter *probedb.AggregateAttestationFilter) ([]*probedb.AggregateAttestation, error) {
+	aggregateAttestations := make([]*probedb.AggregateAttestation, 0)
+	if err := s.StreamAggregateAttestations(ctx, filter, func(aggregateAttestation *probedb.AggregateAttestation) error {
+		aggregateAttestations = append(aggregateAttestations, aggregateAttestation)
+		return nil
+	}); err != nil {
+		return nil, err
+	}
+
+	return aggregateAttestations, nil
 }
 
-// AggregateAttestations obtains the aggregate attestations for a given filter.
-func (s *Service) AggregateAttestations(
-	ctx context.Context,
+// StreamAggregateAttestations calls the handler with each aggregate attestation for a filter.
+func (s *Service) StreamAggregateAttestations(ctx context.Context,
 	filter *probedb.AggregateAttestationFilter,
-) (
-	[]*probedb.AggregateAttestation,
-	error,
-) {
+	handler func(*probedb.AggregateAttestation) error,
+) error {
 	tx := s.tx(ctx)
 	if tx == nil {
-		ctx, cancel, err := s.BeginTx(ctx)
+		ctx, cancel, err := s.beginReadTx(ctx)
 		if err != nil {
-			return nil, errors.Wrap(err, "failed to begin transaction")
+			return errors.Wrap(err, "failed to begin transaction")
 		}
 		tx = s.tx(ctx)
 		defer cancel()
 	}
 
-	// Build the query.
-	queryBuilder := strings.Builder{}
-	queryVals := make([]interface{}, 0)
-
-	queryBuilder.WriteString(`
-SELECT f_ip_addr
-      ,f_source
-      ,f_method
-      ,f_slot
-      ,f_committee_index
-      ,f_aggregation_bits
-      ,f_beacon_block_root
-      ,f_source_root
-      ,f_target_root
-      ,f_delay
-FROM t_aggregate_attestations`)
-
-	wherestr := "WHERE"
-
-	if filter.IPAddr != "" {
-		// Force the IP address to be a V4 if possible
-		ipAddr := net.ParseIP(filter.IPAddr)
-		ip := ipAddr.To4()
-		if ip == nil {
-			ip = ipAddr
-		}
-		queryVals = append(queryVals, ip)
-		queryBuilder.WriteString(fmt.Sprintf(`
-%s f_ip_addr = $%d`, wherestr, len(queryVals)))
-		wherestr = "  AND"
-	}
-
-	if len(filter.Sources) > 0 {
-		queryVals = append(queryVals, filter.Sources)
-		queryBuilder.WriteString(fmt.Sprintf(`
-%s f_source = ANY($%d)`, wherestr, len(queryVals)))
-		wherestr = "  AND"
-	}
-
-	if len(filter.Methods) > 0 {
-		queryVals = append(queryVals, filter.Methods)
-		queryBuilder.WriteString(fmt.Sprintf(`
-%s f_method = $%d`, wherestr, len(queryVals)))
-		wherestr = "  AND"
-	}
-
-	if filter.From != nil {
-		queryVals = append(queryVals, *filter.From)
-		queryBuilder.WriteString(fmt.Sprintf(`
-%s f_slot >= $%d`, wherestr, len(queryVals)))
-		wherestr = "  AND"
-	}
-
-	if filter.To != nil {
-		queryVals = append(queryVals, *filter.To)
-		queryBuilder.WriteString(fmt.Sprintf(`
-%s f_slot <= $%d`, wherestr, len(queryVals)))
-		// wherestr = "  AND"
-	}
-
-	switch filter.Order {
-	case probedb.OrderEarliest:
-		queryBuilder.WriteString(`
-ORDER BY f_slot`)
-	case probedb.OrderLatest:
-		queryBuilder.WriteString(`
-ORDER BY f_slot DESC`)
-	default:
-		return nil, errors.New("no order specified")
-	}
-
-	if filter.Limit != 0 {
-		queryVals = append(queryVals, filter.Limit)
-		queryBuilder.WriteString(fmt.Sprintf(`
-LIMIT $%d`, len(queryVals)))
-	}
-
-	if e := log.Trace(); e.Enabled() {
-		params := make([]string, len(queryVals))
-		for i := range queryVals {
-			params[i] = fmt.Sprintf("%v", queryVals[i])
-		}
-		log.Trace().Str("query", strings.ReplaceAll(queryBuilder.String(), "\n", " ")).Strs("params", params).Msg("SQL query")
+	q, err := aggregateAttestationsQuery(filter)
+	if err != nil {
+		return err
 	}
+	q.log()
 
-	rows, err := tx.Query(ctx,
-		queryBuilder.String(),
-		queryVals...,
-	)
+	rows, err := tx.Query(ctx, q.String(), q.vals...)
 	if err != nil {
-		return nil, err
+		return err
 	}
 	defer rows.Close()
 
-	aggregateAttestations := make([]*probedb.AggregateAttestation, 0)
 	for rows.Next() {
+		if err := ctx.Err(); err != nil {
+			return err
+		}
 		aggregateAttestation := &probedb.AggregateAttestation{}
 		err := rows.Scan(
 			&aggregateAttestation.IPAddr,
+			&aggregateAttestation.Prober,
 			&aggregateAttestation.Source,
 			&aggregateAttestation.Method,
 			&aggregateAttestation.Slot,
@@ -214,14 +165,17 @@ LIMIT $%d`, len(queryVals)))
 			&aggregateAttestation.DelayMS,
 		)
 		if err != nil {
-			return nil, errors.Wrap(err, "failed to scan row")
+			return errors.Wrap(err, "failed to scan row")
 		}
 		ip := aggregateAttestation.IPAddr.To4()
 		if ip == nil {
 			ip = aggregateAttestation.IPAddr
 		}
 		aggregateAttestation.IPAddr = ip
-		aggregateAttestations = append(aggregateAttestations, aggregateAttestation)
+		if err := handler(aggregateAttestation); err != nil {
+			return err
+		}
 	}
-	return aggregateAttestations, nil
+
+	return rows.Err()
 }
@@ -35,6 +35,8 @@ func parseIP(input string) net.IP {
 }
 
 func TestAggregateAttestations(t *testing.T) {
+	requireDatabase(t)
+
 	ctx := context.Background()
 	s, err := postgresql.New(ctx,
 		postgresql.WithLogLevel(zerolog.Disabled),
@@ -56,7 +58,8 @@ func TestAggregateAttestations(t *testing.T) {
 
 	// Set the head delays.
 	for _, aggregateAttestation := range aggregateAttestations {
-		require.NoError(t, s.SetAggregateAttestation(ctx, aggregateAttestation))
+		_, err := s.SetAggregateAttestation(ctx, aggregateAttestation)
+		require.NoError(t, err)
 	}
 
 	tests := []struct {
@@ -15,124 +15,59 @@ package postgresql
 
 import (
 	"context"
-	"fmt"
-	"net"
-	"strings"
 
 	"github.com/pkg/errors"
 	"github.com/wealdtech/probed/services/probedb"
 )
 
 // AttestationSummaries obtains the attestation summaries for a filter.
-func (s *Service) AttestationSummaries(ctx context.Context,
+func (s *Service) AttestationSummaries(ctx context.Context, filter *probedb.AttestationSummaryFilter) ([]*probedb.AttestationSummary, error) {
+	attestationSummaries := make([]*probedb.AttestationSummary, 0)
+	if err := s.StreamAttestationSummaries(ctx, filter, func(attestationSummary *probedb.AttestationSummary) error {
+		attestationSummaries = append(attestationSummaries, attestationSummary)
+		return nil
+	}); err != nil {
+		return nil, err
+	}
+
+	return attestationSummaries, nil
+}
+
+// StreamAttestationSummaries calls the handler with each attestation summary for a filter.
+func (s *Service) StreamAttestationSummaries(ctx context.Context,
 	filter *probedb.AttestationSummaryFilter,
-) (
-	[]*probedb.AttestationSummary,
-	error,
-) {
+	handler func(*probedb.AttestationSummary) error,
+) error {
 	tx := s.tx(ctx)
 	if tx == nil {
-		ctx, cancel, err := s.BeginTx(ctx)
+		ctx, cancel, err := s.beginReadTx(ctx)
 		if err != nil {
-			return nil, errors.Wrap(err, "failed to begin transaction")
+			return errors.Wrap(err, "failed to begin transaction")
 		}
 		tx = s.tx(ctx)
 		defer cancel()
 	}
 
-	// Build the query.
-	queryBuilder := strings.Builder{}
-	queryVals := make([]interface{}, 0)
-
-	queryBuilder.WriteString(`
-SELECT f_ip_addr
-      ,f_source
-      ,f_method
-      ,f_slot
-      ,f_committee_index
-      ,f_beacon_block_root
-      ,f_source_root
-      ,f_target_root
-      ,f_attester_buckets
-FROM t_attestation_summaries`)
-
-	conditions := make([]string, 0)
-
-	if filter.IPAddr != "" {
-		// Force the IP address to be a V4 if possible
-		ipAddr := net.ParseIP(filter.IPAddr)
-		ip := ipAddr.To4()
-		if ip == nil {
-			ip = ipAddr
-		}
-		queryVals = append(queryVals, ip)
-		conditions = append(conditions, fmt.Sprintf(`f_ip_addr = $%d`, len(queryVals)))
-	}
-
-	if len(filter.Sources) > 0 {
-		queryVals = append(queryVals, filter.Sources)
-		conditions = append(conditions, fmt.Sprintf(`f_source = ANY($%d)`, len(queryVals)))
-	}
-
-	if len(filter.Methods) > 0 {
-		queryVals = append(queryVals, filter.Methods)
-		conditions = append(conditions, fmt.Sprintf(`f_method = $%d`, len(queryVals)))
-	}
-
-	if filter.From != nil {
-		queryVals = append(queryVals, *filter.From)
-		conditions = append(conditions, fmt.Sprintf(`f_slot >= $%d`, len(queryVals)))
-	}
-
-	if filter.To != nil {
-		queryVals = append(queryVals, *filter.To)
-		queryBuilder.WriteString(fmt.Sprintf(` f_slot <= $%d`, len(queryVals)))
-	}
-
-	if len(conditions) > 0 {
-		queryBuilder.WriteString("\nWHERE ")
-		queryBuilder.WriteString(strings.Join(conditions, "\n  AND "))
-	}
-
-	switch filter.Order {
-	case probedb.OrderEarliest:
-		queryBuilder.WriteString(`
-ORDER BY f_slot`)
-	case probedb.OrderLatest:
-		queryBuilder.WriteString(`
-ORDER BY f_slot DESC`)
-	default:
-		return nil, errors.New("no order specified")
-	}
-
-	if filter.Limit != 0 {
-		queryVals = append(queryVals, filter.Limit)
-		queryBuilder.WriteString(fmt.Sprintf(`
-LIMIT $%d`, len(queryVals)))
-	}
-
-	if e := log.Trace(); e.Enabled() {
-		params := make([]string, len(queryVals))
-		for i := range queryVals {
-			params[i] = fmt.Sprintf("%v", queryVals[i])
-		}
-		log.Trace().Str("query", strings.ReplaceAll(queryBuilder.String(), "\n", " ")).Strs("params", params).Msg("SQL query")
+	q, err := attestationSummariesQuery(filter)
+	if err != nil {
+		return err
 	}
+	q.log()
 
-	rows, err := tx.Query(ctx,
-		queryBuilder.String(),
-		queryVals...,
-	)
+	rows, err := tx.Query(ctx, q.String(), q.vals...)
 	if err != nil {
-		return nil, err
+		return err
 	}
 	defer rows.Close()
 
-	attestationSummaries := make([]*probedb.AttestationSummary, 0)
 	for rows.Next() {
+		if err := ctx.Err(); err != nil {
+			return err
+		}
 		attestationSummary := &probedb.AttestationSummary{}
 		err := rows.Scan(
 			&attestationSummary.IPAddr,
+			&attestationSummary.Prober,
 			&attestationSummary.Source,
 			&attestationSummary.Method,
 			&attestationSummary.Slot,
@@ -143,13 +78,16 @@ LIMIT $%d`, len(queryVals)))
 			&attestationSummary.AttesterBuckets,
 		)
 		if err != nil {
-			return nil, errors.Wrap(err, "failed to scan row")
+			return errors.Wrap(err, "failed to scan row")
 		}
 		ip := attestationSummary.IPAddr.To4()
 		if ip != nil {
 			attestationSummary.IPAddr = ip
 		}
-		attestationSummaries = append(attestationSummaries, attestationSummary)
+		if err := handler(attestationSummary); err != nil {
+			return err
+		}
 	}
-	return attestationSummaries, nil
+
+	return rows.Err()
 }
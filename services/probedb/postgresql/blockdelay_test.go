@@ -27,6 +27,8 @@ import (
 )
 
 func TestSetBlockDelay(t *testing.T) {
+	requireDatabase(t)
+
 	ctx := context.Background()
 	s, err := postgresql.New(ctx,
 		postgresql.WithLogLevel(zerolog.Disabled),
@@ -50,11 +52,15 @@ func TestSetBlockDelay(t *testing.T) {
 	}
 
 	// Set the block delay.
-	require.NoError(t, s.SetBlockDelay(ctx, blockDelay))
+	action, err := s.SetBlockDelay(ctx, blockDelay)
+	require.NoError(t, err)
+	require.Equal(t, probedb.ActionCreated, action)
 
 	// Attempt to overwrite; should be ignored but no error.
 	blockDelay.DelayMS = 345
-	require.NoError(t, s.SetBlockDelay(ctx, blockDelay))
+	action, err = s.SetBlockDelay(ctx, blockDelay)
+	require.NoError(t, err)
+	require.Equal(t, probedb.ActionIgnored, action)
 }
 
 func slotPtr(in phase0.Slot) *phase0.Slot {
@@ -62,6 +68,8 @@ func slotPtr(in phase0.Slot) *phase0.Slot {
 }
 
 func TestBlockDelays(t *testing.T) {
+	requireDatabase(t)
+
 	ctx := context.Background()
 	s, err := postgresql.New(ctx,
 		postgresql.WithLogLevel(zerolog.Disabled),
@@ -93,7 +101,8 @@ func TestBlockDelays(t *testing.T) {
 
 	// Set the block delays.
 	for _, blockDelay := range blockDelays {
-		require.NoError(t, s.SetBlockDelay(ctx, blockDelay))
+		_, err := s.SetBlockDelay(ctx, blockDelay)
+		require.NoError(t, err)
 	}
 
 	tests := []struct {
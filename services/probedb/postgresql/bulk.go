@@ -0,0 +1,229 @@
+// Copyright © 2023 Weald Technology Trading.
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package postgresql
+
+import (
+	"context"
+	"fmt"
+	"net"
+	"strings"
+
+	"github.com/jackc/pgx/v4"
+	"github.com/pkg/errors"
+	"github.com/wealdtech/probed/services/probedb"
+)
+
+// SetBlockDelays sets multiple block delays.
+// Delays that already exist are subject to the conflict policy.
+func (s *Service) SetBlockDelays(ctx context.Context, delays []*probedb.Delay) error {
+	rows := make([][]interface{}, 0, len(delays))
+	for _, delay := range delays {
+		rows = append(rows, []interface{}{
+			forceIPv4(delay.IPAddr),
+			delay.Source,
+			delay.Method,
+			delay.Slot,
+			delay.DelayMS,
+			delay.Prober,
+		})
+	}
+
+	return s.bulkInsert(ctx,
+		"t_block_delays",
+		[]string{"f_ip_addr", "f_source", "f_method", "f_slot", "f_delay", "f_prober"},
+		[]string{"f_ip_addr", "f_source", "f_method", "f_slot"},
+		s.conflictPolicies.BlockDelays,
+		rows,
+	)
+}
+
+// SetHeadDelays sets multiple head delays.
+// Delays that already exist are subject to the conflict policy.
+func (s *Service) SetHeadDelays(ctx context.Context, delays []*probedb.Delay) error {
+	rows := make([][]interface{}, 0, len(delays))
+	for _, delay := range delays {
+		rows = append(rows, []interface{}{
+			forceIPv4(delay.IPAddr),
+			delay.Source,
+			delay.Method,
+			delay.Slot,
+			delay.DelayMS,
+			delay.Prober,
+		})
+	}
+
+	return s.bulkInsert(ctx,
+		"t_head_delays",
+		[]string{"f_ip_addr", "f_source", "f_method", "f_slot", "f_delay", "f_prober"},
+		[]string{"f_ip_addr", "f_source", "f_method", "f_slot"},
+		s.conflictPolicies.HeadDelays,
+		rows,
+	)
+}
+
+// SetAggregateAttestations sets multiple aggregate attestations.
+// Aggregate attestations that already exist are subject to the conflict policy.
+func (s *Service) SetAggregateAttestations(ctx context.Context, aggregateAttestations []*probedb.AggregateAttestation) error {
+	rows := make([][]interface{}, 0, len(aggregateAttestations))
+	for _, aggregateAttestation := range aggregateAttestations {
+		rows = append(rows, []interface{}{
+			forceIPv4(aggregateAttestation.IPAddr),
+			aggregateAttestation.Source,
+			aggregateAttestation.Method,
+			aggregateAttestation.Slot,
+			aggregateAttestation.CommitteeIndex,
+			aggregateAttestation.AggregationBits,
+			aggregateAttestation.BeaconBlockRoot,
+			aggregateAttestation.SourceRoot,
+			aggregateAttestation.TargetRoot,
+			aggregateAttestation.DelayMS,
+			aggregateAttestation.Prober,
+		})
+	}
+
+	return s.bulkInsert(ctx,
+		"t_aggregate_attestations",
+		[]string{"f_ip_addr", "f_source", "f_method", "f_slot", "f_committee_index", "f_aggregation_bits", "f_beacon_block_root", "f_source_root", "f_target_root", "f_delay", "f_prober"},
+		[]string{"f_ip_addr", "f_source", "f_method", "f_slot", "f_committee_index", "f_aggregation_bits"},
+		s.conflictPolicies.AggregateAttestations,
+		rows,
+	)
+}
+
+// SetAttestationSummaries sets multiple attestation summaries.
+// Attestation summaries that already exist are subject to the conflict policy.
+func (s *Service) SetAttestationSummaries(ctx context.Context, summaries []*probedb.AttestationSummary) error {
+	rows := make([][]interface{}, 0, len(summaries))
+	for _, summary := range summaries {
+		rows = append(rows, []interface{}{
+			forceIPv4(summary.IPAddr),
+			summary.Source,
+			summary.Method,
+			summary.Slot,
+			summary.CommitteeIndex,
+			summary.BeaconBlockRoot,
+			summary.SourceRoot,
+			summary.TargetRoot,
+			summary.AttesterBuckets,
+			summary.Prober,
+		})
+	}
+
+	return s.bulkInsert(ctx,
+		"t_attestation_summaries",
+		[]string{"f_ip_addr", "f_source", "f_method", "f_slot", "f_committee_index", "f_beacon_block_root", "f_source_root", "f_target_root", "f_attester_buckets", "f_prober"},
+		[]string{"f_ip_addr", "f_source", "f_method", "f_slot", "f_committee_index", "f_beacon_block_root", "f_source_root", "f_target_root"},
+		s.conflictPolicies.AttestationSummaries,
+		rows,
+	)
+}
+
+// bulkInsert copies rows in to a staging table and then merges them
+// in to the target table, applying the conflict policy to any rows that
+// conflict with existing rows.
+// The conflict columns must be the leading columns.
+func (s *Service) bulkInsert(ctx context.Context,
+	table string,
+	columns []string,
+	conflictColumns []string,
+	policy probedb.ConflictPolicy,
+	rows [][]interface{},
+) error {
+	if len(rows) == 0 {
+		return nil
+	}
+
+	localTx := false
+	tx := s.tx(ctx)
+	if tx == nil {
+		var err error
+		tx, err = s.pool.Begin(ctx)
+		if err != nil {
+			return err
+		}
+		localTx = true
+	}
+
+	err := s.copyAndMerge(ctx, tx, table, columns, conflictColumns, policy, rows)
+
+	if localTx {
+		if err == nil {
+			// A failed commit loses the rows, so must be reported to the caller.
+			if err = tx.Commit(ctx); err != nil {
+				err = errors.Wrap(err, "failed to commit transaction")
+			}
+		} else {
+			if err := tx.Rollback(ctx); err != nil {
+				log.Warn().Err(err).Msg("Failed to rollback transaction")
+			}
+		}
+	}
+
+	return err
+}
+
+func (s *Service) copyAndMerge(ctx context.Context,
+	tx pgx.Tx,
+	table string,
+	columns []string,
+	conflictColumns []string,
+	policy probedb.ConflictPolicy,
+	rows [][]interface{},
+) error {
+	if policy != probedb.ConflictKeepFirst {
+		valueColumn := -1
+		for i, column := range columns {
+			if column == "f_delay" || column == "f_attester_buckets" {
+				valueColumn = i
+			}
+		}
+		rows = dedupeRows(rows, len(conflictColumns), valueColumn, policy)
+	}
+
+	// The staging table is dropped when the transaction ends; it is truncated
+	// in case this is not the first bulk insert in the transaction.
+	staging := fmt.Sprintf("tmp_%s", strings.TrimPrefix(table, "t_"))
+	if _, err := tx.Exec(ctx, fmt.Sprintf(`CREATE TEMPORARY TABLE IF NOT EXISTS %s (LIKE %s INCLUDING DEFAULTS) ON COMMIT DROP`, staging, table)); err != nil {
+		return errors.Wrap(err, "failed to create staging table")
+	}
+	if _, err := tx.Exec(ctx, fmt.Sprintf(`TRUNCATE %s`, staging)); err != nil {
+		return errors.Wrap(err, "failed to truncate staging table")
+	}
+
+	if _, err := tx.CopyFrom(ctx, pgx.Identifier{staging}, columns, pgx.CopyFromRows(rows)); err != nil {
+		return errors.Wrap(err, "failed to copy rows to staging table")
+	}
+
+	columnList := strings.Join(columns, ",")
+	tag, err := tx.Exec(ctx, fmt.Sprintf(`
+INSERT INTO %s(%s)
+SELECT %s
+FROM %s
+ON CONFLICT (%s) %s`, table, columnList, columnList, staging, strings.Join(conflictColumns, ","), conflictAction(table, policy, columns, conflictColumns)))
+	if err != nil {
+		return errors.Wrap(err, "failed to merge staging table")
+	}
+	log.Trace().Str("table", table).Int("rows", len(rows)).Int64("inserted", tag.RowsAffected()).Msg("Bulk insert complete")
+
+	return nil
+}
+
+// forceIPv4 forces the IP address to be a V4 if possible.
+func forceIPv4(ipAddr net.IP) net.IP {
+	ip := ipAddr.To4()
+	if ip == nil {
+		ip = ipAddr
+	}
+	return ip
+}
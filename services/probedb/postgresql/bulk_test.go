@@ -0,0 +1,64 @@
+// Copyright © 2023 Weald Technology Trading.
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package postgresql_test
+
+import (
+	"context"
+	"os"
+	"testing"
+
+	"github.com/rs/zerolog"
+	"github.com/stretchr/testify/require"
+	"github.com/wealdtech/probed/services/probedb"
+	"github.com/wealdtech/probed/services/probedb/postgresql"
+)
+
+func TestSetBlockDelays(t *testing.T) {
+	requireDatabase(t)
+
+	ctx := context.Background()
+	s, err := postgresql.New(ctx,
+		postgresql.WithLogLevel(zerolog.Disabled),
+		postgresql.WithServer(os.Getenv("PROBEDB_SERVER")),
+		postgresql.WithPort(atoi(os.Getenv("PROBEDB_PORT"))),
+		postgresql.WithUser(os.Getenv("PROBEDB_USER")),
+		postgresql.WithPassword(os.Getenv("PROBEDB_PASSWORD")),
+	)
+	require.NoError(t, err)
+
+	ctx, cancel, err := s.BeginTx(ctx)
+	require.NoError(t, err)
+	defer cancel()
+
+	blockDelays := []*probedb.Delay{
+		{IPAddr: parseIP("1.2.3.4"), Source: "Source 1", Method: "Method 1", Slot: 22345, DelayMS: 1123},
+		{IPAddr: parseIP("1.2.3.4"), Source: "Source 2", Method: "Method 1", Slot: 22345, DelayMS: 1234},
+		// Duplicate within the batch; should be ignored.
+		{IPAddr: parseIP("1.2.3.4"), Source: "Source 2", Method: "Method 1", Slot: 22345, DelayMS: 1345},
+	}
+
+	require.NoError(t, s.SetBlockDelays(ctx, blockDelays))
+	// Repeat; should be ignored.
+	require.NoError(t, s.SetBlockDelays(ctx, blockDelays))
+
+	res, err := s.BlockDelays(ctx, &probedb.DelayFilter{
+		Selection: probedb.SelectionAll,
+		From:      slotPtr(22345),
+		To:        slotPtr(22345),
+	})
+	require.NoError(t, err)
+	require.Len(t, res, 2)
+	require.Equal(t, uint32(1123), res[0].DelayMS)
+	require.Equal(t, uint32(1234), res[1].DelayMS)
+}
@@ -0,0 +1,174 @@
+// Copyright © 2023 Weald Technology Trading.
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package postgresql
+
+import (
+	"context"
+	"fmt"
+	"strings"
+
+	"github.com/jackc/pgx/v4"
+	"github.com/wealdtech/probed/services/probedb"
+)
+
+// column is the name and value of a column.
+type column struct {
+	name  string
+	value interface{}
+}
+
+// applyConflictPolicy applies the conflict policy to the existing row with the given key,
+// replacing its values with the supplied values if required, and returns the action taken.
+func applyConflictPolicy(ctx context.Context,
+	tx pgx.Tx,
+	table string,
+	policy probedb.ConflictPolicy,
+	keys []*column,
+	values []*column,
+) (
+	probedb.Action,
+	error,
+) {
+	switch policy {
+	case probedb.ConflictKeepLatest:
+		return updateRow(ctx, tx, table, keys, values, "")
+	case probedb.ConflictKeepMinimumDelay:
+		return updateRow(ctx, tx, table, keys, values, "f_delay > $%d", delayValue(values))
+	default:
+		return probedb.ActionIgnored, nil
+	}
+}
+
+// updateRow updates the row with the given key if it matches the optional condition,
+// returning ActionUpdated if the row was updated and ActionIgnored if not.
+// The condition contains a single placeholder for the condition argument.
+func updateRow(ctx context.Context,
+	tx pgx.Tx,
+	table string,
+	keys []*column,
+	values []*column,
+	condition string,
+	conditionArg ...interface{},
+) (
+	probedb.Action,
+	error,
+) {
+	sets := make([]string, 0, len(values))
+	args := make([]interface{}, 0, len(values)+len(keys)+1)
+	for _, value := range values {
+		args = append(args, value.value)
+		sets = append(sets, fmt.Sprintf("%s = $%d", value.name, len(args)))
+	}
+	conditions := make([]string, 0, len(keys)+1)
+	for _, key := range keys {
+		args = append(args, key.value)
+		conditions = append(conditions, fmt.Sprintf("%s = $%d", key.name, len(args)))
+	}
+	if condition != "" {
+		args = append(args, conditionArg...)
+		conditions = append(conditions, fmt.Sprintf(condition, len(args)))
+	}
+
+	tag, err := tx.Exec(ctx, fmt.Sprintf(`UPDATE %s SET %s WHERE %s`,
+		table,
+		strings.Join(sets, ","),
+		strings.Join(conditions, " AND "),
+	), args...)
+	if err != nil {
+		return probedb.ActionIgnored, err
+	}
+	if tag.RowsAffected() == 0 {
+		return probedb.ActionIgnored, nil
+	}
+
+	return probedb.ActionUpdated, nil
+}
+
+// delayValue returns the value of the delay column.
+func delayValue(values []*column) interface{} {
+	for _, value := range values {
+		if value.name == "f_delay" {
+			return value.value
+		}
+	}
+
+	return nil
+}
+
+// conflictAction returns the ON CONFLICT action for merging rows in to a table
+// according to a conflict policy.
+func conflictAction(table string, policy probedb.ConflictPolicy, columns []string, conflictColumns []string) string {
+	if policy == probedb.ConflictMerge {
+		merge := fmt.Sprintf("merge_attester_buckets(%s.f_attester_buckets, excluded.f_attester_buckets)", table)
+		return fmt.Sprintf("DO UPDATE SET f_attester_buckets = %s WHERE %s IS DISTINCT FROM %s.f_attester_buckets", merge, merge, table)
+	}
+	if policy != probedb.ConflictKeepLatest && policy != probedb.ConflictKeepMinimumDelay {
+		return "DO NOTHING"
+	}
+
+	keys := make(map[string]bool, len(conflictColumns))
+	for _, conflictColumn := range conflictColumns {
+		keys[conflictColumn] = true
+	}
+	sets := make([]string, 0, len(columns))
+	for _, column := range columns {
+		if !keys[column] {
+			sets = append(sets, fmt.Sprintf("%s = excluded.%s", column, column))
+		}
+	}
+
+	action := fmt.Sprintf("DO UPDATE SET %s", strings.Join(sets, ","))
+	if policy == probedb.ConflictKeepMinimumDelay {
+		action = fmt.Sprintf("%s WHERE excluded.f_delay < %s.f_delay", action, table)
+	}
+
+	return action
+}
+
+// dedupeRows removes rows that have the same key as an earlier row, keeping the row
+// preferred by the conflict policy, as a single statement cannot update a row twice.
+// The key is made up of the first keyColumns columns of the row.
+// The value column is the delay column for ConflictKeepMinimumDelay, and the
+// attester buckets column for ConflictMerge.
+func dedupeRows(rows [][]interface{}, keyColumns int, valueColumn int, policy probedb.ConflictPolicy) [][]interface{} {
+	indices := make(map[string]int, len(rows))
+	res := make([][]interface{}, 0, len(rows))
+	for _, row := range rows {
+		key := fmt.Sprintf("%v", row[:keyColumns])
+		index, exists := indices[key]
+		if !exists {
+			indices[key] = len(res)
+			res = append(res, row)
+			continue
+		}
+		switch policy {
+		case probedb.ConflictKeepLatest:
+			res[index] = row
+		case probedb.ConflictKeepMinimumDelay:
+			if row[valueColumn].(uint32) < res[index][valueColumn].(uint32) {
+				res[index] = row
+			}
+		case probedb.ConflictMerge:
+			merged := make([]interface{}, len(res[index]))
+			copy(merged, res[index])
+			// Whether the buckets changed does not matter here, as the merged row is
+			// still written and the database decides if the existing row is updated.
+			buckets, _ := probedb.MergeAttesterBuckets(res[index][valueColumn].([][]byte), row[valueColumn].([][]byte))
+			merged[valueColumn] = buckets
+			res[index] = merged
+		}
+	}
+
+	return res
+}
@@ -0,0 +1,114 @@
+// Copyright © 2023 Weald Technology Trading.
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package postgresql
+
+import (
+	"testing"
+
+	"github.com/stretchr/testify/require"
+	"github.com/wealdtech/probed/services/probedb"
+)
+
+func TestConflictAction(t *testing.T) {
+	columns := []string{"f_ip_addr", "f_slot", "f_delay", "f_prober"}
+	conflictColumns := []string{"f_ip_addr", "f_slot"}
+
+	tests := []struct {
+		name   string
+		policy probedb.ConflictPolicy
+		action string
+	}{
+		{
+			name:   "KeepFirst",
+			policy: probedb.ConflictKeepFirst,
+			action: "DO NOTHING",
+		},
+		{
+			name:   "KeepLatest",
+			policy: probedb.ConflictKeepLatest,
+			action: "DO UPDATE SET f_delay = excluded.f_delay,f_prober = excluded.f_prober",
+		},
+		{
+			name:   "KeepMinimumDelay",
+			policy: probedb.ConflictKeepMinimumDelay,
+			action: "DO UPDATE SET f_delay = excluded.f_delay,f_prober = excluded.f_prober WHERE excluded.f_delay < t_block_delays.f_delay",
+		},
+	}
+
+	for _, test := range tests {
+		t.Run(test.name, func(t *testing.T) {
+			require.Equal(t, test.action, conflictAction("t_block_delays", test.policy, columns, conflictColumns))
+		})
+	}
+}
+
+func TestConflictActionMerge(t *testing.T) {
+	require.Equal(t,
+		"DO UPDATE SET f_attester_buckets = merge_attester_buckets(t_attestation_summaries.f_attester_buckets, excluded.f_attester_buckets) WHERE merge_attester_buckets(t_attestation_summaries.f_attester_buckets, excluded.f_attester_buckets) IS DISTINCT FROM t_attestation_summaries.f_attester_buckets",
+		conflictAction("t_attestation_summaries", probedb.ConflictMerge, []string{"f_slot", "f_attester_buckets", "f_prober"}, []string{"f_slot"}),
+	)
+}
+
+func TestDedupeRows(t *testing.T) {
+	rows := [][]interface{}{
+		{"1.2.3.4", uint32(1), uint32(100), "prober1"},
+		{"1.2.3.4", uint32(2), uint32(200), "prober1"},
+		{"1.2.3.4", uint32(1), uint32(50), "prober2"},
+		{"1.2.3.4", uint32(1), uint32(80), "prober3"},
+	}
+
+	tests := []struct {
+		name   string
+		policy probedb.ConflictPolicy
+		res    [][]interface{}
+	}{
+		{
+			name:   "KeepLatest",
+			policy: probedb.ConflictKeepLatest,
+			res: [][]interface{}{
+				{"1.2.3.4", uint32(1), uint32(80), "prober3"},
+				{"1.2.3.4", uint32(2), uint32(200), "prober1"},
+			},
+		},
+		{
+			name:   "KeepMinimumDelay",
+			policy: probedb.ConflictKeepMinimumDelay,
+			res: [][]interface{}{
+				{"1.2.3.4", uint32(1), uint32(50), "prober2"},
+				{"1.2.3.4", uint32(2), uint32(200), "prober1"},
+			},
+		},
+	}
+
+	for _, test := range tests {
+		t.Run(test.name, func(t *testing.T) {
+			require.Equal(t, test.res, dedupeRows(rows, 2, 2, test.policy))
+		})
+	}
+}
+
+func TestDedupeRowsMerge(t *testing.T) {
+	rows := [][]interface{}{
+		{"1.2.3.4", uint32(1), [][]byte{{0x01, 0x01}}, "prober1"},
+		{"1.2.3.4", uint32(2), [][]byte{{0x02, 0x01}}, "prober1"},
+		{"1.2.3.4", uint32(1), [][]byte{{}, {0x03, 0x01}}, "prober2"},
+	}
+
+	require.Equal(t, [][]interface{}{
+		{"1.2.3.4", uint32(1), [][]byte{{0x01, 0x01}, {0x02, 0x01}}, "prober1"},
+		{"1.2.3.4", uint32(2), [][]byte{{0x02, 0x01}}, "prober1"},
+	}, dedupeRows(rows, 2, 2, probedb.ConflictMerge))
+	// The original rows are unchanged.
+	require.Equal(t, [][]byte{{0x01, 0x01}}, rows[0][2])
+}
@@ -0,0 +1,59 @@
+// Copyright © 2023 Weald Technology Trading.
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package postgresql_test
+
+import (
+	"context"
+	"os"
+	"testing"
+
+	"github.com/rs/zerolog"
+	"github.com/stretchr/testify/require"
+	"github.com/wealdtech/probed/services/probedb"
+	"github.com/wealdtech/probed/services/probedb/postgresql"
+	"github.com/wealdtech/probed/services/probedb/probedbtest"
+)
+
+func TestConformance(t *testing.T) {
+	requireDatabase(t)
+
+	probedbtest.Run(t, func(ctx context.Context, t *testing.T) probedbtest.Service {
+		s, err := postgresql.New(ctx,
+			postgresql.WithLogLevel(zerolog.Disabled),
+			postgresql.WithServer(os.Getenv("PROBEDB_SERVER")),
+			postgresql.WithPort(atoi(os.Getenv("PROBEDB_PORT"))),
+			postgresql.WithUser(os.Getenv("PROBEDB_USER")),
+			postgresql.WithPassword(os.Getenv("PROBEDB_PASSWORD")),
+		)
+		require.NoError(t, err)
+		return s
+	})
+}
+
+func TestConflictPolicyConformance(t *testing.T) {
+	requireDatabase(t)
+
+	probedbtest.RunConflictPolicies(t, func(ctx context.Context, t *testing.T, policies probedb.ConflictPolicies) probedbtest.Service {
+		s, err := postgresql.New(ctx,
+			postgresql.WithLogLevel(zerolog.Disabled),
+			postgresql.WithServer(os.Getenv("PROBEDB_SERVER")),
+			postgresql.WithPort(atoi(os.Getenv("PROBEDB_PORT"))),
+			postgresql.WithUser(os.Getenv("PROBEDB_USER")),
+			postgresql.WithPassword(os.Getenv("PROBEDB_PASSWORD")),
+			postgresql.WithConflictPolicies(policies),
+		)
+		require.NoError(t, err)
+		return s
+	})
+}
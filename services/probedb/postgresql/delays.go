@@ -0,0 +1,95 @@
+// Copyright © 2023 Weald Technology Trading.
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package postgresql
+
+import (
+	"context"
+
+	"github.com/pkg/errors"
+	"github.com/wealdtech/probed/services/probedb"
+)
+
+// delays obtains delays from the given table.
+func (s *Service) delays(ctx context.Context, table string, filter *probedb.DelayFilter) ([]*probedb.Delay, error) {
+	delays := make([]*probedb.Delay, 0)
+	if err := s.streamDelays(ctx, table, filter, func(delay *probedb.Delay) error {
+		delays = append(delays, delay)
+		return nil
+	}); err != nil {
+		return nil, err
+	}
+
+	return delays, nil
+}
+
+// streamDelays calls the handler with each delay from the given table.
+func (s *Service) streamDelays(ctx context.Context, table string, filter *probedb.DelayFilter, handler func(*probedb.Delay) error) error {
+	tx := s.tx(ctx)
+	if tx == nil {
+		ctx, cancel, err := s.beginReadTx(ctx)
+		if err != nil {
+			return errors.Wrap(err, "failed to begin transaction")
+		}
+		tx = s.tx(ctx)
+		defer cancel()
+	}
+
+	q, err := delaysQuery(table, filter)
+	if err != nil {
+		return err
+	}
+	q.log()
+
+	rows, err := tx.Query(ctx, q.String(), q.vals...)
+	if err != nil {
+		return err
+	}
+	defer rows.Close()
+
+	for rows.Next() {
+		if err := ctx.Err(); err != nil {
+			return err
+		}
+		delay := &probedb.Delay{}
+		if filter.Selection == probedb.SelectionAll {
+			err = rows.Scan(
+				&delay.IPAddr,
+				&delay.Prober,
+				&delay.Source,
+				&delay.Method,
+				&delay.Slot,
+				&delay.DelayMS,
+			)
+		} else {
+			err = rows.Scan(
+				&delay.Slot,
+				&delay.DelayMS,
+			)
+		}
+		if err != nil {
+			return errors.Wrap(err, "failed to scan row")
+		}
+		if len(delay.IPAddr) > 0 {
+			ip := delay.IPAddr.To4()
+			if ip != nil {
+				delay.IPAddr = ip
+			}
+		}
+		if err := handler(delay); err != nil {
+			return err
+		}
+	}
+
+	return rows.Err()
+}
@@ -0,0 +1,95 @@
+// Copyright © 2023 Weald Technology Trading.
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package postgresql
+
+import (
+	"context"
+
+	"github.com/pkg/errors"
+	"github.com/wealdtech/probed/services/probedb"
+)
+
+// BlockDelayStatistics obtains the statistics of the block delays for each slot in a range.
+func (s *Service) BlockDelayStatistics(ctx context.Context, filter *probedb.DelayFilter) ([]*probedb.DelayStatistics, error) {
+	return s.delayStatistics(ctx, "t_block_delays", filter)
+}
+
+// HeadDelayStatistics obtains the statistics of the head delays for each slot in a range.
+func (s *Service) HeadDelayStatistics(ctx context.Context, filter *probedb.DelayFilter) ([]*probedb.DelayStatistics, error) {
+	return s.delayStatistics(ctx, "t_head_delays", filter)
+}
+
+// delayStatistics obtains statistics of the delays from the given table.
+func (s *Service) delayStatistics(ctx context.Context, table string, filter *probedb.DelayFilter) ([]*probedb.DelayStatistics, error) {
+	q, err := delayStatisticsQuery(table, filter)
+	if err != nil {
+		return nil, err
+	}
+	dimensions := probedb.GroupingDimensions(filter)
+
+	tx := s.tx(ctx)
+	if tx == nil {
+		ctx, cancel, err := s.beginReadTx(ctx)
+		if err != nil {
+			return nil, errors.Wrap(err, "failed to begin transaction")
+		}
+		tx = s.tx(ctx)
+		defer cancel()
+	}
+
+	q.log()
+
+	rows, err := tx.Query(ctx, q.String(), q.vals...)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	statistics := make([]*probedb.DelayStatistics, 0)
+	for rows.Next() {
+		groupStatistics := &probedb.DelayStatistics{
+			Values: make([]float64, len(filter.Statistics)),
+		}
+		dest := make([]interface{}, 0, len(dimensions)+len(filter.Statistics))
+		for _, dimension := range dimensions {
+			switch dimension {
+			case probedb.DimensionSlot:
+				dest = append(dest, &groupStatistics.Slot)
+			case probedb.DimensionEpoch:
+				dest = append(dest, &groupStatistics.Epoch)
+			case probedb.DimensionSource:
+				dest = append(dest, &groupStatistics.Source)
+			case probedb.DimensionMethod:
+				dest = append(dest, &groupStatistics.Method)
+			case probedb.DimensionIPAddr:
+				dest = append(dest, &groupStatistics.IPAddr)
+			}
+		}
+		for i := range groupStatistics.Values {
+			dest = append(dest, &groupStatistics.Values[i])
+		}
+		if err := rows.Scan(dest...); err != nil {
+			return nil, errors.Wrap(err, "failed to scan row")
+		}
+		if ip := groupStatistics.IPAddr.To4(); ip != nil {
+			groupStatistics.IPAddr = ip
+		}
+		statistics = append(statistics, groupStatistics)
+	}
+	if err := rows.Err(); err != nil {
+		return nil, err
+	}
+
+	return statistics, nil
+}
@@ -15,24 +15,20 @@ package postgresql
 
 import (
 	"context"
-	"fmt"
-	"net"
-	"strings"
 
-	"github.com/pkg/errors"
 	"github.com/wealdtech/probed/services/probedb"
 )
 
 // SetHeadDelay sets a head delay.
-// If a delay already exists for this head then ignore it.
-func (s *Service) SetHeadDelay(ctx context.Context, delay *probedb.Delay) error {
+// If a delay already exists for this head then the head delay conflict policy is applied.
+func (s *Service) SetHeadDelay(ctx context.Context, delay *probedb.Delay) (probedb.Action, error) {
 	localTx := false
 	tx := s.tx(ctx)
 	if tx == nil {
 		var err error
 		tx, err = s.pool.Begin(ctx)
 		if err != nil {
-			return err
+			return probedb.ActionCreated, err
 		}
 		localTx = true
 	}
@@ -43,14 +39,15 @@ func (s *Service) SetHeadDelay(ctx context.Context, delay *probedb.Delay) error
 		ip = delay.IPAddr
 	}
 
-	_, err := tx.Exec(ctx, `
+	tag, err := tx.Exec(ctx, `
 INSERT INTO t_head_delays(f_ip_addr
                          ,f_source
                          ,f_method
                          ,f_slot
                          ,f_delay
+                         ,f_prober
                          )
-VALUES($1,$2,$3,$4,$5)
+VALUES($1,$2,$3,$4,$5,$6)
 ON CONFLICT (f_ip_addr, f_source, f_method, f_slot) DO NOTHING
 `,
 		ip,
@@ -58,8 +55,25 @@ ON CONFLICT (f_ip_addr, f_source, f_method, f_slot) DO NOTHING
 		delay.Method,
 		delay.Slot,
 		delay.DelayMS,
+		delay.Prober,
 	)
 
+	action := probedb.ActionCreated
+	if err == nil && tag.RowsAffected() == 0 {
+		action, err = applyConflictPolicy(ctx, tx, "t_head_delays", s.conflictPolicies.HeadDelays,
+			[]*column{
+				{name: "f_ip_addr", value: ip},
+				{name: "f_source", value: delay.Source},
+				{name: "f_method", value: delay.Method},
+				{name: "f_slot", value: delay.Slot},
+			},
+			[]*column{
+				{name: "f_delay", value: delay.DelayMS},
+				{name: "f_prober", value: delay.Prober},
+			},
+		)
+	}
+
 	if localTx {
 		if err == nil {
 			if err := tx.Commit(ctx); err != nil {
@@ -72,153 +86,15 @@ ON CONFLICT (f_ip_addr, f_source, f_method, f_slot) DO NOTHING
 		}
 	}
 
-	return err
+	return action, err
 }
 
 // HeadDelays obtains the head delays for a range of slots.
-func (s *Service) HeadDelays(
-	ctx context.Context,
-	filter *probedb.DelayFilter,
-) (
-	[]*probedb.Delay,
-	error,
-) {
-	tx := s.tx(ctx)
-	if tx == nil {
-		ctx, cancel, err := s.BeginTx(ctx)
-		if err != nil {
-			return nil, errors.Wrap(err, "failed to begin transaction")
-		}
-		tx = s.tx(ctx)
-		defer cancel()
-	}
-
-	// Build the query.
-	queryBuilder := strings.Builder{}
-	queryVals := make([]interface{}, 0)
-
-	switch filter.Selection {
-	case probedb.SelectionMinimum:
-		queryBuilder.WriteString(`
-SELECT f_slot
-      ,MIN(f_delay)`)
-	case probedb.SelectionMaximum:
-		queryBuilder.WriteString(`
-SELECT f_slot
-      ,MAX(f_delay)`)
-	case probedb.SelectionMedian:
-		queryBuilder.WriteString(`
-SELECT f_slot
-      ,(PERCENTILE_CONT(0.5) WITHIN GROUP(ORDER BY f_delay))::INT`)
-	case probedb.SelectionAll:
-		queryBuilder.WriteString(`
-SELECT f_ip_addr
-      ,f_source
-      ,f_method
-      ,f_slot
-      ,f_delay`)
-	default:
-		return nil, errors.New("unhandled selection criteria")
-	}
-
-	queryBuilder.WriteString(`
-FROM t_head_delays`)
-
-	conditions := make([]string, 0)
-
-	if filter.IPAddr != "" {
-		// Force the IP address to be a V4 if possible
-		ipAddr := net.ParseIP(filter.IPAddr)
-		ip := ipAddr.To4()
-		if ip == nil {
-			ip = ipAddr
-		}
-		queryVals = append(queryVals, ip)
-		conditions = append(conditions, fmt.Sprintf(`f_ip_addr = $%d`, len(queryVals)))
-	}
-
-	if len(filter.Sources) > 0 {
-		queryVals = append(queryVals, filter.Sources)
-		conditions = append(conditions, fmt.Sprintf(`f_source = ANY($%d)`, len(queryVals)))
-	}
-
-	if len(filter.Methods) > 0 {
-		queryVals = append(queryVals, filter.Methods)
-		conditions = append(conditions, fmt.Sprintf(`f_method = ANY($%d)`, len(queryVals)))
-	}
-
-	if filter.From != nil {
-		queryVals = append(queryVals, *filter.From)
-		conditions = append(conditions, fmt.Sprintf(`f_slot >= $%d`, len(queryVals)))
-	}
-
-	if filter.To != nil {
-		queryVals = append(queryVals, *filter.To)
-		conditions = append(conditions, fmt.Sprintf(`f_slot <= $%d`, len(queryVals)))
-	}
-
-	if len(conditions) > 0 {
-		queryBuilder.WriteString("\nWHERE ")
-		queryBuilder.WriteString(strings.Join(conditions, "\n  AND "))
-	}
-
-	if filter.Selection == probedb.SelectionAll {
-		queryBuilder.WriteString(`
-ORDER BY f_slot
-        ,f_method
-        ,f_ip_addr
-        ,f_source`)
-	} else {
-		queryBuilder.WriteString(`
-GROUP BY f_slot
-ORDER BY f_slot
-`)
-	}
-
-	if e := log.Trace(); e.Enabled() {
-		params := make([]string, len(queryVals))
-		for i := range queryVals {
-			params[i] = fmt.Sprintf("%v", queryVals[i])
-		}
-		log.Trace().Str("query", strings.ReplaceAll(queryBuilder.String(), "\n", " ")).Strs("params", params).Msg("SQL query")
-	}
-
-	rows, err := tx.Query(ctx,
-		queryBuilder.String(),
-		queryVals...,
-	)
-	if err != nil {
-		return nil, err
-	}
-	defer rows.Close()
+func (s *Service) HeadDelays(ctx context.Context, filter *probedb.DelayFilter) ([]*probedb.Delay, error) {
+	return s.delays(ctx, "t_head_delays", filter)
+}
 
-	delays := make([]*probedb.Delay, 0)
-	for rows.Next() {
-		delay := &probedb.Delay{}
-		if filter.Selection == probedb.SelectionAll {
-			err = rows.Scan(
-				&delay.IPAddr,
-				&delay.Source,
-				&delay.Method,
-				&delay.Slot,
-				&delay.DelayMS,
-			)
-		} else {
-			err = rows.Scan(
-				&delay.Slot,
-				&delay.DelayMS,
-			)
-		}
-		if err != nil {
-			return nil, errors.Wrap(err, "failed to scan row")
-		}
-		if len(delay.IPAddr) > 0 {
-			ip := delay.IPAddr.To4()
-			if ip != nil {
-				delay.IPAddr = ip
-			}
-		}
-		delays = append(delays, delay)
-	}
-	return delays, nil
+// StreamHeadDelays calls the handler with each head delay for a filter.
+func (s *Service) StreamHeadDelays(ctx context.Context, filter *probedb.DelayFilter, handler func(*probedb.Delay) error) error {
+	return s.streamDelays(ctx, "t_head_delays", filter, handler)
 }
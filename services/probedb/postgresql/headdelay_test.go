@@ -26,6 +26,8 @@ import (
 )
 
 func TestSetHeadDelay(t *testing.T) {
+	requireDatabase(t)
+
 	ctx := context.Background()
 	s, err := postgresql.New(ctx,
 		postgresql.WithLogLevel(zerolog.Disabled),
@@ -49,14 +51,20 @@ func TestSetHeadDelay(t *testing.T) {
 	}
 
 	// Set the head delay.
-	require.NoError(t, s.SetHeadDelay(ctx, headDelay))
+	action, err := s.SetHeadDelay(ctx, headDelay)
+	require.NoError(t, err)
+	require.Equal(t, probedb.ActionCreated, action)
 
 	// Attempt to overwrite; should be ignored but no error.
 	headDelay.DelayMS = 345
-	require.NoError(t, s.SetHeadDelay(ctx, headDelay))
+	action, err = s.SetHeadDelay(ctx, headDelay)
+	require.NoError(t, err)
+	require.Equal(t, probedb.ActionIgnored, action)
 }
 
 func TestHeadDelays(t *testing.T) {
+	requireDatabase(t)
+
 	ctx := context.Background()
 	s, err := postgresql.New(ctx,
 		postgresql.WithLogLevel(zerolog.Disabled),
@@ -88,7 +96,8 @@ func TestHeadDelays(t *testing.T) {
 
 	// Set the head delays.
 	for _, headDelay := range headDelays {
-		require.NoError(t, s.SetHeadDelay(ctx, headDelay))
+		_, err := s.SetHeadDelay(ctx, headDelay)
+		require.NoError(t, err)
 	}
 
 	tests := []struct {
@@ -1,4 +1,4 @@
-// Copyright © 2021 Weald Technology Trading.
+// Copyright © 2021, 2023 Weald Technology Trading.
 // Licensed under the Apache License, Version 2.0 (the "License");
 // you may not use this file except in compliance with the License.
 // You may obtain a copy of the License at
@@ -18,8 +18,11 @@ import (
 	"testing"
 )
 
-func TestMain(m *testing.M) {
-	if os.Getenv("PROBEDB_SERVER") != "" {
-		os.Exit(m.Run())
+// requireDatabase skips the test if no test database has been configured.
+func requireDatabase(t *testing.T) {
+	t.Helper()
+
+	if os.Getenv("PROBEDB_SERVER") == "" {
+		t.Skip("PROBEDB_SERVER not set")
 	}
 }
@@ -27,6 +27,9 @@ func (s *Service) SetMetadata(ctx context.Context, key string, value []byte) err
 	if tx == nil {
 		return ErrNoTransaction
 	}
+	if plan := s.dryRunTx(ctx); plan != nil {
+		plan.metadata[key] = value
+	}
 
 	_, err := tx.Exec(ctx, `
       INSERT INTO t_metadata(f_key
@@ -53,6 +56,14 @@ func (s *Service) Metadata(ctx context.Context, key string) ([]byte, error) {
 		}
 		defer cancel()
 	}
+	if plan := s.dryRunTx(ctx); plan != nil {
+		if value, exists := plan.metadata[key]; exists {
+			return value, nil
+		}
+		if plan.planned("t_metadata") {
+			return nil, nil
+		}
+	}
 	tx := s.tx(ctx)
 
 	res := &pgtype.JSONB{}
@@ -0,0 +1,78 @@
+// Copyright © 2023 Weald Technology Trading.
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package postgresql
+
+import (
+	"context"
+
+	"github.com/pkg/errors"
+	"github.com/prometheus/client_golang/prometheus"
+	"github.com/wealdtech/probed/services/metrics"
+)
+
+var metricsNamespace = "probed_probedb"
+
+var (
+	replicaLag         prometheus.Gauge
+	replicaLagFailures prometheus.Counter
+)
+
+func registerMetrics(ctx context.Context, monitor metrics.Service) error {
+	if replicaLag != nil {
+		// Already registered.
+		return nil
+	}
+	if monitor == nil {
+		// No monitor.
+		return nil
+	}
+	if monitor.Presenter() == "prometheus" {
+		return registerPrometheusMetrics(ctx)
+	}
+	return nil
+}
+
+func registerPrometheusMetrics(_ context.Context) error {
+	replicaLag = prometheus.NewGauge(prometheus.GaugeOpts{
+		Namespace: metricsNamespace,
+		Name:      "replica_lag_seconds",
+		Help:      "The time by which the data on the read replica trails that on the primary.",
+	})
+	if err := prometheus.Register(replicaLag); err != nil {
+		return errors.Wrap(err, "failed to register replica_lag_seconds")
+	}
+
+	replicaLagFailures = prometheus.NewCounter(prometheus.CounterOpts{
+		Namespace: metricsNamespace,
+		Name:      "replica_lag_failures_total",
+		Help:      "The number of failures to obtain the lag of the read replica.",
+	})
+	if err := prometheus.Register(replicaLagFailures); err != nil {
+		return errors.Wrap(err, "failed to register replica_lag_failures_total")
+	}
+
+	return nil
+}
+
+func setReplicaLag(lag float64) {
+	if replicaLag != nil {
+		replicaLag.Set(lag)
+	}
+}
+
+func replicaLagFailed() {
+	if replicaLagFailures != nil {
+		replicaLagFailures.Inc()
+	}
+}
@@ -0,0 +1,409 @@
+// Copyright © 2023 Weald Technology Trading.
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package postgresql
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"regexp"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/jackc/pgconn"
+	"github.com/jackc/pgx/v4"
+	"github.com/pkg/errors"
+	"github.com/wealdtech/probed/services/probedb"
+)
+
+// schemaLockKey is the key of the advisory lock held whilst the schema is changed.
+// It is the ASCII encoding of "probed".
+const schemaLockKey = int64(0x70726f626564)
+
+// recordingTx is a transaction that records the statements that it executes.
+// For a dry run the statements are recorded but not executed.  Reads of the
+// tables and metadata changed by earlier statements are served from the planned
+// state; other queries are still run, as some statements are generated from the
+// current data.
+type recordingTx struct {
+	pgx.Tx
+	dryRun     bool
+	statements []string
+	// created are the tables created by the statements of a dry run.
+	created map[string]bool
+	// metadata are the metadata values set by the statements of a dry run.
+	metadata map[string][]byte
+}
+
+var (
+	createTableRE = regexp.MustCompile(`(?i)CREATE TABLE (?:IF NOT EXISTS )?(\w+)`)
+	dropTableRE   = regexp.MustCompile(`(?i)DROP TABLE (?:IF EXISTS )?(\w+)`)
+	renameTableRE = regexp.MustCompile(`(?i)ALTER TABLE (\w+) RENAME TO (\w+)`)
+	argRE         = regexp.MustCompile(`\$(\d+)`)
+)
+
+func newRecordingTx(tx pgx.Tx, dryRun bool) *recordingTx {
+	return &recordingTx{
+		Tx:       tx,
+		dryRun:   dryRun,
+		created:  make(map[string]bool),
+		metadata: make(map[string][]byte),
+	}
+}
+
+// Exec executes a statement, recording it with its arguments bound.
+func (t *recordingTx) Exec(ctx context.Context, sql string, args ...interface{}) (pgconn.CommandTag, error) {
+	t.statements = append(t.statements, bindArgs(sql, args))
+	if t.dryRun {
+		t.plan(sql)
+		return nil, nil
+	}
+
+	return t.Tx.Exec(ctx, sql, args...)
+}
+
+// plan updates the planned state with the tables created and dropped by the statement.
+func (t *recordingTx) plan(sql string) {
+	for _, match := range createTableRE.FindAllStringSubmatch(sql, -1) {
+		t.created[match[1]] = true
+	}
+	for _, match := range renameTableRE.FindAllStringSubmatch(sql, -1) {
+		if t.created[match[1]] {
+			delete(t.created, match[1])
+			t.created[match[2]] = true
+		}
+	}
+	for _, match := range dropTableRE.FindAllStringSubmatch(sql, -1) {
+		delete(t.created, match[1])
+	}
+}
+
+// planned returns true if the table is created by the statements of a dry run,
+// in which case it does not exist in the database.
+func (t *recordingTx) planned(table string) bool {
+	return t != nil && t.created[table]
+}
+
+// dryRunTx returns the recording transaction of a dry run, if the context has one.
+func (s *Service) dryRunTx(ctx context.Context) *recordingTx {
+	if tx, isRecording := s.tx(ctx).(*recordingTx); isRecording && tx.dryRun {
+		return tx
+	}
+
+	return nil
+}
+
+// bindArgs returns the statement with its arguments in place of their placeholders.
+func bindArgs(sql string, args []interface{}) string {
+	if len(args) == 0 {
+		return sql
+	}
+
+	return argRE.ReplaceAllStringFunc(sql, func(placeholder string) string {
+		index, err := strconv.Atoi(placeholder[1:])
+		if err != nil || index < 1 || index > len(args) {
+			return placeholder
+		}
+		switch arg := args[index-1].(type) {
+		case string:
+			return quoteLiteral(arg)
+		case []byte:
+			return quoteLiteral(string(arg))
+		default:
+			return fmt.Sprintf("%v", arg)
+		}
+	})
+}
+
+// quoteLiteral quotes a string as an SQL literal.
+func quoteLiteral(in string) string {
+	return fmt.Sprintf("'%s'", strings.ReplaceAll(in, "'", "''"))
+}
+
+// MigrationStatus obtains the status of the schema of the database.
+func (s *Service) MigrationStatus(ctx context.Context) (*probedb.MigrationStatus, error) {
+	status := &probedb.MigrationStatus{
+		LatestVersion: schemaVersion,
+		Pending:       make([]uint64, 0),
+		History:       make([]*probedb.Migration, 0),
+	}
+
+	tableExists, err := s.tableExists(ctx, "t_metadata")
+	if err != nil {
+		return nil, errors.Wrap(err, "failed to check presence of tables")
+	}
+	if tableExists {
+		status.Version, err = s.version(ctx)
+		if err != nil {
+			return nil, errors.Wrap(err, "failed to obtain version")
+		}
+		status.History, err = s.migrations(ctx)
+		if err != nil {
+			return nil, errors.Wrap(err, "failed to obtain migration history")
+		}
+	}
+
+	for i := status.Version + 1; i <= schemaVersion; i++ {
+		status.Pending = append(status.Pending, i)
+	}
+
+	return status, nil
+}
+
+// Migrate migrates the schema to the latest version, returning the statements run.
+// If dryRun is true then the statements are returned without being run.
+// Other than for a dry run the schema advisory lock is held throughout, so an
+// instance that waits for another's migration to finish sees the version to
+// which it migrated.
+func (s *Service) Migrate(ctx context.Context, dryRun bool) ([]string, error) {
+	ctx, cancel, err := s.BeginTx(ctx)
+	if err != nil {
+		return nil, errors.Wrap(err, "failed to begin migration transaction")
+	}
+	if !dryRun {
+		if err := s.lockSchema(ctx); err != nil {
+			cancel()
+			return nil, err
+		}
+	}
+	recorder := newRecordingTx(s.tx(ctx), dryRun)
+	migrationCtx := context.WithValue(ctx, &Tx{}, recorder)
+
+	// See if we have anything at all.
+	tableExists, err := s.tableExists(ctx, "t_metadata")
+	if err != nil {
+		cancel()
+		return nil, errors.Wrap(err, "failed to check presence of tables")
+	}
+	if !tableExists {
+		log.Info().Uint64("target_version", schemaVersion).Msg("Initialising database")
+		if err := s.createTables(migrationCtx); err != nil {
+			cancel()
+			return nil, err
+		}
+		if err := s.finishMigration(migrationCtx, cancel, 0, schemaVersion, dryRun); err != nil {
+			return nil, err
+		}
+		return recorder.statements, nil
+	}
+
+	columnExists, err := s.columnExists(ctx, "t_metadata", "f_key")
+	if err != nil {
+		cancel()
+		return nil, errors.Wrap(err, "failed to check presence of metadata key")
+	}
+	if !columnExists {
+		cancel()
+		return nil, errors.New("database in inconsistent state, cannot continue")
+	}
+
+	version, err := s.version(ctx)
+	if err != nil {
+		cancel()
+		return nil, errors.Wrap(err, "failed to obtain version")
+	}
+
+	if version == schemaVersion {
+		cancel()
+		log.Trace().Msg("No database upgrade is required")
+		return []string{}, nil
+	}
+	if version > schemaVersion {
+		cancel()
+		if s.allowNewerSchema {
+			log.Warn().Uint64("version", version).Uint64("expected_version", schemaVersion).Msg("Database schema is newer than supported by this release; continuing")
+			return []string{}, nil
+		}
+		return nil, errors.Wrap(ErrNewerSchema, fmt.Sprintf("schema version %d is later than latest known version %d", version, schemaVersion))
+	}
+	log.Trace().Uint64("version", version).Uint64("expected_version", schemaVersion).Msg("Database upgrade required")
+
+	for i := version + 1; i <= schemaVersion; i++ {
+		log.Info().Uint64("target_version", i).Msg("Upgrading database")
+		for j, upgrade := range upgrades[i] {
+			log.Info().Int("current", j+1).Int("total", len(upgrades[i])).Msg("Running upgrade function")
+			if err := upgrade.up(migrationCtx, s); err != nil {
+				cancel()
+				return nil, errors.Wrap(err, "failed to upgrade")
+			}
+		}
+	}
+
+	if err := s.finishMigration(migrationCtx, cancel, version, schemaVersion, dryRun); err != nil {
+		return nil, err
+	}
+
+	return recorder.statements, nil
+}
+
+// Rollback rolls the schema back to the given version, returning the statements run.
+// If dryRun is true then the statements are returned without being run.
+func (s *Service) Rollback(ctx context.Context, version uint64, dryRun bool) ([]string, error) {
+	if version == 0 {
+		return nil, errors.New("cannot roll back to before version 1")
+	}
+
+	ctx, cancel, err := s.BeginTx(ctx)
+	if err != nil {
+		return nil, errors.Wrap(err, "failed to begin migration transaction")
+	}
+	if !dryRun {
+		if err := s.lockSchema(ctx); err != nil {
+			cancel()
+			return nil, err
+		}
+	}
+	recorder := newRecordingTx(s.tx(ctx), dryRun)
+	migrationCtx := context.WithValue(ctx, &Tx{}, recorder)
+
+	tableExists, err := s.tableExists(ctx, "t_metadata")
+	if err != nil {
+		cancel()
+		return nil, errors.Wrap(err, "failed to check presence of tables")
+	}
+	if !tableExists {
+		cancel()
+		return nil, errors.New("database has not been initialised")
+	}
+
+	current, err := s.version(ctx)
+	if err != nil {
+		cancel()
+		return nil, errors.Wrap(err, "failed to obtain version")
+	}
+	if current > schemaVersion {
+		cancel()
+		return nil, errors.Wrap(ErrNewerSchema, fmt.Sprintf("schema version %d is later than latest known version %d", current, schemaVersion))
+	}
+	if version > current {
+		cancel()
+		return nil, errors.Errorf("cannot roll back schema version %d to later version %d", current, version)
+	}
+	if version == current {
+		cancel()
+		log.Trace().Msg("No database rollback is required")
+		return []string{}, nil
+	}
+
+	for i := current; i > version; i-- {
+		log.Info().Uint64("target_version", i-1).Msg("Rolling back database")
+		for j := len(upgrades[i]) - 1; j >= 0; j-- {
+			log.Info().Int("current", len(upgrades[i])-j).Int("total", len(upgrades[i])).Msg("Running rollback function")
+			if err := upgrades[i][j].down(migrationCtx, s); err != nil {
+				cancel()
+				return nil, errors.Wrap(err, "failed to roll back")
+			}
+		}
+	}
+
+	if err := s.finishMigration(migrationCtx, cancel, current, version, dryRun); err != nil {
+		return nil, err
+	}
+
+	return recorder.statements, nil
+}
+
+// lockSchema takes the schema advisory lock for the remainder of the transaction,
+// waiting for any other instance that holds it to finish changing the schema.
+func (s *Service) lockSchema(ctx context.Context) error {
+	tx := s.tx(ctx)
+	if tx == nil {
+		return ErrNoTransaction
+	}
+
+	log.Trace().Msg("Obtaining schema lock")
+	if _, err := tx.Exec(ctx, `SELECT pg_advisory_xact_lock($1)`, schemaLockKey); err != nil {
+		return errors.Wrap(err, "failed to obtain schema lock")
+	}
+	log.Trace().Msg("Obtained schema lock")
+
+	return nil
+}
+
+// finishMigration sets the schema version and records the migration, then
+// commits the migration transaction.
+// For a dry run the statements are recorded and the migration transaction is
+// rolled back without changes.
+func (s *Service) finishMigration(ctx context.Context,
+	cancel context.CancelFunc,
+	from uint64,
+	to uint64,
+	dryRun bool,
+) error {
+	if err := s.setVersion(ctx, to); err != nil {
+		cancel()
+		return errors.Wrap(err, "failed to set schema version")
+	}
+
+	if err := s.addMigration(ctx, from, to); err != nil {
+		cancel()
+		return errors.Wrap(err, "failed to record migration")
+	}
+
+	if dryRun {
+		cancel()
+		log.Info().Uint64("from", from).Uint64("to", to).Msg("Dry run complete; no changes made")
+		return nil
+	}
+
+	if err := s.CommitTx(ctx); err != nil {
+		cancel()
+		return errors.Wrap(err, "failed to commit migration transaction")
+	}
+
+	log.Info().Uint64("from", from).Uint64("to", to).Msg("Migration complete")
+
+	return nil
+}
+
+// migrations obtains the history of migrations applied to the database.
+func (s *Service) migrations(ctx context.Context) ([]*probedb.Migration, error) {
+	data, err := s.Metadata(ctx, "schema_history")
+	if err != nil {
+		return nil, errors.Wrap(err, "failed to obtain schema history metadata")
+	}
+
+	migrations := make([]*probedb.Migration, 0)
+	// No data means that no migrations have been recorded.
+	if len(data) == 0 {
+		return migrations, nil
+	}
+
+	if err := json.Unmarshal(data, &migrations); err != nil {
+		return nil, errors.Wrap(err, "failed to unmarshal schema history metadata JSON")
+	}
+
+	return migrations, nil
+}
+
+// addMigration adds a migration to the history of migrations applied to the database.
+func (s *Service) addMigration(ctx context.Context, from uint64, to uint64) error {
+	migrations, err := s.migrations(ctx)
+	if err != nil {
+		return err
+	}
+
+	migrations = append(migrations, &probedb.Migration{
+		From:      from,
+		To:        to,
+		Timestamp: time.Now().UTC(),
+	})
+	data, err := json.Marshal(migrations)
+	if err != nil {
+		return errors.Wrap(err, "failed to marshal schema history metadata")
+	}
+
+	return s.SetMetadata(ctx, "schema_history", data)
+}
@@ -0,0 +1,125 @@
+// Copyright © 2023 Weald Technology Trading.
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package postgresql
+
+import (
+	"context"
+	"fmt"
+	"testing"
+
+	"github.com/stretchr/testify/require"
+)
+
+func TestUpgrades(t *testing.T) {
+	for version, upgrade := range upgrades {
+		require.True(t, version > 1 && version <= schemaVersion, "upgrade for unknown version %d", version)
+		require.NotEmpty(t, upgrade, "no changes for version %d", version)
+		for i := range upgrade {
+			require.NotNil(t, upgrade[i].up, "no up function for change %d of version %d", i, version)
+			require.NotNil(t, upgrade[i].down, "no down function for change %d of version %d", i, version)
+		}
+	}
+}
+
+func TestBindArgs(t *testing.T) {
+	tests := []struct {
+		name string
+		sql  string
+		args []interface{}
+		res  string
+	}{
+		{
+			name: "NoArgs",
+			sql:  `SELECT $1`,
+			res:  `SELECT $1`,
+		},
+		{
+			name: "Args",
+			sql:  `INSERT INTO t_metadata(f_key,f_value) VALUES($1,$2)`,
+			args: []interface{}{"schema", []byte(`{"version":6}`)},
+			res:  `INSERT INTO t_metadata(f_key,f_value) VALUES('schema','{"version":6}')`,
+		},
+		{
+			name: "Quoted",
+			sql:  `SELECT $1`,
+			args: []interface{}{"it's"},
+			res:  `SELECT 'it''s'`,
+		},
+		{
+			name: "Numbers",
+			sql:  `DELETE FROM t_block_delays_default WHERE f_slot >= $1 AND f_slot < $2`,
+			args: []interface{}{uint64(10), uint64(20)},
+			res:  `DELETE FROM t_block_delays_default WHERE f_slot >= 10 AND f_slot < 20`,
+		},
+		{
+			name: "Many",
+			sql:  `SELECT $1, $10`,
+			args: []interface{}{1, 2, 3, 4, 5, 6, 7, 8, 9, 10},
+			res:  `SELECT 1, 10`,
+		},
+		{
+			name: "Missing",
+			sql:  `SELECT $1, $2`,
+			args: []interface{}{1},
+			res:  `SELECT 1, $2`,
+		},
+	}
+
+	for _, test := range tests {
+		t.Run(test.name, func(t *testing.T) {
+			require.Equal(t, test.res, bindArgs(test.sql, test.args))
+		})
+	}
+}
+
+func TestDryRunInitialise(t *testing.T) {
+	s := &Service{partitionSize: 32}
+	// The recorder has no database transaction, so any statement or query that
+	// reached the database would fail.
+	recorder := newRecordingTx(nil, true)
+	ctx := context.WithValue(context.Background(), &Tx{}, recorder)
+
+	require.NoError(t, s.createTables(ctx))
+	require.NoError(t, s.finishMigration(ctx, func() {}, 0, schemaVersion, true))
+
+	// Version and history are recorded with their values.
+	require.Contains(t, recorder.statements[len(recorder.statements)-2], fmt.Sprintf(`VALUES('schema','{"version":%d}')`, schemaVersion))
+	require.Contains(t, recorder.statements[len(recorder.statements)-1], `VALUES('schema_history','[{"from":0,"to":`)
+
+	// Reads are served from the planned state.
+	version, err := s.version(ctx)
+	require.NoError(t, err)
+	require.Equal(t, uint64(schemaVersion), version)
+	migrations, err := s.migrations(ctx)
+	require.NoError(t, err)
+	require.Len(t, migrations, 1)
+}
+
+func TestDryRunPlannedTables(t *testing.T) {
+	s := &Service{partitionSize: 32}
+	recorder := newRecordingTx(nil, true)
+	ctx := context.WithValue(context.Background(), &Tx{}, recorder)
+
+	require.NoError(t, s.createTables(ctx))
+	for _, table := range partitionedTables {
+		require.True(t, recorder.planned(fmt.Sprintf("t_%s", table)))
+	}
+
+	// Tables recreated by renaming remain planned, so partitioning them does not
+	// query the database.
+	require.NoError(t, unpartitionTables(ctx, s))
+	require.False(t, recorder.planned("t_block_delays_unpartitioned"))
+	require.NoError(t, partitionTables(ctx, s))
+	require.Contains(t, recorder.statements, `DROP TABLE t_block_delays_0_0`)
+}
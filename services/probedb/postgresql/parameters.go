@@ -14,20 +14,38 @@
 package postgresql
 
 import (
-	"errors"
+	"time"
 
+	"github.com/pkg/errors"
 	"github.com/rs/zerolog"
+	"github.com/wealdtech/probed/services/metrics"
+	nullmetrics "github.com/wealdtech/probed/services/metrics/null"
+	"github.com/wealdtech/probed/services/probedb"
 )
 
 type parameters struct {
-	logLevel   zerolog.Level
-	server     string
-	port       int32
-	user       string
-	password   string
-	clientCert []byte
-	clientKey  []byte
-	caCert     []byte
+	logLevel              zerolog.Level
+	monitor               metrics.Service
+	server                string
+	port                  int32
+	user                  string
+	password              string
+	replicaServer         string
+	replicaPort           int32
+	database              string
+	sslMode               string
+	clientCert            []byte
+	clientKey             []byte
+	caCert                []byte
+	maxConnections        int32
+	minConnections        int32
+	maxConnectionLifetime time.Duration
+	maxConnectionIdleTime time.Duration
+	statementTimeout      time.Duration
+	applicationName       string
+	partitionSize         uint32
+	allowNewerSchema      bool
+	conflictPolicies      probedb.ConflictPolicies
 }
 
 // Parameter is the interface for service parameters.
@@ -48,6 +66,13 @@ func WithLogLevel(logLevel zerolog.Level) Parameter {
 	})
 }
 
+// WithMonitor sets the monitor for the module.
+func WithMonitor(monitor metrics.Service) Parameter {
+	return parameterFunc(func(p *parameters) {
+		p.monitor = monitor
+	})
+}
+
 // WithServer sets the server for this module.
 func WithServer(server string) Parameter {
 	return parameterFunc(func(p *parameters) {
@@ -76,6 +101,38 @@ func WithPort(port int32) Parameter {
 	})
 }
 
+// WithReplicaServer sets the server of a read replica for this module.
+// If set then providers read from the replica, and setters and upgrades use the primary server.
+func WithReplicaServer(server string) Parameter {
+	return parameterFunc(func(p *parameters) {
+		p.replicaServer = server
+	})
+}
+
+// WithReplicaPort sets the port of the read replica for this module.
+// If not set then the port of the primary server is used.
+func WithReplicaPort(port int32) Parameter {
+	return parameterFunc(func(p *parameters) {
+		p.replicaPort = port
+	})
+}
+
+// WithDatabase sets the name of the database for this module.
+// If not set then the database with the same name as the user is used.
+func WithDatabase(database string) Parameter {
+	return parameterFunc(func(p *parameters) {
+		p.database = database
+	})
+}
+
+// WithSSLMode sets the SSL mode for connections to the server, as per libpq.
+// If not set then "verify-full" is used if certificates are supplied, otherwise "prefer".
+func WithSSLMode(sslMode string) Parameter {
+	return parameterFunc(func(p *parameters) {
+		p.sslMode = sslMode
+	})
+}
+
 // WithClientCert sets the bytes of the client TLS certificate.
 func WithClientCert(cert []byte) Parameter {
 	return parameterFunc(func(p *parameters) {
@@ -97,10 +154,81 @@ func WithCACert(cert []byte) Parameter {
 	})
 }
 
+// WithMaxConnections sets the maximum number of connections in the pool.
+// If not set then the larger of 4 and the number of CPUs is used.
+func WithMaxConnections(connections int32) Parameter {
+	return parameterFunc(func(p *parameters) {
+		p.maxConnections = connections
+	})
+}
+
+// WithMinConnections sets the minimum number of connections in the pool.
+func WithMinConnections(connections int32) Parameter {
+	return parameterFunc(func(p *parameters) {
+		p.minConnections = connections
+	})
+}
+
+// WithMaxConnectionLifetime sets the duration after which a connection is closed and replaced.
+// If not set then connections are replaced after 1 hour.
+func WithMaxConnectionLifetime(lifetime time.Duration) Parameter {
+	return parameterFunc(func(p *parameters) {
+		p.maxConnectionLifetime = lifetime
+	})
+}
+
+// WithMaxConnectionIdleTime sets the duration after which an idle connection is closed.
+// If not set then idle connections are closed after 30 minutes.
+func WithMaxConnectionIdleTime(idleTime time.Duration) Parameter {
+	return parameterFunc(func(p *parameters) {
+		p.maxConnectionIdleTime = idleTime
+	})
+}
+
+// WithStatementTimeout sets the maximum duration of a statement, after which the server aborts it.
+// If not set then the server's default is used.
+func WithStatementTimeout(timeout time.Duration) Parameter {
+	return parameterFunc(func(p *parameters) {
+		p.statementTimeout = timeout
+	})
+}
+
+// WithApplicationName sets the application name reported to the server.
+func WithApplicationName(name string) Parameter {
+	return parameterFunc(func(p *parameters) {
+		p.applicationName = name
+	})
+}
+
+// WithPartitionSize sets the number of slots in each partition of the probe tables.
+func WithPartitionSize(slots uint32) Parameter {
+	return parameterFunc(func(p *parameters) {
+		p.partitionSize = slots
+	})
+}
+
+// WithAllowNewerSchema sets whether the service continues if the database schema is
+// newer than that known to this release, rather than refusing to start.
+func WithAllowNewerSchema(allow bool) Parameter {
+	return parameterFunc(func(p *parameters) {
+		p.allowNewerSchema = allow
+	})
+}
+
+// WithConflictPolicies sets the policies applied when a record has the same key as an existing record.
+func WithConflictPolicies(policies probedb.ConflictPolicies) Parameter {
+	return parameterFunc(func(p *parameters) {
+		p.conflictPolicies = policies
+	})
+}
+
 // parseAndCheckParameters parses and checks parameters to ensure that mandatory parameters are present and correct.
 func parseAndCheckParameters(params ...Parameter) (*parameters, error) {
 	parameters := parameters{
-		logLevel: zerolog.GlobalLevel(),
+		logLevel:        zerolog.GlobalLevel(),
+		monitor:         nullmetrics.New(),
+		applicationName: "probed",
+		partitionSize:   7200,
 	}
 	for _, p := range params {
 		if params != nil {
@@ -108,6 +236,9 @@ func parseAndCheckParameters(params ...Parameter) (*parameters, error) {
 		}
 	}
 
+	if parameters.monitor == nil {
+		return nil, errors.New("no monitor specified")
+	}
 	if parameters.server == "" {
 		return nil, errors.New("no server specified")
 	}
@@ -117,6 +248,44 @@ func parseAndCheckParameters(params ...Parameter) (*parameters, error) {
 	if parameters.port == 0 {
 		return nil, errors.New("no port specified")
 	}
+	switch parameters.sslMode {
+	case "", "disable", "allow", "prefer", "require", "verify-ca", "verify-full":
+	default:
+		return nil, errors.Errorf("invalid SSL mode %q", parameters.sslMode)
+	}
+	if parameters.sslMode == "disable" && (parameters.caCert != nil || parameters.clientCert != nil) {
+		return nil, errors.New("certificates cannot be used when SSL is disabled")
+	}
+	if (parameters.clientCert == nil) != (parameters.clientKey == nil) {
+		return nil, errors.New("client certificate and key must be supplied together")
+	}
+	if parameters.maxConnections < 0 {
+		return nil, errors.New("maximum connections cannot be negative")
+	}
+	if parameters.minConnections < 0 {
+		return nil, errors.New("minimum connections cannot be negative")
+	}
+	if parameters.maxConnections != 0 && parameters.minConnections > parameters.maxConnections {
+		return nil, errors.New("minimum connections cannot be more than maximum connections")
+	}
+	if parameters.maxConnectionLifetime < 0 {
+		return nil, errors.New("maximum connection lifetime cannot be negative")
+	}
+	if parameters.maxConnectionIdleTime < 0 {
+		return nil, errors.New("maximum connection idle time cannot be negative")
+	}
+	if parameters.statementTimeout < 0 {
+		return nil, errors.New("statement timeout cannot be negative")
+	}
+	if parameters.statementTimeout > 0 && parameters.statementTimeout < time.Millisecond {
+		return nil, errors.New("statement timeout must be at least 1ms")
+	}
+	if parameters.partitionSize == 0 {
+		return nil, errors.New("partition size must be positive")
+	}
+	if err := parameters.conflictPolicies.Check(); err != nil {
+		return nil, err
+	}
 
 	return &parameters, nil
 }
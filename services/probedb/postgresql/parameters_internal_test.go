@@ -0,0 +1,123 @@
+// Copyright © 2023 Weald Technology Trading.
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package postgresql
+
+import (
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/require"
+)
+
+func TestParseAndCheckParameters(t *testing.T) {
+	base := []Parameter{
+		WithServer("server.wealdtech.com"),
+		WithUser("probed"),
+		WithPort(5432),
+	}
+
+	tests := []struct {
+		name   string
+		params []Parameter
+		err    string
+	}{
+		{
+			name: "Good",
+		},
+		{
+			name: "SSLModeInvalid",
+			params: []Parameter{
+				WithSSLMode("bad"),
+			},
+			err: `invalid SSL mode "bad"`,
+		},
+		{
+			name: "SSLModeDisabledWithCertificates",
+			params: []Parameter{
+				WithSSLMode("disable"),
+				WithCACert([]byte("cert")),
+			},
+			err: "certificates cannot be used when SSL is disabled",
+		},
+		{
+			name: "ClientKeyMissing",
+			params: []Parameter{
+				WithClientCert([]byte("cert")),
+			},
+			err: "client certificate and key must be supplied together",
+		},
+		{
+			name: "MaxConnectionsNegative",
+			params: []Parameter{
+				WithMaxConnections(-1),
+			},
+			err: "maximum connections cannot be negative",
+		},
+		{
+			name: "MinConnectionsNegative",
+			params: []Parameter{
+				WithMinConnections(-1),
+			},
+			err: "minimum connections cannot be negative",
+		},
+		{
+			name: "MinConnectionsAboveMax",
+			params: []Parameter{
+				WithMaxConnections(2),
+				WithMinConnections(3),
+			},
+			err: "minimum connections cannot be more than maximum connections",
+		},
+		{
+			name: "MaxConnectionLifetimeNegative",
+			params: []Parameter{
+				WithMaxConnectionLifetime(-time.Second),
+			},
+			err: "maximum connection lifetime cannot be negative",
+		},
+		{
+			name: "MaxConnectionIdleTimeNegative",
+			params: []Parameter{
+				WithMaxConnectionIdleTime(-time.Second),
+			},
+			err: "maximum connection idle time cannot be negative",
+		},
+		{
+			name: "StatementTimeoutNegative",
+			params: []Parameter{
+				WithStatementTimeout(-time.Second),
+			},
+			err: "statement timeout cannot be negative",
+		},
+		{
+			name: "StatementTimeoutTooShort",
+			params: []Parameter{
+				WithStatementTimeout(time.Microsecond),
+			},
+			err: "statement timeout must be at least 1ms",
+		},
+	}
+
+	for _, test := range tests {
+		t.Run(test.name, func(t *testing.T) {
+			params := append(append([]Parameter{}, base...), test.params...)
+			_, err := parseAndCheckParameters(params...)
+			if test.err != "" {
+				require.EqualError(t, err, test.err)
+			} else {
+				require.NoError(t, err)
+			}
+		})
+	}
+}
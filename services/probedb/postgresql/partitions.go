@@ -0,0 +1,278 @@
+// Copyright © 2023 Weald Technology Trading.
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package postgresql
+
+import (
+	"context"
+	"fmt"
+	"sort"
+	"strings"
+
+	"github.com/attestantio/go-eth2-client/spec/phase0"
+	"github.com/pkg/errors"
+)
+
+// partitionedTables are the probe tables that are partitioned by slot range.
+var partitionedTables = []string{"block_delays", "head_delays", "aggregate_attestations", "attestation_summaries"}
+
+// partition is a slot range partition of a probe table, holding slots in [start, end).
+type partition struct {
+	start uint64
+	end   uint64
+}
+
+// partitionName returns the name of the partition of the table for the given range.
+func partitionName(table string, start uint64, end uint64) string {
+	return fmt.Sprintf("t_%s_%d_%d", table, start, end)
+}
+
+// parsePartitionName parses the name of a range partition of the table.
+// It returns false if the name is not that of a range partition of the table.
+func parsePartitionName(table string, name string) (*partition, bool) {
+	suffix := strings.TrimPrefix(name, fmt.Sprintf("t_%s_", table))
+	if suffix == name {
+		return nil, false
+	}
+	p := &partition{}
+	if n, err := fmt.Sscanf(suffix, "%d_%d", &p.start, &p.end); err != nil || n != 2 {
+		return nil, false
+	}
+	if partitionName(table, p.start, p.end) != name || p.end <= p.start {
+		return nil, false
+	}
+
+	return p, true
+}
+
+// partitionsFor returns the partitions required to cover the slots from the given
+// start up to and including the given slot, aligned to the partition size.
+// The first partition starts at the given start, which may not be aligned.
+func partitionsFor(start uint64, to uint64, size uint64) []*partition {
+	partitions := make([]*partition, 0)
+	for start <= to {
+		end := (start/size + 1) * size
+		partitions = append(partitions, &partition{start: start, end: end})
+		start = end
+	}
+
+	return partitions
+}
+
+// CreatePartitions creates any partitions missing between the two slots, inclusive,
+// for all probe tables.
+// Partitions are only created above the highest existing partition of each table.
+func (s *Service) CreatePartitions(ctx context.Context, from phase0.Slot, to phase0.Slot) error {
+	for _, table := range partitionedTables {
+		if err := s.createPartitions(ctx, table, uint64(from), uint64(to)); err != nil {
+			return errors.Wrap(err, fmt.Sprintf("failed to create partitions for t_%s", table))
+		}
+	}
+
+	return nil
+}
+
+func (s *Service) createPartitions(ctx context.Context, table string, from uint64, to uint64) error {
+	size := uint64(s.partitionSize)
+
+	partitions, err := s.partitions(ctx, table)
+	if err != nil {
+		return err
+	}
+
+	start := from - from%size
+	if len(partitions) > 0 && partitions[len(partitions)-1].end > start {
+		start = partitions[len(partitions)-1].end
+	}
+
+	for _, partition := range partitionsFor(start, to, size) {
+		if err := s.createPartition(ctx, table, partition); err != nil {
+			return err
+		}
+	}
+
+	return nil
+}
+
+// createPartition creates a single partition of the table.
+// Any rows for the partition's range that have already been written to the default
+// partition are moved to the new partition.
+func (s *Service) createPartition(ctx context.Context, table string, partition *partition) error {
+	name := partitionName(table, partition.start, partition.end)
+	if err := s.inTx(ctx, func(ctx context.Context) error {
+		return s.createPartitionInTx(ctx, table, name, partition)
+	}); err != nil {
+		return err
+	}
+
+	log.Trace().Str("partition", name).Msg("Created partition")
+
+	return nil
+}
+
+func (s *Service) createPartitionInTx(ctx context.Context, table string, name string, partition *partition) error {
+	tx := s.tx(ctx)
+
+	var misplaced bool
+	if err := tx.QueryRow(ctx, fmt.Sprintf(`
+SELECT EXISTS (SELECT 1
+               FROM t_%s_default
+               WHERE f_slot >= $1
+                 AND f_slot < $2)
+`, table),
+		partition.start,
+		partition.end,
+	).Scan(&misplaced); err != nil {
+		return errors.Wrap(err, "failed to check default partition")
+	}
+
+	if !misplaced {
+		if _, err := tx.Exec(ctx, fmt.Sprintf(`CREATE TABLE %s PARTITION OF t_%s FOR VALUES FROM (%d) TO (%d)`, name, table, partition.start, partition.end)); err != nil {
+			return errors.Wrap(err, fmt.Sprintf("failed to create %s", name))
+		}
+		return nil
+	}
+
+	// A range cannot be added while the default partition holds rows for it, so
+	// detach the default partition whilst the rows are moved.
+	log.Debug().Str("partition", name).Msg("Moving rows from default partition")
+	if _, err := tx.Exec(ctx, fmt.Sprintf(`ALTER TABLE t_%s DETACH PARTITION t_%s_default`, table, table)); err != nil {
+		return errors.Wrap(err, "failed to detach default partition")
+	}
+	if _, err := tx.Exec(ctx, fmt.Sprintf(`CREATE TABLE %s PARTITION OF t_%s FOR VALUES FROM (%d) TO (%d)`, name, table, partition.start, partition.end)); err != nil {
+		return errors.Wrap(err, fmt.Sprintf("failed to create %s", name))
+	}
+	if _, err := tx.Exec(ctx, fmt.Sprintf(`INSERT INTO %s SELECT * FROM t_%s_default WHERE f_slot >= $1 AND f_slot < $2`, name, table),
+		partition.start,
+		partition.end,
+	); err != nil {
+		return errors.Wrap(err, "failed to copy rows from default partition")
+	}
+	if _, err := tx.Exec(ctx, fmt.Sprintf(`DELETE FROM t_%s_default WHERE f_slot >= $1 AND f_slot < $2`, table),
+		partition.start,
+		partition.end,
+	); err != nil {
+		return errors.Wrap(err, "failed to remove rows from default partition")
+	}
+	if _, err := tx.Exec(ctx, fmt.Sprintf(`ALTER TABLE t_%s ATTACH PARTITION t_%s_default DEFAULT`, table, table)); err != nil {
+		return errors.Wrap(err, "failed to attach default partition")
+	}
+
+	return nil
+}
+
+// DropPartitions drops the partitions of the given table that hold only slots before
+// the given slot, returning the number of partitions dropped.
+func (s *Service) DropPartitions(ctx context.Context, table string, before phase0.Slot) (uint32, error) {
+	partitions, err := s.partitions(ctx, table)
+	if err != nil {
+		return 0, err
+	}
+
+	dropped := uint32(0)
+	for _, partition := range partitions {
+		if partition.end > uint64(before) {
+			break
+		}
+		if err := s.dropPartition(ctx, partitionName(table, partition.start, partition.end)); err != nil {
+			return dropped, err
+		}
+		dropped++
+	}
+
+	return dropped, nil
+}
+
+func (s *Service) dropPartition(ctx context.Context, name string) error {
+	if err := s.inTx(ctx, func(ctx context.Context) error {
+		if _, err := s.tx(ctx).Exec(ctx, fmt.Sprintf(`DROP TABLE %s`, name)); err != nil {
+			return errors.Wrap(err, fmt.Sprintf("failed to drop %s", name))
+		}
+		return nil
+	}); err != nil {
+		return err
+	}
+
+	log.Trace().Str("partition", name).Msg("Dropped partition")
+
+	return nil
+}
+
+// partitions returns the range partitions of the table, in slot order.
+func (s *Service) partitions(ctx context.Context, table string) ([]*partition, error) {
+	tx := s.tx(ctx)
+	if tx == nil {
+		ctx, cancel, err := s.BeginTx(ctx)
+		if err != nil {
+			return nil, errors.Wrap(err, "failed to begin transaction")
+		}
+		tx = s.tx(ctx)
+		defer cancel()
+	}
+
+	rows, err := tx.Query(ctx, `
+SELECT c.relname
+FROM pg_inherits i
+JOIN pg_class c ON c.oid = i.inhrelid
+WHERE i.inhparent = $1::regclass
+`,
+		fmt.Sprintf("t_%s", table),
+	)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	partitions := make([]*partition, 0)
+	for rows.Next() {
+		var name string
+		if err := rows.Scan(&name); err != nil {
+			return nil, errors.Wrap(err, "failed to scan row")
+		}
+		if partition, isRange := parsePartitionName(table, name); isRange {
+			partitions = append(partitions, partition)
+		}
+	}
+	if err := rows.Err(); err != nil {
+		return nil, err
+	}
+
+	sort.Slice(partitions, func(i, j int) bool {
+		return partitions[i].start < partitions[j].start
+	})
+
+	return partitions, nil
+}
+
+// inTx runs the function inside the context's transaction, or inside a
+// transaction of its own if the context does not have one.
+func (s *Service) inTx(ctx context.Context, fn func(context.Context) error) error {
+	if s.hasTx(ctx) {
+		return fn(ctx)
+	}
+
+	ctx, cancel, err := s.BeginTx(ctx)
+	if err != nil {
+		return err
+	}
+	if err := fn(ctx); err != nil {
+		cancel()
+		return err
+	}
+	if err := s.CommitTx(ctx); err != nil {
+		cancel()
+		return errors.Wrap(err, "failed to commit transaction")
+	}
+
+	return nil
+}
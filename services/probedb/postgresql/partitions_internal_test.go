@@ -0,0 +1,119 @@
+// Copyright © 2023 Weald Technology Trading.
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package postgresql
+
+import (
+	"testing"
+
+	"github.com/stretchr/testify/require"
+)
+
+func TestParsePartitionName(t *testing.T) {
+	tests := []struct {
+		name      string
+		table     string
+		partition string
+		expected  *partition
+	}{
+		{
+			name:      "Range",
+			table:     "block_delays",
+			partition: "t_block_delays_7200_14400",
+			expected:  &partition{start: 7200, end: 14400},
+		},
+		{
+			name:      "Legacy",
+			table:     "head_delays",
+			partition: "t_head_delays_0_21600",
+			expected:  &partition{start: 0, end: 21600},
+		},
+		{
+			name:      "Default",
+			table:     "block_delays",
+			partition: "t_block_delays_default",
+		},
+		{
+			name:      "OtherTable",
+			table:     "block_delays",
+			partition: "t_head_delays_0_7200",
+		},
+		{
+			name:      "Trailing",
+			table:     "block_delays",
+			partition: "t_block_delays_0_7200_old",
+		},
+		{
+			name:      "Empty",
+			table:     "block_delays",
+			partition: "t_block_delays_7200_7200",
+		},
+	}
+
+	for _, test := range tests {
+		t.Run(test.name, func(t *testing.T) {
+			partition, isRange := parsePartitionName(test.table, test.partition)
+			if test.expected == nil {
+				require.False(t, isRange)
+				return
+			}
+			require.True(t, isRange)
+			require.Equal(t, test.expected, partition)
+		})
+	}
+}
+
+func TestPartitionsFor(t *testing.T) {
+	tests := []struct {
+		name     string
+		start    uint64
+		to       uint64
+		size     uint64
+		expected []*partition
+	}{
+		{
+			name:     "Single",
+			start:    7200,
+			to:       7200,
+			size:     7200,
+			expected: []*partition{{start: 7200, end: 14400}},
+		},
+		{
+			name:     "Multiple",
+			start:    7200,
+			to:       14400,
+			size:     7200,
+			expected: []*partition{{start: 7200, end: 14400}, {start: 14400, end: 21600}},
+		},
+		{
+			name:     "Unaligned",
+			start:    100,
+			to:       200,
+			size:     150,
+			expected: []*partition{{start: 100, end: 150}, {start: 150, end: 300}},
+		},
+		{
+			name:     "None",
+			start:    14400,
+			to:       14399,
+			size:     7200,
+			expected: []*partition{},
+		},
+	}
+
+	for _, test := range tests {
+		t.Run(test.name, func(t *testing.T) {
+			require.Equal(t, test.expected, partitionsFor(test.start, test.to, test.size))
+		})
+	}
+}
@@ -0,0 +1,77 @@
+// Copyright © 2023 Weald Technology Trading.
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package postgresql_test
+
+import (
+	"context"
+	"net"
+	"os"
+	"testing"
+
+	"github.com/stretchr/testify/require"
+	"github.com/wealdtech/probed/services/probedb"
+	"github.com/wealdtech/probed/services/probedb/postgresql"
+)
+
+func TestPartitions(t *testing.T) {
+	requireDatabase(t)
+
+	ctx := context.Background()
+
+	s, err := postgresql.New(ctx,
+		postgresql.WithServer(os.Getenv("PROBEDB_SERVER")),
+		postgresql.WithPort(atoi(os.Getenv("PROBEDB_PORT"))),
+		postgresql.WithUser(os.Getenv("PROBEDB_USER")),
+		postgresql.WithPassword(os.Getenv("PROBEDB_PASSWORD")),
+		postgresql.WithPartitionSize(100),
+	)
+	require.NoError(t, err)
+	require.NoError(t, s.Upgrade(ctx))
+
+	ctx, cancel, err := s.BeginTx(ctx)
+	require.NoError(t, err)
+	defer cancel()
+
+	// Write a delay before its partition exists, so that it lands in the default partition.
+	_, err = s.SetBlockDelay(ctx, &probedb.Delay{
+		IPAddr:  net.ParseIP("10.0.0.1"),
+		Source:  "client",
+		Method:  "head event",
+		Slot:    10000050,
+		DelayMS: 1000,
+	})
+	require.NoError(t, err)
+
+	// Creating the partition should move the delay across.
+	require.NoError(t, s.CreatePartitions(ctx, 10000000, 10000250))
+	delays, err := s.BlockDelays(ctx, &probedb.DelayFilter{Selection: probedb.SelectionAll})
+	require.NoError(t, err)
+	require.Len(t, delays, 1)
+
+	// Repeat creation should not error.
+	require.NoError(t, s.CreatePartitions(ctx, 10000000, 10000250))
+
+	// Drop partitions that lie entirely before the given slot.
+	dropped, err := s.DropPartitions(ctx, "block_delays", 10000150)
+	require.NoError(t, err)
+	require.GreaterOrEqual(t, dropped, uint32(1))
+	delays, err = s.BlockDelays(ctx, &probedb.DelayFilter{Selection: probedb.SelectionAll})
+	require.NoError(t, err)
+	require.Len(t, delays, 0)
+
+	// Nothing more to drop.
+	dropped, err = s.DropPartitions(ctx, "block_delays", 10000150)
+	require.NoError(t, err)
+	require.Equal(t, uint32(0), dropped)
+}
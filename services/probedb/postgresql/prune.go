@@ -0,0 +1,96 @@
+// Copyright © 2023 Weald Technology Trading.
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package postgresql
+
+import (
+	"context"
+	"fmt"
+
+	"github.com/attestantio/go-eth2-client/spec/phase0"
+	"github.com/pkg/errors"
+)
+
+// PruneBlockDelays removes up to limit block delays for slots before the given slot,
+// returning the number of block delays removed.
+func (s *Service) PruneBlockDelays(ctx context.Context, before phase0.Slot, limit uint32) (uint32, error) {
+	return s.prune(ctx, "t_block_delays", before, limit)
+}
+
+// PruneHeadDelays removes up to limit head delays for slots before the given slot,
+// returning the number of head delays removed.
+func (s *Service) PruneHeadDelays(ctx context.Context, before phase0.Slot, limit uint32) (uint32, error) {
+	return s.prune(ctx, "t_head_delays", before, limit)
+}
+
+// PruneAggregateAttestations removes up to limit aggregate attestations for slots before the given slot,
+// returning the number of aggregate attestations removed.
+func (s *Service) PruneAggregateAttestations(ctx context.Context, before phase0.Slot, limit uint32) (uint32, error) {
+	return s.prune(ctx, "t_aggregate_attestations", before, limit)
+}
+
+// PruneAttestationSummaries removes up to limit attestation summaries for slots before the given slot,
+// returning the number of attestation summaries removed.
+func (s *Service) PruneAttestationSummaries(ctx context.Context, before phase0.Slot, limit uint32) (uint32, error) {
+	return s.prune(ctx, "t_attestation_summaries", before, limit)
+}
+
+// prune removes up to limit rows for slots before the given slot from the given table.
+// Deletion is bounded so that locks are not held for long periods.
+// Rows are identified by partition as well as location, as locations are only unique within a partition.
+func (s *Service) prune(ctx context.Context, table string, before phase0.Slot, limit uint32) (uint32, error) {
+	localTx := false
+	tx := s.tx(ctx)
+	if tx == nil {
+		var err error
+		tx, err = s.pool.Begin(ctx)
+		if err != nil {
+			return 0, err
+		}
+		localTx = true
+	}
+
+	tag, err := tx.Exec(ctx, fmt.Sprintf(`
+DELETE FROM %s
+WHERE (tableoid, ctid) IN (SELECT tableoid, ctid
+                           FROM %s
+                           WHERE f_slot < $1
+                           LIMIT $2)
+`, table, table),
+		before,
+		limit,
+	)
+
+	removed := uint32(0)
+	if err == nil {
+		removed = uint32(tag.RowsAffected())
+	}
+
+	if localTx {
+		if err == nil {
+			// A failed commit leaves the rows in place, so none have been removed.
+			if err = tx.Commit(ctx); err != nil {
+				err = errors.Wrap(err, "failed to commit transaction")
+			}
+		} else {
+			if err := tx.Rollback(ctx); err != nil {
+				log.Warn().Err(err).Msg("Failed to rollback transaction")
+			}
+		}
+	}
+	if err != nil {
+		return 0, err
+	}
+
+	return removed, nil
+}
@@ -0,0 +1,425 @@
+// Copyright © 2023 Weald Technology Trading.
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package postgresql
+
+import (
+	"fmt"
+	"net"
+	"strings"
+
+	"github.com/attestantio/go-eth2-client/spec/phase0"
+	"github.com/pkg/errors"
+	"github.com/wealdtech/probed/services/probedb"
+)
+
+// query is a SQL query under construction, along with its parameters.
+type query struct {
+	sql  strings.Builder
+	vals []interface{}
+}
+
+// newQuery creates a new query starting with the given SQL.
+func newQuery(sql string) *query {
+	q := &query{
+		vals: make([]interface{}, 0),
+	}
+	q.sql.WriteString(sql)
+
+	return q
+}
+
+// param adds a parameter to the query, returning its placeholder.
+func (q *query) param(val interface{}) string {
+	q.vals = append(q.vals, val)
+
+	return fmt.Sprintf("$%d", len(q.vals))
+}
+
+// write appends SQL to the query.
+func (q *query) write(sql string) {
+	q.sql.WriteString(sql)
+}
+
+// filterConditions returns the conditions for the common filter fields.
+func (q *query) filterConditions(ipAddr string,
+	prober string,
+	sources []string,
+	methods []string,
+	from *phase0.Slot,
+	to *phase0.Slot,
+) []string {
+	conditions := make([]string, 0)
+
+	if ipAddr != "" {
+		// Force the IP address to be a V4 if possible
+		ip := net.ParseIP(ipAddr)
+		if ip4 := ip.To4(); ip4 != nil {
+			ip = ip4
+		}
+		conditions = append(conditions, "f_ip_addr = "+q.param(ip))
+	}
+
+	if prober != "" {
+		conditions = append(conditions, "f_prober = "+q.param(prober))
+	}
+
+	if len(sources) > 0 {
+		conditions = append(conditions, fmt.Sprintf("f_source = ANY(%s)", q.param(sources)))
+	}
+
+	if len(methods) > 0 {
+		conditions = append(conditions, fmt.Sprintf("f_method = ANY(%s)", q.param(methods)))
+	}
+
+	if from != nil {
+		conditions = append(conditions, "f_slot >= "+q.param(*from))
+	}
+
+	if to != nil {
+		conditions = append(conditions, "f_slot <= "+q.param(*to))
+	}
+
+	return conditions
+}
+
+// after returns the condition that selects rows whose columns come after the
+// supplied values, with the first column ordered by the given order and the
+// remaining columns in ascending order.
+func (q *query) after(order probedb.Order, columns []string, vals []interface{}) string {
+	descending := 0
+	if order == probedb.OrderLatest {
+		descending = 1
+	}
+
+	return q.afterDescending(columns, vals, descending)
+}
+
+// afterDescending returns the condition that selects rows whose columns come
+// after the supplied values, with the given number of leading columns in
+// descending order and the remaining columns in ascending order.
+func (q *query) afterDescending(columns []string, vals []interface{}, descending int) string {
+	placeholders := make([]string, len(vals))
+	for i := range vals {
+		placeholders[i] = q.param(vals[i])
+	}
+
+	return afterCondition(columns, placeholders, descending)
+}
+
+// afterCondition returns the condition for afterDescending given the
+// placeholders for the values.
+func afterCondition(columns []string, placeholders []string, descending int) string {
+	switch {
+	case descending == 0 && len(columns) == 1:
+		return fmt.Sprintf("%s > %s", columns[0], placeholders[0])
+	case descending == 0:
+		return fmt.Sprintf("(%s) > (%s)", strings.Join(columns, ","), strings.Join(placeholders, ","))
+	case len(columns) == 1:
+		return fmt.Sprintf("%s < %s", columns[0], placeholders[0])
+	default:
+		return fmt.Sprintf("(%s < %s OR (%s = %s AND %s))",
+			columns[0], placeholders[0], columns[0], placeholders[0],
+			afterCondition(columns[1:], placeholders[1:], descending-1),
+		)
+	}
+}
+
+// where appends the WHERE clause for the conditions, if there are any.
+func (q *query) where(conditions []string) {
+	if len(conditions) > 0 {
+		q.write("\nWHERE ")
+		q.write(strings.Join(conditions, "\n  AND "))
+	}
+}
+
+// orderBy appends an ORDER BY clause for the slot in the given order,
+// followed by the supplied columns in ascending order.
+func (q *query) orderBy(order probedb.Order, columns ...string) error {
+	switch order {
+	case probedb.OrderEarliest:
+		q.write("\nORDER BY f_slot")
+	case probedb.OrderLatest:
+		q.write("\nORDER BY f_slot DESC")
+	default:
+		return errors.New("no order specified")
+	}
+	for _, column := range columns {
+		q.write("\n        ," + column)
+	}
+
+	return nil
+}
+
+// limit appends a LIMIT clause, if the limit is set.
+func (q *query) limit(limit uint32) {
+	if limit != 0 {
+		q.write("\nLIMIT " + q.param(limit))
+	}
+}
+
+// String returns the SQL of the query.
+func (q *query) String() string {
+	return q.sql.String()
+}
+
+// log logs the query and its parameters at trace level.
+func (q *query) log() {
+	if e := log.Trace(); e.Enabled() {
+		params := make([]string, len(q.vals))
+		for i := range q.vals {
+			params[i] = fmt.Sprintf("%v", q.vals[i])
+		}
+		log.Trace().Str("query", strings.ReplaceAll(q.String(), "\n", " ")).Strs("params", params).Msg("SQL query")
+	}
+}
+
+// delaysQuery builds the query to obtain delays from the given table.
+func delaysQuery(table string, filter *probedb.DelayFilter) (*query, error) {
+	var q *query
+	switch filter.Selection {
+	case probedb.SelectionMinimum:
+		q = newQuery(`
+SELECT f_slot
+      ,MIN(f_delay)`)
+	case probedb.SelectionMaximum:
+		q = newQuery(`
+SELECT f_slot
+      ,MAX(f_delay)`)
+	case probedb.SelectionMedian:
+		q = newQuery(`
+SELECT f_slot
+      ,(PERCENTILE_CONT(0.5) WITHIN GROUP(ORDER BY f_delay))::INT`)
+	case probedb.SelectionAll:
+		q = newQuery(`
+SELECT f_ip_addr
+      ,f_prober
+      ,f_source
+      ,f_method
+      ,f_slot
+      ,f_delay`)
+	default:
+		return nil, errors.New("unhandled selection criteria")
+	}
+
+	cursor, err := probedb.ParseDelayCursor(filter.Cursor)
+	if err != nil {
+		return nil, err
+	}
+
+	q.write("\nFROM " + table)
+	conditions := q.filterConditions(filter.IPAddr, filter.Prober, filter.Sources, filter.Methods, filter.From, filter.To)
+	if cursor != nil {
+		if filter.Selection == probedb.SelectionAll {
+			conditions = append(conditions, q.after(filter.Order,
+				[]string{"f_slot", "f_method", "f_ip_addr", "f_source"},
+				[]interface{}{cursor.Slot, cursor.Method, cursor.IPAddr, cursor.Source},
+			))
+		} else {
+			conditions = append(conditions, q.after(filter.Order, []string{"f_slot"}, []interface{}{cursor.Slot}))
+		}
+	}
+	q.where(conditions)
+
+	if filter.Selection == probedb.SelectionAll {
+		if err := q.orderBy(filter.Order, "f_method", "f_ip_addr", "f_source"); err != nil {
+			return nil, err
+		}
+	} else {
+		q.write("\nGROUP BY f_slot")
+		if err := q.orderBy(filter.Order); err != nil {
+			return nil, err
+		}
+	}
+	q.limit(filter.Limit)
+
+	return q, nil
+}
+
+// delayStatisticsQuery builds the query to obtain statistics of delays from the given table.
+// The query returns the grouping dimensions, in the order given by probedb.GroupingDimensions,
+// followed by the statistics.
+func delayStatisticsQuery(table string, filter *probedb.DelayFilter) (*query, error) {
+	if filter.Order > probedb.OrderLatest {
+		return nil, errors.New("no order specified")
+	}
+	if err := probedb.CheckStatistics(filter.Statistics); err != nil {
+		return nil, err
+	}
+	if err := probedb.CheckDimensions(filter.GroupBy); err != nil {
+		return nil, err
+	}
+	cursor, err := probedb.ParseDelayCursor(filter.Cursor)
+	if err != nil {
+		return nil, err
+	}
+
+	q := newQuery("")
+
+	columns := make([]string, 0)
+	cursorVals := make([]interface{}, 0)
+	// Epochs and slots come first and are in the order of the filter.
+	descending := 0
+	for _, dimension := range probedb.GroupingDimensions(filter) {
+		switch dimension {
+		case probedb.DimensionSlot:
+			columns = append(columns, "f_slot")
+		case probedb.DimensionEpoch:
+			columns = append(columns, fmt.Sprintf("f_slot / %s::INTEGER", q.param(probedb.SlotsPerEpoch(filter))))
+		case probedb.DimensionSource:
+			columns = append(columns, "f_source")
+		case probedb.DimensionMethod:
+			columns = append(columns, "f_method")
+		case probedb.DimensionIPAddr:
+			columns = append(columns, "f_ip_addr")
+		}
+		if filter.Order == probedb.OrderLatest && (dimension == probedb.DimensionEpoch || dimension == probedb.DimensionSlot) {
+			descending++
+		}
+		if cursor != nil {
+			cursorVals = append(cursorVals, cursorVal(cursor, dimension))
+		}
+	}
+	groups := len(columns)
+
+	for _, statistic := range filter.Statistics {
+		switch statistic.Type {
+		case probedb.StatisticCount:
+			columns = append(columns, "COUNT(*)::FLOAT8")
+		case probedb.StatisticMinimum:
+			columns = append(columns, "MIN(f_delay)::FLOAT8")
+		case probedb.StatisticMaximum:
+			columns = append(columns, "MAX(f_delay)::FLOAT8")
+		case probedb.StatisticMean:
+			columns = append(columns, "AVG(f_delay)::FLOAT8")
+		case probedb.StatisticStdDev:
+			columns = append(columns, "STDDEV_POP(f_delay)::FLOAT8")
+		case probedb.StatisticPercentile:
+			columns = append(columns, fmt.Sprintf("PERCENTILE_CONT(%s::FLOAT8) WITHIN GROUP(ORDER BY f_delay)", q.param(statistic.Percentile/100)))
+		}
+	}
+
+	q.write("\nSELECT ")
+	q.write(strings.Join(columns, "\n      ,"))
+	q.write("\nFROM " + table)
+	conditions := q.filterConditions(filter.IPAddr, filter.Prober, filter.Sources, filter.Methods, filter.From, filter.To)
+	if cursor != nil {
+		// Groups after the cursor are made up of the rows whose grouping columns are after the cursor.
+		conditions = append(conditions, q.afterDescending(columns[:groups], cursorVals, descending))
+	}
+	q.where(conditions)
+
+	// Group and order by column position, as the epoch column is an expression.
+	positions := make([]string, groups)
+	orderPositions := make([]string, groups)
+	for i := range positions {
+		positions[i] = fmt.Sprintf("%d", i+1)
+		orderPositions[i] = positions[i]
+		if i < descending {
+			orderPositions[i] += " DESC"
+		}
+	}
+	q.write(fmt.Sprintf(`
+GROUP BY %s
+ORDER BY %s`, strings.Join(positions, ","), strings.Join(orderPositions, ",")))
+	q.limit(filter.Limit)
+
+	return q, nil
+}
+
+// cursorVal returns the value of the cursor for a grouping dimension.
+func cursorVal(cursor *probedb.Position, dimension probedb.Dimension) interface{} {
+	switch dimension {
+	case probedb.DimensionEpoch:
+		return cursor.Epoch
+	case probedb.DimensionSource:
+		return cursor.Source
+	case probedb.DimensionMethod:
+		return cursor.Method
+	case probedb.DimensionIPAddr:
+		return cursor.IPAddr
+	default:
+		return cursor.Slot
+	}
+}
+
+// aggregateAttestationsQuery builds the query to obtain aggregate attestations.
+func aggregateAttestationsQuery(filter *probedb.AggregateAttestationFilter) (*query, error) {
+	cursor, err := probedb.ParseAggregateAttestationCursor(filter.Cursor)
+	if err != nil {
+		return nil, err
+	}
+
+	q := newQuery(`
+SELECT f_ip_addr
+      ,f_prober
+      ,f_source
+      ,f_method
+      ,f_slot
+      ,f_committee_index
+      ,f_aggregation_bits
+      ,f_beacon_block_root
+      ,f_source_root
+      ,f_target_root
+      ,f_delay
+FROM t_aggregate_attestations`)
+	conditions := q.filterConditions(filter.IPAddr, filter.Prober, filter.Sources, filter.Methods, filter.From, filter.To)
+	if cursor != nil {
+		conditions = append(conditions, q.after(filter.Order,
+			[]string{"f_slot", "f_method", "f_ip_addr", "f_source", "f_committee_index", "f_aggregation_bits"},
+			[]interface{}{cursor.Slot, cursor.Method, cursor.IPAddr, cursor.Source, cursor.CommitteeIndex, cursor.Data[0]},
+		))
+	}
+	q.where(conditions)
+	if err := q.orderBy(filter.Order, "f_method", "f_ip_addr", "f_source", "f_committee_index", "f_aggregation_bits"); err != nil {
+		return nil, err
+	}
+	q.limit(filter.Limit)
+
+	return q, nil
+}
+
+// attestationSummariesQuery builds the query to obtain attestation summaries.
+func attestationSummariesQuery(filter *probedb.AttestationSummaryFilter) (*query, error) {
+	cursor, err := probedb.ParseAttestationSummaryCursor(filter.Cursor)
+	if err != nil {
+		return nil, err
+	}
+
+	q := newQuery(`
+SELECT f_ip_addr
+      ,f_prober
+      ,f_source
+      ,f_method
+      ,f_slot
+      ,f_committee_index
+      ,f_beacon_block_root
+      ,f_source_root
+      ,f_target_root
+      ,f_attester_buckets
+FROM t_attestation_summaries`)
+	conditions := q.filterConditions(filter.IPAddr, filter.Prober, filter.Sources, filter.Methods, filter.From, filter.To)
+	if cursor != nil {
+		conditions = append(conditions, q.after(filter.Order,
+			[]string{"f_slot", "f_method", "f_ip_addr", "f_source", "f_committee_index", "f_beacon_block_root", "f_source_root", "f_target_root"},
+			[]interface{}{cursor.Slot, cursor.Method, cursor.IPAddr, cursor.Source, cursor.CommitteeIndex, cursor.Data[0], cursor.Data[1], cursor.Data[2]},
+		))
+	}
+	q.where(conditions)
+	if err := q.orderBy(filter.Order, "f_method", "f_ip_addr", "f_source", "f_committee_index", "f_beacon_block_root", "f_source_root", "f_target_root"); err != nil {
+		return nil, err
+	}
+	q.limit(filter.Limit)
+
+	return q, nil
+}
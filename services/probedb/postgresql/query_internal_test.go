@@ -0,0 +1,661 @@
+// Copyright © 2023 Weald Technology Trading.
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package postgresql
+
+import (
+	"net"
+	"testing"
+
+	"github.com/attestantio/go-eth2-client/spec/phase0"
+	"github.com/stretchr/testify/require"
+	"github.com/wealdtech/probed/services/probedb"
+)
+
+func slotPtr(in phase0.Slot) *phase0.Slot {
+	return &in
+}
+
+func TestQueryWhere(t *testing.T) {
+	tests := []struct {
+		name    string
+		ipAddr  string
+		prober  string
+		sources []string
+		methods []string
+		from    *phase0.Slot
+		to      *phase0.Slot
+		sql     string
+		vals    []interface{}
+	}{
+		{
+			name: "Empty",
+			sql:  "SELECT 1",
+			vals: []interface{}{},
+		},
+		{
+			name:   "IPv4",
+			ipAddr: "1.2.3.4",
+			sql:    "SELECT 1\nWHERE f_ip_addr = $1",
+			vals:   []interface{}{net.ParseIP("1.2.3.4").To4()},
+		},
+		{
+			name:   "IPv6",
+			ipAddr: "2001:db8::1",
+			sql:    "SELECT 1\nWHERE f_ip_addr = $1",
+			vals:   []interface{}{net.ParseIP("2001:db8::1")},
+		},
+		{
+			name:    "Methods",
+			methods: []string{"m1", "m2"},
+			sql:     "SELECT 1\nWHERE f_method = ANY($1)",
+			vals:    []interface{}{[]string{"m1", "m2"}},
+		},
+		{
+			name: "To",
+			to:   slotPtr(20),
+			sql:  "SELECT 1\nWHERE f_slot <= $1",
+			vals: []interface{}{phase0.Slot(20)},
+		},
+		{
+			name:    "All",
+			ipAddr:  "1.2.3.4",
+			prober:  "prober1",
+			sources: []string{"s1"},
+			methods: []string{"m1"},
+			from:    slotPtr(10),
+			to:      slotPtr(20),
+			sql:     "SELECT 1\nWHERE f_ip_addr = $1\n  AND f_prober = $2\n  AND f_source = ANY($3)\n  AND f_method = ANY($4)\n  AND f_slot >= $5\n  AND f_slot <= $6",
+			vals: []interface{}{
+				net.ParseIP("1.2.3.4").To4(),
+				"prober1",
+				[]string{"s1"},
+				[]string{"m1"},
+				phase0.Slot(10),
+				phase0.Slot(20),
+			},
+		},
+	}
+
+	for _, test := range tests {
+		t.Run(test.name, func(t *testing.T) {
+			q := newQuery("SELECT 1")
+			q.where(q.filterConditions(test.ipAddr, test.prober, test.sources, test.methods, test.from, test.to))
+			require.Equal(t, test.sql, q.String())
+			require.Equal(t, test.vals, q.vals)
+		})
+	}
+}
+
+func TestQueryAfter(t *testing.T) {
+	tests := []struct {
+		name    string
+		order   probedb.Order
+		columns []string
+		vals    []interface{}
+		sql     string
+	}{
+		{
+			name:    "EarliestSingle",
+			columns: []string{"f_slot"},
+			vals:    []interface{}{uint32(5)},
+			sql:     "f_slot > $1",
+		},
+		{
+			name:    "EarliestMultiple",
+			columns: []string{"f_slot", "f_method"},
+			vals:    []interface{}{uint32(5), "m1"},
+			sql:     "(f_slot,f_method) > ($1,$2)",
+		},
+		{
+			name:    "LatestSingle",
+			order:   probedb.OrderLatest,
+			columns: []string{"f_slot"},
+			vals:    []interface{}{uint32(5)},
+			sql:     "f_slot < $1",
+		},
+		{
+			name:    "LatestTwo",
+			order:   probedb.OrderLatest,
+			columns: []string{"f_slot", "f_method"},
+			vals:    []interface{}{uint32(5), "m1"},
+			sql:     "(f_slot < $1 OR (f_slot = $1 AND f_method > $2))",
+		},
+		{
+			name:    "LatestMultiple",
+			order:   probedb.OrderLatest,
+			columns: []string{"f_slot", "f_method", "f_source"},
+			vals:    []interface{}{uint32(5), "m1", "s1"},
+			sql:     "(f_slot < $1 OR (f_slot = $1 AND (f_method,f_source) > ($2,$3)))",
+		},
+	}
+
+	for _, test := range tests {
+		t.Run(test.name, func(t *testing.T) {
+			q := newQuery("")
+			require.Equal(t, test.sql, q.after(test.order, test.columns, test.vals))
+			require.Equal(t, test.vals, q.vals)
+		})
+	}
+}
+
+func TestDelaysQuery(t *testing.T) {
+	tests := []struct {
+		name   string
+		filter *probedb.DelayFilter
+		sql    string
+		vals   []interface{}
+		err    string
+	}{
+		{
+			name:   "SelectionInvalid",
+			filter: &probedb.DelayFilter{Selection: 99},
+			err:    "unhandled selection criteria",
+		},
+		{
+			name:   "Minimum",
+			filter: &probedb.DelayFilter{Selection: probedb.SelectionMinimum},
+			sql: `
+SELECT f_slot
+      ,MIN(f_delay)
+FROM t_block_delays
+GROUP BY f_slot
+ORDER BY f_slot`,
+			vals: []interface{}{},
+		},
+		{
+			name: "Median",
+			filter: &probedb.DelayFilter{
+				Selection: probedb.SelectionMedian,
+				Methods:   []string{"m1"},
+				From:      slotPtr(5),
+			},
+			sql: `
+SELECT f_slot
+      ,(PERCENTILE_CONT(0.5) WITHIN GROUP(ORDER BY f_delay))::INT
+FROM t_block_delays
+WHERE f_method = ANY($1)
+  AND f_slot >= $2
+GROUP BY f_slot
+ORDER BY f_slot`,
+			vals: []interface{}{[]string{"m1"}, phase0.Slot(5)},
+		},
+		{
+			name: "All",
+			filter: &probedb.DelayFilter{
+				Selection: probedb.SelectionAll,
+				Prober:    "prober1",
+			},
+			sql: `
+SELECT f_ip_addr
+      ,f_prober
+      ,f_source
+      ,f_method
+      ,f_slot
+      ,f_delay
+FROM t_block_delays
+WHERE f_prober = $1
+ORDER BY f_slot
+        ,f_method
+        ,f_ip_addr
+        ,f_source`,
+			vals: []interface{}{"prober1"},
+		},
+		{
+			name: "AllCursor",
+			filter: &probedb.DelayFilter{
+				Selection: probedb.SelectionAll,
+				Limit:     100,
+				Cursor: probedb.DelayPosition(&probedb.Delay{
+					IPAddr: net.ParseIP("1.2.3.4"),
+					Source: "s1",
+					Method: "m1",
+					Slot:   5,
+				}).Cursor(),
+			},
+			sql: `
+SELECT f_ip_addr
+      ,f_prober
+      ,f_source
+      ,f_method
+      ,f_slot
+      ,f_delay
+FROM t_block_delays
+WHERE (f_slot,f_method,f_ip_addr,f_source) > ($1,$2,$3,$4)
+ORDER BY f_slot
+        ,f_method
+        ,f_ip_addr
+        ,f_source
+LIMIT $5`,
+			vals: []interface{}{uint32(5), "m1", net.ParseIP("1.2.3.4").To4(), "s1", uint32(100)},
+		},
+		{
+			name: "MinimumCursor",
+			filter: &probedb.DelayFilter{
+				Selection: probedb.SelectionMinimum,
+				Limit:     10,
+				Cursor:    probedb.DelayPosition(&probedb.Delay{Slot: 5}).Cursor(),
+			},
+			sql: `
+SELECT f_slot
+      ,MIN(f_delay)
+FROM t_block_delays
+WHERE f_slot > $1
+GROUP BY f_slot
+ORDER BY f_slot
+LIMIT $2`,
+			vals: []interface{}{uint32(5), uint32(10)},
+		},
+		{
+			name: "AllLatestCursor",
+			filter: &probedb.DelayFilter{
+				Selection: probedb.SelectionAll,
+				Order:     probedb.OrderLatest,
+				Limit:     100,
+				Cursor: probedb.DelayPosition(&probedb.Delay{
+					IPAddr: net.ParseIP("1.2.3.4"),
+					Source: "s1",
+					Method: "m1",
+					Slot:   5,
+				}).Cursor(),
+			},
+			sql: `
+SELECT f_ip_addr
+      ,f_prober
+      ,f_source
+      ,f_method
+      ,f_slot
+      ,f_delay
+FROM t_block_delays
+WHERE (f_slot < $1 OR (f_slot = $1 AND (f_method,f_ip_addr,f_source) > ($2,$3,$4)))
+ORDER BY f_slot DESC
+        ,f_method
+        ,f_ip_addr
+        ,f_source
+LIMIT $5`,
+			vals: []interface{}{uint32(5), "m1", net.ParseIP("1.2.3.4").To4(), "s1", uint32(100)},
+		},
+		{
+			name: "MinimumLatestCursor",
+			filter: &probedb.DelayFilter{
+				Selection: probedb.SelectionMinimum,
+				Order:     probedb.OrderLatest,
+				Cursor:    probedb.DelayPosition(&probedb.Delay{Slot: 5}).Cursor(),
+			},
+			sql: `
+SELECT f_slot
+      ,MIN(f_delay)
+FROM t_block_delays
+WHERE f_slot < $1
+GROUP BY f_slot
+ORDER BY f_slot DESC`,
+			vals: []interface{}{uint32(5)},
+		},
+		{
+			name:   "OrderInvalid",
+			filter: &probedb.DelayFilter{Selection: probedb.SelectionAll, Order: 99},
+			err:    "no order specified",
+		},
+		{
+			name: "CursorInvalid",
+			filter: &probedb.DelayFilter{
+				Selection: probedb.SelectionAll,
+				Cursor:    "invalid",
+			},
+			err: "invalid cursor",
+		},
+	}
+
+	for _, test := range tests {
+		t.Run(test.name, func(t *testing.T) {
+			q, err := delaysQuery("t_block_delays", test.filter)
+			if test.err != "" {
+				require.EqualError(t, err, test.err)
+				return
+			}
+			require.NoError(t, err)
+			require.Equal(t, test.sql, q.String())
+			require.Equal(t, test.vals, q.vals)
+		})
+	}
+}
+
+func TestDelayStatisticsQuery(t *testing.T) {
+	tests := []struct {
+		name   string
+		filter *probedb.DelayFilter
+		sql    string
+		vals   []interface{}
+		err    string
+	}{
+		{
+			name:   "StatisticsMissing",
+			filter: &probedb.DelayFilter{},
+			err:    "no statistics requested",
+		},
+		{
+			name: "DimensionInvalid",
+			filter: &probedb.DelayFilter{
+				Statistics: []probedb.Statistic{{Type: probedb.StatisticCount}},
+				GroupBy:    []probedb.Dimension{99},
+			},
+			err: "unhandled dimension",
+		},
+		{
+			name: "Slot",
+			filter: &probedb.DelayFilter{
+				Statistics: []probedb.Statistic{
+					{Type: probedb.StatisticCount},
+					{Type: probedb.StatisticMinimum},
+					{Type: probedb.StatisticMaximum},
+					{Type: probedb.StatisticMean},
+					{Type: probedb.StatisticStdDev},
+					{Type: probedb.StatisticPercentile, Percentile: 95},
+				},
+				To: slotPtr(10),
+			},
+			sql: `
+SELECT f_slot
+      ,COUNT(*)::FLOAT8
+      ,MIN(f_delay)::FLOAT8
+      ,MAX(f_delay)::FLOAT8
+      ,AVG(f_delay)::FLOAT8
+      ,STDDEV_POP(f_delay)::FLOAT8
+      ,PERCENTILE_CONT($1::FLOAT8) WITHIN GROUP(ORDER BY f_delay)
+FROM t_head_delays
+WHERE f_slot <= $2
+GROUP BY 1
+ORDER BY 1`,
+			vals: []interface{}{0.95, phase0.Slot(10)},
+		},
+		{
+			name: "Grouped",
+			filter: &probedb.DelayFilter{
+				Statistics:    []probedb.Statistic{{Type: probedb.StatisticPercentile, Percentile: 50}},
+				GroupBy:       []probedb.Dimension{probedb.DimensionSource, probedb.DimensionIPAddr, probedb.DimensionEpoch, probedb.DimensionMethod},
+				SlotsPerEpoch: 8,
+				Sources:       []string{"s1"},
+			},
+			sql: `
+SELECT f_slot / $1::INTEGER
+      ,f_method
+      ,f_ip_addr
+      ,f_source
+      ,PERCENTILE_CONT($2::FLOAT8) WITHIN GROUP(ORDER BY f_delay)
+FROM t_head_delays
+WHERE f_source = ANY($3)
+GROUP BY 1,2,3,4
+ORDER BY 1,2,3,4`,
+			vals: []interface{}{uint32(8), 0.5, []string{"s1"}},
+		},
+		{
+			name: "GroupedCursor",
+			filter: &probedb.DelayFilter{
+				Statistics:    []probedb.Statistic{{Type: probedb.StatisticCount}},
+				GroupBy:       []probedb.Dimension{probedb.DimensionEpoch, probedb.DimensionSource},
+				SlotsPerEpoch: 8,
+				Limit:         2,
+				Cursor:        probedb.DelayStatisticsPosition(&probedb.DelayStatistics{Epoch: 3, Source: "s1"}).Cursor(),
+			},
+			sql: `
+SELECT f_slot / $1::INTEGER
+      ,f_source
+      ,COUNT(*)::FLOAT8
+FROM t_head_delays
+WHERE (f_slot / $1::INTEGER,f_source) > ($2,$3)
+GROUP BY 1,2
+ORDER BY 1,2
+LIMIT $4`,
+			vals: []interface{}{uint32(8), uint32(3), "s1", uint32(2)},
+		},
+		{
+			name: "GroupedLatestCursor",
+			filter: &probedb.DelayFilter{
+				Statistics:    []probedb.Statistic{{Type: probedb.StatisticCount}},
+				GroupBy:       []probedb.Dimension{probedb.DimensionEpoch, probedb.DimensionSlot, probedb.DimensionSource},
+				SlotsPerEpoch: 8,
+				Order:         probedb.OrderLatest,
+				Cursor:        probedb.DelayStatisticsPosition(&probedb.DelayStatistics{Epoch: 3, Slot: 25, Source: "s1"}).Cursor(),
+			},
+			sql: `
+SELECT f_slot / $1::INTEGER
+      ,f_slot
+      ,f_source
+      ,COUNT(*)::FLOAT8
+FROM t_head_delays
+WHERE (f_slot / $1::INTEGER < $2 OR (f_slot / $1::INTEGER = $2 AND (f_slot < $3 OR (f_slot = $3 AND f_source > $4))))
+GROUP BY 1,2,3
+ORDER BY 1 DESC,2 DESC,3`,
+			vals: []interface{}{uint32(8), uint32(3), uint32(25), "s1"},
+		},
+		{
+			name: "OrderInvalid",
+			filter: &probedb.DelayFilter{
+				Statistics: []probedb.Statistic{{Type: probedb.StatisticCount}},
+				Order:      99,
+			},
+			err: "no order specified",
+		},
+	}
+
+	for _, test := range tests {
+		t.Run(test.name, func(t *testing.T) {
+			q, err := delayStatisticsQuery("t_head_delays", test.filter)
+			if test.err != "" {
+				require.EqualError(t, err, test.err)
+				return
+			}
+			require.NoError(t, err)
+			require.Equal(t, test.sql, q.String())
+			require.Equal(t, test.vals, q.vals)
+		})
+	}
+}
+
+func TestAggregateAttestationsQuery(t *testing.T) {
+	columns := `
+SELECT f_ip_addr
+      ,f_prober
+      ,f_source
+      ,f_method
+      ,f_slot
+      ,f_committee_index
+      ,f_aggregation_bits
+      ,f_beacon_block_root
+      ,f_source_root
+      ,f_target_root
+      ,f_delay
+FROM t_aggregate_attestations`
+	order := `
+        ,f_method
+        ,f_ip_addr
+        ,f_source
+        ,f_committee_index
+        ,f_aggregation_bits`
+	cursor := probedb.AggregateAttestationPosition(&probedb.AggregateAttestation{
+		IPAddr:          net.ParseIP("1.2.3.4"),
+		Source:          "s1",
+		Method:          "m1",
+		Slot:            5,
+		CommitteeIndex:  2,
+		AggregationBits: []byte{0x01},
+	}).Cursor()
+
+	tests := []struct {
+		name   string
+		filter *probedb.AggregateAttestationFilter
+		sql    string
+		vals   []interface{}
+		err    string
+	}{
+		{
+			name:   "OrderInvalid",
+			filter: &probedb.AggregateAttestationFilter{Order: 99},
+			err:    "no order specified",
+		},
+		{
+			name:   "Empty",
+			filter: &probedb.AggregateAttestationFilter{},
+			sql:    columns + "\nORDER BY f_slot" + order,
+			vals:   []interface{}{},
+		},
+		{
+			name: "Full",
+			filter: &probedb.AggregateAttestationFilter{
+				Sources: []string{"s1", "s2"},
+				Methods: []string{"m1", "m2"},
+				From:    slotPtr(1),
+				To:      slotPtr(2),
+				Order:   probedb.OrderLatest,
+				Limit:   10,
+			},
+			sql:  columns + "\nWHERE f_source = ANY($1)\n  AND f_method = ANY($2)\n  AND f_slot >= $3\n  AND f_slot <= $4\nORDER BY f_slot DESC" + order + "\nLIMIT $5",
+			vals: []interface{}{[]string{"s1", "s2"}, []string{"m1", "m2"}, phase0.Slot(1), phase0.Slot(2), uint32(10)},
+		},
+		{
+			name: "Cursor",
+			filter: &probedb.AggregateAttestationFilter{
+				Limit:  10,
+				Cursor: cursor,
+			},
+			sql:  columns + "\nWHERE (f_slot,f_method,f_ip_addr,f_source,f_committee_index,f_aggregation_bits) > ($1,$2,$3,$4,$5,$6)\nORDER BY f_slot" + order + "\nLIMIT $7",
+			vals: []interface{}{uint32(5), "m1", net.ParseIP("1.2.3.4").To4(), "s1", uint16(2), []byte{0x01}, uint32(10)},
+		},
+		{
+			name: "CursorLatest",
+			filter: &probedb.AggregateAttestationFilter{
+				Prober: "prober1",
+				Order:  probedb.OrderLatest,
+				Cursor: cursor,
+			},
+			sql:  columns + "\nWHERE f_prober = $1\n  AND (f_slot < $2 OR (f_slot = $2 AND (f_method,f_ip_addr,f_source,f_committee_index,f_aggregation_bits) > ($3,$4,$5,$6,$7)))\nORDER BY f_slot DESC" + order,
+			vals: []interface{}{"prober1", uint32(5), "m1", net.ParseIP("1.2.3.4").To4(), "s1", uint16(2), []byte{0x01}},
+		},
+		{
+			name: "CursorMismatch",
+			filter: &probedb.AggregateAttestationFilter{
+				Cursor: probedb.DelayPosition(&probedb.Delay{Slot: 5}).Cursor(),
+			},
+			err: "invalid cursor",
+		},
+	}
+
+	for _, test := range tests {
+		t.Run(test.name, func(t *testing.T) {
+			q, err := aggregateAttestationsQuery(test.filter)
+			if test.err != "" {
+				require.EqualError(t, err, test.err)
+				return
+			}
+			require.NoError(t, err)
+			require.Equal(t, test.sql, q.String())
+			require.Equal(t, test.vals, q.vals)
+		})
+	}
+}
+
+func TestAttestationSummariesQuery(t *testing.T) {
+	columns := `
+SELECT f_ip_addr
+      ,f_prober
+      ,f_source
+      ,f_method
+      ,f_slot
+      ,f_committee_index
+      ,f_beacon_block_root
+      ,f_source_root
+      ,f_target_root
+      ,f_attester_buckets
+FROM t_attestation_summaries`
+	order := `
+        ,f_method
+        ,f_ip_addr
+        ,f_source
+        ,f_committee_index
+        ,f_beacon_block_root
+        ,f_source_root
+        ,f_target_root`
+
+	tests := []struct {
+		name   string
+		filter *probedb.AttestationSummaryFilter
+		sql    string
+		vals   []interface{}
+		err    string
+	}{
+		{
+			name:   "OrderInvalid",
+			filter: &probedb.AttestationSummaryFilter{Order: 99},
+			err:    "no order specified",
+		},
+		{
+			name:   "Empty",
+			filter: &probedb.AttestationSummaryFilter{},
+			sql:    columns + "\nORDER BY f_slot" + order,
+			vals:   []interface{}{},
+		},
+		{
+			name: "To",
+			filter: &probedb.AttestationSummaryFilter{
+				To: slotPtr(2),
+			},
+			sql:  columns + "\nWHERE f_slot <= $1\nORDER BY f_slot" + order,
+			vals: []interface{}{phase0.Slot(2)},
+		},
+		{
+			name: "Full",
+			filter: &probedb.AttestationSummaryFilter{
+				IPAddr:  "2001:db8::1",
+				Prober:  "prober1",
+				Methods: []string{"m1"},
+				From:    slotPtr(1),
+				To:      slotPtr(2),
+				Order:   probedb.OrderLatest,
+				Limit:   10,
+			},
+			sql:  columns + "\nWHERE f_ip_addr = $1\n  AND f_prober = $2\n  AND f_method = ANY($3)\n  AND f_slot >= $4\n  AND f_slot <= $5\nORDER BY f_slot DESC" + order + "\nLIMIT $6",
+			vals: []interface{}{net.ParseIP("2001:db8::1"), "prober1", []string{"m1"}, phase0.Slot(1), phase0.Slot(2), uint32(10)},
+		},
+		{
+			name: "Cursor",
+			filter: &probedb.AttestationSummaryFilter{
+				Limit: 10,
+				Cursor: probedb.AttestationSummaryPosition(&probedb.AttestationSummary{
+					IPAddr:          net.ParseIP("2001:db8::1"),
+					Source:          "s1",
+					Method:          "m1",
+					Slot:            5,
+					CommitteeIndex:  2,
+					BeaconBlockRoot: []byte{0x01},
+					SourceRoot:      []byte{0x02},
+					TargetRoot:      []byte{0x03},
+				}).Cursor(),
+			},
+			sql:  columns + "\nWHERE (f_slot,f_method,f_ip_addr,f_source,f_committee_index,f_beacon_block_root,f_source_root,f_target_root) > ($1,$2,$3,$4,$5,$6,$7,$8)\nORDER BY f_slot" + order + "\nLIMIT $9",
+			vals: []interface{}{uint32(5), "m1", net.ParseIP("2001:db8::1"), "s1", uint16(2), []byte{0x01}, []byte{0x02}, []byte{0x03}, uint32(10)},
+		},
+	}
+
+	for _, test := range tests {
+		t.Run(test.name, func(t *testing.T) {
+			q, err := attestationSummariesQuery(test.filter)
+			if test.err != "" {
+				require.EqualError(t, err, test.err)
+				return
+			}
+			require.NoError(t, err)
+			require.Equal(t, test.sql, q.String())
+			require.Equal(t, test.vals, q.vals)
+		})
+	}
+}
@@ -0,0 +1,66 @@
+// Copyright © 2023 Weald Technology Trading.
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package postgresql
+
+import (
+	"context"
+	"time"
+
+	"github.com/pkg/errors"
+)
+
+// replicaLagInterval is the interval at which the lag of the read replica is obtained.
+var replicaLagInterval = 15 * time.Second
+
+// monitorReplicaLag periodically reports the lag of the read replica until the context is done.
+func (s *Service) monitorReplicaLag(ctx context.Context) {
+	ticker := time.NewTicker(replicaLagInterval)
+	defer ticker.Stop()
+
+	for {
+		lag, err := s.replicaLag(ctx)
+		if err != nil {
+			if ctx.Err() != nil {
+				return
+			}
+			log.Warn().Err(err).Msg("Failed to obtain replica lag")
+			replicaLagFailed()
+		} else {
+			log.Trace().Dur("lag", lag).Msg("Obtained replica lag")
+			setReplicaLag(lag.Seconds())
+		}
+
+		select {
+		case <-ctx.Done():
+			return
+		case <-ticker.C:
+		}
+	}
+}
+
+// replicaLag obtains the time by which the data on the read replica trails that on the primary.
+// The lag is 0 if the replica has replayed all of the data that it has received.
+func (s *Service) replicaLag(ctx context.Context) (time.Duration, error) {
+	var lag float64
+	if err := s.replicaPool.QueryRow(ctx, `
+SELECT CASE
+         WHEN NOT pg_is_in_recovery() THEN 0
+         WHEN pg_last_wal_receive_lsn() = pg_last_wal_replay_lsn() THEN 0
+         ELSE COALESCE(EXTRACT(EPOCH FROM NOW() - pg_last_xact_replay_timestamp()), 0)
+       END::DOUBLE PRECISION`).Scan(&lag); err != nil {
+		return 0, errors.Wrap(err, "failed to obtain replica lag")
+	}
+
+	return time.Duration(lag * float64(time.Second)), nil
+}
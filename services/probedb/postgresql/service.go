@@ -24,11 +24,16 @@ import (
 	"github.com/pkg/errors"
 	"github.com/rs/zerolog"
 	zerologger "github.com/rs/zerolog/log"
+	"github.com/wealdtech/probed/services/probedb"
 )
 
 // Service is a chain database service.
 type Service struct {
-	pool *pgxpool.Pool
+	pool             *pgxpool.Pool
+	replicaPool      *pgxpool.Pool
+	partitionSize    uint32
+	allowNewerSchema bool
+	conflictPolicies probedb.ConflictPolicies
 }
 
 // module-wide log.
@@ -44,59 +49,137 @@ func New(ctx context.Context, params ...Parameter) (*Service, error) {
 	// Set logging.
 	log = zerologger.With().Str("service", "probedb").Str("impl", "postgresql").Logger().Level(parameters.logLevel)
 
+	if err := registerMetrics(ctx, parameters.monitor); err != nil {
+		return nil, errors.Wrap(err, "failed to register metrics")
+	}
+
+	config, err := poolConfig(parameters, parameters.server, parameters.port)
+	if err != nil {
+		return nil, err
+	}
+
+	pool, err := pgxpool.ConnectConfig(context.Background(), config)
+	if err != nil {
+		return nil, errors.Wrap(err, "failed to connect to database")
+	}
+
+	go func() {
+		<-ctx.Done()
+		log.Trace().Msg("Context done; closing pool")
+		pool.Close()
+	}()
+
+	s := &Service{
+		pool:             pool,
+		partitionSize:    parameters.partitionSize,
+		allowNewerSchema: parameters.allowNewerSchema,
+		conflictPolicies: parameters.conflictPolicies,
+	}
+
+	if parameters.replicaServer != "" {
+		replicaPort := parameters.replicaPort
+		if replicaPort == 0 {
+			replicaPort = parameters.port
+		}
+		replicaConfig, err := poolConfig(parameters, parameters.replicaServer, replicaPort)
+		if err != nil {
+			return nil, errors.Wrap(err, "failed to generate replica config")
+		}
+		s.replicaPool, err = pgxpool.ConnectConfig(context.Background(), replicaConfig)
+		if err != nil {
+			return nil, errors.Wrap(err, "failed to connect to replica database")
+		}
+		go func() {
+			<-ctx.Done()
+			log.Trace().Msg("Context done; closing replica pool")
+			s.replicaPool.Close()
+		}()
+		go s.monitorReplicaLag(ctx)
+	}
+
+	return s, nil
+}
+
+// poolConfig creates the configuration for a connection pool to the given server from the parameters.
+func poolConfig(parameters *parameters, server string, port int32) (*pgxpool.Config, error) {
 	dsnItems := make([]string, 0, 16)
-	dsnItems = append(dsnItems, fmt.Sprintf("host=%s", parameters.server))
-	dsnItems = append(dsnItems, fmt.Sprintf("user=%s", parameters.user))
+	dsnItems = append(dsnItems, fmt.Sprintf("host=%s", dsnValue(server)))
+	dsnItems = append(dsnItems, fmt.Sprintf("user=%s", dsnValue(parameters.user)))
 	if parameters.password != "" {
-		dsnItems = append(dsnItems, fmt.Sprintf("password=%s", parameters.password))
+		dsnItems = append(dsnItems, fmt.Sprintf("password=%s", dsnValue(parameters.password)))
+	}
+	dsnItems = append(dsnItems, fmt.Sprintf("port=%d", port))
+	if parameters.database != "" {
+		dsnItems = append(dsnItems, fmt.Sprintf("dbname=%s", dsnValue(parameters.database)))
+	}
+	sslMode := parameters.sslMode
+	if sslMode == "" && (parameters.caCert != nil || parameters.clientCert != nil) {
+		sslMode = "verify-full"
+	}
+	if sslMode != "" {
+		dsnItems = append(dsnItems, fmt.Sprintf("sslmode=%s", sslMode))
 	}
-	dsnItems = append(dsnItems, fmt.Sprintf("port=%d", parameters.port))
 
-	var tlsConfig *tls.Config
-	if parameters.caCert != nil || parameters.clientCert != nil {
-		dsnItems = append(dsnItems, "sslmode=verify-full")
+	config, err := pgxpool.ParseConfig(strings.Join(dsnItems, " "))
+	if err != nil {
+		return nil, errors.Wrap(err, "failed to generate pgx config")
+	}
 
-		// Add TLS configuration.
-		tlsConfig = &tls.Config{
-			ServerName: parameters.server,
-			MinVersion: tls.VersionTLS13,
-		}
+	if parameters.caCert != nil || parameters.clientCert != nil {
+		// Add the certificates to the TLS configurations generated for the SSL mode,
+		// which include those of any fallback connections.
+		var clientCerts []tls.Certificate
 		if parameters.clientCert != nil {
 			clientPair, err := tls.X509KeyPair(parameters.clientCert, parameters.clientKey)
 			if err != nil {
 				return nil, errors.Wrap(err, "failed to create client certificate")
 			}
-			tlsConfig.Certificates = []tls.Certificate{clientPair}
+			clientCerts = []tls.Certificate{clientPair}
 		}
+		var rootCAs *x509.CertPool
 		if parameters.caCert != nil {
-			rootCAs := x509.NewCertPool()
+			rootCAs = x509.NewCertPool()
 			if !rootCAs.AppendCertsFromPEM(parameters.caCert) {
 				return nil, errors.New("failed to append root CA certificates")
 			}
+		}
+		tlsConfigs := []*tls.Config{config.ConnConfig.TLSConfig}
+		for _, fallback := range config.ConnConfig.Fallbacks {
+			tlsConfigs = append(tlsConfigs, fallback.TLSConfig)
+		}
+		for _, tlsConfig := range tlsConfigs {
+			if tlsConfig == nil {
+				continue
+			}
+			tlsConfig.MinVersion = tls.VersionTLS13
+			tlsConfig.Certificates = clientCerts
 			tlsConfig.RootCAs = rootCAs
 		}
 	}
 
-	config, err := pgxpool.ParseConfig(strings.Join(dsnItems, " "))
-	if err != nil {
-		return nil, errors.Wrap(err, "failed to generate pgx config")
+	if parameters.maxConnections != 0 {
+		config.MaxConns = parameters.maxConnections
 	}
-	config.ConnConfig.TLSConfig = tlsConfig
-
-	pool, err := pgxpool.ConnectConfig(context.Background(), config)
-	if err != nil {
-		return nil, errors.Wrap(err, "failed to connect to database")
+	if parameters.minConnections != 0 {
+		config.MinConns = parameters.minConnections
 	}
-
-	go func() {
-		<-ctx.Done()
-		log.Trace().Msg("Context done; closing pool")
-		pool.Close()
-	}()
-
-	s := &Service{
-		pool: pool,
+	if parameters.maxConnectionLifetime != 0 {
+		config.MaxConnLifetime = parameters.maxConnectionLifetime
+	}
+	if parameters.maxConnectionIdleTime != 0 {
+		config.MaxConnIdleTime = parameters.maxConnectionIdleTime
+	}
+	if parameters.statementTimeout != 0 {
+		config.ConnConfig.RuntimeParams["statement_timeout"] = fmt.Sprintf("%d", parameters.statementTimeout.Milliseconds())
+	}
+	if parameters.applicationName != "" {
+		config.ConnConfig.RuntimeParams["application_name"] = parameters.applicationName
 	}
 
-	return s, nil
+	return config, nil
+}
+
+// dsnValue quotes a value for use in a DSN.
+func dsnValue(value string) string {
+	return fmt.Sprintf("'%s'", strings.NewReplacer(`\`, `\\`, `'`, `\'`).Replace(value))
 }
@@ -0,0 +1,138 @@
+// Copyright © 2023 Weald Technology Trading.
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package postgresql
+
+import (
+	"crypto/ecdsa"
+	"crypto/elliptic"
+	"crypto/rand"
+	"crypto/x509"
+	"crypto/x509/pkix"
+	"encoding/pem"
+	"math/big"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/require"
+)
+
+func TestPoolConfig(t *testing.T) {
+	base := []Parameter{
+		WithServer("server.wealdtech.com"),
+		WithUser("probed"),
+		WithPassword("pass word's"),
+		WithPort(5432),
+	}
+
+	parameters, err := parseAndCheckParameters(base...)
+	require.NoError(t, err)
+	config, err := poolConfig(parameters, parameters.server, parameters.port)
+	require.NoError(t, err)
+	require.Equal(t, "server.wealdtech.com", config.ConnConfig.Host)
+	require.Equal(t, "probed", config.ConnConfig.User)
+	require.Equal(t, "pass word's", config.ConnConfig.Password)
+	require.Equal(t, "probed", config.ConnConfig.RuntimeParams["application_name"])
+	require.NotContains(t, config.ConnConfig.RuntimeParams, "statement_timeout")
+
+	parameters, err = parseAndCheckParameters(append(base,
+		WithDatabase("probes"),
+		WithSSLMode("disable"),
+		WithMaxConnections(20),
+		WithMinConnections(2),
+		WithMaxConnectionLifetime(10*time.Minute),
+		WithMaxConnectionIdleTime(time.Minute),
+		WithStatementTimeout(30*time.Second),
+		WithApplicationName("probed-test"),
+	)...)
+	require.NoError(t, err)
+	config, err = poolConfig(parameters, parameters.server, parameters.port)
+	require.NoError(t, err)
+	require.Equal(t, "probes", config.ConnConfig.Database)
+	require.Nil(t, config.ConnConfig.TLSConfig)
+	require.Empty(t, config.ConnConfig.Fallbacks)
+	require.Equal(t, int32(20), config.MaxConns)
+	require.Equal(t, int32(2), config.MinConns)
+	require.Equal(t, 10*time.Minute, config.MaxConnLifetime)
+	require.Equal(t, time.Minute, config.MaxConnIdleTime)
+	require.Equal(t, "30000", config.ConnConfig.RuntimeParams["statement_timeout"])
+	require.Equal(t, "probed-test", config.ConnConfig.RuntimeParams["application_name"])
+}
+
+func TestPoolConfigTLS(t *testing.T) {
+	cert, key := generateCert(t)
+	base := []Parameter{
+		WithServer("server.wealdtech.com"),
+		WithUser("probed"),
+		WithPort(5432),
+		WithCACert(cert),
+		WithClientCert(cert),
+		WithClientKey(key),
+	}
+
+	// Certificates default to full verification.
+	parameters, err := parseAndCheckParameters(base...)
+	require.NoError(t, err)
+	config, err := poolConfig(parameters, parameters.server, parameters.port)
+	require.NoError(t, err)
+	require.NotNil(t, config.ConnConfig.TLSConfig)
+	require.Equal(t, "server.wealdtech.com", config.ConnConfig.TLSConfig.ServerName)
+	require.False(t, config.ConnConfig.TLSConfig.InsecureSkipVerify)
+	require.NotNil(t, config.ConnConfig.TLSConfig.RootCAs)
+	require.Len(t, config.ConnConfig.TLSConfig.Certificates, 1)
+	require.Empty(t, config.ConnConfig.Fallbacks)
+
+	// Certificates are also used by fallback connections.
+	parameters, err = parseAndCheckParameters(append(base, WithSSLMode("allow"))...)
+	require.NoError(t, err)
+	config, err = poolConfig(parameters, parameters.server, parameters.port)
+	require.NoError(t, err)
+	require.Nil(t, config.ConnConfig.TLSConfig)
+	require.Len(t, config.ConnConfig.Fallbacks, 1)
+	require.NotNil(t, config.ConnConfig.Fallbacks[0].TLSConfig)
+	require.Len(t, config.ConnConfig.Fallbacks[0].TLSConfig.Certificates, 1)
+
+	// Verification of the CA only.
+	parameters, err = parseAndCheckParameters(append(base, WithSSLMode("verify-ca"))...)
+	require.NoError(t, err)
+	config, err = poolConfig(parameters, parameters.server, parameters.port)
+	require.NoError(t, err)
+	require.True(t, config.ConnConfig.TLSConfig.InsecureSkipVerify)
+	require.NotNil(t, config.ConnConfig.TLSConfig.VerifyPeerCertificate)
+	require.NotNil(t, config.ConnConfig.TLSConfig.RootCAs)
+}
+
+// generateCert generates a self-signed PEM-encoded certificate and key.
+func generateCert(t *testing.T) ([]byte, []byte) {
+	t.Helper()
+
+	key, err := ecdsa.GenerateKey(elliptic.P256(), rand.Reader)
+	require.NoError(t, err)
+	template := &x509.Certificate{
+		SerialNumber:          big.NewInt(1),
+		Subject:               pkix.Name{CommonName: "server.wealdtech.com"},
+		DNSNames:              []string{"server.wealdtech.com"},
+		NotBefore:             time.Now().Add(-time.Hour),
+		NotAfter:              time.Now().Add(time.Hour),
+		KeyUsage:              x509.KeyUsageDigitalSignature | x509.KeyUsageCertSign,
+		BasicConstraintsValid: true,
+		IsCA:                  true,
+	}
+	der, err := x509.CreateCertificate(rand.Reader, template, template, &key.PublicKey, key)
+	require.NoError(t, err)
+	keyDER, err := x509.MarshalECPrivateKey(key)
+	require.NoError(t, err)
+
+	return pem.EncodeToMemory(&pem.Block{Type: "CERTIFICATE", Bytes: der}),
+		pem.EncodeToMemory(&pem.Block{Type: "EC PRIVATE KEY", Bytes: keyDER})
+}
@@ -34,6 +34,8 @@ func atoi(input string) int32 {
 }
 
 func TestService(t *testing.T) {
+	requireDatabase(t)
+
 	tests := []struct {
 		name     string
 		server   string
@@ -91,6 +93,8 @@ func TestService(t *testing.T) {
 }
 
 func TestInterfaces(t *testing.T) {
+	requireDatabase(t)
+
 	ctx := context.Background()
 
 	s, err := postgresql.New(ctx,
@@ -104,3 +108,34 @@ func TestInterfaces(t *testing.T) {
 	require.Implements(t, (*probedb.Service)(nil), s)
 	require.Implements(t, (*probedb.BlockDelaysSetter)(nil), s)
 }
+
+func TestReplica(t *testing.T) {
+	requireDatabase(t)
+
+	ctx, cancel := context.WithCancel(context.Background())
+	defer cancel()
+
+	// Use the primary as its own replica.
+	s, err := postgresql.New(ctx,
+		postgresql.WithServer(os.Getenv("PROBEDB_SERVER")),
+		postgresql.WithPort(atoi(os.Getenv("PROBEDB_PORT"))),
+		postgresql.WithUser(os.Getenv("PROBEDB_USER")),
+		postgresql.WithPassword(os.Getenv("PROBEDB_PASSWORD")),
+		postgresql.WithReplicaServer(os.Getenv("PROBEDB_SERVER")),
+	)
+	require.NoError(t, err)
+	require.NoError(t, s.Upgrade(ctx))
+
+	// Providers read from the replica.
+	_, err = s.BlockDelays(ctx, &probedb.DelayFilter{Limit: 1})
+	require.NoError(t, err)
+	_, err = s.AggregateAttestations(ctx, &probedb.AggregateAttestationFilter{Limit: 1})
+	require.NoError(t, err)
+
+	// Providers use the transaction in the context, if present.
+	ctx, txCancel, err := s.BeginTx(ctx)
+	require.NoError(t, err)
+	defer txCancel()
+	_, err = s.BlockDelays(ctx, &probedb.DelayFilter{Limit: 1})
+	require.NoError(t, err)
+}
@@ -15,19 +15,23 @@ package postgresql
 
 import (
 	"context"
+	"net"
 
+	"github.com/jackc/pgx/v4"
+	"github.com/pkg/errors"
 	"github.com/wealdtech/probed/services/probedb"
 )
 
 // SetAttestationSummary sets an attestation summary.
-func (s *Service) SetAttestationSummary(ctx context.Context, summary *probedb.AttestationSummary) error {
+// If the attestation summary already exists then the attestation summary conflict policy is applied.
+func (s *Service) SetAttestationSummary(ctx context.Context, summary *probedb.AttestationSummary) (probedb.Action, error) {
 	localTx := false
 	tx := s.tx(ctx)
 	if tx == nil {
 		var err error
 		tx, err = s.pool.Begin(ctx)
 		if err != nil {
-			return err
+			return probedb.ActionCreated, err
 		}
 		localTx = true
 	}
@@ -38,7 +42,7 @@ func (s *Service) SetAttestationSummary(ctx context.Context, summary *probedb.At
 		ip = summary.IPAddr
 	}
 
-	_, err := tx.Exec(ctx, `
+	tag, err := tx.Exec(ctx, `
 INSERT INTO t_attestation_summaries(f_ip_addr
                                    ,f_source
                                    ,f_method
@@ -48,12 +52,10 @@ INSERT INTO t_attestation_summaries(f_ip_addr
                                    ,f_source_root
                                    ,f_target_root
                                    ,f_attester_buckets
+                                   ,f_prober
                                    )
-VALUES($1,$2,$3,$4,$5,$6,$7,$8,$9)
-ON CONFLICT (f_ip_addr, f_source, f_method, f_slot, f_committee_index, f_beacon_block_root, f_source_root, f_target_root) DO
-NOTHING
--- UPDATE
--- SET f_attester_buckets = excluded.f_attester_buckets
+VALUES($1,$2,$3,$4,$5,$6,$7,$8,$9,$10)
+ON CONFLICT (f_ip_addr, f_source, f_method, f_slot, f_committee_index, f_beacon_block_root, f_source_root, f_target_root) DO NOTHING
 `,
 		ip,
 		summary.Source,
@@ -64,8 +66,14 @@ NOTHING
 		summary.SourceRoot,
 		summary.TargetRoot,
 		summary.AttesterBuckets,
+		summary.Prober,
 	)
 
+	action := probedb.ActionCreated
+	if err == nil && tag.RowsAffected() == 0 {
+		action, err = s.resolveAttestationSummaryConflict(ctx, tx, ip, summary)
+	}
+
 	if localTx {
 		if err == nil {
 			if err := tx.Commit(ctx); err != nil {
@@ -78,5 +86,67 @@ NOTHING
 		}
 	}
 
-	return err
+	return action, err
+}
+
+// resolveAttestationSummaryConflict applies the conflict policy to an existing attestation summary.
+func (s *Service) resolveAttestationSummaryConflict(ctx context.Context,
+	tx pgx.Tx,
+	ip net.IP,
+	summary *probedb.AttestationSummary,
+) (
+	probedb.Action,
+	error,
+) {
+	if s.conflictPolicies.AttestationSummaries != probedb.ConflictMerge {
+		return applyConflictPolicy(ctx, tx, "t_attestation_summaries", s.conflictPolicies.AttestationSummaries,
+			[]*column{
+				{name: "f_ip_addr", value: ip},
+				{name: "f_source", value: summary.Source},
+				{name: "f_method", value: summary.Method},
+				{name: "f_slot", value: summary.Slot},
+				{name: "f_committee_index", value: summary.CommitteeIndex},
+				{name: "f_beacon_block_root", value: summary.BeaconBlockRoot},
+				{name: "f_source_root", value: summary.SourceRoot},
+				{name: "f_target_root", value: summary.TargetRoot},
+			},
+			[]*column{
+				{name: "f_attester_buckets", value: summary.AttesterBuckets},
+				{name: "f_prober", value: summary.Prober},
+			},
+		)
+	}
+
+	// Merge the buckets in the database, so that concurrent merges cannot lose attesters.
+	tag, err := tx.Exec(ctx, `
+UPDATE t_attestation_summaries
+SET f_attester_buckets = merge_attester_buckets(f_attester_buckets, $9)
+WHERE f_ip_addr = $1
+  AND f_source = $2
+  AND f_method = $3
+  AND f_slot = $4
+  AND f_committee_index = $5
+  AND f_beacon_block_root = $6
+  AND f_source_root = $7
+  AND f_target_root = $8
+  AND merge_attester_buckets(f_attester_buckets, $9) IS DISTINCT FROM f_attester_buckets
+`,
+		ip,
+		summary.Source,
+		summary.Method,
+		summary.Slot,
+		summary.CommitteeIndex,
+		summary.BeaconBlockRoot,
+		summary.SourceRoot,
+		summary.TargetRoot,
+		summary.AttesterBuckets,
+	)
+	if err != nil {
+		return probedb.ActionIgnored, errors.Wrap(err, "failed to merge attester buckets")
+	}
+	if tag.RowsAffected() == 0 {
+		return probedb.ActionIgnored, nil
+	}
+
+	return probedb.ActionUpdated, nil
 }
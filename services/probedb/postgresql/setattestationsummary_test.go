@@ -26,6 +26,8 @@ import (
 )
 
 func TestSetAttestationSummary(t *testing.T) {
+	requireDatabase(t)
+
 	ctx := context.Background()
 	s, err := postgresql.New(ctx,
 		postgresql.WithLogLevel(zerolog.Disabled),
@@ -56,7 +58,9 @@ func TestSetAttestationSummary(t *testing.T) {
 	}
 
 	// Set the attestation summary.
-	require.NoError(t, s.SetAttestationSummary(ctx, summary))
+	action, err := s.SetAttestationSummary(ctx, summary)
+	require.NoError(t, err)
+	require.Equal(t, probedb.ActionCreated, action)
 
 	// Attempt to overwrite; should be ignored but no error.
 	summary.AttesterBuckets = [][]byte{
@@ -64,5 +68,7 @@ func TestSetAttestationSummary(t *testing.T) {
 			0x00,
 		},
 	}
-	require.NoError(t, s.SetAttestationSummary(ctx, summary))
+	action, err = s.SetAttestationSummary(ctx, summary)
+	require.NoError(t, err)
+	require.Equal(t, probedb.ActionIgnored, action)
 }
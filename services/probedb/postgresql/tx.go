@@ -17,6 +17,7 @@ import (
 	"context"
 
 	"github.com/jackc/pgx/v4"
+	"github.com/jackc/pgx/v4/pgxpool"
 	"github.com/pkg/errors"
 )
 
@@ -32,15 +33,32 @@ type Tx struct{}
 // BeginTx begins a transaction on the database.
 // The transaction can be rolled back by invoking the cancel function.
 func (s *Service) BeginTx(ctx context.Context) (context.Context, context.CancelFunc, error) {
+	return s.beginTx(ctx, s.pool, pgx.TxOptions{})
+}
+
+// beginReadTx begins a read-only transaction on the replica database if
+// there is one, otherwise on the primary database.
+// The transaction can be rolled back by invoking the cancel function.
+func (s *Service) beginReadTx(ctx context.Context) (context.Context, context.CancelFunc, error) {
+	if s.replicaPool == nil {
+		return s.BeginTx(ctx)
+	}
+
+	return s.beginTx(ctx, s.replicaPool, pgx.TxOptions{AccessMode: pgx.ReadOnly})
+}
+
+// beginTx begins a transaction on the given pool.
+func (s *Service) beginTx(ctx context.Context, pool *pgxpool.Pool, txOptions pgx.TxOptions) (context.Context, context.CancelFunc, error) {
 	ctx, cancel := context.WithCancel(ctx)
-	tx, err := s.pool.Begin(ctx)
+	tx, err := pool.BeginTx(ctx, txOptions)
 	if err != nil {
 		cancel()
 		return nil, nil, errors.Wrap(err, "failed to begin transaction")
 	}
 	ctx = context.WithValue(ctx, &Tx{}, tx)
 	return ctx, func() {
-		if err := tx.Rollback(ctx); err != nil {
+		// The transaction may already have been committed, in which case there is nothing to roll back.
+		if err := tx.Rollback(ctx); err != nil && !errors.Is(err, pgx.ErrTxClosed) {
 			log.Warn().Err(err).Msg("Failed to rollback transaction")
 		}
 		cancel()
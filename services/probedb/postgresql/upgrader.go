@@ -25,82 +25,48 @@ type schemaMetadata struct {
 	Version uint64 `json:"version"`
 }
 
-var schemaVersion = uint64(2)
+var schemaVersion = uint64(6)
+
+// ErrNewerSchema is returned when the database schema is newer than that known to this release.
+var ErrNewerSchema = errors.New("database schema is newer than supported by this release")
 
 type upgradeFunc func(context.Context, *Service) error
 
-var upgrades = map[uint64][]upgradeFunc{
+// upgrade is a change to the schema, along with the change that reverses it.
+type upgrade struct {
+	up   upgradeFunc
+	down upgradeFunc
+}
+
+// upgrades are the changes to upgrade the schema to each version.
+// Changes are reversed in the opposite order to that in which they are applied.
+var upgrades = map[uint64][]*upgrade{
 	2: {
-		createAggregateAttestations,
-		createAttestationSummaries,
+		{up: createAggregateAttestations, down: dropAggregateAttestations},
+		{up: createAttestationSummaries, down: dropAttestationSummaries},
+	},
+	3: {
+		{up: addProber, down: dropProber},
+	},
+	4: {
+		{up: addSlotIndices, down: dropSlotIndices},
+	},
+	5: {
+		{up: partitionTables, down: unpartitionTables},
+	},
+	6: {
+		{up: createBucketFunctions, down: dropBucketFunctions},
 	},
 }
 
 // Upgrade upgrades the database.
+// Concurrent upgrades, from this or other instances, are serialised by an advisory lock.
+// If the database schema is newer than that known to this release then ErrNewerSchema
+// is returned, unless the service was created to allow newer schemas.
 func (s *Service) Upgrade(ctx context.Context) error {
-	// See if we have anything at all.
-	tableExists, err := s.tableExists(ctx, "t_metadata")
-	if err != nil {
-		return errors.Wrap(err, "failed to check presence of tables")
-	}
-	if !tableExists {
-		return s.Init(ctx)
-	}
-
-	columnExists, err := s.columnExists(ctx, "t_metadata", "f_key")
-	if err != nil {
-		return errors.Wrap(err, "failed to check presence of metadata key")
-	}
-	if !columnExists {
-		return errors.New("database in inconsistent state, cannot continue")
-	}
-
-	version, err := s.version(ctx)
-	if err != nil {
-		return errors.Wrap(err, "failed to obtain version")
-	}
-
-	if version == schemaVersion {
-		log.Trace().Msg("No database upgrade is required")
-		return nil
-	}
-	if version > schemaVersion {
-		log.Warn().Uint64("version", version).Uint64("expected_version", schemaVersion).Msg("Database schema outdated; please recompile")
-		return nil
-	}
-	log.Trace().Uint64("version", version).Uint64("expected_version", schemaVersion).Msg("Database upgrade required")
-
-	ctx, cancel, err := s.BeginTx(ctx)
-	if err != nil {
-		return errors.Wrap(err, "failed to begin upgrade transaction")
-	}
-
-	for i := version + 1; i <= schemaVersion; i++ {
-		log.Info().Uint64("target_version", i).Msg("Upgrading database")
-		if upgrade, exists := upgrades[i]; exists {
-			for i, upgradeFunc := range upgrade {
-				log.Info().Int("current", i+1).Int("total", len(upgrade)).Msg("Running upgrade function")
-				if err := upgradeFunc(ctx, s); err != nil {
-					cancel()
-					return errors.Wrap(err, "failed to upgrade")
-				}
-			}
-		}
-	}
-
-	if err := s.setVersion(ctx, schemaVersion); err != nil {
-		cancel()
-		return errors.Wrap(err, "failed to set latest schema version")
-	}
+	_, err := s.Migrate(ctx, false)
 
-	if err := s.CommitTx(ctx); err != nil {
-		cancel()
-		return errors.Wrap(err, "failed to commit upgrade transaction")
-	}
-
-	log.Info().Msg("Upgrade complete")
-
-	return nil
+	return err
 }
 
 // columnExists returns true if the given column exists in the given table.
@@ -216,9 +182,34 @@ func (s *Service) Init(ctx context.Context) error {
 	if err != nil {
 		return errors.Wrap(err, "failed to begin initial tables transaction")
 	}
+
+	if err := s.lockSchema(ctx); err != nil {
+		cancel()
+		return err
+	}
+
+	if err := s.createTables(ctx); err != nil {
+		cancel()
+		return err
+	}
+
+	if err := s.addMigration(ctx, 0, schemaVersion); err != nil {
+		cancel()
+		return errors.Wrap(err, "failed to record migration")
+	}
+
+	if err := s.CommitTx(ctx); err != nil {
+		cancel()
+		return errors.Wrap(err, "failed to commit initial tables transaction")
+	}
+
+	return nil
+}
+
+// createTables creates the tables at the latest schema version.
+func (s *Service) createTables(ctx context.Context) error {
 	tx := s.tx(ctx)
 	if tx == nil {
-		cancel()
 		return ErrNoTransaction
 	}
 
@@ -229,7 +220,7 @@ CREATE TABLE t_metadata (
  ,f_value JSONB NOT NULL
 );
 CREATE UNIQUE INDEX i_metadata_1 ON t_metadata(f_key);
-INSERT INTO t_metadata VALUES('schema', '{"version": 2}');
+INSERT INTO t_metadata VALUES('schema', '{"version": 6}');
 
 -- t_block_delays contains block delay metrics.
 CREATE TABLE t_block_delays (
@@ -239,8 +230,13 @@ CREATE TABLE t_block_delays (
  ,f_slot    INTEGER NOT NULL
   -- f_delay is the recorded delay in milliseconds.
  ,f_delay   INTEGER NOT NULL
-);
+  -- f_prober is the authenticated identity of the prober, if any.
+ ,f_prober  TEXT NOT NULL DEFAULT ''
+) PARTITION BY RANGE (f_slot);
+CREATE TABLE t_block_delays_default PARTITION OF t_block_delays DEFAULT;
 CREATE UNIQUE INDEX i_block_delays_1 ON t_block_delays(f_ip_addr, f_source, f_method, f_slot);
+CREATE INDEX i_block_delays_2 ON t_block_delays(f_prober);
+CREATE INDEX i_block_delays_3 ON t_block_delays(f_slot);
 
 -- t_head_delays contains head delay metrics.
 CREATE TABLE t_head_delays (
@@ -250,8 +246,13 @@ CREATE TABLE t_head_delays (
  ,f_slot    INTEGER NOT NULL
   -- f_delay is the recorded delay in milliseconds.
  ,f_delay   INTEGER NOT NULL
-);
+  -- f_prober is the authenticated identity of the prober, if any.
+ ,f_prober  TEXT NOT NULL DEFAULT ''
+) PARTITION BY RANGE (f_slot);
+CREATE TABLE t_head_delays_default PARTITION OF t_head_delays DEFAULT;
 CREATE UNIQUE INDEX i_head_delays_1 ON t_head_delays(f_ip_addr, f_source, f_method, f_slot);
+CREATE INDEX i_head_delays_2 ON t_head_delays(f_prober);
+CREATE INDEX i_head_delays_3 ON t_head_delays(f_slot);
 
 -- t_aggregate_attestations contains aggregate attestations.
 CREATE TABLE t_aggregate_attestations (
@@ -266,8 +267,13 @@ CREATE TABLE t_aggregate_attestations (
  ,f_target_root       BYTEA NOT NULL
   -- f_delay is the recorded delay in milliseconds.
  ,f_delay             INTEGER NOT NULL
-);
+  -- f_prober is the authenticated identity of the prober, if any.
+ ,f_prober            TEXT NOT NULL DEFAULT ''
+) PARTITION BY RANGE (f_slot);
+CREATE TABLE t_aggregate_attestations_default PARTITION OF t_aggregate_attestations DEFAULT;
 CREATE UNIQUE INDEX i_aggregate_attestations_1 ON t_aggregate_attestations(f_ip_addr, f_source, f_method, f_slot, f_committee_index, f_aggregation_bits);
+CREATE INDEX i_aggregate_attestations_2 ON t_aggregate_attestations(f_prober);
+CREATE INDEX i_aggregate_attestations_3 ON t_aggregate_attestations(f_slot);
 
 -- t_attestation_summaries contains attestation summaries.
 CREATE TABLE t_attestation_summaries(
@@ -280,19 +286,18 @@ CREATE TABLE t_attestation_summaries(
  ,f_source_root       BYTEA NOT NULL
  ,f_target_root       BYTEA NOT NULL
  ,f_attester_buckets  BYTEA[] NOT NULL
-);
+  -- f_prober is the authenticated identity of the prober, if any.
+ ,f_prober            TEXT NOT NULL DEFAULT ''
+) PARTITION BY RANGE (f_slot);
+CREATE TABLE t_attestation_summaries_default PARTITION OF t_attestation_summaries DEFAULT;
 CREATE UNIQUE INDEX i_attestation_summaries_1 ON t_attestation_summaries(f_ip_addr, f_source, f_method, f_slot, f_committee_index, f_beacon_block_root, f_source_root, f_target_root);
+CREATE INDEX i_attestation_summaries_2 ON t_attestation_summaries(f_prober);
+CREATE INDEX i_attestation_summaries_3 ON t_attestation_summaries(f_slot);
 `); err != nil {
-		cancel()
 		return errors.Wrap(err, "failed to create initial tables")
 	}
 
-	if err := s.CommitTx(ctx); err != nil {
-		cancel()
-		return errors.Wrap(err, "failed to commit initial tables transaction")
-	}
-
-	return nil
+	return createBucketFunctions(ctx, s)
 }
 
 // createAggregateAttestations creates the t_aggregate_attestations table.
@@ -326,6 +331,20 @@ CREATE TABLE t_aggregate_attestations (
 	return nil
 }
 
+// dropAggregateAttestations drops the t_aggregate_attestations table.
+func dropAggregateAttestations(ctx context.Context, s *Service) error {
+	tx := s.tx(ctx)
+	if tx == nil {
+		return ErrNoTransaction
+	}
+
+	if _, err := tx.Exec(ctx, `DROP TABLE t_aggregate_attestations`); err != nil {
+		return errors.Wrap(err, "failed to drop t_aggregate_attestations")
+	}
+
+	return nil
+}
+
 // createAttestationSummaries creates the t_attestation_summaries table.
 func createAttestationSummaries(ctx context.Context, s *Service) error {
 	tx := s.tx(ctx)
@@ -354,3 +373,320 @@ CREATE TABLE t_attestation_summaries(
 
 	return nil
 }
+
+// dropAttestationSummaries drops the t_attestation_summaries table.
+func dropAttestationSummaries(ctx context.Context, s *Service) error {
+	tx := s.tx(ctx)
+	if tx == nil {
+		return ErrNoTransaction
+	}
+
+	if _, err := tx.Exec(ctx, `DROP TABLE t_attestation_summaries`); err != nil {
+		return errors.Wrap(err, "failed to drop t_attestation_summaries")
+	}
+
+	return nil
+}
+
+// addProber adds the prober identity to the data tables.
+func addProber(ctx context.Context, s *Service) error {
+	tx := s.tx(ctx)
+	if tx == nil {
+		return ErrNoTransaction
+	}
+
+	for _, table := range []string{"block_delays", "head_delays", "aggregate_attestations", "attestation_summaries"} {
+		if _, err := tx.Exec(ctx, fmt.Sprintf(`ALTER TABLE t_%s ADD COLUMN f_prober TEXT NOT NULL DEFAULT ''`, table)); err != nil {
+			return errors.Wrap(err, fmt.Sprintf("failed to add f_prober to t_%s", table))
+		}
+		if _, err := tx.Exec(ctx, fmt.Sprintf(`CREATE INDEX i_%s_2 ON t_%s(f_prober)`, table, table)); err != nil {
+			return errors.Wrap(err, fmt.Sprintf("failed to create i_%s_2", table))
+		}
+	}
+
+	return nil
+}
+
+// dropProber drops the prober identity from the data tables.
+func dropProber(ctx context.Context, s *Service) error {
+	tx := s.tx(ctx)
+	if tx == nil {
+		return ErrNoTransaction
+	}
+
+	for _, table := range []string{"block_delays", "head_delays", "aggregate_attestations", "attestation_summaries"} {
+		if _, err := tx.Exec(ctx, fmt.Sprintf(`DROP INDEX i_%s_2`, table)); err != nil {
+			return errors.Wrap(err, fmt.Sprintf("failed to drop i_%s_2", table))
+		}
+		if _, err := tx.Exec(ctx, fmt.Sprintf(`ALTER TABLE t_%s DROP COLUMN f_prober`, table)); err != nil {
+			return errors.Wrap(err, fmt.Sprintf("failed to drop f_prober from t_%s", table))
+		}
+	}
+
+	return nil
+}
+
+// addSlotIndices adds slot indices to the data tables.
+func addSlotIndices(ctx context.Context, s *Service) error {
+	tx := s.tx(ctx)
+	if tx == nil {
+		return ErrNoTransaction
+	}
+
+	for _, table := range []string{"block_delays", "head_delays", "aggregate_attestations", "attestation_summaries"} {
+		if _, err := tx.Exec(ctx, fmt.Sprintf(`CREATE INDEX i_%s_3 ON t_%s(f_slot)`, table, table)); err != nil {
+			return errors.Wrap(err, fmt.Sprintf("failed to create i_%s_3", table))
+		}
+	}
+
+	return nil
+}
+
+// dropSlotIndices drops the slot indices from the data tables.
+func dropSlotIndices(ctx context.Context, s *Service) error {
+	tx := s.tx(ctx)
+	if tx == nil {
+		return ErrNoTransaction
+	}
+
+	for _, table := range []string{"block_delays", "head_delays", "aggregate_attestations", "attestation_summaries"} {
+		if _, err := tx.Exec(ctx, fmt.Sprintf(`DROP INDEX i_%s_3`, table)); err != nil {
+			return errors.Wrap(err, fmt.Sprintf("failed to drop i_%s_3", table))
+		}
+	}
+
+	return nil
+}
+
+// uniqueColumns are the columns of the unique index of each probe table.
+var uniqueColumns = map[string]string{
+	"block_delays":           "f_ip_addr, f_source, f_method, f_slot",
+	"head_delays":            "f_ip_addr, f_source, f_method, f_slot",
+	"aggregate_attestations": "f_ip_addr, f_source, f_method, f_slot, f_committee_index, f_aggregation_bits",
+	"attestation_summaries":  "f_ip_addr, f_source, f_method, f_slot, f_committee_index, f_beacon_block_root, f_source_root, f_target_root",
+}
+
+// partitionTables converts the probe tables to tables partitioned by slot range.
+// The existing data becomes the first partition, covering all slots up to the
+// partition boundary above the highest slot present.
+func partitionTables(ctx context.Context, s *Service) error {
+	tx := s.tx(ctx)
+	if tx == nil {
+		return ErrNoTransaction
+	}
+
+	for _, table := range partitionedTables {
+		// A table created earlier in a dry run is not in the database, and has no rows.
+		maxSlot := int64(-1)
+		if !s.dryRunTx(ctx).planned(fmt.Sprintf("t_%s", table)) {
+			if err := tx.QueryRow(ctx, fmt.Sprintf(`SELECT COALESCE(MAX(f_slot), -1) FROM t_%s`, table)).Scan(&maxSlot); err != nil {
+				return errors.Wrap(err, fmt.Sprintf("failed to obtain highest slot of t_%s", table))
+			}
+		}
+		end := uint64(maxSlot+1) + uint64(s.partitionSize) - 1
+		end -= end % uint64(s.partitionSize)
+		legacy := partitionName(table, 0, end)
+
+		// Move the existing table and its indices out of the way.
+		if _, err := tx.Exec(ctx, fmt.Sprintf(`ALTER TABLE t_%s RENAME TO %s`, table, legacy)); err != nil {
+			return errors.Wrap(err, fmt.Sprintf("failed to rename t_%s", table))
+		}
+		for i := 1; i <= 3; i++ {
+			if _, err := tx.Exec(ctx, fmt.Sprintf(`ALTER INDEX i_%s_%d RENAME TO i_%s_0_%d_%d`, table, i, table, end, i)); err != nil {
+				return errors.Wrap(err, fmt.Sprintf("failed to rename i_%s_%d", table, i))
+			}
+		}
+
+		// Create the partitioned table.
+		if _, err := tx.Exec(ctx, fmt.Sprintf(`CREATE TABLE t_%s (LIKE %s INCLUDING DEFAULTS) PARTITION BY RANGE (f_slot)`, table, legacy)); err != nil {
+			return errors.Wrap(err, fmt.Sprintf("failed to create partitioned t_%s", table))
+		}
+		if _, err := tx.Exec(ctx, fmt.Sprintf(`CREATE UNIQUE INDEX i_%s_1 ON t_%s(%s)`, table, table, uniqueColumns[table])); err != nil {
+			return errors.Wrap(err, fmt.Sprintf("failed to create i_%s_1", table))
+		}
+		if _, err := tx.Exec(ctx, fmt.Sprintf(`CREATE INDEX i_%s_2 ON t_%s(f_prober)`, table, table)); err != nil {
+			return errors.Wrap(err, fmt.Sprintf("failed to create i_%s_2", table))
+		}
+		if _, err := tx.Exec(ctx, fmt.Sprintf(`CREATE INDEX i_%s_3 ON t_%s(f_slot)`, table, table)); err != nil {
+			return errors.Wrap(err, fmt.Sprintf("failed to create i_%s_3", table))
+		}
+
+		// Attach the existing data, if any, and the default partition.
+		if end > 0 {
+			if _, err := tx.Exec(ctx, fmt.Sprintf(`ALTER TABLE t_%s ATTACH PARTITION %s FOR VALUES FROM (0) TO (%d)`, table, legacy, end)); err != nil {
+				return errors.Wrap(err, fmt.Sprintf("failed to attach %s", legacy))
+			}
+		} else if _, err := tx.Exec(ctx, fmt.Sprintf(`DROP TABLE %s`, legacy)); err != nil {
+			return errors.Wrap(err, fmt.Sprintf("failed to drop %s", legacy))
+		}
+		if _, err := tx.Exec(ctx, fmt.Sprintf(`CREATE TABLE t_%s_default PARTITION OF t_%s DEFAULT`, table, table)); err != nil {
+			return errors.Wrap(err, fmt.Sprintf("failed to create t_%s_default", table))
+		}
+	}
+
+	return nil
+}
+
+// unpartitionTables converts the probe tables back to unpartitioned tables,
+// copying the data from all of their partitions.
+func unpartitionTables(ctx context.Context, s *Service) error {
+	tx := s.tx(ctx)
+	if tx == nil {
+		return ErrNoTransaction
+	}
+
+	for _, table := range partitionedTables {
+		if _, err := tx.Exec(ctx, fmt.Sprintf(`CREATE TABLE t_%s_unpartitioned (LIKE t_%s INCLUDING DEFAULTS)`, table, table)); err != nil {
+			return errors.Wrap(err, fmt.Sprintf("failed to create unpartitioned t_%s", table))
+		}
+		if _, err := tx.Exec(ctx, fmt.Sprintf(`INSERT INTO t_%s_unpartitioned SELECT * FROM t_%s`, table, table)); err != nil {
+			return errors.Wrap(err, fmt.Sprintf("failed to copy data from t_%s", table))
+		}
+
+		// Dropping the partitioned table also drops its partitions and indices.
+		if _, err := tx.Exec(ctx, fmt.Sprintf(`DROP TABLE t_%s`, table)); err != nil {
+			return errors.Wrap(err, fmt.Sprintf("failed to drop partitioned t_%s", table))
+		}
+		if _, err := tx.Exec(ctx, fmt.Sprintf(`ALTER TABLE t_%s_unpartitioned RENAME TO t_%s`, table, table)); err != nil {
+			return errors.Wrap(err, fmt.Sprintf("failed to rename unpartitioned t_%s", table))
+		}
+		if _, err := tx.Exec(ctx, fmt.Sprintf(`CREATE UNIQUE INDEX i_%s_1 ON t_%s(%s)`, table, table, uniqueColumns[table])); err != nil {
+			return errors.Wrap(err, fmt.Sprintf("failed to create i_%s_1", table))
+		}
+		if _, err := tx.Exec(ctx, fmt.Sprintf(`CREATE INDEX i_%s_2 ON t_%s(f_prober)`, table, table)); err != nil {
+			return errors.Wrap(err, fmt.Sprintf("failed to create i_%s_2", table))
+		}
+		if _, err := tx.Exec(ctx, fmt.Sprintf(`CREATE INDEX i_%s_3 ON t_%s(f_slot)`, table, table)); err != nil {
+			return errors.Wrap(err, fmt.Sprintf("failed to create i_%s_3", table))
+		}
+	}
+
+	return nil
+}
+
+// bucketFunctions are the functions used to merge attester buckets in the database.
+// merge_attester_buckets() has the same semantics as probedb.MergeAttesterBuckets().
+var bucketFunctions = `
+-- bitlist_length returns the length of a bitlist, or 0 if it is not a valid bitlist.
+CREATE FUNCTION bitlist_length(bitlist BYTEA) RETURNS INTEGER AS $$
+DECLARE
+  last INTEGER;
+  msb  INTEGER := 7;
+BEGIN
+  IF bitlist IS NULL OR length(bitlist) = 0 THEN
+    RETURN 0;
+  END IF;
+  last := get_byte(bitlist, length(bitlist) - 1);
+  IF last = 0 THEN
+    RETURN 0;
+  END IF;
+  WHILE last >> msb = 0 LOOP
+    msb := msb - 1;
+  END LOOP;
+  RETURN (length(bitlist) - 1) * 8 + msb;
+END
+$$ LANGUAGE plpgsql IMMUTABLE;
+
+-- bitlist_empty returns true if a bitlist has no bits set.
+CREATE FUNCTION bitlist_empty(bitlist BYTEA) RETURNS BOOLEAN AS $$
+DECLARE
+  bits INTEGER := bitlist_length(bitlist);
+BEGIN
+  IF bits = 0 THEN
+    RETURN TRUE;
+  END IF;
+  FOR i IN 0..length(bitlist) - 2 LOOP
+    IF get_byte(bitlist, i) <> 0 THEN
+      RETURN FALSE;
+    END IF;
+  END LOOP;
+  RETURN get_byte(bitlist, length(bitlist) - 1) = 1 << (bits % 8);
+END
+$$ LANGUAGE plpgsql IMMUTABLE;
+
+-- merge_attester_buckets merges new attester buckets in to existing attester buckets,
+-- keeping each attester only in the earliest bucket in which it was seen.
+CREATE FUNCTION merge_attester_buckets(existing BYTEA[], updates BYTEA[]) RETURNS BYTEA[] AS $$
+DECLARE
+  existing_buckets INTEGER := COALESCE(array_length(existing, 1), 0);
+  merged           BYTEA[] := '{}';
+  bucket           BYTEA;
+  seen             BYTEA;
+  bits             INTEGER;
+  length_bit       INTEGER;
+  b                INTEGER;
+  s                INTEGER;
+BEGIN
+  FOR i IN 1..GREATEST(existing_buckets, COALESCE(array_length(updates, 1), 0)) LOOP
+    bucket := existing[i];
+    bits := bitlist_length(bucket);
+    IF bits = 0 THEN
+      IF bitlist_length(updates[i]) > 0 THEN
+        bucket := updates[i];
+        bits := bitlist_length(bucket);
+      END IF;
+    ELSIF bitlist_length(updates[i]) = bits THEN
+      FOR j IN 0..length(bucket) - 1 LOOP
+        bucket := set_byte(bucket, j, get_byte(bucket, j) | get_byte(updates[i], j));
+      END LOOP;
+    END IF;
+
+    IF bits > 0 AND seen IS NULL THEN
+      length_bit := 1 << (bits % 8);
+      seen := set_byte(decode(repeat('00', length(bucket)), 'hex'), length(bucket) - 1, length_bit);
+    END IF;
+    IF bits > 0 AND bitlist_length(seen) = bits THEN
+      -- Clear attesters seen in earlier buckets.
+      FOR j IN 0..length(bucket) - 1 LOOP
+        b := get_byte(bucket, j);
+        s := get_byte(seen, j);
+        bucket := set_byte(bucket, j, b & ~s);
+        seen := set_byte(seen, j, b | s);
+      END LOOP;
+      bucket := set_byte(bucket, length(bucket) - 1, get_byte(bucket, length(bucket) - 1) | length_bit);
+    END IF;
+
+    merged := array_append(merged, bucket);
+  END LOOP;
+
+  -- Additional buckets are only kept if they contain attesters.
+  WHILE array_length(merged, 1) > existing_buckets AND bitlist_empty(merged[array_length(merged, 1)]) LOOP
+    merged := merged[1:array_length(merged, 1) - 1];
+  END LOOP;
+
+  RETURN merged;
+END
+$$ LANGUAGE plpgsql IMMUTABLE;
+`
+
+// createBucketFunctions creates the functions used to merge attester buckets.
+func createBucketFunctions(ctx context.Context, s *Service) error {
+	tx := s.tx(ctx)
+	if tx == nil {
+		return ErrNoTransaction
+	}
+
+	if _, err := tx.Exec(ctx, bucketFunctions); err != nil {
+		return errors.Wrap(err, "failed to create bucket functions")
+	}
+
+	return nil
+}
+
+// dropBucketFunctions drops the functions used to merge attester buckets.
+func dropBucketFunctions(ctx context.Context, s *Service) error {
+	tx := s.tx(ctx)
+	if tx == nil {
+		return ErrNoTransaction
+	}
+
+	if _, err := tx.Exec(ctx, `
+DROP FUNCTION merge_attester_buckets(BYTEA[], BYTEA[]);
+DROP FUNCTION bitlist_empty(BYTEA);
+DROP FUNCTION bitlist_length(BYTEA);
+`); err != nil {
+		return errors.Wrap(err, "failed to drop bucket functions")
+	}
+
+	return nil
+}
@@ -15,6 +15,7 @@ package postgresql_test
 
 import (
 	"context"
+	"fmt"
 	"os"
 	"testing"
 
@@ -23,6 +24,8 @@ import (
 )
 
 func TestUpgrader(t *testing.T) {
+	requireDatabase(t)
+
 	ctx := context.Background()
 
 	s, err := postgresql.New(ctx,
@@ -38,3 +41,84 @@ func TestUpgrader(t *testing.T) {
 	// Ensure repeat run does not error.
 	require.NoError(t, s.Upgrade(ctx))
 }
+
+func TestConcurrentUpgrades(t *testing.T) {
+	requireDatabase(t)
+
+	ctx := context.Background()
+
+	errs := make(chan error)
+	for i := 0; i < 4; i++ {
+		go func() {
+			s, err := postgresql.New(ctx,
+				postgresql.WithServer(os.Getenv("PROBEDB_SERVER")),
+				postgresql.WithPort(atoi(os.Getenv("PROBEDB_PORT"))),
+				postgresql.WithUser(os.Getenv("PROBEDB_USER")),
+				postgresql.WithPassword(os.Getenv("PROBEDB_PASSWORD")),
+			)
+			if err != nil {
+				errs <- err
+				return
+			}
+			errs <- s.Upgrade(ctx)
+		}()
+	}
+	for i := 0; i < 4; i++ {
+		require.NoError(t, <-errs)
+	}
+}
+
+func TestMigrations(t *testing.T) {
+	requireDatabase(t)
+
+	ctx := context.Background()
+
+	s, err := postgresql.New(ctx,
+		postgresql.WithServer(os.Getenv("PROBEDB_SERVER")),
+		postgresql.WithPort(atoi(os.Getenv("PROBEDB_PORT"))),
+		postgresql.WithUser(os.Getenv("PROBEDB_USER")),
+		postgresql.WithPassword(os.Getenv("PROBEDB_PASSWORD")),
+	)
+	require.NoError(t, err)
+	require.NoError(t, s.Upgrade(ctx))
+
+	status, err := s.MigrationStatus(ctx)
+	require.NoError(t, err)
+	require.Equal(t, status.LatestVersion, status.Version)
+	require.Empty(t, status.Pending)
+	require.NotEmpty(t, status.History)
+
+	// Nothing to migrate.
+	statements, err := s.Migrate(ctx, true)
+	require.NoError(t, err)
+	require.Empty(t, statements)
+
+	// Dry run of a rollback leaves the schema untouched.
+	statements, err = s.Rollback(ctx, 1, true)
+	require.NoError(t, err)
+	require.NotEmpty(t, statements)
+	dryRunStatus, err := s.MigrationStatus(ctx)
+	require.NoError(t, err)
+	require.Equal(t, status, dryRunStatus)
+
+	// Roll back and forward again.
+	_, err = s.Rollback(ctx, status.Version-1, false)
+	require.NoError(t, err)
+	rolledBackStatus, err := s.MigrationStatus(ctx)
+	require.NoError(t, err)
+	require.Equal(t, status.Version-1, rolledBackStatus.Version)
+	require.Equal(t, []uint64{status.Version}, rolledBackStatus.Pending)
+	require.Len(t, rolledBackStatus.History, len(status.History)+1)
+
+	statements, err = s.Migrate(ctx, false)
+	require.NoError(t, err)
+	require.NotEmpty(t, statements)
+	migratedStatus, err := s.MigrationStatus(ctx)
+	require.NoError(t, err)
+	require.Equal(t, status.Version, migratedStatus.Version)
+	require.Len(t, migratedStatus.History, len(status.History)+2)
+
+	// Cannot roll back to a later version.
+	_, err = s.Rollback(ctx, status.Version+1, false)
+	require.EqualError(t, err, fmt.Sprintf("cannot roll back schema version %d to later version %d", status.Version, status.Version+1))
+}
@@ -0,0 +1,226 @@
+// Copyright © 2023 Weald Technology Trading.
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package probedbtest
+
+import (
+	"context"
+	"net"
+	"testing"
+
+	"github.com/stretchr/testify/require"
+	"github.com/wealdtech/probed/services/probedb"
+)
+
+// aggregateAttestation creates an aggregate attestation with fixed roots.
+func aggregateAttestation(ipAddr net.IP, prober string, source string, method string, slot uint32, aggregationBits []byte, delayMS uint32) *probedb.AggregateAttestation {
+	return &probedb.AggregateAttestation{
+		IPAddr:          ipAddr,
+		Prober:          prober,
+		Source:          source,
+		Method:          method,
+		Slot:            slot,
+		CommitteeIndex:  1,
+		AggregationBits: aggregationBits,
+		BeaconBlockRoot: []byte{0x01, 0x02},
+		SourceRoot:      []byte{0x03, 0x04},
+		TargetRoot:      []byte{0x05, 0x06},
+		DelayMS:         delayMS,
+	}
+}
+
+func testSetAggregateAttestation(ctx context.Context, t *testing.T, s Service) {
+	first := aggregateAttestation(ip("1.2.3.4"), "prober1", "Source 1", "Method 1", 1, []byte{0x01, 0x10}, 100)
+	otherBits := aggregateAttestation(ip("1.2.3.4"), "prober1", "Source 1", "Method 1", 1, []byte{0x03, 0x10}, 200)
+	otherCommittee := aggregateAttestation(ip("1.2.3.4"), "prober1", "Source 1", "Method 1", 1, []byte{0x01, 0x10}, 300)
+	otherCommittee.CommitteeIndex = 2
+
+	tests := []struct {
+		name                 string
+		aggregateAttestation *probedb.AggregateAttestation
+		action               probedb.Action
+	}{
+		{
+			name:                 "New",
+			aggregateAttestation: first,
+			action:               probedb.ActionCreated,
+		},
+		{
+			name:                 "Duplicate",
+			aggregateAttestation: first,
+			action:               probedb.ActionIgnored,
+		},
+		{
+			name:                 "DelayDiffers",
+			aggregateAttestation: aggregateAttestation(ip("1.2.3.4"), "prober1", "Source 1", "Method 1", 1, []byte{0x01, 0x10}, 999),
+			action:               probedb.ActionIgnored,
+		},
+		{
+			name:                 "ProberDiffers",
+			aggregateAttestation: aggregateAttestation(ip("1.2.3.4"), "prober2", "Source 1", "Method 1", 1, []byte{0x01, 0x10}, 100),
+			action:               probedb.ActionIgnored,
+		},
+		{
+			name:                 "IPv4Mapped",
+			aggregateAttestation: aggregateAttestation(net.ParseIP("::ffff:1.2.3.4"), "prober1", "Source 1", "Method 1", 1, []byte{0x01, 0x10}, 100),
+			action:               probedb.ActionIgnored,
+		},
+		{
+			name:                 "AggregationBitsDiffer",
+			aggregateAttestation: otherBits,
+			action:               probedb.ActionCreated,
+		},
+		{
+			name:                 "CommitteeIndexDiffers",
+			aggregateAttestation: otherCommittee,
+			action:               probedb.ActionCreated,
+		},
+	}
+
+	for _, test := range tests {
+		t.Run(test.name, func(t *testing.T) {
+			action, err := s.SetAggregateAttestation(ctx, test.aggregateAttestation)
+			require.NoError(t, err)
+			require.Equal(t, test.action, action)
+		})
+	}
+
+	aggregateAttestations, err := s.AggregateAttestations(ctx, &probedb.AggregateAttestationFilter{})
+	require.NoError(t, err)
+	require.ElementsMatch(t, []*probedb.AggregateAttestation{first, otherBits, otherCommittee}, aggregateAttestations)
+}
+
+func testAggregateAttestations(ctx context.Context, t *testing.T, s Service) {
+	// Aggregate attestations are set out of order, to ensure that they are sorted on return.
+	aggregateAttestations := []*probedb.AggregateAttestation{
+		aggregateAttestation(ip("10.0.0.1"), "prober1", "Source 1", "Method 1", 3, []byte{0x01}, 100),
+		aggregateAttestation(ip("9.0.0.1"), "prober2", "Source 2", "Method 1", 1, []byte{0x02}, 200),
+		aggregateAttestation(ip("2001:db8::1"), "prober1", "Source 1", "Method 2", 4, []byte{0x03}, 300),
+		aggregateAttestation(ip("9.0.0.1"), "prober1", "Source 1", "Method 3", 2, []byte{0x04}, 400),
+		aggregateAttestation(ip("10.0.0.1"), "prober3", "Source 3", "Method 1", 5, []byte{0x05}, 500),
+	}
+	for _, aggregateAttestation := range aggregateAttestations {
+		action, err := s.SetAggregateAttestation(ctx, aggregateAttestation)
+		require.NoError(t, err)
+		require.Equal(t, probedb.ActionCreated, action)
+	}
+
+	// selected returns the aggregate attestations at the given indices.
+	selected := func(indices ...int) []*probedb.AggregateAttestation {
+		res := make([]*probedb.AggregateAttestation, 0, len(indices))
+		for _, index := range indices {
+			res = append(res, aggregateAttestations[index])
+		}
+		return res
+	}
+
+	tests := []struct {
+		name   string
+		filter *probedb.AggregateAttestationFilter
+		res    []*probedb.AggregateAttestation
+		err    string
+	}{
+		{
+			name:   "OrderInvalid",
+			filter: &probedb.AggregateAttestationFilter{Order: 99},
+			err:    "no order specified",
+		},
+		{
+			name:   "Earliest",
+			filter: &probedb.AggregateAttestationFilter{},
+			res:    selected(1, 3, 0, 2, 4),
+		},
+		{
+			name:   "Latest",
+			filter: &probedb.AggregateAttestationFilter{Order: probedb.OrderLatest},
+			res:    selected(4, 2, 0, 3, 1),
+		},
+		{
+			name:   "EarliestLimit",
+			filter: &probedb.AggregateAttestationFilter{Limit: 2},
+			res:    selected(1, 3),
+		},
+		{
+			name:   "LatestLimit",
+			filter: &probedb.AggregateAttestationFilter{Order: probedb.OrderLatest, Limit: 2},
+			res:    selected(4, 2),
+		},
+		{
+			name:   "LimitExceedsResults",
+			filter: &probedb.AggregateAttestationFilter{Limit: 10},
+			res:    selected(1, 3, 0, 2, 4),
+		},
+		{
+			name:   "IPAddr",
+			filter: &probedb.AggregateAttestationFilter{IPAddr: "9.0.0.1"},
+			res:    selected(1, 3),
+		},
+		{
+			name:   "IPAddrMapped",
+			filter: &probedb.AggregateAttestationFilter{IPAddr: "::ffff:9.0.0.1"},
+			res:    selected(1, 3),
+		},
+		{
+			name:   "IPAddrV6",
+			filter: &probedb.AggregateAttestationFilter{IPAddr: "2001:db8::1"},
+			res:    selected(2),
+		},
+		{
+			name:   "Prober",
+			filter: &probedb.AggregateAttestationFilter{Prober: "prober1"},
+			res:    selected(3, 0, 2),
+		},
+		{
+			name:   "Sources",
+			filter: &probedb.AggregateAttestationFilter{Sources: []string{"Source 2", "Source 3"}},
+			res:    selected(1, 4),
+		},
+		{
+			name:   "Methods",
+			filter: &probedb.AggregateAttestationFilter{Methods: []string{"Method 2", "Method 3"}},
+			res:    selected(3, 2),
+		},
+		{
+			name:   "From",
+			filter: &probedb.AggregateAttestationFilter{From: slotPtr(4)},
+			res:    selected(2, 4),
+		},
+		{
+			name:   "To",
+			filter: &probedb.AggregateAttestationFilter{To: slotPtr(2)},
+			res:    selected(1, 3),
+		},
+		{
+			name:   "FromToLatestLimit",
+			filter: &probedb.AggregateAttestationFilter{From: slotPtr(2), To: slotPtr(4), Order: probedb.OrderLatest, Limit: 2},
+			res:    selected(2, 0),
+		},
+		{
+			name:   "NoMatch",
+			filter: &probedb.AggregateAttestationFilter{From: slotPtr(6)},
+			res:    []*probedb.AggregateAttestation{},
+		},
+	}
+
+	for _, test := range tests {
+		t.Run(test.name, func(t *testing.T) {
+			res, err := s.AggregateAttestations(ctx, test.filter)
+			if test.err != "" {
+				require.EqualError(t, err, test.err)
+			} else {
+				require.NoError(t, err)
+				require.Equal(t, test.res, res)
+			}
+		})
+	}
+}
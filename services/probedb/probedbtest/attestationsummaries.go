@@ -0,0 +1,232 @@
+// Copyright © 2023 Weald Technology Trading.
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package probedbtest
+
+import (
+	"context"
+	"net"
+	"testing"
+
+	"github.com/stretchr/testify/require"
+	"github.com/wealdtech/probed/services/probedb"
+)
+
+// attestationSummary creates an attestation summary with fixed source and target roots.
+func attestationSummary(ipAddr net.IP, prober string, source string, method string, slot uint32, beaconBlockRoot []byte, attesterBuckets [][]byte) *probedb.AttestationSummary {
+	return &probedb.AttestationSummary{
+		IPAddr:          ipAddr,
+		Prober:          prober,
+		Source:          source,
+		Method:          method,
+		Slot:            slot,
+		CommitteeIndex:  1,
+		BeaconBlockRoot: beaconBlockRoot,
+		SourceRoot:      []byte{0x03, 0x04},
+		TargetRoot:      []byte{0x05, 0x06},
+		AttesterBuckets: attesterBuckets,
+	}
+}
+
+func testSetAttestationSummary(ctx context.Context, t *testing.T, s Service) {
+	first := attestationSummary(ip("1.2.3.4"), "prober1", "Source 1", "Method 1", 1, []byte{0x01, 0x02}, [][]byte{{0x01, 0x02}, {0x04}})
+	otherRoot := attestationSummary(ip("1.2.3.4"), "prober1", "Source 1", "Method 1", 1, []byte{0x0a, 0x0b}, [][]byte{{0x01}})
+	otherTarget := attestationSummary(ip("1.2.3.4"), "prober1", "Source 1", "Method 1", 1, []byte{0x01, 0x02}, [][]byte{{0x02}})
+	otherTarget.TargetRoot = []byte{0x0c, 0x0d}
+	otherCommittee := attestationSummary(ip("1.2.3.4"), "prober1", "Source 1", "Method 1", 1, []byte{0x01, 0x02}, [][]byte{{0x03}})
+	otherCommittee.CommitteeIndex = 2
+
+	tests := []struct {
+		name    string
+		summary *probedb.AttestationSummary
+		action  probedb.Action
+	}{
+		{
+			name:    "New",
+			summary: first,
+			action:  probedb.ActionCreated,
+		},
+		{
+			name:    "Duplicate",
+			summary: first,
+			action:  probedb.ActionIgnored,
+		},
+		{
+			name:    "AttesterBucketsDiffer",
+			summary: attestationSummary(ip("1.2.3.4"), "prober1", "Source 1", "Method 1", 1, []byte{0x01, 0x02}, [][]byte{{0xff}}),
+			action:  probedb.ActionIgnored,
+		},
+		{
+			name:    "ProberDiffers",
+			summary: attestationSummary(ip("1.2.3.4"), "prober2", "Source 1", "Method 1", 1, []byte{0x01, 0x02}, [][]byte{{0x01, 0x02}, {0x04}}),
+			action:  probedb.ActionIgnored,
+		},
+		{
+			name:    "IPv4Mapped",
+			summary: attestationSummary(net.ParseIP("::ffff:1.2.3.4"), "prober1", "Source 1", "Method 1", 1, []byte{0x01, 0x02}, [][]byte{{0x01, 0x02}, {0x04}}),
+			action:  probedb.ActionIgnored,
+		},
+		{
+			name:    "BeaconBlockRootDiffers",
+			summary: otherRoot,
+			action:  probedb.ActionCreated,
+		},
+		{
+			name:    "TargetRootDiffers",
+			summary: otherTarget,
+			action:  probedb.ActionCreated,
+		},
+		{
+			name:    "CommitteeIndexDiffers",
+			summary: otherCommittee,
+			action:  probedb.ActionCreated,
+		},
+	}
+
+	for _, test := range tests {
+		t.Run(test.name, func(t *testing.T) {
+			action, err := s.SetAttestationSummary(ctx, test.summary)
+			require.NoError(t, err)
+			require.Equal(t, test.action, action)
+		})
+	}
+
+	summaries, err := s.AttestationSummaries(ctx, &probedb.AttestationSummaryFilter{})
+	require.NoError(t, err)
+	require.ElementsMatch(t, []*probedb.AttestationSummary{first, otherRoot, otherTarget, otherCommittee}, summaries)
+}
+
+func testAttestationSummaries(ctx context.Context, t *testing.T, s Service) {
+	// Attestation summaries are set out of order, to ensure that they are sorted on return.
+	summaries := []*probedb.AttestationSummary{
+		attestationSummary(ip("10.0.0.1"), "prober1", "Source 1", "Method 1", 3, []byte{0x01}, [][]byte{{0x01}}),
+		attestationSummary(ip("9.0.0.1"), "prober2", "Source 2", "Method 1", 1, []byte{0x02}, [][]byte{{0x02}}),
+		attestationSummary(ip("2001:db8::1"), "prober1", "Source 1", "Method 2", 4, []byte{0x03}, [][]byte{{0x03}}),
+		attestationSummary(ip("9.0.0.1"), "prober1", "Source 1", "Method 3", 2, []byte{0x04}, [][]byte{{0x04}}),
+		attestationSummary(ip("10.0.0.1"), "prober3", "Source 3", "Method 1", 5, []byte{0x05}, [][]byte{{0x05}}),
+	}
+	for _, summary := range summaries {
+		action, err := s.SetAttestationSummary(ctx, summary)
+		require.NoError(t, err)
+		require.Equal(t, probedb.ActionCreated, action)
+	}
+
+	// selected returns the attestation summaries at the given indices.
+	selected := func(indices ...int) []*probedb.AttestationSummary {
+		res := make([]*probedb.AttestationSummary, 0, len(indices))
+		for _, index := range indices {
+			res = append(res, summaries[index])
+		}
+		return res
+	}
+
+	tests := []struct {
+		name   string
+		filter *probedb.AttestationSummaryFilter
+		res    []*probedb.AttestationSummary
+		err    string
+	}{
+		{
+			name:   "OrderInvalid",
+			filter: &probedb.AttestationSummaryFilter{Order: 99},
+			err:    "no order specified",
+		},
+		{
+			name:   "Earliest",
+			filter: &probedb.AttestationSummaryFilter{},
+			res:    selected(1, 3, 0, 2, 4),
+		},
+		{
+			name:   "Latest",
+			filter: &probedb.AttestationSummaryFilter{Order: probedb.OrderLatest},
+			res:    selected(4, 2, 0, 3, 1),
+		},
+		{
+			name:   "EarliestLimit",
+			filter: &probedb.AttestationSummaryFilter{Limit: 2},
+			res:    selected(1, 3),
+		},
+		{
+			name:   "LatestLimit",
+			filter: &probedb.AttestationSummaryFilter{Order: probedb.OrderLatest, Limit: 2},
+			res:    selected(4, 2),
+		},
+		{
+			name:   "LimitExceedsResults",
+			filter: &probedb.AttestationSummaryFilter{Limit: 10},
+			res:    selected(1, 3, 0, 2, 4),
+		},
+		{
+			name:   "IPAddr",
+			filter: &probedb.AttestationSummaryFilter{IPAddr: "9.0.0.1"},
+			res:    selected(1, 3),
+		},
+		{
+			name:   "IPAddrMapped",
+			filter: &probedb.AttestationSummaryFilter{IPAddr: "::ffff:9.0.0.1"},
+			res:    selected(1, 3),
+		},
+		{
+			name:   "IPAddrV6",
+			filter: &probedb.AttestationSummaryFilter{IPAddr: "2001:db8::1"},
+			res:    selected(2),
+		},
+		{
+			name:   "Prober",
+			filter: &probedb.AttestationSummaryFilter{Prober: "prober1"},
+			res:    selected(3, 0, 2),
+		},
+		{
+			name:   "Sources",
+			filter: &probedb.AttestationSummaryFilter{Sources: []string{"Source 2", "Source 3"}},
+			res:    selected(1, 4),
+		},
+		{
+			name:   "Methods",
+			filter: &probedb.AttestationSummaryFilter{Methods: []string{"Method 2", "Method 3"}},
+			res:    selected(3, 2),
+		},
+		{
+			name:   "From",
+			filter: &probedb.AttestationSummaryFilter{From: slotPtr(4)},
+			res:    selected(2, 4),
+		},
+		{
+			name:   "To",
+			filter: &probedb.AttestationSummaryFilter{To: slotPtr(2)},
+			res:    selected(1, 3),
+		},
+		{
+			name:   "FromToLatestLimit",
+			filter: &probedb.AttestationSummaryFilter{From: slotPtr(2), To: slotPtr(4), Order: probedb.OrderLatest, Limit: 2},
+			res:    selected(2, 0),
+		},
+		{
+			name:   "NoMatch",
+			filter: &probedb.AttestationSummaryFilter{From: slotPtr(6)},
+			res:    []*probedb.AttestationSummary{},
+		},
+	}
+
+	for _, test := range tests {
+		t.Run(test.name, func(t *testing.T) {
+			res, err := s.AttestationSummaries(ctx, test.filter)
+			if test.err != "" {
+				require.EqualError(t, err, test.err)
+			} else {
+				require.NoError(t, err)
+				require.Equal(t, test.res, res)
+			}
+		})
+	}
+}
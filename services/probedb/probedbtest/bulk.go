@@ -0,0 +1,108 @@
+// Copyright © 2023 Weald Technology Trading.
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package probedbtest
+
+import (
+	"context"
+	"testing"
+
+	"github.com/stretchr/testify/require"
+	"github.com/wealdtech/probed/services/probedb"
+)
+
+func testBulkSetters(ctx context.Context, t *testing.T, s Service) {
+	t.Run("BlockDelays", func(t *testing.T) {
+		bulkSetter, isBulkSetter := s.(probedb.BlockDelaysBulkSetter)
+		if !isBulkSetter {
+			t.Skip("bulk setter not implemented")
+		}
+		testSetDelays(ctx, t, s.SetBlockDelay, bulkSetter.SetBlockDelays, s.BlockDelays)
+	})
+
+	t.Run("HeadDelays", func(t *testing.T) {
+		bulkSetter, isBulkSetter := s.(probedb.HeadDelaysBulkSetter)
+		if !isBulkSetter {
+			t.Skip("bulk setter not implemented")
+		}
+		testSetDelays(ctx, t, s.SetHeadDelay, bulkSetter.SetHeadDelays, s.HeadDelays)
+	})
+
+	t.Run("AggregateAttestations", func(t *testing.T) {
+		bulkSetter, isBulkSetter := s.(probedb.AggregateAttestationsBulkSetter)
+		if !isBulkSetter {
+			t.Skip("bulk setter not implemented")
+		}
+
+		existing := aggregateAttestation(ip("1.2.3.4"), "prober1", "Source 1", "Method 1", 1, []byte{0x01}, 100)
+		_, err := s.SetAggregateAttestation(ctx, existing)
+		require.NoError(t, err)
+
+		added := aggregateAttestation(ip("2001:db8::1"), "prober1", "Source 1", "Method 1", 2, []byte{0x01}, 200)
+		require.NoError(t, bulkSetter.SetAggregateAttestations(ctx, []*probedb.AggregateAttestation{
+			aggregateAttestation(ip("1.2.3.4"), "prober2", "Source 1", "Method 1", 1, []byte{0x01}, 999),
+			added,
+			aggregateAttestation(ip("2001:db8::1"), "prober1", "Source 1", "Method 1", 2, []byte{0x01}, 999),
+		}))
+
+		res, err := s.AggregateAttestations(ctx, &probedb.AggregateAttestationFilter{})
+		require.NoError(t, err)
+		require.Equal(t, []*probedb.AggregateAttestation{existing, added}, res)
+	})
+
+	t.Run("AttestationSummaries", func(t *testing.T) {
+		bulkSetter, isBulkSetter := s.(probedb.AttestationSummariesBulkSetter)
+		if !isBulkSetter {
+			t.Skip("bulk setter not implemented")
+		}
+
+		existing := attestationSummary(ip("1.2.3.4"), "prober1", "Source 1", "Method 1", 1, []byte{0x01}, [][]byte{{0x01}})
+		_, err := s.SetAttestationSummary(ctx, existing)
+		require.NoError(t, err)
+
+		added := attestationSummary(ip("2001:db8::1"), "prober1", "Source 1", "Method 1", 2, []byte{0x01}, [][]byte{{0x02}})
+		require.NoError(t, bulkSetter.SetAttestationSummaries(ctx, []*probedb.AttestationSummary{
+			attestationSummary(ip("1.2.3.4"), "prober2", "Source 1", "Method 1", 1, []byte{0x01}, [][]byte{{0xff}}),
+			added,
+			attestationSummary(ip("2001:db8::1"), "prober1", "Source 1", "Method 1", 2, []byte{0x01}, [][]byte{{0xff}}),
+		}))
+
+		res, err := s.AttestationSummaries(ctx, &probedb.AttestationSummaryFilter{})
+		require.NoError(t, err)
+		require.Equal(t, []*probedb.AttestationSummary{existing, added}, res)
+	})
+}
+
+// testSetDelays tests a bulk delay setter, which should ignore delays that
+// duplicate either existing delays or earlier delays in the same call.
+func testSetDelays(ctx context.Context,
+	t *testing.T,
+	set delaySetter,
+	setBulk func(ctx context.Context, delays []*probedb.Delay) error,
+	provide delaysProvider,
+) {
+	existing := &probedb.Delay{IPAddr: ip("1.2.3.4"), Prober: "prober1", Source: "Source 1", Method: "Method 1", Slot: 1, DelayMS: 100}
+	_, err := set(ctx, existing)
+	require.NoError(t, err)
+
+	added := &probedb.Delay{IPAddr: ip("2001:db8::1"), Prober: "prober1", Source: "Source 1", Method: "Method 1", Slot: 2, DelayMS: 200}
+	require.NoError(t, setBulk(ctx, []*probedb.Delay{
+		{IPAddr: ip("1.2.3.4"), Prober: "prober2", Source: "Source 1", Method: "Method 1", Slot: 1, DelayMS: 999},
+		added,
+		{IPAddr: ip("2001:db8::1"), Prober: "prober1", Source: "Source 1", Method: "Method 1", Slot: 2, DelayMS: 999},
+	}))
+
+	res, err := provide(ctx, &probedb.DelayFilter{Selection: probedb.SelectionAll})
+	require.NoError(t, err)
+	require.Equal(t, []*probedb.Delay{existing, added}, res)
+}
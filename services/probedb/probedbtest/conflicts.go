@@ -0,0 +1,289 @@
+// Copyright © 2023 Weald Technology Trading.
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package probedbtest
+
+import (
+	"context"
+	"testing"
+
+	"github.com/stretchr/testify/require"
+	"github.com/wealdtech/probed/services/probedb"
+)
+
+// RunConflictPolicies runs the conflict policy conformance tests against services
+// created by newService with the given conflict policies.
+// Each test is run against a new service inside a transaction that is
+// cancelled when the test completes, so the service must start with no data
+// visible to the transaction.
+func RunConflictPolicies(t *testing.T, newService func(ctx context.Context, t *testing.T, policies probedb.ConflictPolicies) Service) {
+	t.Helper()
+
+	tests := []struct {
+		name     string
+		policies probedb.ConflictPolicies
+		test     func(ctx context.Context, t *testing.T, s Service, policy probedb.ConflictPolicy)
+	}{
+		{
+			name: "KeepFirst",
+			policies: probedb.ConflictPolicies{
+				BlockDelays:           probedb.ConflictKeepFirst,
+				HeadDelays:            probedb.ConflictKeepFirst,
+				AggregateAttestations: probedb.ConflictKeepFirst,
+				AttestationSummaries:  probedb.ConflictKeepFirst,
+			},
+		},
+		{
+			name: "KeepLatest",
+			policies: probedb.ConflictPolicies{
+				BlockDelays:           probedb.ConflictKeepLatest,
+				HeadDelays:            probedb.ConflictKeepLatest,
+				AggregateAttestations: probedb.ConflictKeepLatest,
+				AttestationSummaries:  probedb.ConflictKeepLatest,
+			},
+		},
+		{
+			name: "KeepMinimumDelay",
+			policies: probedb.ConflictPolicies{
+				BlockDelays:           probedb.ConflictKeepMinimumDelay,
+				HeadDelays:            probedb.ConflictKeepMinimumDelay,
+				AggregateAttestations: probedb.ConflictKeepMinimumDelay,
+				AttestationSummaries:  probedb.ConflictMerge,
+			},
+		},
+	}
+
+	for _, test := range tests {
+		policies := test.policies
+		subtests := []struct {
+			name string
+			test func(ctx context.Context, t *testing.T, s Service)
+		}{
+			{name: "BlockDelays", test: func(ctx context.Context, t *testing.T, s Service) {
+				testDelayConflicts(ctx, t, policies.BlockDelays, s.SetBlockDelay, s.BlockDelays)
+			}},
+			{name: "HeadDelays", test: func(ctx context.Context, t *testing.T, s Service) {
+				testDelayConflicts(ctx, t, policies.HeadDelays, s.SetHeadDelay, s.HeadDelays)
+			}},
+			{name: "AggregateAttestations", test: func(ctx context.Context, t *testing.T, s Service) {
+				testAggregateAttestationConflicts(ctx, t, policies.AggregateAttestations, s)
+			}},
+			{name: "AttestationSummaries", test: func(ctx context.Context, t *testing.T, s Service) {
+				testAttestationSummaryConflicts(ctx, t, policies.AttestationSummaries, s)
+			}},
+			{name: "BulkBlockDelays", test: func(ctx context.Context, t *testing.T, s Service) {
+				bulkSetter, isBulkSetter := s.(probedb.BlockDelaysBulkSetter)
+				if !isBulkSetter {
+					t.Skip("bulk setter not implemented")
+				}
+				testBulkDelayConflicts(ctx, t, policies.BlockDelays, s.SetBlockDelay, bulkSetter.SetBlockDelays, s.BlockDelays)
+			}},
+			{name: "BulkAttestationSummaries", test: func(ctx context.Context, t *testing.T, s Service) {
+				bulkSetter, isBulkSetter := s.(probedb.AttestationSummariesBulkSetter)
+				if !isBulkSetter {
+					t.Skip("bulk setter not implemented")
+				}
+				testBulkAttestationSummaryConflicts(ctx, t, policies.AttestationSummaries, s, bulkSetter)
+			}},
+		}
+
+		t.Run(test.name, func(t *testing.T) {
+			for _, subtest := range subtests {
+				t.Run(subtest.name, func(t *testing.T) {
+					ctx, cancel := context.WithCancel(context.Background())
+					defer cancel()
+					s := newService(ctx, t, policies)
+
+					ctx, txCancel, err := s.BeginTx(ctx)
+					require.NoError(t, err)
+					defer txCancel()
+
+					subtest.test(ctx, t, s)
+				})
+			}
+		})
+	}
+}
+
+func testDelayConflicts(ctx context.Context,
+	t *testing.T,
+	policy probedb.ConflictPolicy,
+	set delaySetter,
+	provide delaysProvider,
+) {
+	first := &probedb.Delay{IPAddr: ip("1.2.3.4"), Prober: "prober1", Source: "Source 1", Method: "Method 1", Slot: 1, DelayMS: 100}
+	lower := &probedb.Delay{IPAddr: ip("1.2.3.4"), Prober: "prober2", Source: "Source 1", Method: "Method 1", Slot: 1, DelayMS: 50}
+	higher := &probedb.Delay{IPAddr: ip("1.2.3.4"), Prober: "prober3", Source: "Source 1", Method: "Method 1", Slot: 1, DelayMS: 80}
+
+	action, err := set(ctx, first)
+	require.NoError(t, err)
+	require.Equal(t, probedb.ActionCreated, action)
+
+	lowerAction, err := set(ctx, lower)
+	require.NoError(t, err)
+	higherAction, err := set(ctx, higher)
+	require.NoError(t, err)
+
+	res, err := provide(ctx, &probedb.DelayFilter{Selection: probedb.SelectionAll})
+	require.NoError(t, err)
+
+	switch policy {
+	case probedb.ConflictKeepLatest:
+		require.Equal(t, probedb.ActionUpdated, lowerAction)
+		require.Equal(t, probedb.ActionUpdated, higherAction)
+		require.Equal(t, []*probedb.Delay{higher}, res)
+	case probedb.ConflictKeepMinimumDelay:
+		require.Equal(t, probedb.ActionUpdated, lowerAction)
+		require.Equal(t, probedb.ActionIgnored, higherAction)
+		require.Equal(t, []*probedb.Delay{lower}, res)
+	default:
+		require.Equal(t, probedb.ActionIgnored, lowerAction)
+		require.Equal(t, probedb.ActionIgnored, higherAction)
+		require.Equal(t, []*probedb.Delay{first}, res)
+	}
+}
+
+func testAggregateAttestationConflicts(ctx context.Context, t *testing.T, policy probedb.ConflictPolicy, s Service) {
+	first := aggregateAttestation(ip("1.2.3.4"), "prober1", "Source 1", "Method 1", 1, []byte{0x01, 0x10}, 100)
+	lower := aggregateAttestation(ip("1.2.3.4"), "prober2", "Source 1", "Method 1", 1, []byte{0x01, 0x10}, 50)
+	lower.BeaconBlockRoot = []byte{0x0a, 0x0b}
+	higher := aggregateAttestation(ip("1.2.3.4"), "prober3", "Source 1", "Method 1", 1, []byte{0x01, 0x10}, 80)
+
+	action, err := s.SetAggregateAttestation(ctx, first)
+	require.NoError(t, err)
+	require.Equal(t, probedb.ActionCreated, action)
+
+	lowerAction, err := s.SetAggregateAttestation(ctx, lower)
+	require.NoError(t, err)
+	higherAction, err := s.SetAggregateAttestation(ctx, higher)
+	require.NoError(t, err)
+
+	res, err := s.AggregateAttestations(ctx, &probedb.AggregateAttestationFilter{})
+	require.NoError(t, err)
+
+	switch policy {
+	case probedb.ConflictKeepLatest:
+		require.Equal(t, probedb.ActionUpdated, lowerAction)
+		require.Equal(t, probedb.ActionUpdated, higherAction)
+		require.Equal(t, []*probedb.AggregateAttestation{higher}, res)
+	case probedb.ConflictKeepMinimumDelay:
+		require.Equal(t, probedb.ActionUpdated, lowerAction)
+		require.Equal(t, probedb.ActionIgnored, higherAction)
+		require.Equal(t, []*probedb.AggregateAttestation{lower}, res)
+	default:
+		require.Equal(t, probedb.ActionIgnored, lowerAction)
+		require.Equal(t, probedb.ActionIgnored, higherAction)
+		require.Equal(t, []*probedb.AggregateAttestation{first}, res)
+	}
+}
+
+func testAttestationSummaryConflicts(ctx context.Context, t *testing.T, policy probedb.ConflictPolicy, s Service) {
+	// Buckets are bitlists of length 8.
+	// Attester 1 is in the second bucket of the first summary and the first bucket of the second summary.
+	first := attestationSummary(ip("1.2.3.4"), "prober1", "Source 1", "Method 1", 1, []byte{0x01, 0x02}, [][]byte{{0x01, 0x01}, {0x02, 0x01}})
+	second := attestationSummary(ip("1.2.3.4"), "prober2", "Source 1", "Method 1", 1, []byte{0x01, 0x02}, [][]byte{{0x02, 0x01}, {0x05, 0x01}})
+
+	action, err := s.SetAttestationSummary(ctx, first)
+	require.NoError(t, err)
+	require.Equal(t, probedb.ActionCreated, action)
+
+	secondAction, err := s.SetAttestationSummary(ctx, second)
+	require.NoError(t, err)
+	// Resubmitting the same summary changes nothing, other than for keep-latest.
+	repeatAction, err := s.SetAttestationSummary(ctx, second)
+	require.NoError(t, err)
+
+	res, err := s.AttestationSummaries(ctx, &probedb.AttestationSummaryFilter{})
+	require.NoError(t, err)
+	require.Len(t, res, 1)
+
+	switch policy {
+	case probedb.ConflictKeepLatest:
+		require.Equal(t, probedb.ActionUpdated, secondAction)
+		require.Equal(t, probedb.ActionUpdated, repeatAction)
+		require.Equal(t, second, res[0])
+	case probedb.ConflictMerge:
+		require.Equal(t, probedb.ActionUpdated, secondAction)
+		require.Equal(t, probedb.ActionIgnored, repeatAction)
+		require.Equal(t, "prober1", res[0].Prober)
+		// Each attester is kept in the earliest bucket in which it was seen.
+		require.Equal(t, [][]byte{{0x03, 0x01}, {0x04, 0x01}}, res[0].AttesterBuckets)
+	default:
+		require.Equal(t, probedb.ActionIgnored, secondAction)
+		require.Equal(t, probedb.ActionIgnored, repeatAction)
+		require.Equal(t, first.AttesterBuckets, res[0].AttesterBuckets)
+	}
+}
+
+func testBulkDelayConflicts(ctx context.Context,
+	t *testing.T,
+	policy probedb.ConflictPolicy,
+	set delaySetter,
+	setBulk func(ctx context.Context, delays []*probedb.Delay) error,
+	provide delaysProvider,
+) {
+	_, err := set(ctx, &probedb.Delay{IPAddr: ip("1.2.3.4"), Prober: "prober1", Source: "Source 1", Method: "Method 1", Slot: 1, DelayMS: 100})
+	require.NoError(t, err)
+
+	// The batch holds two delays with the same key as the existing delay, and two with the same key as each other.
+	require.NoError(t, setBulk(ctx, []*probedb.Delay{
+		{IPAddr: ip("1.2.3.4"), Prober: "prober2", Source: "Source 1", Method: "Method 1", Slot: 1, DelayMS: 50},
+		{IPAddr: ip("1.2.3.4"), Prober: "prober3", Source: "Source 1", Method: "Method 1", Slot: 1, DelayMS: 80},
+		{IPAddr: ip("2001:db8::1"), Prober: "prober1", Source: "Source 1", Method: "Method 1", Slot: 2, DelayMS: 300},
+		{IPAddr: ip("2001:db8::1"), Prober: "prober2", Source: "Source 1", Method: "Method 1", Slot: 2, DelayMS: 200},
+	}))
+
+	res, err := provide(ctx, &probedb.DelayFilter{Selection: probedb.SelectionAll})
+	require.NoError(t, err)
+	require.Len(t, res, 2)
+
+	switch policy {
+	case probedb.ConflictKeepLatest:
+		require.Equal(t, uint32(80), res[0].DelayMS)
+		require.Equal(t, uint32(200), res[1].DelayMS)
+	case probedb.ConflictKeepMinimumDelay:
+		require.Equal(t, uint32(50), res[0].DelayMS)
+		require.Equal(t, uint32(200), res[1].DelayMS)
+	default:
+		require.Equal(t, uint32(100), res[0].DelayMS)
+		require.Equal(t, uint32(300), res[1].DelayMS)
+	}
+}
+
+func testBulkAttestationSummaryConflicts(ctx context.Context,
+	t *testing.T,
+	policy probedb.ConflictPolicy,
+	s Service,
+	bulkSetter probedb.AttestationSummariesBulkSetter,
+) {
+	_, err := s.SetAttestationSummary(ctx, attestationSummary(ip("1.2.3.4"), "prober1", "Source 1", "Method 1", 1, []byte{0x01, 0x02}, [][]byte{{0x01, 0x01}}))
+	require.NoError(t, err)
+
+	require.NoError(t, bulkSetter.SetAttestationSummaries(ctx, []*probedb.AttestationSummary{
+		attestationSummary(ip("1.2.3.4"), "prober2", "Source 1", "Method 1", 1, []byte{0x01, 0x02}, [][]byte{{}, {0x03, 0x01}}),
+		attestationSummary(ip("1.2.3.4"), "prober3", "Source 1", "Method 1", 1, []byte{0x01, 0x02}, [][]byte{{0x04, 0x01}}),
+	}))
+
+	res, err := s.AttestationSummaries(ctx, &probedb.AttestationSummaryFilter{})
+	require.NoError(t, err)
+	require.Len(t, res, 1)
+
+	switch policy {
+	case probedb.ConflictKeepLatest:
+		require.Equal(t, [][]byte{{0x04, 0x01}}, res[0].AttesterBuckets)
+	case probedb.ConflictMerge:
+		require.Equal(t, [][]byte{{0x05, 0x01}, {0x02, 0x01}}, res[0].AttesterBuckets)
+	default:
+		require.Equal(t, [][]byte{{0x01, 0x01}}, res[0].AttesterBuckets)
+	}
+}
@@ -0,0 +1,120 @@
+// Copyright © 2023 Weald Technology Trading.
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+// Package probedbtest provides a conformance suite for probe database implementations.
+package probedbtest
+
+import (
+	"context"
+	"net"
+	"testing"
+
+	"github.com/attestantio/go-eth2-client/spec/phase0"
+	"github.com/stretchr/testify/require"
+	"github.com/wealdtech/probed/services/probedb"
+)
+
+// Service is the set of interfaces that a probe database must implement
+// to be validated by the conformance suite.
+type Service interface {
+	probedb.Service
+	probedb.BlockDelaysSetter
+	probedb.BlockDelaysProvider
+	probedb.HeadDelaysSetter
+	probedb.HeadDelaysProvider
+	probedb.AggregateAttestationsSetter
+	probedb.AggregateAttestationsProvider
+	probedb.AttestationSummariesSetter
+	probedb.AttestationSummariesProvider
+}
+
+// Run runs the conformance suite against services created by newService.
+// Each test is run against a new service inside a transaction that is
+// cancelled when the test completes, so the service must start with no data
+// visible to the transaction.
+// Bulk setters, pruners and streamers are tested if the service implements them.
+func Run(t *testing.T, newService func(ctx context.Context, t *testing.T) Service) {
+	t.Helper()
+
+	tests := []struct {
+		name string
+		test func(ctx context.Context, t *testing.T, s Service)
+	}{
+		{name: "Metadata", test: testMetadata},
+		{name: "SetBlockDelay", test: func(ctx context.Context, t *testing.T, s Service) {
+			testSetDelay(ctx, t, s.SetBlockDelay, s.BlockDelays)
+		}},
+		{name: "BlockDelays", test: func(ctx context.Context, t *testing.T, s Service) {
+			testDelays(ctx, t, s.SetBlockDelay, s.BlockDelays)
+		}},
+		{name: "SetHeadDelay", test: func(ctx context.Context, t *testing.T, s Service) {
+			testSetDelay(ctx, t, s.SetHeadDelay, s.HeadDelays)
+		}},
+		{name: "HeadDelays", test: func(ctx context.Context, t *testing.T, s Service) {
+			testDelays(ctx, t, s.SetHeadDelay, s.HeadDelays)
+		}},
+		{name: "DelayStatistics", test: testDelayStatisticsProviders},
+		{name: "SetAggregateAttestation", test: testSetAggregateAttestation},
+		{name: "AggregateAttestations", test: testAggregateAttestations},
+		{name: "SetAttestationSummary", test: testSetAttestationSummary},
+		{name: "AttestationSummaries", test: testAttestationSummaries},
+		{name: "Cursors", test: testCursors},
+		{name: "Streamers", test: testStreamers},
+		{name: "BulkSetters", test: testBulkSetters},
+		{name: "Pruners", test: testPruners},
+	}
+
+	for _, test := range tests {
+		t.Run(test.name, func(t *testing.T) {
+			ctx, cancel := context.WithCancel(context.Background())
+			defer cancel()
+			s := newService(ctx, t)
+
+			ctx, txCancel, err := s.BeginTx(ctx)
+			require.NoError(t, err)
+			defer txCancel()
+
+			test.test(ctx, t, s)
+		})
+	}
+}
+
+// ip parses an IP address, forcing it to be a V4 if possible.
+func ip(input string) net.IP {
+	ipAddr := net.ParseIP(input)
+	if ip := ipAddr.To4(); ip != nil {
+		return ip
+	}
+	return ipAddr
+}
+
+func slotPtr(in phase0.Slot) *phase0.Slot {
+	return &in
+}
+
+func testMetadata(ctx context.Context, t *testing.T, s Service) {
+	value, err := s.Metadata(ctx, "conformance")
+	require.NoError(t, err)
+	require.Nil(t, value)
+
+	require.NoError(t, s.SetMetadata(ctx, "conformance", []byte(`{"version":1}`)))
+	value, err = s.Metadata(ctx, "conformance")
+	require.NoError(t, err)
+	require.JSONEq(t, `{"version":1}`, string(value))
+
+	// Setting an existing key overwrites it.
+	require.NoError(t, s.SetMetadata(ctx, "conformance", []byte(`{"version":2}`)))
+	value, err = s.Metadata(ctx, "conformance")
+	require.NoError(t, err)
+	require.JSONEq(t, `{"version":2}`, string(value))
+}
@@ -0,0 +1,264 @@
+// Copyright © 2023 Weald Technology Trading.
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package probedbtest
+
+import (
+	"context"
+	"testing"
+
+	"github.com/stretchr/testify/require"
+	"github.com/wealdtech/probed/services/probedb"
+)
+
+func testCursors(ctx context.Context, t *testing.T, s Service) {
+	t.Run("Delays", func(t *testing.T) {
+		testDelayCursors(ctx, t, s)
+	})
+	t.Run("AggregateAttestations", func(t *testing.T) {
+		testAggregateAttestationCursors(ctx, t, s)
+	})
+	t.Run("AttestationSummaries", func(t *testing.T) {
+		testAttestationSummaryCursors(ctx, t, s)
+	})
+	t.Run("DelayStatistics", func(t *testing.T) {
+		provider, isProvider := s.(probedb.BlockDelayStatisticsProvider)
+		if !isProvider {
+			t.Skip("statistics provider not implemented")
+		}
+		testDelayStatisticsCursors(ctx, t, s.SetBlockDelay, provider.BlockDelayStatistics)
+	})
+}
+
+func testDelayCursors(ctx context.Context, t *testing.T, s Service) {
+	// Multiple delays share slots, so pages must break within slots.
+	for _, delay := range []*probedb.Delay{
+		{IPAddr: ip("10.0.0.1"), Prober: "prober1", Source: "Source 1", Method: "Method 1", Slot: 1, DelayMS: 100},
+		{IPAddr: ip("9.0.0.1"), Prober: "prober1", Source: "Source 2", Method: "Method 1", Slot: 1, DelayMS: 200},
+		{IPAddr: ip("2001:db8::1"), Prober: "prober2", Source: "Source 1", Method: "Method 1", Slot: 1, DelayMS: 400},
+		{IPAddr: ip("9.0.0.1"), Prober: "prober1", Source: "Source 1", Method: "Method 1", Slot: 1, DelayMS: 300},
+		{IPAddr: ip("9.0.0.1"), Prober: "prober2", Source: "Source 1", Method: "Method 2", Slot: 1, DelayMS: 50},
+		{IPAddr: ip("2001:db8::1"), Prober: "prober2", Source: "Source 1", Method: "Method 2", Slot: 2, DelayMS: 60},
+		{IPAddr: ip("10.0.0.1"), Prober: "prober3", Source: "Source 3", Method: "Method 3", Slot: 3, DelayMS: 75},
+		{IPAddr: ip("9.0.0.1"), Prober: "prober1", Source: "Source 2", Method: "Method 1", Slot: 4, DelayMS: 40},
+		{IPAddr: ip("10.0.0.1"), Prober: "prober1", Source: "Source 1", Method: "Method 1", Slot: 4, DelayMS: 10},
+	} {
+		_, err := s.SetBlockDelay(ctx, delay)
+		require.NoError(t, err)
+	}
+
+	for _, order := range []probedb.Order{probedb.OrderEarliest, probedb.OrderLatest} {
+		for _, selection := range []probedb.Selection{probedb.SelectionAll, probedb.SelectionMinimum, probedb.SelectionMedian} {
+			all, err := s.BlockDelays(ctx, &probedb.DelayFilter{Selection: selection, Order: order})
+			require.NoError(t, err)
+			require.NotEmpty(t, all)
+
+			for limit := uint32(1); limit <= uint32(len(all))+1; limit++ {
+				res := make([]*probedb.Delay, 0)
+				filter := &probedb.DelayFilter{Selection: selection, Order: order, Limit: limit}
+				for {
+					page, err := s.BlockDelays(ctx, filter)
+					require.NoError(t, err)
+					require.LessOrEqual(t, len(page), int(limit))
+					if len(page) == 0 {
+						break
+					}
+					res = append(res, page...)
+					filter.Cursor = probedb.DelayPosition(page[len(page)-1]).Cursor()
+				}
+				require.Equal(t, all, res, "order %d selection %d limit %d", order, selection, limit)
+			}
+		}
+	}
+
+	// A cursor continues from the given position even if it is not that of a result.
+	res, err := s.BlockDelays(ctx, &probedb.DelayFilter{
+		Selection: probedb.SelectionAll,
+		Limit:     2,
+		Cursor:    probedb.DelayPosition(&probedb.Delay{IPAddr: ip("9.0.0.1"), Source: "Source 1", Method: "Method 1", Slot: 1}).Cursor(),
+	})
+	require.NoError(t, err)
+	require.Len(t, res, 2)
+	require.Equal(t, ip("9.0.0.1"), res[0].IPAddr)
+	require.Equal(t, "Source 2", res[0].Source)
+	require.Equal(t, ip("10.0.0.1"), res[1].IPAddr)
+
+	_, err = s.BlockDelays(ctx, &probedb.DelayFilter{Selection: probedb.SelectionAll, Cursor: "invalid"})
+	require.EqualError(t, err, "invalid cursor")
+}
+
+func testAggregateAttestationCursors(ctx context.Context, t *testing.T, s Service) {
+	otherCommittee := aggregateAttestation(ip("9.0.0.1"), "prober1", "Source 1", "Method 1", 1, []byte{0x01}, 500)
+	otherCommittee.CommitteeIndex = 0
+	aggregateAttestations := []*probedb.AggregateAttestation{
+		aggregateAttestation(ip("9.0.0.1"), "prober1", "Source 1", "Method 1", 1, []byte{0x02}, 100),
+		aggregateAttestation(ip("2001:db8::1"), "prober1", "Source 1", "Method 1", 1, []byte{0x01}, 200),
+		aggregateAttestation(ip("9.0.0.1"), "prober1", "Source 1", "Method 1", 1, []byte{0x01}, 300),
+		aggregateAttestation(ip("9.0.0.1"), "prober2", "Source 2", "Method 1", 2, []byte{0x01}, 400),
+		otherCommittee,
+		aggregateAttestation(ip("10.0.0.1"), "prober1", "Source 1", "Method 0", 1, []byte{0x01}, 600),
+	}
+	for _, aggregateAttestation := range aggregateAttestations {
+		_, err := s.SetAggregateAttestation(ctx, aggregateAttestation)
+		require.NoError(t, err)
+	}
+
+	// selected returns the aggregate attestations at the given indices.
+	selected := func(indices ...int) []*probedb.AggregateAttestation {
+		res := make([]*probedb.AggregateAttestation, 0, len(indices))
+		for _, index := range indices {
+			res = append(res, aggregateAttestations[index])
+		}
+		return res
+	}
+
+	tests := []struct {
+		name  string
+		order probedb.Order
+		res   []*probedb.AggregateAttestation
+	}{
+		{
+			// Ordered by slot, method, IP address, source, committee index and aggregation bits.
+			name: "Earliest",
+			res:  selected(5, 4, 2, 0, 1, 3),
+		},
+		{
+			name:  "Latest",
+			order: probedb.OrderLatest,
+			res:   selected(3, 5, 4, 2, 0, 1),
+		},
+	}
+
+	for _, test := range tests {
+		t.Run(test.name, func(t *testing.T) {
+			all, err := s.AggregateAttestations(ctx, &probedb.AggregateAttestationFilter{Order: test.order})
+			require.NoError(t, err)
+			require.Equal(t, test.res, all)
+
+			for limit := uint32(1); limit <= uint32(len(all)); limit++ {
+				res := make([]*probedb.AggregateAttestation, 0)
+				filter := &probedb.AggregateAttestationFilter{Order: test.order, Limit: limit}
+				for {
+					page, err := s.AggregateAttestations(ctx, filter)
+					require.NoError(t, err)
+					require.LessOrEqual(t, len(page), int(limit))
+					if len(page) == 0 {
+						break
+					}
+					res = append(res, page...)
+					filter.Cursor = probedb.AggregateAttestationPosition(page[len(page)-1]).Cursor()
+				}
+				require.Equal(t, all, res, "limit %d", limit)
+			}
+		})
+	}
+
+	_, err := s.AggregateAttestations(ctx, &probedb.AggregateAttestationFilter{Cursor: "invalid"})
+	require.EqualError(t, err, "invalid cursor")
+}
+
+func testAttestationSummaryCursors(ctx context.Context, t *testing.T, s Service) {
+	otherTarget := attestationSummary(ip("9.0.0.1"), "prober1", "Source 1", "Method 1", 1, []byte{0x01}, [][]byte{{0x01}})
+	otherTarget.TargetRoot = []byte{0x01}
+	summaries := []*probedb.AttestationSummary{
+		attestationSummary(ip("9.0.0.1"), "prober1", "Source 1", "Method 1", 1, []byte{0x02}, [][]byte{{0x01}}),
+		attestationSummary(ip("9.0.0.1"), "prober1", "Source 2", "Method 1", 1, []byte{0x01}, [][]byte{{0x01}}),
+		attestationSummary(ip("9.0.0.1"), "prober1", "Source 1", "Method 1", 1, []byte{0x01}, [][]byte{{0x01}}),
+		attestationSummary(ip("9.0.0.1"), "prober2", "Source 1", "Method 1", 3, []byte{0x01}, [][]byte{{0x01}}),
+		otherTarget,
+	}
+	for _, summary := range summaries {
+		_, err := s.SetAttestationSummary(ctx, summary)
+		require.NoError(t, err)
+	}
+
+	// Ordered by slot, method, IP address, source, committee index and roots.
+	all, err := s.AttestationSummaries(ctx, &probedb.AttestationSummaryFilter{})
+	require.NoError(t, err)
+	require.Equal(t, []*probedb.AttestationSummary{summaries[4], summaries[2], summaries[0], summaries[1], summaries[3]}, all)
+
+	for limit := uint32(1); limit <= uint32(len(all)); limit++ {
+		res := make([]*probedb.AttestationSummary, 0)
+		filter := &probedb.AttestationSummaryFilter{Limit: limit}
+		for {
+			page, err := s.AttestationSummaries(ctx, filter)
+			require.NoError(t, err)
+			require.LessOrEqual(t, len(page), int(limit))
+			if len(page) == 0 {
+				break
+			}
+			res = append(res, page...)
+			filter.Cursor = probedb.AttestationSummaryPosition(page[len(page)-1]).Cursor()
+		}
+		require.Equal(t, all, res, "limit %d", limit)
+	}
+
+	// A cursor for a different type of result is rejected.
+	_, err = s.AttestationSummaries(ctx, &probedb.AttestationSummaryFilter{
+		Cursor: probedb.DelayPosition(&probedb.Delay{Slot: 1}).Cursor(),
+	})
+	require.EqualError(t, err, "invalid cursor")
+}
+
+func testDelayStatisticsCursors(ctx context.Context, t *testing.T, set delaySetter, provide delayStatisticsProvider) {
+	for _, delay := range []*probedb.Delay{
+		{IPAddr: ip("10.0.0.1"), Prober: "prober1", Source: "Source 1", Method: "Method 1", Slot: 1, DelayMS: 300},
+		{IPAddr: ip("9.0.0.1"), Prober: "prober1", Source: "Source 2", Method: "Method 1", Slot: 1, DelayMS: 100},
+		{IPAddr: ip("2001:db8::1"), Prober: "prober2", Source: "Source 1", Method: "Method 1", Slot: 9, DelayMS: 400},
+		{IPAddr: ip("9.0.0.1"), Prober: "prober1", Source: "Source 1", Method: "Method 2", Slot: 17, DelayMS: 200},
+		{IPAddr: ip("9.0.0.1"), Prober: "prober1", Source: "Source 3", Method: "Method 2", Slot: 18, DelayMS: 200},
+	} {
+		_, err := set(ctx, delay)
+		require.NoError(t, err)
+	}
+
+	for _, groupBy := range [][]probedb.Dimension{
+		nil,
+		{probedb.DimensionEpoch, probedb.DimensionSource},
+		{probedb.DimensionEpoch, probedb.DimensionSlot, probedb.DimensionMethod},
+		{probedb.DimensionIPAddr, probedb.DimensionMethod},
+	} {
+		for _, order := range []probedb.Order{probedb.OrderEarliest, probedb.OrderLatest} {
+			filter := &probedb.DelayFilter{
+				Statistics:    []probedb.Statistic{{Type: probedb.StatisticCount}},
+				GroupBy:       groupBy,
+				SlotsPerEpoch: 8,
+				Order:         order,
+			}
+			all, err := provide(ctx, filter)
+			require.NoError(t, err)
+			require.NotEmpty(t, all)
+
+			for limit := uint32(1); limit <= uint32(len(all)); limit++ {
+				res := make([]*probedb.DelayStatistics, 0)
+				filter.Limit = limit
+				filter.Cursor = ""
+				for {
+					page, err := provide(ctx, filter)
+					require.NoError(t, err)
+					require.LessOrEqual(t, len(page), int(limit))
+					if len(page) == 0 {
+						break
+					}
+					res = append(res, page...)
+					filter.Cursor = probedb.DelayStatisticsPosition(page[len(page)-1]).Cursor()
+				}
+				require.Len(t, res, len(all))
+				for i := range all {
+					require.Equal(t, probedb.DelayStatisticsPosition(all[i]), probedb.DelayStatisticsPosition(res[i]), "group by %v order %d limit %d", groupBy, order, limit)
+					require.InDeltaSlice(t, all[i].Values, res[i].Values, 1e-9)
+				}
+			}
+		}
+	}
+}
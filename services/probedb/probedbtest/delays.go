@@ -0,0 +1,275 @@
+// Copyright © 2023 Weald Technology Trading.
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package probedbtest
+
+import (
+	"context"
+	"net"
+	"testing"
+
+	"github.com/stretchr/testify/require"
+	"github.com/wealdtech/probed/services/probedb"
+)
+
+type delaySetter func(ctx context.Context, delay *probedb.Delay) (probedb.Action, error)
+
+type delaysProvider func(ctx context.Context, filter *probedb.DelayFilter) ([]*probedb.Delay, error)
+
+func testSetDelay(ctx context.Context, t *testing.T, set delaySetter, provide delaysProvider) {
+	delay := &probedb.Delay{IPAddr: ip("1.2.3.4"), Prober: "prober1", Source: "Source 1", Method: "Method 1", Slot: 1, DelayMS: 100}
+	other := &probedb.Delay{IPAddr: ip("1.2.3.4"), Prober: "prober1", Source: "Source 2", Method: "Method 1", Slot: 1, DelayMS: 200}
+
+	tests := []struct {
+		name   string
+		delay  *probedb.Delay
+		action probedb.Action
+	}{
+		{
+			name:   "New",
+			delay:  delay,
+			action: probedb.ActionCreated,
+		},
+		{
+			name:   "Duplicate",
+			delay:  delay,
+			action: probedb.ActionIgnored,
+		},
+		{
+			name:   "DelayDiffers",
+			delay:  &probedb.Delay{IPAddr: ip("1.2.3.4"), Prober: "prober1", Source: "Source 1", Method: "Method 1", Slot: 1, DelayMS: 300},
+			action: probedb.ActionIgnored,
+		},
+		{
+			name:   "ProberDiffers",
+			delay:  &probedb.Delay{IPAddr: ip("1.2.3.4"), Prober: "prober2", Source: "Source 1", Method: "Method 1", Slot: 1, DelayMS: 100},
+			action: probedb.ActionIgnored,
+		},
+		{
+			name:   "IPv4In16Bytes",
+			delay:  &probedb.Delay{IPAddr: net.ParseIP("1.2.3.4"), Prober: "prober1", Source: "Source 1", Method: "Method 1", Slot: 1, DelayMS: 100},
+			action: probedb.ActionIgnored,
+		},
+		{
+			name:   "IPv4Mapped",
+			delay:  &probedb.Delay{IPAddr: net.ParseIP("::ffff:1.2.3.4"), Prober: "prober1", Source: "Source 1", Method: "Method 1", Slot: 1, DelayMS: 100},
+			action: probedb.ActionIgnored,
+		},
+		{
+			name:   "SourceDiffers",
+			delay:  other,
+			action: probedb.ActionCreated,
+		},
+		{
+			name:   "IPv6",
+			delay:  &probedb.Delay{IPAddr: ip("2001:db8::1"), Prober: "prober1", Source: "Source 1", Method: "Method 1", Slot: 1, DelayMS: 400},
+			action: probedb.ActionCreated,
+		},
+		{
+			name:   "MethodDiffers",
+			delay:  &probedb.Delay{IPAddr: ip("1.2.3.4"), Prober: "prober1", Source: "Source 1", Method: "Method 2", Slot: 1, DelayMS: 500},
+			action: probedb.ActionCreated,
+		},
+		{
+			name:   "SlotDiffers",
+			delay:  &probedb.Delay{IPAddr: ip("1.2.3.4"), Prober: "prober1", Source: "Source 1", Method: "Method 1", Slot: 2, DelayMS: 600},
+			action: probedb.ActionCreated,
+		},
+	}
+
+	for _, test := range tests {
+		t.Run(test.name, func(t *testing.T) {
+			action, err := set(ctx, test.delay)
+			require.NoError(t, err)
+			require.Equal(t, test.action, action)
+		})
+	}
+
+	// The first delay is retained, and IPv4 addresses are returned in their 4-byte form.
+	delays, err := provide(ctx, &probedb.DelayFilter{Selection: probedb.SelectionAll, Methods: []string{"Method 1"}, To: slotPtr(1)})
+	require.NoError(t, err)
+	require.Equal(t, []*probedb.Delay{delay, other, {IPAddr: ip("2001:db8::1"), Prober: "prober1", Source: "Source 1", Method: "Method 1", Slot: 1, DelayMS: 400}}, delays)
+}
+
+func testDelays(ctx context.Context, t *testing.T, set delaySetter, provide delaysProvider) {
+	// Delays are set out of order, to ensure that they are sorted on return.
+	delays := []*probedb.Delay{
+		{IPAddr: ip("10.0.0.1"), Prober: "prober1", Source: "Source 1", Method: "Method 1", Slot: 1, DelayMS: 100},
+		{IPAddr: ip("9.0.0.1"), Prober: "prober1", Source: "Source 2", Method: "Method 1", Slot: 1, DelayMS: 200},
+		{IPAddr: ip("2001:db8::1"), Prober: "prober2", Source: "Source 1", Method: "Method 1", Slot: 1, DelayMS: 400},
+		{IPAddr: ip("9.0.0.1"), Prober: "prober1", Source: "Source 1", Method: "Method 1", Slot: 1, DelayMS: 300},
+		{IPAddr: ip("9.0.0.1"), Prober: "prober2", Source: "Source 1", Method: "Method 2", Slot: 1, DelayMS: 50},
+		{IPAddr: ip("2001:db8::1"), Prober: "prober2", Source: "Source 1", Method: "Method 2", Slot: 2, DelayMS: 60},
+		{IPAddr: ip("10.0.0.1"), Prober: "prober3", Source: "Source 3", Method: "Method 3", Slot: 3, DelayMS: 75},
+		{IPAddr: ip("9.0.0.1"), Prober: "prober1", Source: "Source 2", Method: "Method 1", Slot: 4, DelayMS: 40},
+		{IPAddr: ip("10.0.0.1"), Prober: "prober1", Source: "Source 1", Method: "Method 1", Slot: 4, DelayMS: 10},
+		{IPAddr: ip("9.0.0.1"), Prober: "prober1", Source: "Source 1", Method: "Method 1", Slot: 4, DelayMS: 30},
+		{IPAddr: ip("10.0.0.1"), Prober: "prober1", Source: "Source 2", Method: "Method 1", Slot: 4, DelayMS: 20},
+	}
+	for _, delay := range delays {
+		action, err := set(ctx, delay)
+		require.NoError(t, err)
+		require.Equal(t, probedb.ActionCreated, action)
+	}
+
+	// selected returns the delays at the given indices.
+	selected := func(indices ...int) []*probedb.Delay {
+		res := make([]*probedb.Delay, 0, len(indices))
+		for _, index := range indices {
+			res = append(res, delays[index])
+		}
+		return res
+	}
+
+	tests := []struct {
+		name   string
+		filter *probedb.DelayFilter
+		res    []*probedb.Delay
+		err    string
+	}{
+		{
+			name:   "SelectionInvalid",
+			filter: &probedb.DelayFilter{Selection: 99},
+			err:    "unhandled selection criteria",
+		},
+		{
+			// Ordered by slot, method, IP address (IPv4 before IPv6) and source.
+			name:   "All",
+			filter: &probedb.DelayFilter{Selection: probedb.SelectionAll},
+			res:    selected(3, 1, 0, 2, 4, 5, 6, 9, 7, 8, 10),
+		},
+		{
+			// Ordered by descending slot, then method, IP address and source.
+			name:   "AllOrderLatest",
+			filter: &probedb.DelayFilter{Selection: probedb.SelectionAll, Order: probedb.OrderLatest},
+			res:    selected(9, 7, 8, 10, 6, 5, 3, 1, 0, 2, 4),
+		},
+		{
+			name:   "AllOrderLatestLimit",
+			filter: &probedb.DelayFilter{Selection: probedb.SelectionAll, Order: probedb.OrderLatest, Limit: 5},
+			res:    selected(9, 7, 8, 10, 6),
+		},
+		{
+			name:   "OrderInvalid",
+			filter: &probedb.DelayFilter{Order: 99},
+			err:    "no order specified",
+		},
+		{
+			name:   "Minimum",
+			filter: &probedb.DelayFilter{Selection: probedb.SelectionMinimum},
+			res:    []*probedb.Delay{{Slot: 1, DelayMS: 50}, {Slot: 2, DelayMS: 60}, {Slot: 3, DelayMS: 75}, {Slot: 4, DelayMS: 10}},
+		},
+		{
+			name:   "MinimumOrderLatest",
+			filter: &probedb.DelayFilter{Selection: probedb.SelectionMinimum, Order: probedb.OrderLatest, Limit: 3},
+			res:    []*probedb.Delay{{Slot: 4, DelayMS: 10}, {Slot: 3, DelayMS: 75}, {Slot: 2, DelayMS: 60}},
+		},
+		{
+			name:   "Maximum",
+			filter: &probedb.DelayFilter{Selection: probedb.SelectionMaximum},
+			res:    []*probedb.Delay{{Slot: 1, DelayMS: 400}, {Slot: 2, DelayMS: 60}, {Slot: 3, DelayMS: 75}, {Slot: 4, DelayMS: 40}},
+		},
+		{
+			name:   "Median",
+			filter: &probedb.DelayFilter{Selection: probedb.SelectionMedian},
+			res:    []*probedb.Delay{{Slot: 1, DelayMS: 200}, {Slot: 2, DelayMS: 60}, {Slot: 3, DelayMS: 75}, {Slot: 4, DelayMS: 25}},
+		},
+		{
+			name:   "MedianOrderLatest",
+			filter: &probedb.DelayFilter{Selection: probedb.SelectionMedian, Order: probedb.OrderLatest},
+			res:    []*probedb.Delay{{Slot: 4, DelayMS: 25}, {Slot: 3, DelayMS: 75}, {Slot: 2, DelayMS: 60}, {Slot: 1, DelayMS: 200}},
+		},
+		{
+			name:   "MedianFiltered",
+			filter: &probedb.DelayFilter{Selection: probedb.SelectionMedian, Methods: []string{"Method 1"}},
+			res:    []*probedb.Delay{{Slot: 1, DelayMS: 250}, {Slot: 4, DelayMS: 25}},
+		},
+		{
+			name:   "IPAddr",
+			filter: &probedb.DelayFilter{Selection: probedb.SelectionAll, IPAddr: "9.0.0.1"},
+			res:    selected(3, 1, 4, 9, 7),
+		},
+		{
+			name:   "IPAddrMapped",
+			filter: &probedb.DelayFilter{Selection: probedb.SelectionAll, IPAddr: "::ffff:9.0.0.1"},
+			res:    selected(3, 1, 4, 9, 7),
+		},
+		{
+			name:   "IPAddrV6",
+			filter: &probedb.DelayFilter{Selection: probedb.SelectionAll, IPAddr: "2001:db8::1"},
+			res:    selected(2, 5),
+		},
+		{
+			name:   "Prober",
+			filter: &probedb.DelayFilter{Selection: probedb.SelectionAll, Prober: "prober2"},
+			res:    selected(2, 4, 5),
+		},
+		{
+			name:   "Sources",
+			filter: &probedb.DelayFilter{Selection: probedb.SelectionAll, Sources: []string{"Source 2", "Source 3"}},
+			res:    selected(1, 6, 7, 10),
+		},
+		{
+			name:   "Methods",
+			filter: &probedb.DelayFilter{Selection: probedb.SelectionAll, Methods: []string{"Method 2", "Method 3"}},
+			res:    selected(4, 5, 6),
+		},
+		{
+			name:   "From",
+			filter: &probedb.DelayFilter{Selection: probedb.SelectionAll, From: slotPtr(2)},
+			res:    selected(5, 6, 9, 7, 8, 10),
+		},
+		{
+			name:   "To",
+			filter: &probedb.DelayFilter{Selection: probedb.SelectionAll, To: slotPtr(2)},
+			res:    selected(3, 1, 0, 2, 4, 5),
+		},
+		{
+			name:   "FromTo",
+			filter: &probedb.DelayFilter{Selection: probedb.SelectionAll, From: slotPtr(2), To: slotPtr(3)},
+			res:    selected(5, 6),
+		},
+		{
+			name:   "FromMinimum",
+			filter: &probedb.DelayFilter{Selection: probedb.SelectionMinimum, From: slotPtr(3)},
+			res:    []*probedb.Delay{{Slot: 3, DelayMS: 75}, {Slot: 4, DelayMS: 10}},
+		},
+		{
+			name:   "Combined",
+			filter: &probedb.DelayFilter{Selection: probedb.SelectionAll, Prober: "prober1", Methods: []string{"Method 1"}, From: slotPtr(4)},
+			res:    selected(9, 7, 8, 10),
+		},
+		{
+			name:   "NoMatch",
+			filter: &probedb.DelayFilter{Selection: probedb.SelectionAll, From: slotPtr(5)},
+			res:    []*probedb.Delay{},
+		},
+		{
+			name:   "NoMatchMedian",
+			filter: &probedb.DelayFilter{Selection: probedb.SelectionMedian, From: slotPtr(5)},
+			res:    []*probedb.Delay{},
+		},
+	}
+
+	for _, test := range tests {
+		t.Run(test.name, func(t *testing.T) {
+			res, err := provide(ctx, test.filter)
+			if test.err != "" {
+				require.EqualError(t, err, test.err)
+			} else {
+				require.NoError(t, err)
+				require.Equal(t, test.res, res)
+			}
+		})
+	}
+}
@@ -0,0 +1,148 @@
+// Copyright © 2023 Weald Technology Trading.
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package probedbtest
+
+import (
+	"context"
+	"testing"
+
+	"github.com/attestantio/go-eth2-client/spec/phase0"
+	"github.com/stretchr/testify/require"
+	"github.com/wealdtech/probed/services/probedb"
+)
+
+func testPruners(ctx context.Context, t *testing.T, s Service) {
+	t.Run("BlockDelays", func(t *testing.T) {
+		pruner, isPruner := s.(probedb.BlockDelaysPruner)
+		if !isPruner {
+			t.Skip("pruner not implemented")
+		}
+		testPruneDelays(ctx, t, s.SetBlockDelay, pruner.PruneBlockDelays, s.BlockDelays)
+	})
+
+	t.Run("HeadDelays", func(t *testing.T) {
+		pruner, isPruner := s.(probedb.HeadDelaysPruner)
+		if !isPruner {
+			t.Skip("pruner not implemented")
+		}
+		testPruneDelays(ctx, t, s.SetHeadDelay, pruner.PruneHeadDelays, s.HeadDelays)
+	})
+
+	t.Run("AggregateAttestations", func(t *testing.T) {
+		pruner, isPruner := s.(probedb.AggregateAttestationsPruner)
+		if !isPruner {
+			t.Skip("pruner not implemented")
+		}
+
+		aggregateAttestations := []*probedb.AggregateAttestation{
+			aggregateAttestation(ip("1.2.3.4"), "prober1", "Source 1", "Method 1", 1, []byte{0x01}, 100),
+			aggregateAttestation(ip("1.2.3.4"), "prober1", "Source 1", "Method 1", 1, []byte{0x02}, 100),
+			aggregateAttestation(ip("1.2.3.4"), "prober1", "Source 1", "Method 1", 2, []byte{0x01}, 100),
+			aggregateAttestation(ip("1.2.3.4"), "prober1", "Source 1", "Method 1", 3, []byte{0x01}, 100),
+		}
+		for _, aggregateAttestation := range aggregateAttestations {
+			_, err := s.SetAggregateAttestation(ctx, aggregateAttestation)
+			require.NoError(t, err)
+		}
+
+		requirePruned(ctx, t, pruner.PruneAggregateAttestations)
+
+		res, err := s.AggregateAttestations(ctx, &probedb.AggregateAttestationFilter{})
+		require.NoError(t, err)
+		require.Equal(t, aggregateAttestations[3:], res)
+
+		// Pruned aggregate attestations can be set again.
+		action, err := s.SetAggregateAttestation(ctx, aggregateAttestations[0])
+		require.NoError(t, err)
+		require.Equal(t, probedb.ActionCreated, action)
+	})
+
+	t.Run("AttestationSummaries", func(t *testing.T) {
+		pruner, isPruner := s.(probedb.AttestationSummariesPruner)
+		if !isPruner {
+			t.Skip("pruner not implemented")
+		}
+
+		summaries := []*probedb.AttestationSummary{
+			attestationSummary(ip("1.2.3.4"), "prober1", "Source 1", "Method 1", 1, []byte{0x01}, [][]byte{{0x01}}),
+			attestationSummary(ip("1.2.3.4"), "prober1", "Source 1", "Method 1", 1, []byte{0x02}, [][]byte{{0x01}}),
+			attestationSummary(ip("1.2.3.4"), "prober1", "Source 1", "Method 1", 2, []byte{0x01}, [][]byte{{0x01}}),
+			attestationSummary(ip("1.2.3.4"), "prober1", "Source 1", "Method 1", 3, []byte{0x01}, [][]byte{{0x01}}),
+		}
+		for _, summary := range summaries {
+			_, err := s.SetAttestationSummary(ctx, summary)
+			require.NoError(t, err)
+		}
+
+		requirePruned(ctx, t, pruner.PruneAttestationSummaries)
+
+		res, err := s.AttestationSummaries(ctx, &probedb.AttestationSummaryFilter{})
+		require.NoError(t, err)
+		require.Equal(t, summaries[3:], res)
+
+		// Pruned attestation summaries can be set again.
+		action, err := s.SetAttestationSummary(ctx, summaries[0])
+		require.NoError(t, err)
+		require.Equal(t, probedb.ActionCreated, action)
+	})
+}
+
+func testPruneDelays(ctx context.Context,
+	t *testing.T,
+	set delaySetter,
+	prune func(ctx context.Context, before phase0.Slot, limit uint32) (uint32, error),
+	provide delaysProvider,
+) {
+	delays := []*probedb.Delay{
+		{IPAddr: ip("1.2.3.4"), Prober: "prober1", Source: "Source 1", Method: "Method 1", Slot: 1, DelayMS: 100},
+		{IPAddr: ip("1.2.3.4"), Prober: "prober1", Source: "Source 2", Method: "Method 1", Slot: 1, DelayMS: 200},
+		{IPAddr: ip("1.2.3.4"), Prober: "prober1", Source: "Source 1", Method: "Method 1", Slot: 2, DelayMS: 300},
+		{IPAddr: ip("1.2.3.4"), Prober: "prober1", Source: "Source 1", Method: "Method 1", Slot: 3, DelayMS: 400},
+	}
+	for _, delay := range delays {
+		_, err := set(ctx, delay)
+		require.NoError(t, err)
+	}
+
+	requirePruned(ctx, t, prune)
+
+	res, err := provide(ctx, &probedb.DelayFilter{Selection: probedb.SelectionAll})
+	require.NoError(t, err)
+	require.Equal(t, delays[3:], res)
+
+	// Pruned delays can be set again.
+	action, err := set(ctx, delays[0])
+	require.NoError(t, err)
+	require.Equal(t, probedb.ActionCreated, action)
+}
+
+// requirePruned prunes records before slot 3 in batches of 2, where the
+// three records for slots 1 and 2 should be removed.
+func requirePruned(ctx context.Context, t *testing.T, prune func(ctx context.Context, before phase0.Slot, limit uint32) (uint32, error)) {
+	removed, err := prune(ctx, 3, 0)
+	require.NoError(t, err)
+	require.Equal(t, uint32(0), removed)
+
+	removed, err = prune(ctx, 3, 2)
+	require.NoError(t, err)
+	require.Equal(t, uint32(2), removed)
+
+	removed, err = prune(ctx, 3, 2)
+	require.NoError(t, err)
+	require.Equal(t, uint32(1), removed)
+
+	removed, err = prune(ctx, 3, 2)
+	require.NoError(t, err)
+	require.Equal(t, uint32(0), removed)
+}
@@ -0,0 +1,202 @@
+// Copyright © 2023 Weald Technology Trading.
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package probedbtest
+
+import (
+	"context"
+	"math"
+	"testing"
+
+	"github.com/stretchr/testify/require"
+	"github.com/wealdtech/probed/services/probedb"
+)
+
+type delayStatisticsProvider func(ctx context.Context, filter *probedb.DelayFilter) ([]*probedb.DelayStatistics, error)
+
+func testDelayStatisticsProviders(ctx context.Context, t *testing.T, s Service) {
+	t.Run("BlockDelays", func(t *testing.T) {
+		provider, isProvider := s.(probedb.BlockDelayStatisticsProvider)
+		if !isProvider {
+			t.Skip("statistics provider not implemented")
+		}
+		testDelayStatistics(ctx, t, s.SetBlockDelay, provider.BlockDelayStatistics)
+	})
+
+	t.Run("HeadDelays", func(t *testing.T) {
+		provider, isProvider := s.(probedb.HeadDelayStatisticsProvider)
+		if !isProvider {
+			t.Skip("statistics provider not implemented")
+		}
+		testDelayStatistics(ctx, t, s.SetHeadDelay, provider.HeadDelayStatistics)
+	})
+}
+
+func testDelayStatistics(ctx context.Context, t *testing.T, set delaySetter, provide delayStatisticsProvider) {
+	for _, delay := range []*probedb.Delay{
+		{IPAddr: ip("10.0.0.1"), Prober: "prober1", Source: "Source 1", Method: "Method 1", Slot: 1, DelayMS: 300},
+		{IPAddr: ip("9.0.0.1"), Prober: "prober1", Source: "Source 2", Method: "Method 1", Slot: 1, DelayMS: 100},
+		{IPAddr: ip("2001:db8::1"), Prober: "prober2", Source: "Source 1", Method: "Method 1", Slot: 1, DelayMS: 400},
+		{IPAddr: ip("9.0.0.1"), Prober: "prober1", Source: "Source 1", Method: "Method 1", Slot: 1, DelayMS: 200},
+		{IPAddr: ip("2001:db8::1"), Prober: "prober2", Source: "Source 1", Method: "Method 2", Slot: 2, DelayMS: 60},
+		{IPAddr: ip("10.0.0.1"), Prober: "prober1", Source: "Source 1", Method: "Method 1", Slot: 4, DelayMS: 10},
+		{IPAddr: ip("9.0.0.1"), Prober: "prober1", Source: "Source 1", Method: "Method 1", Slot: 4, DelayMS: 30},
+	} {
+		_, err := set(ctx, delay)
+		require.NoError(t, err)
+	}
+
+	all := []probedb.Statistic{
+		{Type: probedb.StatisticCount},
+		{Type: probedb.StatisticMinimum},
+		{Type: probedb.StatisticMaximum},
+		{Type: probedb.StatisticMean},
+		{Type: probedb.StatisticStdDev},
+		{Type: probedb.StatisticPercentile, Percentile: 0},
+		{Type: probedb.StatisticPercentile, Percentile: 50},
+		{Type: probedb.StatisticPercentile, Percentile: 75},
+		{Type: probedb.StatisticPercentile, Percentile: 90},
+		{Type: probedb.StatisticPercentile, Percentile: 100},
+	}
+
+	tests := []struct {
+		name   string
+		filter *probedb.DelayFilter
+		res    []*probedb.DelayStatistics
+		err    string
+	}{
+		{
+			name:   "NoStatistics",
+			filter: &probedb.DelayFilter{},
+			err:    "no statistics requested",
+		},
+		{
+			name: "PercentileInvalid",
+			filter: &probedb.DelayFilter{
+				Statistics: []probedb.Statistic{{Type: probedb.StatisticPercentile, Percentile: 101}},
+			},
+			err: "percentile must be between 0 and 100",
+		},
+		{
+			name:   "All",
+			filter: &probedb.DelayFilter{Statistics: all},
+			res: []*probedb.DelayStatistics{
+				{Slot: 1, Values: []float64{4, 100, 400, 250, math.Sqrt(12500), 100, 250, 325, 370, 400}},
+				{Slot: 2, Values: []float64{1, 60, 60, 60, 0, 60, 60, 60, 60, 60}},
+				{Slot: 4, Values: []float64{2, 10, 30, 20, 10, 10, 20, 25, 28, 30}},
+			},
+		},
+		{
+			name: "Filtered",
+			filter: &probedb.DelayFilter{
+				Prober:     "prober1",
+				From:       slotPtr(1),
+				To:         slotPtr(3),
+				Statistics: []probedb.Statistic{{Type: probedb.StatisticPercentile, Percentile: 95}, {Type: probedb.StatisticCount}},
+			},
+			res: []*probedb.DelayStatistics{
+				{Slot: 1, Values: []float64{290, 3}},
+			},
+		},
+		{
+			name: "DimensionInvalid",
+			filter: &probedb.DelayFilter{
+				Statistics: []probedb.Statistic{{Type: probedb.StatisticCount}},
+				GroupBy:    []probedb.Dimension{99},
+			},
+			err: "unhandled dimension",
+		},
+		{
+			name: "GroupByEpochAndSource",
+			filter: &probedb.DelayFilter{
+				Statistics:    []probedb.Statistic{{Type: probedb.StatisticCount}, {Type: probedb.StatisticMean}},
+				GroupBy:       []probedb.Dimension{probedb.DimensionSource, probedb.DimensionEpoch},
+				SlotsPerEpoch: 2,
+			},
+			res: []*probedb.DelayStatistics{
+				{Epoch: 0, Source: "Source 1", Values: []float64{3, 300}},
+				{Epoch: 0, Source: "Source 2", Values: []float64{1, 100}},
+				{Epoch: 1, Source: "Source 1", Values: []float64{1, 60}},
+				{Epoch: 2, Source: "Source 1", Values: []float64{2, 20}},
+			},
+		},
+		{
+			name: "GroupByEpochAndSourceOrderLatest",
+			filter: &probedb.DelayFilter{
+				Statistics:    []probedb.Statistic{{Type: probedb.StatisticCount}, {Type: probedb.StatisticMean}},
+				GroupBy:       []probedb.Dimension{probedb.DimensionSource, probedb.DimensionEpoch},
+				SlotsPerEpoch: 2,
+				Order:         probedb.OrderLatest,
+			},
+			res: []*probedb.DelayStatistics{
+				{Epoch: 2, Source: "Source 1", Values: []float64{2, 20}},
+				{Epoch: 1, Source: "Source 1", Values: []float64{1, 60}},
+				{Epoch: 0, Source: "Source 1", Values: []float64{3, 300}},
+				{Epoch: 0, Source: "Source 2", Values: []float64{1, 100}},
+			},
+		},
+		{
+			name: "GroupByMethodAndIPAddr",
+			filter: &probedb.DelayFilter{
+				Statistics: []probedb.Statistic{{Type: probedb.StatisticCount}, {Type: probedb.StatisticMaximum}},
+				GroupBy:    []probedb.Dimension{probedb.DimensionIPAddr, probedb.DimensionMethod},
+			},
+			res: []*probedb.DelayStatistics{
+				{Method: "Method 1", IPAddr: ip("9.0.0.1"), Values: []float64{3, 200}},
+				{Method: "Method 1", IPAddr: ip("10.0.0.1"), Values: []float64{2, 300}},
+				{Method: "Method 1", IPAddr: ip("2001:db8::1"), Values: []float64{1, 400}},
+				{Method: "Method 2", IPAddr: ip("2001:db8::1"), Values: []float64{1, 60}},
+			},
+		},
+		{
+			name: "GroupBySlotAndSource",
+			filter: &probedb.DelayFilter{
+				To:         slotPtr(1),
+				Statistics: []probedb.Statistic{{Type: probedb.StatisticMinimum}},
+				GroupBy:    []probedb.Dimension{probedb.DimensionSlot, probedb.DimensionSource},
+			},
+			res: []*probedb.DelayStatistics{
+				{Slot: 1, Source: "Source 1", Values: []float64{200}},
+				{Slot: 1, Source: "Source 2", Values: []float64{100}},
+			},
+		},
+		{
+			name: "Empty",
+			filter: &probedb.DelayFilter{
+				From:       slotPtr(5),
+				Statistics: []probedb.Statistic{{Type: probedb.StatisticCount}},
+			},
+			res: []*probedb.DelayStatistics{},
+		},
+	}
+
+	for _, test := range tests {
+		t.Run(test.name, func(t *testing.T) {
+			res, err := provide(ctx, test.filter)
+			if test.err != "" {
+				require.EqualError(t, err, test.err)
+				return
+			}
+			require.NoError(t, err)
+			require.Len(t, res, len(test.res))
+			for i := range test.res {
+				require.Equal(t, test.res[i].Slot, res[i].Slot)
+				require.Equal(t, test.res[i].Epoch, res[i].Epoch)
+				require.Equal(t, test.res[i].Source, res[i].Source)
+				require.Equal(t, test.res[i].Method, res[i].Method)
+				require.Equal(t, test.res[i].IPAddr, res[i].IPAddr)
+				require.InDeltaSlice(t, test.res[i].Values, res[i].Values, 1e-9)
+			}
+		})
+	}
+}
@@ -0,0 +1,181 @@
+// Copyright © 2023 Weald Technology Trading.
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package probedbtest
+
+import (
+	"context"
+	"testing"
+
+	"github.com/pkg/errors"
+	"github.com/stretchr/testify/require"
+	"github.com/wealdtech/probed/services/probedb"
+)
+
+// errStop is returned by handlers to stop streaming.
+var errStop = errors.New("stop")
+
+func testStreamers(ctx context.Context, t *testing.T, s Service) {
+	for _, delay := range []*probedb.Delay{
+		{IPAddr: ip("10.0.0.1"), Prober: "prober1", Source: "Source 1", Method: "Method 1", Slot: 1, DelayMS: 100},
+		{IPAddr: ip("9.0.0.1"), Prober: "prober1", Source: "Source 2", Method: "Method 1", Slot: 1, DelayMS: 200},
+		{IPAddr: ip("2001:db8::1"), Prober: "prober2", Source: "Source 1", Method: "Method 1", Slot: 2, DelayMS: 400},
+		{IPAddr: ip("9.0.0.1"), Prober: "prober1", Source: "Source 1", Method: "Method 2", Slot: 3, DelayMS: 300},
+	} {
+		_, err := s.SetBlockDelay(ctx, delay)
+		require.NoError(t, err)
+		_, err = s.SetHeadDelay(ctx, delay)
+		require.NoError(t, err)
+	}
+	for _, aggregateAttestation := range []*probedb.AggregateAttestation{
+		aggregateAttestation(ip("10.0.0.1"), "prober1", "Source 1", "Method 1", 3, []byte{0x01}, 100),
+		aggregateAttestation(ip("9.0.0.1"), "prober2", "Source 2", "Method 1", 1, []byte{0x02}, 200),
+		aggregateAttestation(ip("9.0.0.1"), "prober1", "Source 1", "Method 3", 2, []byte{0x04}, 400),
+	} {
+		_, err := s.SetAggregateAttestation(ctx, aggregateAttestation)
+		require.NoError(t, err)
+	}
+	for _, summary := range []*probedb.AttestationSummary{
+		attestationSummary(ip("10.0.0.1"), "prober1", "Source 1", "Method 1", 3, []byte{0x01}, [][]byte{{0x01}}),
+		attestationSummary(ip("9.0.0.1"), "prober2", "Source 2", "Method 1", 1, []byte{0x02}, [][]byte{{0x02}}),
+		attestationSummary(ip("9.0.0.1"), "prober1", "Source 1", "Method 3", 2, []byte{0x04}, [][]byte{{0x04}}),
+	} {
+		_, err := s.SetAttestationSummary(ctx, summary)
+		require.NoError(t, err)
+	}
+
+	t.Run("BlockDelays", func(t *testing.T) {
+		streamer, isStreamer := s.(probedb.BlockDelaysStreamer)
+		if !isStreamer {
+			t.Skip("block delays streamer not implemented")
+		}
+		testDelaysStreamer(ctx, t, s.BlockDelays, streamer.StreamBlockDelays)
+	})
+	t.Run("HeadDelays", func(t *testing.T) {
+		streamer, isStreamer := s.(probedb.HeadDelaysStreamer)
+		if !isStreamer {
+			t.Skip("head delays streamer not implemented")
+		}
+		testDelaysStreamer(ctx, t, s.HeadDelays, streamer.StreamHeadDelays)
+	})
+	t.Run("AggregateAttestations", func(t *testing.T) {
+		streamer, isStreamer := s.(probedb.AggregateAttestationsStreamer)
+		if !isStreamer {
+			t.Skip("aggregate attestations streamer not implemented")
+		}
+		testAggregateAttestationsStreamer(ctx, t, s, streamer)
+	})
+	t.Run("AttestationSummaries", func(t *testing.T) {
+		streamer, isStreamer := s.(probedb.AttestationSummariesStreamer)
+		if !isStreamer {
+			t.Skip("attestation summaries streamer not implemented")
+		}
+		testAttestationSummariesStreamer(ctx, t, s, streamer)
+	})
+}
+
+type delaysStreamer func(ctx context.Context, filter *probedb.DelayFilter, handler func(*probedb.Delay) error) error
+
+func testDelaysStreamer(ctx context.Context, t *testing.T, provide delaysProvider, stream delaysStreamer) {
+	// Streamed delays match those provided.
+	for _, filter := range []*probedb.DelayFilter{
+		{Selection: probedb.SelectionAll},
+		{Selection: probedb.SelectionAll, Limit: 2, Cursor: probedb.DelayPosition(&probedb.Delay{IPAddr: ip("10.0.0.1"), Source: "Source 1", Method: "Method 1", Slot: 1}).Cursor()},
+		{Selection: probedb.SelectionMinimum},
+		{Selection: probedb.SelectionMedian, Limit: 2},
+	} {
+		expected, err := provide(ctx, filter)
+		require.NoError(t, err)
+
+		streamed := make([]*probedb.Delay, 0)
+		require.NoError(t, stream(ctx, filter, func(delay *probedb.Delay) error {
+			streamed = append(streamed, delay)
+			return nil
+		}))
+		require.Equal(t, expected, streamed)
+	}
+
+	// An invalid filter is rejected.
+	require.EqualError(t, stream(ctx, &probedb.DelayFilter{Selection: 99}, func(*probedb.Delay) error { return nil }), "unhandled selection criteria")
+
+	// An error from the handler stops streaming.
+	handled := 0
+	err := stream(ctx, &probedb.DelayFilter{Selection: probedb.SelectionAll}, func(*probedb.Delay) error {
+		handled++
+		return errStop
+	})
+	require.ErrorIs(t, err, errStop)
+	require.Equal(t, 1, handled)
+
+	// Cancelling the context stops streaming.
+	cancelCtx, cancel := context.WithCancel(ctx)
+	defer cancel()
+	handled = 0
+	err = stream(cancelCtx, &probedb.DelayFilter{Selection: probedb.SelectionAll}, func(*probedb.Delay) error {
+		handled++
+		cancel()
+		return nil
+	})
+	require.ErrorIs(t, err, context.Canceled)
+	require.Equal(t, 1, handled)
+}
+
+func testAggregateAttestationsStreamer(ctx context.Context, t *testing.T, s Service, streamer probedb.AggregateAttestationsStreamer) {
+	for _, filter := range []*probedb.AggregateAttestationFilter{
+		{},
+		{Order: probedb.OrderLatest, Limit: 2},
+	} {
+		expected, err := s.AggregateAttestations(ctx, filter)
+		require.NoError(t, err)
+
+		streamed := make([]*probedb.AggregateAttestation, 0)
+		require.NoError(t, streamer.StreamAggregateAttestations(ctx, filter, func(aggregateAttestation *probedb.AggregateAttestation) error {
+			streamed = append(streamed, aggregateAttestation)
+			return nil
+		}))
+		require.Equal(t, expected, streamed)
+	}
+
+	handled := 0
+	err := streamer.StreamAggregateAttestations(ctx, &probedb.AggregateAttestationFilter{}, func(*probedb.AggregateAttestation) error {
+		handled++
+		return errStop
+	})
+	require.ErrorIs(t, err, errStop)
+	require.Equal(t, 1, handled)
+}
+
+func testAttestationSummariesStreamer(ctx context.Context, t *testing.T, s Service, streamer probedb.AttestationSummariesStreamer) {
+	for _, filter := range []*probedb.AttestationSummaryFilter{
+		{},
+		{Order: probedb.OrderLatest, Limit: 2},
+	} {
+		expected, err := s.AttestationSummaries(ctx, filter)
+		require.NoError(t, err)
+
+		streamed := make([]*probedb.AttestationSummary, 0)
+		require.NoError(t, streamer.StreamAttestationSummaries(ctx, filter, func(summary *probedb.AttestationSummary) error {
+			streamed = append(streamed, summary)
+			return nil
+		}))
+		require.Equal(t, expected, streamed)
+	}
+
+	handled := 0
+	err := streamer.StreamAttestationSummaries(ctx, &probedb.AttestationSummaryFilter{}, func(*probedb.AttestationSummary) error {
+		handled++
+		return errStop
+	})
+	require.ErrorIs(t, err, errStop)
+	require.Equal(t, 1, handled)
+}
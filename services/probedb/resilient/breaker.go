@@ -0,0 +1,136 @@
+// Copyright © 2023 Weald Technology Trading.
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package resilient
+
+import (
+	"sync"
+	"time"
+)
+
+// breakerState is the state of a circuit breaker.
+type breakerState uint8
+
+const (
+	// breakerClosed allows all calls through.
+	breakerClosed breakerState = iota
+	// breakerHalfOpen allows a single trial call through.
+	breakerHalfOpen
+	// breakerOpen rejects all calls.
+	breakerOpen
+)
+
+var breakerStateStrings = [...]string{
+	"closed",
+	"half-open",
+	"open",
+}
+
+// String returns a string representation of the state.
+func (s breakerState) String() string {
+	if int(s) >= len(breakerStateStrings) {
+		return "unknown"
+	}
+	return breakerStateStrings[s]
+}
+
+// breaker is a circuit breaker.
+// It opens after a number of consecutive failures, rejecting calls until the
+// open duration has passed, after which it allows a single trial call through.
+// If the trial call succeeds the breaker closes, otherwise it opens again.
+type breaker struct {
+	failureThreshold int
+	openDuration     time.Duration
+	now              func() time.Time
+
+	mu       sync.Mutex
+	state    breakerState
+	failures int
+	openedAt time.Time
+	trialing bool
+}
+
+func newBreaker(failureThreshold int, openDuration time.Duration) *breaker {
+	return &breaker{
+		failureThreshold: failureThreshold,
+		openDuration:     openDuration,
+		now:              time.Now,
+	}
+}
+
+// allow returns true if a call is allowed through.
+// If not, it also returns the time after which a call may be allowed.
+func (b *breaker) allow() (time.Duration, bool) {
+	b.mu.Lock()
+	defer b.mu.Unlock()
+
+	if b.state == breakerOpen {
+		remaining := b.openDuration - b.now().Sub(b.openedAt)
+		if remaining > 0 {
+			return remaining, false
+		}
+		b.setState(breakerHalfOpen)
+	}
+
+	if b.state == breakerHalfOpen {
+		if b.trialing {
+			// Another call is already trialing the database.
+			return b.openDuration, false
+		}
+		b.trialing = true
+	}
+
+	return 0, true
+}
+
+// success records a call that reached the database.
+func (b *breaker) success() {
+	b.mu.Lock()
+	defer b.mu.Unlock()
+
+	b.failures = 0
+	b.trialing = false
+	if b.state != breakerClosed {
+		log.Info().Msg("Database calls succeeding; closing circuit breaker")
+		b.setState(breakerClosed)
+	}
+}
+
+// failure records a call that failed to reach the database.
+func (b *breaker) failure() {
+	b.mu.Lock()
+	defer b.mu.Unlock()
+
+	b.failures++
+	b.trialing = false
+	if b.state == breakerHalfOpen || (b.state == breakerClosed && b.failures >= b.failureThreshold) {
+		log.Warn().Int("failures", b.failures).Dur("open_duration", b.openDuration).Msg("Database calls failing; opening circuit breaker")
+		b.openedAt = b.now()
+		b.setState(breakerOpen)
+	}
+}
+
+// abandon records a call whose outcome is unknown because it was cancelled by the caller.
+func (b *breaker) abandon() {
+	b.mu.Lock()
+	defer b.mu.Unlock()
+
+	b.trialing = false
+}
+
+// setState sets the state of the breaker.
+// The caller must hold the lock.
+func (b *breaker) setState(state breakerState) {
+	b.state = state
+	setBreakerState(state)
+}
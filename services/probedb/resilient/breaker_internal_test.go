@@ -0,0 +1,76 @@
+// Copyright © 2023 Weald Technology Trading.
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package resilient
+
+import (
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/require"
+)
+
+func TestBreaker(t *testing.T) {
+	now := time.Unix(1600000000, 0)
+	b := newBreaker(2, 10*time.Second)
+	b.now = func() time.Time { return now }
+
+	// Closed; a single failure does not open it.
+	_, allowed := b.allow()
+	require.True(t, allowed)
+	b.failure()
+	require.Equal(t, breakerClosed, b.state)
+
+	// A success resets the failure count.
+	b.success()
+	b.failure()
+	require.Equal(t, breakerClosed, b.state)
+
+	// Second consecutive failure opens it.
+	b.failure()
+	require.Equal(t, breakerOpen, b.state)
+	now = now.Add(4 * time.Second)
+	retryAfter, allowed := b.allow()
+	require.False(t, allowed)
+	require.Equal(t, 6*time.Second, retryAfter)
+
+	// After the open duration a single trial call is allowed.
+	now = now.Add(6 * time.Second)
+	_, allowed = b.allow()
+	require.True(t, allowed)
+	require.Equal(t, breakerHalfOpen, b.state)
+	_, allowed = b.allow()
+	require.False(t, allowed)
+
+	// An abandoned trial allows another.
+	b.abandon()
+	_, allowed = b.allow()
+	require.True(t, allowed)
+
+	// A failed trial opens it again.
+	b.failure()
+	require.Equal(t, breakerOpen, b.state)
+	_, allowed = b.allow()
+	require.False(t, allowed)
+
+	// A successful trial closes it.
+	now = now.Add(10 * time.Second)
+	_, allowed = b.allow()
+	require.True(t, allowed)
+	b.success()
+	require.Equal(t, breakerClosed, b.state)
+	_, allowed = b.allow()
+	require.True(t, allowed)
+	_, allowed = b.allow()
+	require.True(t, allowed)
+}
@@ -0,0 +1,94 @@
+// Copyright © 2023 Weald Technology Trading.
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package resilient
+
+import (
+	"context"
+
+	"github.com/pkg/errors"
+	"github.com/prometheus/client_golang/prometheus"
+	"github.com/wealdtech/probed/services/metrics"
+)
+
+var metricsNamespace = "probed_resilient"
+
+var (
+	calls             *prometheus.CounterVec
+	retries           *prometheus.CounterVec
+	breakerStateGauge prometheus.Gauge
+)
+
+func registerMetrics(ctx context.Context, monitor metrics.Service) error {
+	if calls != nil {
+		// Already registered.
+		return nil
+	}
+	if monitor == nil {
+		// No monitor.
+		return nil
+	}
+	if monitor.Presenter() == "prometheus" {
+		return registerPrometheusMetrics(ctx)
+	}
+	return nil
+}
+
+func registerPrometheusMetrics(_ context.Context) error {
+	calls = prometheus.NewCounterVec(prometheus.CounterOpts{
+		Namespace: metricsNamespace,
+		Name:      "calls_total",
+		Help:      "The number of calls to the database.",
+	}, []string{"operation", "result"})
+	if err := prometheus.Register(calls); err != nil {
+		return errors.Wrap(err, "failed to register calls_total")
+	}
+
+	retries = prometheus.NewCounterVec(prometheus.CounterOpts{
+		Namespace: metricsNamespace,
+		Name:      "retries_total",
+		Help:      "The number of calls to the database retried after a transient failure.",
+	}, []string{"operation"})
+	if err := prometheus.Register(retries); err != nil {
+		return errors.Wrap(err, "failed to register retries_total")
+	}
+
+	breakerStateGauge = prometheus.NewGauge(prometheus.GaugeOpts{
+		Namespace: metricsNamespace,
+		Name:      "circuit_breaker_state",
+		Help:      "The state of the circuit breaker (0 closed, 1 half-open, 2 open).",
+	})
+	if err := prometheus.Register(breakerStateGauge); err != nil {
+		return errors.Wrap(err, "failed to register circuit_breaker_state")
+	}
+
+	return nil
+}
+
+func callCompleted(operation string, result string) {
+	if calls != nil {
+		calls.WithLabelValues(operation, result).Inc()
+	}
+}
+
+func callRetried(operation string) {
+	if retries != nil {
+		retries.WithLabelValues(operation).Inc()
+	}
+}
+
+func setBreakerState(state breakerState) {
+	if breakerStateGauge != nil {
+		breakerStateGauge.Set(float64(state))
+	}
+}
@@ -0,0 +1,160 @@
+// Copyright © 2023 Weald Technology Trading.
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package resilient
+
+import (
+	"errors"
+	"time"
+
+	"github.com/rs/zerolog"
+	"github.com/wealdtech/probed/services/metrics"
+	nullmetrics "github.com/wealdtech/probed/services/metrics/null"
+	"github.com/wealdtech/probed/services/probedb"
+)
+
+type parameters struct {
+	logLevel         zerolog.Level
+	monitor          metrics.Service
+	probeDB          probedb.Service
+	timeout          time.Duration
+	maxRetries       int
+	retryBackoff     time.Duration
+	failureThreshold int
+	openDuration     time.Duration
+}
+
+// Parameter is the interface for service parameters.
+type Parameter interface {
+	apply(*parameters)
+}
+
+type parameterFunc func(*parameters)
+
+func (f parameterFunc) apply(p *parameters) {
+	f(p)
+}
+
+// WithLogLevel sets the log level for the module.
+func WithLogLevel(logLevel zerolog.Level) Parameter {
+	return parameterFunc(func(p *parameters) {
+		p.logLevel = logLevel
+	})
+}
+
+// WithMonitor sets the monitor for the module.
+func WithMonitor(monitor metrics.Service) Parameter {
+	return parameterFunc(func(p *parameters) {
+		p.monitor = monitor
+	})
+}
+
+// WithProbeDB sets the underlying probe database for the module.
+// This must support the setter interfaces.
+func WithProbeDB(probeDB probedb.Service) Parameter {
+	return parameterFunc(func(p *parameters) {
+		p.probeDB = probeDB
+	})
+}
+
+// WithTimeout sets the maximum time for a single call to the underlying database.
+func WithTimeout(timeout time.Duration) Parameter {
+	return parameterFunc(func(p *parameters) {
+		p.timeout = timeout
+	})
+}
+
+// WithMaxRetries sets the maximum number of times a call that fails with a
+// transient error is retried.
+func WithMaxRetries(retries int) Parameter {
+	return parameterFunc(func(p *parameters) {
+		p.maxRetries = retries
+	})
+}
+
+// WithRetryBackoff sets the time to wait before the first retry; it doubles with each subsequent retry.
+func WithRetryBackoff(backoff time.Duration) Parameter {
+	return parameterFunc(func(p *parameters) {
+		p.retryBackoff = backoff
+	})
+}
+
+// WithFailureThreshold sets the number of consecutive failed calls after which
+// the circuit breaker opens.
+func WithFailureThreshold(threshold int) Parameter {
+	return parameterFunc(func(p *parameters) {
+		p.failureThreshold = threshold
+	})
+}
+
+// WithOpenDuration sets the time for which the circuit breaker stays open before
+// allowing a trial call through.
+func WithOpenDuration(duration time.Duration) Parameter {
+	return parameterFunc(func(p *parameters) {
+		p.openDuration = duration
+	})
+}
+
+// parseAndCheckParameters parses and checks parameters to ensure that mandatory parameters are present and correct.
+func parseAndCheckParameters(params ...Parameter) (*parameters, error) {
+	parameters := parameters{
+		logLevel:         zerolog.GlobalLevel(),
+		monitor:          nullmetrics.New(),
+		timeout:          10 * time.Second,
+		maxRetries:       3,
+		retryBackoff:     100 * time.Millisecond,
+		failureThreshold: 5,
+		openDuration:     30 * time.Second,
+	}
+	for _, p := range params {
+		if params != nil {
+			p.apply(&parameters)
+		}
+	}
+
+	if parameters.monitor == nil {
+		return nil, errors.New("no monitor specified")
+	}
+	if parameters.probeDB == nil {
+		return nil, errors.New("no probe database specified")
+	}
+	if _, isSetter := parameters.probeDB.(probedb.BlockDelaysSetter); !isSetter {
+		return nil, errors.New("probe database does not support setting block delays")
+	}
+	if _, isSetter := parameters.probeDB.(probedb.HeadDelaysSetter); !isSetter {
+		return nil, errors.New("probe database does not support setting head delays")
+	}
+	if _, isSetter := parameters.probeDB.(probedb.AggregateAttestationsSetter); !isSetter {
+		return nil, errors.New("probe database does not support setting aggregate attestations")
+	}
+	if _, isSetter := parameters.probeDB.(probedb.AttestationSummariesSetter); !isSetter {
+		return nil, errors.New("probe database does not support setting attestation summaries")
+	}
+	if parameters.timeout <= 0 {
+		return nil, errors.New("timeout must be positive")
+	}
+	if parameters.maxRetries < 0 {
+		return nil, errors.New("maximum retries cannot be negative")
+	}
+	if parameters.retryBackoff <= 0 {
+		return nil, errors.New("retry backoff must be positive")
+	}
+	if parameters.failureThreshold <= 0 {
+		return nil, errors.New("failure threshold must be positive")
+	}
+	if parameters.openDuration <= 0 {
+		return nil, errors.New("open duration must be positive")
+	}
+
+	return &parameters, nil
+}
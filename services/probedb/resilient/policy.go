@@ -0,0 +1,120 @@
+// Copyright © 2023 Weald Technology Trading.
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package resilient
+
+import (
+	"context"
+	"io"
+	"net"
+	"strings"
+	"time"
+
+	"github.com/jackc/pgconn"
+	"github.com/pkg/errors"
+	"github.com/wealdtech/probed/services/probedb"
+)
+
+// transientCodes are PostgreSQL error codes, outside of the connection
+// exception class, for which a retry may succeed.
+var transientCodes = map[string]bool{
+	"40001": true, // serialization_failure
+	"40P01": true, // deadlock_detected
+	"53300": true, // too_many_connections
+	"55P03": true, // lock_not_available
+	"57P01": true, // admin_shutdown
+	"57P02": true, // crash_shutdown
+	"57P03": true, // cannot_connect_now
+}
+
+// call calls the function with a timeout, retrying it if it fails with a
+// transient error and failing fast if the circuit breaker is open.
+// Calls within a transaction are not retried, as the failure will have
+// aborted the transaction.
+func (s *Service) call(ctx context.Context, operation string, fn func(context.Context) error) error {
+	retries := s.maxRetries
+	if _, inTx := ctx.Value(txContextKey{}).(bool); inTx {
+		retries = 0
+	}
+
+	backoff := s.retryBackoff
+	for attempt := 0; ; attempt++ {
+		retryAfter, allowed := s.breaker.allow()
+		if !allowed {
+			log.Trace().Str("operation", operation).Dur("retry_after", retryAfter).Msg("Circuit breaker open; rejecting call")
+			callCompleted(operation, "rejected")
+			return &probedb.UnavailableError{RetryAfter: retryAfter}
+		}
+
+		callCtx, cancel := context.WithTimeout(ctx, s.timeout)
+		err := fn(callCtx)
+		timedOut := errors.Is(callCtx.Err(), context.DeadlineExceeded)
+		cancel()
+
+		switch {
+		case err == nil:
+			s.breaker.success()
+			callCompleted(operation, "succeeded")
+			return nil
+		case ctx.Err() != nil:
+			// The caller gave up, so this says nothing about the database.
+			s.breaker.abandon()
+			callCompleted(operation, "cancelled")
+			return err
+		case !timedOut && !Transient(err):
+			// The database was reached, and rejected the call.
+			s.breaker.success()
+			callCompleted(operation, "failed")
+			return err
+		}
+
+		s.breaker.failure()
+		if timedOut {
+			err = errors.Wrapf(err, "timed out after %s", s.timeout)
+		}
+		if attempt >= retries {
+			callCompleted(operation, "failed")
+			return err
+		}
+
+		log.Debug().Err(err).Str("operation", operation).Int("attempt", attempt+1).Dur("backoff", backoff).Msg("Transient failure; retrying")
+		callRetried(operation)
+		select {
+		case <-ctx.Done():
+			callCompleted(operation, "cancelled")
+			return ctx.Err()
+		case <-time.After(backoff):
+		}
+		backoff *= 2
+	}
+}
+
+// Transient returns true if the error is one for which a retry may succeed.
+func Transient(err error) bool {
+	if pgconn.SafeToRetry(err) || pgconn.Timeout(err) {
+		return true
+	}
+
+	var pgErr *pgconn.PgError
+	if errors.As(err, &pgErr) {
+		// Class 08 is connection exceptions.
+		return strings.HasPrefix(pgErr.Code, "08") || transientCodes[pgErr.Code]
+	}
+
+	var netErr net.Error
+	if errors.As(err, &netErr) {
+		return true
+	}
+
+	return errors.Is(err, io.EOF) || errors.Is(err, io.ErrUnexpectedEOF)
+}
@@ -0,0 +1,67 @@
+// Copyright © 2023 Weald Technology Trading.
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package resilient
+
+import (
+	"io"
+	"net"
+	"testing"
+
+	"github.com/jackc/pgconn"
+	"github.com/pkg/errors"
+	"github.com/stretchr/testify/require"
+)
+
+func TestTransient(t *testing.T) {
+	tests := []struct {
+		name      string
+		err       error
+		transient bool
+	}{
+		{
+			name:      "ConnectionFailure",
+			err:       &pgconn.PgError{Code: "08006"},
+			transient: true,
+		},
+		{
+			name:      "SerializationFailure",
+			err:       errors.Wrap(&pgconn.PgError{Code: "40001"}, "failed"),
+			transient: true,
+		},
+		{
+			name: "UniqueViolation",
+			err:  &pgconn.PgError{Code: "23505"},
+		},
+		{
+			name:      "Network",
+			err:       &net.OpError{Op: "dial", Err: errors.New("connection refused")},
+			transient: true,
+		},
+		{
+			name:      "UnexpectedEOF",
+			err:       errors.Wrap(io.ErrUnexpectedEOF, "failed"),
+			transient: true,
+		},
+		{
+			name: "Other",
+			err:  errors.New("failed"),
+		},
+	}
+
+	for _, test := range tests {
+		t.Run(test.name, func(t *testing.T) {
+			require.Equal(t, test.transient, Transient(test.err))
+		})
+	}
+}
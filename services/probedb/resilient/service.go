@@ -0,0 +1,117 @@
+// Copyright © 2023 Weald Technology Trading.
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+// Package resilient provides a probe database that applies timeouts, retries
+// and a circuit breaker to calls to an underlying probe database.
+package resilient
+
+import (
+	"context"
+	"time"
+
+	"github.com/pkg/errors"
+	"github.com/rs/zerolog"
+	zerologger "github.com/rs/zerolog/log"
+	"github.com/wealdtech/probed/services/probedb"
+)
+
+// Service is a resilient probe database service.
+type Service struct {
+	probeDB                     probedb.Service
+	blockDelaysSetter           probedb.BlockDelaysSetter
+	headDelaysSetter            probedb.HeadDelaysSetter
+	aggregateAttestationsSetter probedb.AggregateAttestationsSetter
+	attestationSummariesSetter  probedb.AttestationSummariesSetter
+	timeout                     time.Duration
+	maxRetries                  int
+	retryBackoff                time.Duration
+	breaker                     *breaker
+}
+
+// txContextKey marks a context as holding a transaction begun through this service.
+type txContextKey struct{}
+
+// module-wide log.
+var log zerolog.Logger
+
+// New creates a new resilient probe database service.
+func New(ctx context.Context, params ...Parameter) (*Service, error) {
+	parameters, err := parseAndCheckParameters(params...)
+	if err != nil {
+		return nil, errors.Wrap(err, "problem with parameters")
+	}
+
+	// Set logging.
+	log = zerologger.With().Str("service", "probedb").Str("impl", "resilient").Logger().Level(parameters.logLevel)
+
+	if err := registerMetrics(ctx, parameters.monitor); err != nil {
+		return nil, errors.New("failed to register metrics")
+	}
+
+	s := &Service{
+		probeDB:                     parameters.probeDB,
+		blockDelaysSetter:           parameters.probeDB.(probedb.BlockDelaysSetter),
+		headDelaysSetter:            parameters.probeDB.(probedb.HeadDelaysSetter),
+		aggregateAttestationsSetter: parameters.probeDB.(probedb.AggregateAttestationsSetter),
+		attestationSummariesSetter:  parameters.probeDB.(probedb.AttestationSummariesSetter),
+		timeout:                     parameters.timeout,
+		maxRetries:                  parameters.maxRetries,
+		retryBackoff:                parameters.retryBackoff,
+		breaker:                     newBreaker(parameters.failureThreshold, parameters.openDuration),
+	}
+
+	return s, nil
+}
+
+// BeginTx begins a transaction.
+// No timeout is applied, as the transaction outlives the call.
+func (s *Service) BeginTx(ctx context.Context) (context.Context, context.CancelFunc, error) {
+	var txCtx context.Context
+	var cancel context.CancelFunc
+	err := s.call(ctx, "begin", func(_ context.Context) error {
+		var err error
+		txCtx, cancel, err = s.probeDB.BeginTx(ctx)
+		return err
+	})
+	if err != nil {
+		return nil, nil, err
+	}
+
+	return context.WithValue(txCtx, txContextKey{}, true), cancel, nil
+}
+
+// CommitTx commits a transaction.
+func (s *Service) CommitTx(ctx context.Context) error {
+	return s.call(ctx, "commit", func(ctx context.Context) error {
+		return s.probeDB.CommitTx(ctx)
+	})
+}
+
+// SetMetadata sets a metadata key to a JSON value.
+func (s *Service) SetMetadata(ctx context.Context, key string, value []byte) error {
+	return s.call(ctx, "set metadata", func(ctx context.Context) error {
+		return s.probeDB.SetMetadata(ctx, key, value)
+	})
+}
+
+// Metadata obtains the JSON value from a metadata key.
+func (s *Service) Metadata(ctx context.Context, key string) ([]byte, error) {
+	var value []byte
+	err := s.call(ctx, "metadata", func(ctx context.Context) error {
+		var err error
+		value, err = s.probeDB.Metadata(ctx, key)
+		return err
+	})
+
+	return value, err
+}
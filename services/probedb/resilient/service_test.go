@@ -0,0 +1,257 @@
+// Copyright © 2023 Weald Technology Trading.
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package resilient_test
+
+import (
+	"context"
+	"sync/atomic"
+	"testing"
+	"time"
+
+	"github.com/jackc/pgconn"
+	"github.com/pkg/errors"
+	"github.com/rs/zerolog"
+	"github.com/stretchr/testify/require"
+	"github.com/wealdtech/probed/services/probedb"
+	mockprobedb "github.com/wealdtech/probed/services/probedb/mock"
+	"github.com/wealdtech/probed/services/probedb/resilient"
+)
+
+// scriptedProbeDB is a probe database whose block delay calls fail with a
+// given error a number of times, or hang until their context is done.
+type scriptedProbeDB struct {
+	*mockprobedb.Service
+	err      error
+	failures int32
+	hang     int32
+	calls    int32
+}
+
+func (s *scriptedProbeDB) SetBlockDelay(ctx context.Context, delay *probedb.Delay) (probedb.Action, error) {
+	atomic.AddInt32(&s.calls, 1)
+	if atomic.LoadInt32(&s.hang) == 1 {
+		<-ctx.Done()
+		return probedb.ActionCreated, ctx.Err()
+	}
+	if atomic.AddInt32(&s.failures, -1) >= 0 {
+		return probedb.ActionCreated, s.err
+	}
+	return s.Service.SetBlockDelay(ctx, delay)
+}
+
+func newService(t *testing.T, probeDB probedb.Service, params ...resilient.Parameter) *resilient.Service {
+	t.Helper()
+
+	params = append([]resilient.Parameter{
+		resilient.WithLogLevel(zerolog.Disabled),
+		resilient.WithProbeDB(probeDB),
+		resilient.WithRetryBackoff(time.Millisecond),
+	}, params...)
+	s, err := resilient.New(context.Background(), params...)
+	require.NoError(t, err)
+
+	return s
+}
+
+func TestService(t *testing.T) {
+	ctx := context.Background()
+
+	tests := []struct {
+		name   string
+		params []resilient.Parameter
+		err    string
+	}{
+		{
+			name: "ProbeDBMissing",
+			params: []resilient.Parameter{
+				resilient.WithLogLevel(zerolog.Disabled),
+			},
+			err: "problem with parameters: no probe database specified",
+		},
+		{
+			name: "TimeoutZero",
+			params: []resilient.Parameter{
+				resilient.WithLogLevel(zerolog.Disabled),
+				resilient.WithProbeDB(mockprobedb.New()),
+				resilient.WithTimeout(0),
+			},
+			err: "problem with parameters: timeout must be positive",
+		},
+		{
+			name: "MaxRetriesNegative",
+			params: []resilient.Parameter{
+				resilient.WithLogLevel(zerolog.Disabled),
+				resilient.WithProbeDB(mockprobedb.New()),
+				resilient.WithMaxRetries(-1),
+			},
+			err: "problem with parameters: maximum retries cannot be negative",
+		},
+		{
+			name: "FailureThresholdZero",
+			params: []resilient.Parameter{
+				resilient.WithLogLevel(zerolog.Disabled),
+				resilient.WithProbeDB(mockprobedb.New()),
+				resilient.WithFailureThreshold(0),
+			},
+			err: "problem with parameters: failure threshold must be positive",
+		},
+		{
+			name: "Good",
+			params: []resilient.Parameter{
+				resilient.WithLogLevel(zerolog.Disabled),
+				resilient.WithProbeDB(mockprobedb.New()),
+			},
+		},
+	}
+
+	for _, test := range tests {
+		t.Run(test.name, func(t *testing.T) {
+			_, err := resilient.New(ctx, test.params...)
+			if test.err != "" {
+				require.EqualError(t, err, test.err)
+			} else {
+				require.NoError(t, err)
+			}
+		})
+	}
+}
+
+func TestRetries(t *testing.T) {
+	ctx := context.Background()
+
+	tests := []struct {
+		name     string
+		err      error
+		failures int32
+		calls    int32
+		success  bool
+	}{
+		{
+			name:     "Transient",
+			err:      &pgconn.PgError{Code: "08006"},
+			failures: 2,
+			calls:    3,
+			success:  true,
+		},
+		{
+			name:     "TransientExhausted",
+			err:      &pgconn.PgError{Code: "40P01"},
+			failures: 10,
+			calls:    4,
+		},
+		{
+			name:     "Permanent",
+			err:      &pgconn.PgError{Code: "23505"},
+			failures: 10,
+			calls:    1,
+		},
+		{
+			name:     "Unknown",
+			err:      errors.New("unknown"),
+			failures: 10,
+			calls:    1,
+		},
+	}
+
+	for _, test := range tests {
+		t.Run(test.name, func(t *testing.T) {
+			probeDB := &scriptedProbeDB{Service: mockprobedb.New(), err: test.err, failures: test.failures}
+			s := newService(t, probeDB, resilient.WithMaxRetries(3), resilient.WithFailureThreshold(100))
+
+			_, err := s.SetBlockDelay(ctx, &probedb.Delay{Slot: 1})
+			if test.success {
+				require.NoError(t, err)
+			} else {
+				require.ErrorIs(t, err, test.err)
+			}
+			require.Equal(t, test.calls, atomic.LoadInt32(&probeDB.calls))
+		})
+	}
+}
+
+func TestTimeout(t *testing.T) {
+	ctx := context.Background()
+
+	probeDB := &scriptedProbeDB{Service: mockprobedb.New(), hang: 1}
+	s := newService(t, probeDB, resilient.WithTimeout(10*time.Millisecond), resilient.WithMaxRetries(1))
+
+	started := time.Now()
+	_, err := s.SetBlockDelay(ctx, &probedb.Delay{Slot: 1})
+	require.ErrorIs(t, err, context.DeadlineExceeded)
+	require.Contains(t, err.Error(), "timed out after 10ms")
+	require.Less(t, time.Since(started), time.Second)
+	require.Equal(t, int32(2), atomic.LoadInt32(&probeDB.calls))
+}
+
+func TestNoRetriesInTransaction(t *testing.T) {
+	ctx := context.Background()
+
+	probeDB := &scriptedProbeDB{Service: mockprobedb.New(), err: &pgconn.PgError{Code: "08006"}, failures: 10}
+	s := newService(t, probeDB, resilient.WithMaxRetries(3))
+
+	txCtx, cancel, err := s.BeginTx(ctx)
+	require.NoError(t, err)
+	defer cancel()
+
+	_, err = s.SetBlockDelay(txCtx, &probedb.Delay{Slot: 1})
+	require.Error(t, err)
+	require.Equal(t, int32(1), atomic.LoadInt32(&probeDB.calls))
+}
+
+func TestCircuitBreaker(t *testing.T) {
+	ctx := context.Background()
+
+	probeDB := &scriptedProbeDB{Service: mockprobedb.New(), err: &pgconn.PgError{Code: "57P03"}, failures: 3}
+	s := newService(t, probeDB,
+		resilient.WithMaxRetries(0),
+		resilient.WithFailureThreshold(3),
+		resilient.WithOpenDuration(50*time.Millisecond),
+	)
+
+	// Trip the breaker.
+	for i := 0; i < 3; i++ {
+		_, err := s.SetBlockDelay(ctx, &probedb.Delay{Slot: 1})
+		require.ErrorIs(t, err, probeDB.err)
+	}
+
+	// Calls should now fail fast, without reaching the database.
+	_, err := s.SetBlockDelay(ctx, &probedb.Delay{Slot: 1})
+	var unavailableErr *probedb.UnavailableError
+	require.ErrorAs(t, err, &unavailableErr)
+	require.Greater(t, unavailableErr.RetryAfter, time.Duration(0))
+	require.LessOrEqual(t, unavailableErr.RetryAfter, 50*time.Millisecond)
+	require.Equal(t, int32(3), atomic.LoadInt32(&probeDB.calls))
+
+	// After the open duration a trial call is allowed through, and its success closes the breaker.
+	time.Sleep(60 * time.Millisecond)
+	action, err := s.SetBlockDelay(ctx, &probedb.Delay{Slot: 1})
+	require.NoError(t, err)
+	require.Equal(t, probedb.ActionCreated, action)
+	action, err = s.SetBlockDelay(ctx, &probedb.Delay{Slot: 1})
+	require.NoError(t, err)
+	require.Equal(t, probedb.ActionIgnored, action)
+}
+
+func TestCircuitBreakerIgnoresPermanentErrors(t *testing.T) {
+	ctx := context.Background()
+
+	probeDB := &scriptedProbeDB{Service: mockprobedb.New(), err: errors.New("bad data"), failures: 10}
+	s := newService(t, probeDB, resilient.WithFailureThreshold(2))
+
+	for i := 0; i < 5; i++ {
+		_, err := s.SetBlockDelay(ctx, &probedb.Delay{Slot: 1})
+		require.EqualError(t, err, "bad data")
+	}
+	require.Equal(t, int32(5), atomic.LoadInt32(&probeDB.calls))
+}
@@ -0,0 +1,128 @@
+// Copyright © 2023 Weald Technology Trading.
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package resilient
+
+import (
+	"context"
+
+	"github.com/wealdtech/probed/services/probedb"
+)
+
+// SetBlockDelay sets a block delay.
+func (s *Service) SetBlockDelay(ctx context.Context, delay *probedb.Delay) (probedb.Action, error) {
+	action := probedb.ActionCreated
+	err := s.call(ctx, "set block delay", func(ctx context.Context) error {
+		var err error
+		action, err = s.blockDelaysSetter.SetBlockDelay(ctx, delay)
+		return err
+	})
+
+	return action, err
+}
+
+// SetHeadDelay sets a head delay.
+func (s *Service) SetHeadDelay(ctx context.Context, delay *probedb.Delay) (probedb.Action, error) {
+	action := probedb.ActionCreated
+	err := s.call(ctx, "set head delay", func(ctx context.Context) error {
+		var err error
+		action, err = s.headDelaysSetter.SetHeadDelay(ctx, delay)
+		return err
+	})
+
+	return action, err
+}
+
+// SetAggregateAttestation sets an aggregate attestation.
+func (s *Service) SetAggregateAttestation(ctx context.Context, aggregateAttestation *probedb.AggregateAttestation) (probedb.Action, error) {
+	action := probedb.ActionCreated
+	err := s.call(ctx, "set aggregate attestation", func(ctx context.Context) error {
+		var err error
+		action, err = s.aggregateAttestationsSetter.SetAggregateAttestation(ctx, aggregateAttestation)
+		return err
+	})
+
+	return action, err
+}
+
+// SetAttestationSummary sets an attestation summary.
+func (s *Service) SetAttestationSummary(ctx context.Context, summary *probedb.AttestationSummary) (probedb.Action, error) {
+	action := probedb.ActionCreated
+	err := s.call(ctx, "set attestation summary", func(ctx context.Context) error {
+		var err error
+		action, err = s.attestationSummariesSetter.SetAttestationSummary(ctx, summary)
+		return err
+	})
+
+	return action, err
+}
+
+// SetBlockDelays sets multiple block delays.
+func (s *Service) SetBlockDelays(ctx context.Context, delays []*probedb.Delay) error {
+	return s.call(ctx, "set block delays", func(ctx context.Context) error {
+		if bulkSetter, isBulkSetter := s.probeDB.(probedb.BlockDelaysBulkSetter); isBulkSetter {
+			return bulkSetter.SetBlockDelays(ctx, delays)
+		}
+		for _, delay := range delays {
+			if _, err := s.blockDelaysSetter.SetBlockDelay(ctx, delay); err != nil {
+				return err
+			}
+		}
+		return nil
+	})
+}
+
+// SetHeadDelays sets multiple head delays.
+func (s *Service) SetHeadDelays(ctx context.Context, delays []*probedb.Delay) error {
+	return s.call(ctx, "set head delays", func(ctx context.Context) error {
+		if bulkSetter, isBulkSetter := s.probeDB.(probedb.HeadDelaysBulkSetter); isBulkSetter {
+			return bulkSetter.SetHeadDelays(ctx, delays)
+		}
+		for _, delay := range delays {
+			if _, err := s.headDelaysSetter.SetHeadDelay(ctx, delay); err != nil {
+				return err
+			}
+		}
+		return nil
+	})
+}
+
+// SetAggregateAttestations sets multiple aggregate attestations.
+func (s *Service) SetAggregateAttestations(ctx context.Context, aggregateAttestations []*probedb.AggregateAttestation) error {
+	return s.call(ctx, "set aggregate attestations", func(ctx context.Context) error {
+		if bulkSetter, isBulkSetter := s.probeDB.(probedb.AggregateAttestationsBulkSetter); isBulkSetter {
+			return bulkSetter.SetAggregateAttestations(ctx, aggregateAttestations)
+		}
+		for _, aggregateAttestation := range aggregateAttestations {
+			if _, err := s.aggregateAttestationsSetter.SetAggregateAttestation(ctx, aggregateAttestation); err != nil {
+				return err
+			}
+		}
+		return nil
+	})
+}
+
+// SetAttestationSummaries sets multiple attestation summaries.
+func (s *Service) SetAttestationSummaries(ctx context.Context, summaries []*probedb.AttestationSummary) error {
+	return s.call(ctx, "set attestation summaries", func(ctx context.Context) error {
+		if bulkSetter, isBulkSetter := s.probeDB.(probedb.AttestationSummariesBulkSetter); isBulkSetter {
+			return bulkSetter.SetAttestationSummaries(ctx, summaries)
+		}
+		for _, summary := range summaries {
+			if _, err := s.attestationSummariesSetter.SetAttestationSummary(ctx, summary); err != nil {
+				return err
+			}
+		}
+		return nil
+	})
+}
@@ -15,14 +15,16 @@ package probedb
 
 import (
 	"context"
+
+	"github.com/attestantio/go-eth2-client/spec/phase0"
 )
 
 // AggregateAttestationsSetter defines functions to create and update aggregate attestations.
 type AggregateAttestationsSetter interface {
 	Service
 
-	// SetAggregateAttestation sets an aggregate attestation.
-	SetAggregateAttestation(ctx context.Context, aggregateAttestation *AggregateAttestation) error
+	// SetAggregateAttestation sets an aggregate attestation, returning the action taken.
+	SetAggregateAttestation(ctx context.Context, aggregateAttestation *AggregateAttestation) (Action, error)
 }
 
 // AggregateAttestationsProvider defines functions to obtain aggregate attestations.
@@ -31,12 +33,21 @@ type AggregateAttestationsProvider interface {
 	AggregateAttestations(ctx context.Context, filter *AggregateAttestationFilter) ([]*AggregateAttestation, error)
 }
 
+// AggregateAttestationsStreamer defines functions to stream aggregate attestations.
+type AggregateAttestationsStreamer interface {
+	// StreamAggregateAttestations calls the handler with each aggregate attestation for a filter,
+	// in the order in which AggregateAttestations would return them.
+	// If the handler returns an error then streaming stops and the error is returned.
+	// The handler must not access the database in the same transaction.
+	StreamAggregateAttestations(ctx context.Context, filter *AggregateAttestationFilter, handler func(*AggregateAttestation) error) error
+}
+
 // AttestationSummariesSetter defines functions to create and update attestation summaries.
 type AttestationSummariesSetter interface {
 	Service
 
-	// SetAttestationSummary sets an attestation summary.
-	SetAttestationSummary(ctx context.Context, summary *AttestationSummary) error
+	// SetAttestationSummary sets an attestation summary, returning the action taken.
+	SetAttestationSummary(ctx context.Context, summary *AttestationSummary) (Action, error)
 }
 
 // AttestationSummariesProvider defines functions to obtain attestation summaries.
@@ -45,12 +56,21 @@ type AttestationSummariesProvider interface {
 	AttestationSummaries(ctx context.Context, filter *AttestationSummaryFilter) ([]*AttestationSummary, error)
 }
 
+// AttestationSummariesStreamer defines functions to stream attestation summaries.
+type AttestationSummariesStreamer interface {
+	// StreamAttestationSummaries calls the handler with each attestation summary for a filter,
+	// in the order in which AttestationSummaries would return them.
+	// If the handler returns an error then streaming stops and the error is returned.
+	// The handler must not access the database in the same transaction.
+	StreamAttestationSummaries(ctx context.Context, filter *AttestationSummaryFilter, handler func(*AttestationSummary) error) error
+}
+
 // BlockDelaysSetter defines functions to create and update block delays.
 type BlockDelaysSetter interface {
 	Service
 
-	// SetBlockDelay sets a block delay.
-	SetBlockDelay(ctx context.Context, delay *Delay) error
+	// SetBlockDelay sets a block delay, returning the action taken.
+	SetBlockDelay(ctx context.Context, delay *Delay) (Action, error)
 }
 
 // BlockDelaysProvider defines functions to obtain block delays.
@@ -59,12 +79,27 @@ type BlockDelaysProvider interface {
 	BlockDelays(ctx context.Context, filter *DelayFilter) ([]*Delay, error)
 }
 
+// BlockDelaysStreamer defines functions to stream block delays.
+type BlockDelaysStreamer interface {
+	// StreamBlockDelays calls the handler with each block delay for a filter,
+	// in the order in which BlockDelays would return them.
+	// If the handler returns an error then streaming stops and the error is returned.
+	// The handler must not access the database in the same transaction.
+	StreamBlockDelays(ctx context.Context, filter *DelayFilter, handler func(*Delay) error) error
+}
+
+// BlockDelayStatisticsProvider defines functions to obtain statistics of block delays.
+type BlockDelayStatisticsProvider interface {
+	// BlockDelayStatistics obtains the statistics of the block delays for each slot in a range.
+	BlockDelayStatistics(ctx context.Context, filter *DelayFilter) ([]*DelayStatistics, error)
+}
+
 // HeadDelaysSetter defines functions to create and update head delays.
 type HeadDelaysSetter interface {
 	Service
 
-	// SetHeadDelay sets a head delay.
-	SetHeadDelay(ctx context.Context, delay *Delay) error
+	// SetHeadDelay sets a head delay, returning the action taken.
+	SetHeadDelay(ctx context.Context, delay *Delay) (Action, error)
 }
 
 // HeadDelaysProvider defines functions to obtain head delays.
@@ -73,6 +108,95 @@ type HeadDelaysProvider interface {
 	HeadDelays(ctx context.Context, filter *DelayFilter) ([]*Delay, error)
 }
 
+// HeadDelaysStreamer defines functions to stream head delays.
+type HeadDelaysStreamer interface {
+	// StreamHeadDelays calls the handler with each head delay for a filter,
+	// in the order in which HeadDelays would return them.
+	// If the handler returns an error then streaming stops and the error is returned.
+	// The handler must not access the database in the same transaction.
+	StreamHeadDelays(ctx context.Context, filter *DelayFilter, handler func(*Delay) error) error
+}
+
+// HeadDelayStatisticsProvider defines functions to obtain statistics of head delays.
+type HeadDelayStatisticsProvider interface {
+	// HeadDelayStatistics obtains the statistics of the head delays for each slot in a range.
+	HeadDelayStatistics(ctx context.Context, filter *DelayFilter) ([]*DelayStatistics, error)
+}
+
+// BlockDelaysBulkSetter defines functions to create block delays in bulk.
+type BlockDelaysBulkSetter interface {
+	Service
+
+	// SetBlockDelays sets multiple block delays.
+	// Delays that already exist are handled by the block delay conflict policy.
+	SetBlockDelays(ctx context.Context, delays []*Delay) error
+}
+
+// HeadDelaysBulkSetter defines functions to create head delays in bulk.
+type HeadDelaysBulkSetter interface {
+	Service
+
+	// SetHeadDelays sets multiple head delays.
+	// Delays that already exist are handled by the head delay conflict policy.
+	SetHeadDelays(ctx context.Context, delays []*Delay) error
+}
+
+// AggregateAttestationsBulkSetter defines functions to create aggregate attestations in bulk.
+type AggregateAttestationsBulkSetter interface {
+	Service
+
+	// SetAggregateAttestations sets multiple aggregate attestations.
+	// Aggregate attestations that already exist are handled by the aggregate
+	// attestation conflict policy.
+	SetAggregateAttestations(ctx context.Context, aggregateAttestations []*AggregateAttestation) error
+}
+
+// AttestationSummariesBulkSetter defines functions to create attestation summaries in bulk.
+type AttestationSummariesBulkSetter interface {
+	Service
+
+	// SetAttestationSummaries sets multiple attestation summaries.
+	// Attestation summaries that already exist are handled by the attestation
+	// summary conflict policy.
+	SetAttestationSummaries(ctx context.Context, summaries []*AttestationSummary) error
+}
+
+// BlockDelaysPruner defines functions to remove old block delays.
+type BlockDelaysPruner interface {
+	Service
+
+	// PruneBlockDelays removes up to limit block delays for slots before the given slot,
+	// returning the number of block delays removed.
+	PruneBlockDelays(ctx context.Context, before phase0.Slot, limit uint32) (uint32, error)
+}
+
+// HeadDelaysPruner defines functions to remove old head delays.
+type HeadDelaysPruner interface {
+	Service
+
+	// PruneHeadDelays removes up to limit head delays for slots before the given slot,
+	// returning the number of head delays removed.
+	PruneHeadDelays(ctx context.Context, before phase0.Slot, limit uint32) (uint32, error)
+}
+
+// AggregateAttestationsPruner defines functions to remove old aggregate attestations.
+type AggregateAttestationsPruner interface {
+	Service
+
+	// PruneAggregateAttestations removes up to limit aggregate attestations for slots before the given slot,
+	// returning the number of aggregate attestations removed.
+	PruneAggregateAttestations(ctx context.Context, before phase0.Slot, limit uint32) (uint32, error)
+}
+
+// AttestationSummariesPruner defines functions to remove old attestation summaries.
+type AttestationSummariesPruner interface {
+	Service
+
+	// PruneAttestationSummaries removes up to limit attestation summaries for slots before the given slot,
+	// returning the number of attestation summaries removed.
+	PruneAttestationSummaries(ctx context.Context, before phase0.Slot, limit uint32) (uint32, error)
+}
+
 // Service defines a minimal probe database service.
 type Service interface {
 	// BeginTx begins a transaction.
@@ -87,3 +211,34 @@ type Service interface {
 	// Metadata obtains the JSON value from a metadata key.
 	Metadata(ctx context.Context, key string) ([]byte, error)
 }
+
+// Partitioner defines functions to manage slot-range partitions of the probe tables.
+type Partitioner interface {
+	Service
+
+	// CreatePartitions creates any partitions missing between the two slots, inclusive,
+	// for all probe tables.
+	CreatePartitions(ctx context.Context, from phase0.Slot, to phase0.Slot) error
+
+	// DropPartitions drops the partitions of the given table that hold only slots before
+	// the given slot, returning the number of partitions dropped.
+	// The table is one of "block_delays", "head_delays", "aggregate_attestations" or
+	// "attestation_summaries".
+	DropPartitions(ctx context.Context, table string, before phase0.Slot) (uint32, error)
+}
+
+// SchemaMigrator defines functions to inspect and migrate the schema of the database.
+type SchemaMigrator interface {
+	Service
+
+	// MigrationStatus obtains the status of the schema of the database.
+	MigrationStatus(ctx context.Context) (*MigrationStatus, error)
+
+	// Migrate migrates the schema to the latest version, returning the statements run.
+	// If dryRun is true then the statements are returned without being run.
+	Migrate(ctx context.Context, dryRun bool) ([]string, error)
+
+	// Rollback rolls the schema back to the given version, returning the statements run.
+	// If dryRun is true then the statements are returned without being run.
+	Rollback(ctx context.Context, version uint64, dryRun bool) ([]string, error)
+}
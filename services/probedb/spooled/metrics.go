@@ -0,0 +1,107 @@
+// Copyright © 2023 Weald Technology Trading.
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package spooled
+
+import (
+	"context"
+
+	"github.com/pkg/errors"
+	"github.com/prometheus/client_golang/prometheus"
+	"github.com/wealdtech/probed/services/metrics"
+)
+
+var metricsNamespace = "probed_spooled"
+
+var (
+	spoolRecords    prometheus.Gauge
+	spoolSize       prometheus.Gauge
+	spooledRecords  *prometheus.CounterVec
+	replayedRecords *prometheus.CounterVec
+)
+
+func registerMetrics(ctx context.Context, monitor metrics.Service) error {
+	if spoolRecords != nil {
+		// Already registered.
+		return nil
+	}
+	if monitor == nil {
+		// No monitor.
+		return nil
+	}
+	if monitor.Presenter() == "prometheus" {
+		return registerPrometheusMetrics(ctx)
+	}
+	return nil
+}
+
+func registerPrometheusMetrics(_ context.Context) error {
+	spoolRecords = prometheus.NewGauge(prometheus.GaugeOpts{
+		Namespace: metricsNamespace,
+		Name:      "depth_records",
+		Help:      "The number of records in the spool waiting to be replayed.",
+	})
+	if err := prometheus.Register(spoolRecords); err != nil {
+		return errors.Wrap(err, "failed to register depth_records")
+	}
+
+	spoolSize = prometheus.NewGauge(prometheus.GaugeOpts{
+		Namespace: metricsNamespace,
+		Name:      "size_bytes",
+		Help:      "The size of the spool on disk.",
+	})
+	if err := prometheus.Register(spoolSize); err != nil {
+		return errors.Wrap(err, "failed to register size_bytes")
+	}
+
+	spooledRecords = prometheus.NewCounterVec(prometheus.CounterOpts{
+		Namespace: metricsNamespace,
+		Name:      "spooled_records_total",
+		Help:      "The number of records written to the spool.",
+	}, []string{"result"})
+	if err := prometheus.Register(spooledRecords); err != nil {
+		return errors.Wrap(err, "failed to register spooled_records_total")
+	}
+
+	replayedRecords = prometheus.NewCounterVec(prometheus.CounterOpts{
+		Namespace: metricsNamespace,
+		Name:      "replayed_records_total",
+		Help:      "The number of records replayed from the spool to the database.",
+	}, []string{"result"})
+	if err := prometheus.Register(replayedRecords); err != nil {
+		return errors.Wrap(err, "failed to register replayed_records_total")
+	}
+
+	return nil
+}
+
+func setSpoolDepth(records int, size int64) {
+	if spoolRecords != nil {
+		spoolRecords.Set(float64(records))
+	}
+	if spoolSize != nil {
+		spoolSize.Set(float64(size))
+	}
+}
+
+func recordsSpooled(result string) {
+	if spooledRecords != nil {
+		spooledRecords.WithLabelValues(result).Inc()
+	}
+}
+
+func recordsReplayed(result string) {
+	if replayedRecords != nil {
+		replayedRecords.WithLabelValues(result).Inc()
+	}
+}
@@ -0,0 +1,148 @@
+// Copyright © 2023 Weald Technology Trading.
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package spooled
+
+import (
+	"errors"
+	"time"
+
+	"github.com/rs/zerolog"
+	"github.com/wealdtech/probed/services/metrics"
+	nullmetrics "github.com/wealdtech/probed/services/metrics/null"
+	"github.com/wealdtech/probed/services/probedb"
+)
+
+type parameters struct {
+	logLevel       zerolog.Level
+	monitor        metrics.Service
+	probeDB        probedb.Service
+	dir            string
+	segmentSize    int64
+	maxSize        int64
+	replayInterval time.Duration
+}
+
+// Parameter is the interface for service parameters.
+type Parameter interface {
+	apply(*parameters)
+}
+
+type parameterFunc func(*parameters)
+
+func (f parameterFunc) apply(p *parameters) {
+	f(p)
+}
+
+// WithLogLevel sets the log level for the module.
+func WithLogLevel(logLevel zerolog.Level) Parameter {
+	return parameterFunc(func(p *parameters) {
+		p.logLevel = logLevel
+	})
+}
+
+// WithMonitor sets the monitor for the module.
+func WithMonitor(monitor metrics.Service) Parameter {
+	return parameterFunc(func(p *parameters) {
+		p.monitor = monitor
+	})
+}
+
+// WithProbeDB sets the underlying probe database for the module.
+// This must support the setter interfaces.
+func WithProbeDB(probeDB probedb.Service) Parameter {
+	return parameterFunc(func(p *parameters) {
+		p.probeDB = probeDB
+	})
+}
+
+// WithDir sets the directory in which spool segment files are held.
+func WithDir(dir string) Parameter {
+	return parameterFunc(func(p *parameters) {
+		p.dir = dir
+	})
+}
+
+// WithSegmentSize sets the size, in bytes, after which a new segment file is started.
+func WithSegmentSize(size int64) Parameter {
+	return parameterFunc(func(p *parameters) {
+		p.segmentSize = size
+	})
+}
+
+// WithMaxSize sets the maximum total size, in bytes, of the spool.
+// Records that would take the spool over this size are rejected.
+func WithMaxSize(size int64) Parameter {
+	return parameterFunc(func(p *parameters) {
+		p.maxSize = size
+	})
+}
+
+// WithReplayInterval sets the time between attempts to replay the spool.
+func WithReplayInterval(interval time.Duration) Parameter {
+	return parameterFunc(func(p *parameters) {
+		p.replayInterval = interval
+	})
+}
+
+// parseAndCheckParameters parses and checks parameters to ensure that mandatory parameters are present and correct.
+func parseAndCheckParameters(params ...Parameter) (*parameters, error) {
+	parameters := parameters{
+		logLevel:       zerolog.GlobalLevel(),
+		monitor:        nullmetrics.New(),
+		segmentSize:    16 * 1024 * 1024,
+		maxSize:        1024 * 1024 * 1024,
+		replayInterval: 10 * time.Second,
+	}
+	for _, p := range params {
+		if params != nil {
+			p.apply(&parameters)
+		}
+	}
+
+	if parameters.monitor == nil {
+		return nil, errors.New("no monitor specified")
+	}
+	if parameters.probeDB == nil {
+		return nil, errors.New("no probe database specified")
+	}
+	if _, isSetter := parameters.probeDB.(probedb.BlockDelaysSetter); !isSetter {
+		return nil, errors.New("probe database does not support setting block delays")
+	}
+	if _, isSetter := parameters.probeDB.(probedb.HeadDelaysSetter); !isSetter {
+		return nil, errors.New("probe database does not support setting head delays")
+	}
+	if _, isSetter := parameters.probeDB.(probedb.AggregateAttestationsSetter); !isSetter {
+		return nil, errors.New("probe database does not support setting aggregate attestations")
+	}
+	if _, isSetter := parameters.probeDB.(probedb.AttestationSummariesSetter); !isSetter {
+		return nil, errors.New("probe database does not support setting attestation summaries")
+	}
+	if parameters.dir == "" {
+		return nil, errors.New("no spool directory specified")
+	}
+	if parameters.segmentSize <= 0 {
+		return nil, errors.New("segment size must be positive")
+	}
+	if parameters.maxSize <= 0 {
+		return nil, errors.New("maximum size must be positive")
+	}
+	if parameters.segmentSize > parameters.maxSize {
+		return nil, errors.New("segment size cannot be larger than maximum size")
+	}
+	if parameters.replayInterval <= 0 {
+		return nil, errors.New("replay interval must be positive")
+	}
+
+	return &parameters, nil
+}
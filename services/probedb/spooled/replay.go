@@ -0,0 +1,108 @@
+// Copyright © 2023 Weald Technology Trading.
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package spooled
+
+import (
+	"context"
+	"os"
+	"time"
+
+	"github.com/pkg/errors"
+)
+
+// run replays the spool at each replay interval until the context is done.
+func (s *Service) run(ctx context.Context) {
+	ticker := time.NewTicker(s.replayInterval)
+	defer ticker.Stop()
+
+	for {
+		if err := s.replay(ctx); err != nil {
+			log.Debug().Err(err).Msg("Failed to replay spool; will retry")
+		}
+
+		select {
+		case <-ctx.Done():
+			s.mu.Lock()
+			if err := s.closeActive(); err != nil {
+				log.Warn().Err(err).Msg("Failed to close spool segment")
+			}
+			s.mu.Unlock()
+			return
+		case <-ticker.C:
+		}
+	}
+}
+
+// replay replays the spool to the underlying database until it is empty.
+func (s *Service) replay(ctx context.Context) error {
+	for {
+		segments, err := s.seal()
+		if err != nil {
+			return err
+		}
+		if len(segments) == 0 {
+			return nil
+		}
+
+		for _, segment := range segments {
+			if err := s.replaySegment(ctx, segment); err != nil {
+				return err
+			}
+		}
+	}
+}
+
+// replaySegment replays the records in a segment, removing the segment once
+// all of its records have been replayed.
+// A record that fails to replay whilst the underlying database is available
+// cannot be written and is dropped.
+func (s *Service) replaySegment(ctx context.Context, segment string) error {
+	info, err := os.Stat(segment)
+	if err != nil {
+		return errors.Wrap(err, "failed to obtain segment information")
+	}
+	records, lines, err := readSegment(segment)
+	if err != nil {
+		return err
+	}
+
+	started := time.Now()
+	for i := s.replayed[segment]; i < len(records); i++ {
+		if _, err := s.write(ctx, records[i]); err != nil {
+			if ctx.Err() != nil || !s.available(ctx) {
+				s.replayed[segment] = i
+				return errors.Wrap(err, "failed to replay record")
+			}
+			log.Error().Err(err).Str("segment", segment).Msg("Failed to replay record; dropping")
+			recordsReplayed("dropped")
+			continue
+		}
+		recordsReplayed("succeeded")
+	}
+	delete(s.replayed, segment)
+
+	if err := s.removeSegment(segment, lines, info.Size()); err != nil {
+		return err
+	}
+	log.Trace().Str("segment", segment).Int("records", len(records)).Dur("elapsed", time.Since(started)).Msg("Replayed spool segment")
+
+	return nil
+}
+
+// available returns true if the underlying database is available.
+func (s *Service) available(ctx context.Context) bool {
+	_, err := s.probeDB.Metadata(ctx, "schema")
+
+	return err == nil
+}
@@ -0,0 +1,137 @@
+// Copyright © 2023 Weald Technology Trading.
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+// Package spooled provides a probe database that writes records to an
+// underlying probe database, spooling them to disk if the underlying
+// database is unavailable and replaying them when it recovers.
+package spooled
+
+import (
+	"context"
+	"os"
+	"sync"
+	"time"
+
+	"github.com/pkg/errors"
+	"github.com/rs/zerolog"
+	zerologger "github.com/rs/zerolog/log"
+	"github.com/wealdtech/probed/services/probedb"
+)
+
+// ErrSpoolFull is returned when a record cannot be spooled without exceeding the maximum size.
+var ErrSpoolFull = errors.New("spool full")
+
+// Service is a spooled probe database service.
+type Service struct {
+	probeDB                     probedb.Service
+	blockDelaysSetter           probedb.BlockDelaysSetter
+	headDelaysSetter            probedb.HeadDelaysSetter
+	aggregateAttestationsSetter probedb.AggregateAttestationsSetter
+	attestationSummariesSetter  probedb.AttestationSummariesSetter
+	dir                         string
+	segmentSize                 int64
+	maxSize                     int64
+	replayInterval              time.Duration
+
+	// mu protects the fields below, which describe the spool on disk.
+	mu          sync.Mutex
+	active      *os.File
+	activeSize  int64
+	nextSegment uint64
+	size        int64
+	records     int
+	// spooling is true if records are being written straight to the spool
+	// because the underlying database has failed and the spool has yet to be replayed.
+	spooling bool
+
+	// replayed is the number of records already replayed from each segment.
+	// It is only accessed by the replayer.
+	replayed map[string]int
+}
+
+type txContextKey struct{}
+
+// record is a single spooled record; exactly one field is set.
+type record struct {
+	BlockDelay           *probedb.Delay                `json:"block_delay,omitempty"`
+	HeadDelay            *probedb.Delay                `json:"head_delay,omitempty"`
+	AggregateAttestation *probedb.AggregateAttestation `json:"aggregate_attestation,omitempty"`
+	AttestationSummary   *probedb.AttestationSummary   `json:"attestation_summary,omitempty"`
+}
+
+// module-wide log.
+var log zerolog.Logger
+
+// New creates a new spooled probe database service.
+func New(ctx context.Context, params ...Parameter) (*Service, error) {
+	parameters, err := parseAndCheckParameters(params...)
+	if err != nil {
+		return nil, errors.Wrap(err, "problem with parameters")
+	}
+
+	// Set logging.
+	log = zerologger.With().Str("service", "probedb").Str("impl", "spooled").Logger().Level(parameters.logLevel)
+
+	if err := registerMetrics(ctx, parameters.monitor); err != nil {
+		return nil, errors.New("failed to register metrics")
+	}
+
+	s := &Service{
+		probeDB:                     parameters.probeDB,
+		blockDelaysSetter:           parameters.probeDB.(probedb.BlockDelaysSetter),
+		headDelaysSetter:            parameters.probeDB.(probedb.HeadDelaysSetter),
+		aggregateAttestationsSetter: parameters.probeDB.(probedb.AggregateAttestationsSetter),
+		attestationSummariesSetter:  parameters.probeDB.(probedb.AttestationSummariesSetter),
+		dir:                         parameters.dir,
+		segmentSize:                 parameters.segmentSize,
+		maxSize:                     parameters.maxSize,
+		replayInterval:              parameters.replayInterval,
+		replayed:                    make(map[string]int),
+	}
+
+	// Pick up any segments left by a previous run.
+	if err := s.open(); err != nil {
+		return nil, err
+	}
+
+	go s.run(ctx)
+
+	return s, nil
+}
+
+// BeginTx begins a transaction.
+// Records set within the transaction are never spooled, as they would be
+// replayed regardless of whether or not the transaction was committed.
+func (s *Service) BeginTx(ctx context.Context) (context.Context, context.CancelFunc, error) {
+	ctx, cancel, err := s.probeDB.BeginTx(ctx)
+	if err != nil {
+		return nil, nil, err
+	}
+
+	return context.WithValue(ctx, txContextKey{}, true), cancel, nil
+}
+
+// CommitTx commits a transaction.
+func (s *Service) CommitTx(ctx context.Context) error {
+	return s.probeDB.CommitTx(ctx)
+}
+
+// SetMetadata sets a metadata key to a JSON value.
+func (s *Service) SetMetadata(ctx context.Context, key string, value []byte) error {
+	return s.probeDB.SetMetadata(ctx, key, value)
+}
+
+// Metadata obtains the JSON value from a metadata key.
+func (s *Service) Metadata(ctx context.Context, key string) ([]byte, error) {
+	return s.probeDB.Metadata(ctx, key)
+}
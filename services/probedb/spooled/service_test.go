@@ -0,0 +1,402 @@
+// Copyright © 2023 Weald Technology Trading.
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package spooled_test
+
+import (
+	"context"
+	"os"
+	"path/filepath"
+	"sync/atomic"
+	"testing"
+	"time"
+
+	"github.com/pkg/errors"
+	"github.com/rs/zerolog"
+	"github.com/stretchr/testify/require"
+	"github.com/wealdtech/probed/services/probedb"
+	mockprobedb "github.com/wealdtech/probed/services/probedb/mock"
+	"github.com/wealdtech/probed/services/probedb/spooled"
+)
+
+var (
+	errUnavailable = &probedb.UnavailableError{RetryAfter: time.Second}
+	errRejected    = errors.New("rejected")
+)
+
+// flakyProbeDB is a probe database that can be made unavailable, and that
+// rejects block delays for a given slot.
+type flakyProbeDB struct {
+	*mockprobedb.Service
+	down       int32
+	rejectSlot uint32
+}
+
+func newFlakyProbeDB() *flakyProbeDB {
+	return &flakyProbeDB{
+		Service:    mockprobedb.New(),
+		rejectSlot: 99,
+	}
+}
+
+func (s *flakyProbeDB) setDown(down bool) {
+	if down {
+		atomic.StoreInt32(&s.down, 1)
+	} else {
+		atomic.StoreInt32(&s.down, 0)
+	}
+}
+
+func (s *flakyProbeDB) unavailable() bool {
+	return atomic.LoadInt32(&s.down) == 1
+}
+
+func (s *flakyProbeDB) SetBlockDelay(ctx context.Context, delay *probedb.Delay) (probedb.Action, error) {
+	if s.unavailable() {
+		return probedb.ActionCreated, errUnavailable
+	}
+	if delay.Slot == s.rejectSlot {
+		return probedb.ActionCreated, errRejected
+	}
+	return s.Service.SetBlockDelay(ctx, delay)
+}
+
+func (s *flakyProbeDB) SetHeadDelay(ctx context.Context, delay *probedb.Delay) (probedb.Action, error) {
+	if s.unavailable() {
+		return probedb.ActionCreated, errUnavailable
+	}
+	return s.Service.SetHeadDelay(ctx, delay)
+}
+
+func (s *flakyProbeDB) SetBlockDelays(ctx context.Context, delays []*probedb.Delay) error {
+	if s.unavailable() {
+		return errUnavailable
+	}
+	return s.Service.SetBlockDelays(ctx, delays)
+}
+
+func (s *flakyProbeDB) Metadata(ctx context.Context, key string) ([]byte, error) {
+	if s.unavailable() {
+		return nil, errUnavailable
+	}
+	return s.Service.Metadata(ctx, key)
+}
+
+func (s *flakyProbeDB) blockDelays(ctx context.Context) int {
+	delays, err := s.Service.BlockDelays(ctx, &probedb.DelayFilter{Selection: probedb.SelectionAll})
+	if err != nil {
+		return -1
+	}
+	return len(delays)
+}
+
+func (s *flakyProbeDB) headDelays(ctx context.Context) int {
+	delays, err := s.Service.HeadDelays(ctx, &probedb.DelayFilter{Selection: probedb.SelectionAll})
+	if err != nil {
+		return -1
+	}
+	return len(delays)
+}
+
+// segments returns the number of segment files in the directory.
+func segments(t *testing.T, dir string) int {
+	t.Helper()
+
+	segments, err := filepath.Glob(filepath.Join(dir, "*.spool"))
+	require.NoError(t, err)
+	return len(segments)
+}
+
+func TestService(t *testing.T) {
+	ctx, cancel := context.WithCancel(context.Background())
+	defer cancel()
+
+	tests := []struct {
+		name   string
+		params []spooled.Parameter
+		err    string
+	}{
+		{
+			name: "MonitorMissing",
+			params: []spooled.Parameter{
+				spooled.WithLogLevel(zerolog.Disabled),
+				spooled.WithMonitor(nil),
+				spooled.WithProbeDB(newFlakyProbeDB()),
+				spooled.WithDir(t.TempDir()),
+			},
+			err: "problem with parameters: no monitor specified",
+		},
+		{
+			name: "ProbeDBMissing",
+			params: []spooled.Parameter{
+				spooled.WithLogLevel(zerolog.Disabled),
+				spooled.WithDir(t.TempDir()),
+			},
+			err: "problem with parameters: no probe database specified",
+		},
+		{
+			name: "DirMissing",
+			params: []spooled.Parameter{
+				spooled.WithLogLevel(zerolog.Disabled),
+				spooled.WithProbeDB(newFlakyProbeDB()),
+			},
+			err: "problem with parameters: no spool directory specified",
+		},
+		{
+			name: "SegmentSizeTooLarge",
+			params: []spooled.Parameter{
+				spooled.WithLogLevel(zerolog.Disabled),
+				spooled.WithProbeDB(newFlakyProbeDB()),
+				spooled.WithDir(t.TempDir()),
+				spooled.WithSegmentSize(2048),
+				spooled.WithMaxSize(1024),
+			},
+			err: "problem with parameters: segment size cannot be larger than maximum size",
+		},
+		{
+			name: "ReplayIntervalZero",
+			params: []spooled.Parameter{
+				spooled.WithLogLevel(zerolog.Disabled),
+				spooled.WithProbeDB(newFlakyProbeDB()),
+				spooled.WithDir(t.TempDir()),
+				spooled.WithReplayInterval(0),
+			},
+			err: "problem with parameters: replay interval must be positive",
+		},
+		{
+			name: "Good",
+			params: []spooled.Parameter{
+				spooled.WithLogLevel(zerolog.Disabled),
+				spooled.WithProbeDB(newFlakyProbeDB()),
+				spooled.WithDir(filepath.Join(t.TempDir(), "spool")),
+			},
+		},
+	}
+
+	for _, test := range tests {
+		t.Run(test.name, func(t *testing.T) {
+			_, err := spooled.New(ctx, test.params...)
+			if test.err != "" {
+				require.EqualError(t, err, test.err)
+			} else {
+				require.NoError(t, err)
+			}
+		})
+	}
+}
+
+func TestSpoolAndReplay(t *testing.T) {
+	ctx, cancel := context.WithCancel(context.Background())
+	defer cancel()
+
+	dir := t.TempDir()
+	probeDB := newFlakyProbeDB()
+	s, err := spooled.New(ctx,
+		spooled.WithLogLevel(zerolog.Disabled),
+		spooled.WithProbeDB(probeDB),
+		spooled.WithDir(dir),
+		spooled.WithReplayInterval(20*time.Millisecond),
+	)
+	require.NoError(t, err)
+
+	// Written directly whilst the database is available.
+	action, err := s.SetBlockDelay(ctx, &probedb.Delay{Slot: 1})
+	require.NoError(t, err)
+	require.Equal(t, probedb.ActionCreated, action)
+	require.Equal(t, 0, segments(t, dir))
+
+	// Spooled whilst the database is unavailable.
+	probeDB.setDown(true)
+	action, err = s.SetBlockDelay(ctx, &probedb.Delay{Slot: 2})
+	require.NoError(t, err)
+	require.Equal(t, probedb.ActionQueued, action)
+	action, err = s.SetHeadDelay(ctx, &probedb.Delay{Slot: 2})
+	require.NoError(t, err)
+	require.Equal(t, probedb.ActionQueued, action)
+	require.NoError(t, s.SetBlockDelays(ctx, []*probedb.Delay{{Slot: 3}, {Slot: 4}}))
+	require.NotZero(t, segments(t, dir))
+
+	// Replayed once the database is available again.
+	probeDB.setDown(false)
+	require.Eventually(t, func() bool {
+		return probeDB.blockDelays(ctx) == 4 && probeDB.headDelays(ctx) == 1 && segments(t, dir) == 0
+	}, time.Second, 10*time.Millisecond)
+
+	// Written directly once the spool is empty.
+	action, err = s.SetBlockDelay(ctx, &probedb.Delay{Slot: 5})
+	require.NoError(t, err)
+	require.Equal(t, probedb.ActionCreated, action)
+}
+
+func TestSpoolFull(t *testing.T) {
+	ctx, cancel := context.WithCancel(context.Background())
+	defer cancel()
+
+	probeDB := newFlakyProbeDB()
+	probeDB.setDown(true)
+	s, err := spooled.New(ctx,
+		spooled.WithLogLevel(zerolog.Disabled),
+		spooled.WithProbeDB(probeDB),
+		spooled.WithDir(t.TempDir()),
+		spooled.WithSegmentSize(100),
+		spooled.WithMaxSize(150),
+		spooled.WithReplayInterval(time.Hour),
+	)
+	require.NoError(t, err)
+
+	_, err = s.SetBlockDelay(ctx, &probedb.Delay{Slot: 1})
+	require.NoError(t, err)
+	_, err = s.SetBlockDelay(ctx, &probedb.Delay{Slot: 2})
+	require.ErrorIs(t, err, spooled.ErrSpoolFull)
+}
+
+func TestSegments(t *testing.T) {
+	ctx, cancel := context.WithCancel(context.Background())
+	defer cancel()
+
+	dir := t.TempDir()
+	probeDB := newFlakyProbeDB()
+	probeDB.setDown(true)
+	s, err := spooled.New(ctx,
+		spooled.WithLogLevel(zerolog.Disabled),
+		spooled.WithProbeDB(probeDB),
+		spooled.WithDir(dir),
+		spooled.WithSegmentSize(100),
+		spooled.WithReplayInterval(time.Hour),
+	)
+	require.NoError(t, err)
+
+	for i := 0; i < 3; i++ {
+		_, err = s.SetBlockDelay(ctx, &probedb.Delay{Slot: uint32(i)})
+		require.NoError(t, err)
+	}
+	require.Equal(t, 3, segments(t, dir))
+}
+
+func TestReplayOnRestart(t *testing.T) {
+	ctx, cancel := context.WithCancel(context.Background())
+
+	dir := t.TempDir()
+	probeDB := newFlakyProbeDB()
+	probeDB.setDown(true)
+	s, err := spooled.New(ctx,
+		spooled.WithLogLevel(zerolog.Disabled),
+		spooled.WithProbeDB(probeDB),
+		spooled.WithDir(dir),
+		spooled.WithReplayInterval(time.Hour),
+	)
+	require.NoError(t, err)
+	for i := 0; i < 3; i++ {
+		_, err = s.SetBlockDelay(ctx, &probedb.Delay{Slot: uint32(i)})
+		require.NoError(t, err)
+	}
+	cancel()
+
+	// Simulate a partial record written as the process stopped.
+	segmentFiles, err := filepath.Glob(filepath.Join(dir, "*.spool"))
+	require.NoError(t, err)
+	require.NotEmpty(t, segmentFiles)
+	f, err := os.OpenFile(segmentFiles[len(segmentFiles)-1], os.O_APPEND|os.O_WRONLY, 0o600)
+	require.NoError(t, err)
+	_, err = f.WriteString(`{"block_delay":{"Sl`)
+	require.NoError(t, err)
+	require.NoError(t, f.Close())
+
+	ctx, cancel = context.WithCancel(context.Background())
+	defer cancel()
+	probeDB.setDown(false)
+	_, err = spooled.New(ctx,
+		spooled.WithLogLevel(zerolog.Disabled),
+		spooled.WithProbeDB(probeDB),
+		spooled.WithDir(dir),
+		spooled.WithReplayInterval(time.Hour),
+	)
+	require.NoError(t, err)
+	require.Eventually(t, func() bool {
+		return probeDB.blockDelays(ctx) == 3 && segments(t, dir) == 0
+	}, time.Second, 10*time.Millisecond)
+}
+
+func TestReplayDropsRejected(t *testing.T) {
+	ctx, cancel := context.WithCancel(context.Background())
+	defer cancel()
+
+	dir := t.TempDir()
+	probeDB := newFlakyProbeDB()
+	s, err := spooled.New(ctx,
+		spooled.WithLogLevel(zerolog.Disabled),
+		spooled.WithProbeDB(probeDB),
+		spooled.WithDir(dir),
+		spooled.WithReplayInterval(20*time.Millisecond),
+	)
+	require.NoError(t, err)
+
+	// The record is spooled whilst the database is unavailable, and subsequently
+	// dropped as the database rejects it.
+	probeDB.setDown(true)
+	action, err := s.SetBlockDelay(ctx, &probedb.Delay{Slot: probeDB.rejectSlot})
+	require.NoError(t, err)
+	require.Equal(t, probedb.ActionQueued, action)
+	_, err = s.SetBlockDelay(ctx, &probedb.Delay{Slot: 1})
+	require.NoError(t, err)
+	probeDB.setDown(false)
+
+	require.Eventually(t, func() bool {
+		return probeDB.blockDelays(ctx) == 1 && segments(t, dir) == 0
+	}, time.Second, 10*time.Millisecond)
+}
+
+func TestRejectedNotSpooled(t *testing.T) {
+	ctx, cancel := context.WithCancel(context.Background())
+	defer cancel()
+
+	dir := t.TempDir()
+	probeDB := newFlakyProbeDB()
+	s, err := spooled.New(ctx,
+		spooled.WithLogLevel(zerolog.Disabled),
+		spooled.WithProbeDB(probeDB),
+		spooled.WithDir(dir),
+		spooled.WithReplayInterval(time.Hour),
+	)
+	require.NoError(t, err)
+
+	// A record rejected by an available database would be rejected again on replay.
+	_, err = s.SetBlockDelay(ctx, &probedb.Delay{Slot: probeDB.rejectSlot})
+	require.ErrorIs(t, err, errRejected)
+	require.Equal(t, 0, segments(t, dir))
+}
+
+func TestTransactionNotSpooled(t *testing.T) {
+	ctx, cancel := context.WithCancel(context.Background())
+	defer cancel()
+
+	dir := t.TempDir()
+	probeDB := newFlakyProbeDB()
+	s, err := spooled.New(ctx,
+		spooled.WithLogLevel(zerolog.Disabled),
+		spooled.WithProbeDB(probeDB),
+		spooled.WithDir(dir),
+		spooled.WithReplayInterval(time.Hour),
+	)
+	require.NoError(t, err)
+
+	// Records within a transaction are not spooled, as the transaction may be rolled back.
+	txCtx, txCancel, err := s.BeginTx(ctx)
+	require.NoError(t, err)
+	defer txCancel()
+	probeDB.setDown(true)
+	_, err = s.SetBlockDelay(txCtx, &probedb.Delay{Slot: 1})
+	require.ErrorIs(t, err, errUnavailable)
+	require.ErrorIs(t, s.SetBlockDelays(txCtx, []*probedb.Delay{{Slot: 2}}), errUnavailable)
+	require.Equal(t, 0, segments(t, dir))
+}
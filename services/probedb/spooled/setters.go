@@ -0,0 +1,194 @@
+// Copyright © 2023 Weald Technology Trading.
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package spooled
+
+import (
+	"context"
+
+	"github.com/pkg/errors"
+	"github.com/wealdtech/probed/services/probedb"
+	"github.com/wealdtech/probed/services/probedb/resilient"
+)
+
+// SetBlockDelay sets a block delay, spooling it if it cannot be written.
+func (s *Service) SetBlockDelay(ctx context.Context, delay *probedb.Delay) (probedb.Action, error) {
+	return s.set(ctx, &record{BlockDelay: delay})
+}
+
+// SetHeadDelay sets a head delay, spooling it if it cannot be written.
+func (s *Service) SetHeadDelay(ctx context.Context, delay *probedb.Delay) (probedb.Action, error) {
+	return s.set(ctx, &record{HeadDelay: delay})
+}
+
+// SetAggregateAttestation sets an aggregate attestation, spooling it if it cannot be written.
+func (s *Service) SetAggregateAttestation(ctx context.Context, aggregateAttestation *probedb.AggregateAttestation) (probedb.Action, error) {
+	return s.set(ctx, &record{AggregateAttestation: aggregateAttestation})
+}
+
+// SetAttestationSummary sets an attestation summary, spooling it if it cannot be written.
+func (s *Service) SetAttestationSummary(ctx context.Context, summary *probedb.AttestationSummary) (probedb.Action, error) {
+	return s.set(ctx, &record{AttestationSummary: summary})
+}
+
+// SetBlockDelays sets multiple block delays, spooling them if they cannot be written.
+func (s *Service) SetBlockDelays(ctx context.Context, delays []*probedb.Delay) error {
+	records := make([]*record, len(delays))
+	for i := range delays {
+		records[i] = &record{BlockDelay: delays[i]}
+	}
+
+	return s.setBulk(ctx, records, func() error {
+		if bulkSetter, isBulkSetter := s.probeDB.(probedb.BlockDelaysBulkSetter); isBulkSetter {
+			return bulkSetter.SetBlockDelays(ctx, delays)
+		}
+		return s.writeAll(ctx, records)
+	})
+}
+
+// SetHeadDelays sets multiple head delays, spooling them if they cannot be written.
+func (s *Service) SetHeadDelays(ctx context.Context, delays []*probedb.Delay) error {
+	records := make([]*record, len(delays))
+	for i := range delays {
+		records[i] = &record{HeadDelay: delays[i]}
+	}
+
+	return s.setBulk(ctx, records, func() error {
+		if bulkSetter, isBulkSetter := s.probeDB.(probedb.HeadDelaysBulkSetter); isBulkSetter {
+			return bulkSetter.SetHeadDelays(ctx, delays)
+		}
+		return s.writeAll(ctx, records)
+	})
+}
+
+// SetAggregateAttestations sets multiple aggregate attestations, spooling them if they cannot be written.
+func (s *Service) SetAggregateAttestations(ctx context.Context, aggregateAttestations []*probedb.AggregateAttestation) error {
+	records := make([]*record, len(aggregateAttestations))
+	for i := range aggregateAttestations {
+		records[i] = &record{AggregateAttestation: aggregateAttestations[i]}
+	}
+
+	return s.setBulk(ctx, records, func() error {
+		if bulkSetter, isBulkSetter := s.probeDB.(probedb.AggregateAttestationsBulkSetter); isBulkSetter {
+			return bulkSetter.SetAggregateAttestations(ctx, aggregateAttestations)
+		}
+		return s.writeAll(ctx, records)
+	})
+}
+
+// SetAttestationSummaries sets multiple attestation summaries, spooling them if they cannot be written.
+func (s *Service) SetAttestationSummaries(ctx context.Context, summaries []*probedb.AttestationSummary) error {
+	records := make([]*record, len(summaries))
+	for i := range summaries {
+		records[i] = &record{AttestationSummary: summaries[i]}
+	}
+
+	return s.setBulk(ctx, records, func() error {
+		if bulkSetter, isBulkSetter := s.probeDB.(probedb.AttestationSummariesBulkSetter); isBulkSetter {
+			return bulkSetter.SetAttestationSummaries(ctx, summaries)
+		}
+		return s.writeAll(ctx, records)
+	})
+}
+
+// set writes a record to the underlying database, spooling it if the
+// database is unavailable.
+func (s *Service) set(ctx context.Context, record *record) (probedb.Action, error) {
+	if inTx(ctx) {
+		// Spooled records would be replayed even if the transaction were rolled back.
+		return s.write(ctx, record)
+	}
+
+	if !s.isSpooling() {
+		action, err := s.write(ctx, record)
+		if err == nil || ctx.Err() != nil || !spoolable(err) {
+			return action, err
+		}
+		log.Warn().Err(err).Msg("Failed to write record; spooling")
+	}
+
+	if err := s.append(record); err != nil {
+		return probedb.ActionCreated, err
+	}
+
+	return probedb.ActionQueued, nil
+}
+
+// setBulk writes records to the underlying database, spooling them if the
+// database is unavailable.
+func (s *Service) setBulk(ctx context.Context, records []*record, write func() error) error {
+	if inTx(ctx) {
+		// Spooled records would be replayed even if the transaction were rolled back.
+		return write()
+	}
+
+	if !s.isSpooling() {
+		err := write()
+		if err == nil || ctx.Err() != nil || !spoolable(err) {
+			return err
+		}
+		log.Warn().Err(err).Int("records", len(records)).Msg("Failed to write records; spooling")
+	}
+
+	for _, record := range records {
+		if err := s.append(record); err != nil {
+			return err
+		}
+	}
+
+	return nil
+}
+
+// write writes a record to the underlying database.
+func (s *Service) write(ctx context.Context, record *record) (probedb.Action, error) {
+	switch {
+	case record.BlockDelay != nil:
+		return s.blockDelaysSetter.SetBlockDelay(ctx, record.BlockDelay)
+	case record.HeadDelay != nil:
+		return s.headDelaysSetter.SetHeadDelay(ctx, record.HeadDelay)
+	case record.AggregateAttestation != nil:
+		return s.aggregateAttestationsSetter.SetAggregateAttestation(ctx, record.AggregateAttestation)
+	default:
+		return s.attestationSummariesSetter.SetAttestationSummary(ctx, record.AttestationSummary)
+	}
+}
+
+// writeAll writes records to the underlying database one at a time.
+func (s *Service) writeAll(ctx context.Context, records []*record) error {
+	for _, record := range records {
+		if _, err := s.write(ctx, record); err != nil {
+			return err
+		}
+	}
+
+	return nil
+}
+
+// inTx returns true if the context holds a transaction begun by this service.
+func inTx(ctx context.Context) bool {
+	_, inTx := ctx.Value(txContextKey{}).(bool)
+
+	return inTx
+}
+
+// spoolable returns true if the error shows that the database is unavailable,
+// in which case the write may succeed later.
+// Other errors, such as constraint violations, would fail again on replay.
+func spoolable(err error) bool {
+	var unavailableErr *probedb.UnavailableError
+	if errors.As(err, &unavailableErr) {
+		return true
+	}
+
+	return errors.Is(err, context.DeadlineExceeded) || resilient.Transient(err)
+}
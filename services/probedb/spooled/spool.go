@@ -0,0 +1,255 @@
+// Copyright © 2023 Weald Technology Trading.
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package spooled
+
+import (
+	"bufio"
+	"bytes"
+	"encoding/json"
+	"fmt"
+	"io"
+	"os"
+	"path/filepath"
+	"sort"
+	"strconv"
+	"strings"
+
+	"github.com/pkg/errors"
+)
+
+// segmentSuffix is the suffix of spool segment files.
+const segmentSuffix = ".spool"
+
+// open creates the spool directory if required, and accounts for any segments
+// that are already present.
+func (s *Service) open() error {
+	if err := os.MkdirAll(s.dir, 0o700); err != nil {
+		return errors.Wrap(err, "failed to create spool directory")
+	}
+
+	segments, err := s.segments()
+	if err != nil {
+		return err
+	}
+	for _, segment := range segments {
+		info, err := os.Stat(segment)
+		if err != nil {
+			return errors.Wrap(err, "failed to obtain segment information")
+		}
+		lines, err := countLines(segment)
+		if err != nil {
+			return err
+		}
+		s.size += info.Size()
+		s.records += lines
+
+		sequence, err := strconv.ParseUint(strings.TrimSuffix(filepath.Base(segment), segmentSuffix), 10, 64)
+		if err != nil {
+			return errors.Wrap(err, fmt.Sprintf("invalid segment name %s", segment))
+		}
+		if sequence >= s.nextSegment {
+			s.nextSegment = sequence + 1
+		}
+	}
+	if len(segments) > 0 {
+		log.Info().Int("segments", len(segments)).Int("records", s.records).Msg("Found existing spool segments")
+	}
+	setSpoolDepth(s.records, s.size)
+
+	return nil
+}
+
+// segments returns the paths of the segment files, oldest first.
+func (s *Service) segments() ([]string, error) {
+	segments, err := filepath.Glob(filepath.Join(s.dir, "*"+segmentSuffix))
+	if err != nil {
+		return nil, errors.Wrap(err, "failed to list spool segments")
+	}
+	// Segment names are zero-padded sequence numbers, so sort in order of creation.
+	sort.Strings(segments)
+
+	return segments, nil
+}
+
+// append appends a record to the active segment, starting a new segment if required.
+// Once a record has been appended, records are spooled without first attempting to
+// write them to the underlying database until the spool has been replayed.
+func (s *Service) append(record *record) error {
+	data, err := json.Marshal(record)
+	if err != nil {
+		return errors.Wrap(err, "failed to marshal record")
+	}
+	data = append(data, '\n')
+
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	if s.size+int64(len(data)) > s.maxSize {
+		recordsSpooled("rejected")
+		return ErrSpoolFull
+	}
+
+	if s.active != nil && s.activeSize+int64(len(data)) > s.segmentSize {
+		if err := s.closeActive(); err != nil {
+			return err
+		}
+	}
+	if s.active == nil {
+		path := filepath.Join(s.dir, fmt.Sprintf("%020d%s", s.nextSegment, segmentSuffix))
+		s.active, err = os.OpenFile(path, os.O_CREATE|os.O_EXCL|os.O_WRONLY|os.O_APPEND, 0o600)
+		if err != nil {
+			return errors.Wrap(err, "failed to create spool segment")
+		}
+		s.nextSegment++
+		s.activeSize = 0
+		log.Trace().Str("segment", path).Msg("Started spool segment")
+	}
+
+	if _, err := s.active.Write(data); err != nil {
+		recordsSpooled("failed")
+		return errors.Wrap(err, "failed to write to spool segment")
+	}
+	if err := s.active.Sync(); err != nil {
+		recordsSpooled("failed")
+		return errors.Wrap(err, "failed to sync spool segment")
+	}
+	s.activeSize += int64(len(data))
+	s.size += int64(len(data))
+	s.records++
+	s.spooling = true
+	recordsSpooled("succeeded")
+	setSpoolDepth(s.records, s.size)
+
+	return nil
+}
+
+// closeActive closes the active segment, so that the next record starts a new segment.
+// The caller must hold the lock.
+func (s *Service) closeActive() error {
+	if s.active == nil {
+		return nil
+	}
+	if err := s.active.Close(); err != nil {
+		return errors.Wrap(err, "failed to close spool segment")
+	}
+	s.active = nil
+
+	return nil
+}
+
+// seal closes the active segment and returns all segments, which will no
+// longer be appended to.
+// If there are no segments then the spool is empty and records are once
+// again written to the underlying database.
+func (s *Service) seal() ([]string, error) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	if err := s.closeActive(); err != nil {
+		return nil, err
+	}
+	segments, err := s.segments()
+	if err != nil {
+		return nil, err
+	}
+	if len(segments) == 0 && s.spooling {
+		log.Info().Msg("Spool empty; resuming writes to database")
+		s.spooling = false
+	}
+
+	return segments, nil
+}
+
+// isSpooling returns true if records are being written straight to the spool.
+func (s *Service) isSpooling() bool {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	return s.spooling
+}
+
+// removeSegment removes a segment that has been replayed.
+func (s *Service) removeSegment(segment string, lines int, size int64) error {
+	if err := os.Remove(segment); err != nil {
+		return errors.Wrap(err, "failed to remove spool segment")
+	}
+
+	s.mu.Lock()
+	s.size -= size
+	s.records -= lines
+	setSpoolDepth(s.records, s.size)
+	s.mu.Unlock()
+
+	return nil
+}
+
+// readSegment reads the records from a segment, returning the records and
+// the number of lines in the segment.
+// Lines that cannot be decoded, for example a partial record written when
+// the process stopped, are skipped.
+func readSegment(segment string) ([]*record, int, error) {
+	f, err := os.Open(segment)
+	if err != nil {
+		return nil, 0, errors.Wrap(err, "failed to open spool segment")
+	}
+	defer f.Close()
+
+	records := make([]*record, 0)
+	lines := 0
+	reader := bufio.NewReader(f)
+	for {
+		line, err := reader.ReadBytes('\n')
+		if len(line) > 0 {
+			lines++
+			record := &record{}
+			if err := json.Unmarshal(bytes.TrimSpace(line), record); err != nil {
+				log.Warn().Str("segment", segment).Int("line", lines).Err(err).Msg("Invalid record in spool segment; skipping")
+			} else {
+				records = append(records, record)
+			}
+		}
+		if errors.Is(err, io.EOF) {
+			break
+		}
+		if err != nil {
+			return nil, 0, errors.Wrap(err, "failed to read spool segment")
+		}
+	}
+
+	return records, lines, nil
+}
+
+// countLines counts the lines in a segment.
+func countLines(segment string) (int, error) {
+	f, err := os.Open(segment)
+	if err != nil {
+		return 0, errors.Wrap(err, "failed to open spool segment")
+	}
+	defer f.Close()
+
+	lines := 0
+	reader := bufio.NewReader(f)
+	for {
+		line, err := reader.ReadBytes('\n')
+		if len(line) > 0 {
+			lines++
+		}
+		if errors.Is(err, io.EOF) {
+			return lines, nil
+		}
+		if err != nil {
+			return 0, errors.Wrap(err, "failed to read spool segment")
+		}
+	}
+}
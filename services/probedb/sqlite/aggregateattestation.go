@@ -0,0 +1,185 @@
+// Copyright © 2023 Weald Technology Trading.
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package sqlite
+
+import (
+	"context"
+	"database/sql"
+	"fmt"
+
+	"github.com/pkg/errors"
+	"github.com/wealdtech/probed/services/probedb"
+)
+
+// SetAggregateAttestation sets an aggregate attestation.
+// If the aggregate attestation already exists then the aggregate attestation conflict policy is applied.
+func (s *Service) SetAggregateAttestation(ctx context.Context, aggregateAttestation *probedb.AggregateAttestation) (probedb.Action, error) {
+	action := probedb.ActionCreated
+	err := s.withTx(ctx, func(tx *sql.Tx) error {
+		res, err := tx.ExecContext(ctx, `
+INSERT INTO t_aggregate_attestations(f_ip_addr
+                                    ,f_source
+                                    ,f_method
+                                    ,f_slot
+                                    ,f_committee_index
+                                    ,f_aggregation_bits
+                                    ,f_beacon_block_root
+                                    ,f_source_root
+                                    ,f_target_root
+                                    ,f_delay
+                                    ,f_prober
+                                    )
+VALUES(?,?,?,?,?,?,?,?,?,?,?)
+ON CONFLICT (f_ip_addr, f_source, f_method, f_slot, f_committee_index, f_aggregation_bits) DO NOTHING
+`,
+			ipAddrString(aggregateAttestation.IPAddr),
+			aggregateAttestation.Source,
+			aggregateAttestation.Method,
+			aggregateAttestation.Slot,
+			aggregateAttestation.CommitteeIndex,
+			aggregateAttestation.AggregationBits,
+			aggregateAttestation.BeaconBlockRoot,
+			aggregateAttestation.SourceRoot,
+			aggregateAttestation.TargetRoot,
+			aggregateAttestation.DelayMS,
+			aggregateAttestation.Prober,
+		)
+		if err != nil {
+			return err
+		}
+		rowsAffected, err := res.RowsAffected()
+		if err != nil {
+			return err
+		}
+		if rowsAffected == 0 {
+			action, err = applyConflictPolicy(ctx, tx, "t_aggregate_attestations", s.conflictPolicies.AggregateAttestations,
+				[]*column{
+					{name: "f_ip_addr", value: ipAddrString(aggregateAttestation.IPAddr)},
+					{name: "f_source", value: aggregateAttestation.Source},
+					{name: "f_method", value: aggregateAttestation.Method},
+					{name: "f_slot", value: aggregateAttestation.Slot},
+					{name: "f_committee_index", value: aggregateAttestation.CommitteeIndex},
+					{name: "f_aggregation_bits", value: aggregateAttestation.AggregationBits},
+				},
+				[]*column{
+					{name: "f_beacon_block_root", value: aggregateAttestation.BeaconBlockRoot},
+					{name: "f_source_root", value: aggregateAttestation.SourceRoot},
+					{name: "f_target_root", value: aggregateAttestation.TargetRoot},
+					{name: "f_delay", value: aggregateAttestation.DelayMS},
+					{name: "f_prober", value: aggregateAttestation.Prober},
+				},
+			)
+		}
+		return err
+	})
+
+	return action, err
+}
+
+// AggregateAttestations obtains the aggregate attestations for a filter.
+func (s *Service) AggregateAttestations(ctx context.Context, filter *probedb.AggregateAttestationFilter) ([]*probedb.AggregateAttestation, error) {
+	aggregateAttestations := make([]*probedb.AggregateAttestation, 0)
+	if err := s.StreamAggregateAttestations(ctx, filter, func(aggregateAttestation *probedb.AggregateAttestation) error {
+		aggregateAttestations = append(aggregateAttestations, aggregateAttestation)
+		return nil
+	}); err != nil {
+		return nil, err
+	}
+
+	return aggregateAttestations, nil
+}
+
+// StreamAggregateAttestations calls the handler with each aggregate attestation for a filter.
+func (s *Service) StreamAggregateAttestations(ctx context.Context, filter *probedb.AggregateAttestationFilter, handler func(*probedb.AggregateAttestation) error) error {
+	tx := s.tx(ctx)
+	if tx == nil {
+		ctx, cancel, err := s.BeginTx(ctx)
+		if err != nil {
+			return errors.Wrap(err, "failed to begin transaction")
+		}
+		tx = s.tx(ctx)
+		defer cancel()
+	}
+
+	direction, err := orderDirection(filter.Order)
+	if err != nil {
+		return err
+	}
+	cursor, err := probedb.ParseAggregateAttestationCursor(filter.Cursor)
+	if err != nil {
+		return err
+	}
+	conditions := filterConditions(filter.IPAddr, filter.Prober, filter.Sources, filter.Methods, filter.From, filter.To)
+	conditions.addCursor(cursor, filter.Order)
+	query := fmt.Sprintf(`
+SELECT f_ip_addr
+      ,f_prober
+      ,f_source
+      ,f_method
+      ,f_slot
+      ,f_committee_index
+      ,f_aggregation_bits
+      ,f_beacon_block_root
+      ,f_source_root
+      ,f_target_root
+      ,f_delay
+FROM t_aggregate_attestations%s
+ORDER BY f_slot%s`, conditions.where(), direction)
+	logQuery(query, conditions.vals)
+
+	rows, err := tx.QueryContext(ctx, query, conditions.vals...)
+	if err != nil {
+		return err
+	}
+	defer rows.Close()
+
+	// IP addresses are stored as text, so cannot be ordered by the query.
+	batcher := newSlotBatcher(filter.Order, cursor, filter.Limit)
+	for rows.Next() {
+		if err := ctx.Err(); err != nil {
+			return err
+		}
+		aggregateAttestation := &probedb.AggregateAttestation{}
+		var ipAddr string
+		err := rows.Scan(
+			&ipAddr,
+			&aggregateAttestation.Prober,
+			&aggregateAttestation.Source,
+			&aggregateAttestation.Method,
+			&aggregateAttestation.Slot,
+			&aggregateAttestation.CommitteeIndex,
+			&aggregateAttestation.AggregationBits,
+			&aggregateAttestation.BeaconBlockRoot,
+			&aggregateAttestation.SourceRoot,
+			&aggregateAttestation.TargetRoot,
+			&aggregateAttestation.DelayMS,
+		)
+		if err != nil {
+			return errors.Wrap(err, "failed to scan row")
+		}
+		aggregateAttestation.IPAddr = parseIPAddr(ipAddr)
+		done, err := batcher.add(ctx, probedb.AggregateAttestationPosition(aggregateAttestation), func() error { return handler(aggregateAttestation) })
+		if err != nil {
+			return err
+		}
+		if done {
+			break
+		}
+	}
+	if err := rows.Err(); err != nil {
+		return err
+	}
+
+	return batcher.flush(ctx)
+}
@@ -0,0 +1,95 @@
+// Copyright © 2023 Weald Technology Trading.
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package sqlite_test
+
+import (
+	"context"
+	"testing"
+
+	"github.com/stretchr/testify/require"
+	"github.com/wealdtech/probed/services/probedb"
+)
+
+func TestAggregateAttestations(t *testing.T) {
+	ctx, cancel := context.WithCancel(context.Background())
+	defer cancel()
+	s := newService(ctx, t)
+
+	aggregateAttestations := []*probedb.AggregateAttestation{
+		{IPAddr: parseIP("1.2.3.4"), Prober: "prober1", Source: "Source 1", Method: "Method 1", Slot: 12345, CommitteeIndex: 1, AggregationBits: []byte{0x01, 0x10}, BeaconBlockRoot: []byte{0x01}, SourceRoot: []byte{0x02}, TargetRoot: []byte{0x03}, DelayMS: 1123},
+		{IPAddr: parseIP("1.2.3.4"), Prober: "prober1", Source: "Source 1", Method: "Method 1", Slot: 12346, CommitteeIndex: 1, AggregationBits: []byte{0x01, 0x10}, BeaconBlockRoot: []byte{0x01}, SourceRoot: []byte{0x02}, TargetRoot: []byte{0x03}, DelayMS: 1345},
+		{IPAddr: parseIP("5.6.7.8"), Source: "Source 2", Method: "Method 2", Slot: 12347, CommitteeIndex: 2, AggregationBits: []byte{0x03}, BeaconBlockRoot: []byte{0x04}, SourceRoot: []byte{0x05}, TargetRoot: []byte{0x06}, DelayMS: 1456},
+	}
+
+	for _, aggregateAttestation := range aggregateAttestations {
+		action, err := s.SetAggregateAttestation(ctx, aggregateAttestation)
+		require.NoError(t, err)
+		require.Equal(t, probedb.ActionCreated, action)
+	}
+	action, err := s.SetAggregateAttestation(ctx, aggregateAttestations[0])
+	require.NoError(t, err)
+	require.Equal(t, probedb.ActionIgnored, action)
+
+	tests := []struct {
+		name   string
+		filter *probedb.AggregateAttestationFilter
+		res    []*probedb.AggregateAttestation
+	}{
+		{
+			name:   "All",
+			filter: &probedb.AggregateAttestationFilter{},
+			res:    aggregateAttestations,
+		},
+		{
+			name: "SingleSource",
+			filter: &probedb.AggregateAttestationFilter{
+				Sources: []string{"Source 1"},
+			},
+			res: []*probedb.AggregateAttestation{
+				aggregateAttestations[0],
+				aggregateAttestations[1],
+			},
+		},
+		{
+			name: "MultipleMethods",
+			filter: &probedb.AggregateAttestationFilter{
+				Methods: []string{"Method 1", "Method 2"},
+				To:      slotPtr(12346),
+			},
+			res: []*probedb.AggregateAttestation{
+				aggregateAttestations[0],
+				aggregateAttestations[1],
+			},
+		},
+		{
+			name: "LatestLimit",
+			filter: &probedb.AggregateAttestationFilter{
+				Order: probedb.OrderLatest,
+				Limit: 2,
+			},
+			res: []*probedb.AggregateAttestation{
+				aggregateAttestations[2],
+				aggregateAttestations[1],
+			},
+		},
+	}
+
+	for _, test := range tests {
+		t.Run(test.name, func(t *testing.T) {
+			res, err := s.AggregateAttestations(ctx, test.filter)
+			require.NoError(t, err)
+			require.Equal(t, test.res, res)
+		})
+	}
+}
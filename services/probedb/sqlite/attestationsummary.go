@@ -0,0 +1,247 @@
+// Copyright © 2023 Weald Technology Trading.
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package sqlite
+
+import (
+	"context"
+	"database/sql"
+	"encoding/json"
+	"fmt"
+
+	"github.com/pkg/errors"
+	"github.com/wealdtech/probed/services/probedb"
+)
+
+// SetAttestationSummary sets an attestation summary.
+// If the attestation summary already exists then the attestation summary conflict policy is applied.
+func (s *Service) SetAttestationSummary(ctx context.Context, summary *probedb.AttestationSummary) (probedb.Action, error) {
+	attesterBuckets, err := json.Marshal(summary.AttesterBuckets)
+	if err != nil {
+		return probedb.ActionCreated, errors.Wrap(err, "failed to marshal attester buckets")
+	}
+
+	action := probedb.ActionCreated
+	err = s.withTx(ctx, func(tx *sql.Tx) error {
+		res, err := tx.ExecContext(ctx, `
+INSERT INTO t_attestation_summaries(f_ip_addr
+                                   ,f_source
+                                   ,f_method
+                                   ,f_slot
+                                   ,f_committee_index
+                                   ,f_beacon_block_root
+                                   ,f_source_root
+                                   ,f_target_root
+                                   ,f_attester_buckets
+                                   ,f_prober
+                                   )
+VALUES(?,?,?,?,?,?,?,?,?,?)
+ON CONFLICT (f_ip_addr, f_source, f_method, f_slot, f_committee_index, f_beacon_block_root, f_source_root, f_target_root) DO NOTHING
+`,
+			ipAddrString(summary.IPAddr),
+			summary.Source,
+			summary.Method,
+			summary.Slot,
+			summary.CommitteeIndex,
+			summary.BeaconBlockRoot,
+			summary.SourceRoot,
+			summary.TargetRoot,
+			string(attesterBuckets),
+			summary.Prober,
+		)
+		if err != nil {
+			return err
+		}
+		rowsAffected, err := res.RowsAffected()
+		if err != nil {
+			return err
+		}
+		if rowsAffected == 0 {
+			action, err = s.resolveAttestationSummaryConflict(ctx, tx, summary, string(attesterBuckets))
+		}
+		return err
+	})
+
+	return action, err
+}
+
+// resolveAttestationSummaryConflict applies the conflict policy to an existing attestation summary.
+func (s *Service) resolveAttestationSummaryConflict(ctx context.Context,
+	tx *sql.Tx,
+	summary *probedb.AttestationSummary,
+	attesterBuckets string,
+) (
+	probedb.Action,
+	error,
+) {
+	keys := []*column{
+		{name: "f_ip_addr", value: ipAddrString(summary.IPAddr)},
+		{name: "f_source", value: summary.Source},
+		{name: "f_method", value: summary.Method},
+		{name: "f_slot", value: summary.Slot},
+		{name: "f_committee_index", value: summary.CommitteeIndex},
+		{name: "f_beacon_block_root", value: summary.BeaconBlockRoot},
+		{name: "f_source_root", value: summary.SourceRoot},
+		{name: "f_target_root", value: summary.TargetRoot},
+	}
+
+	if s.conflictPolicies.AttestationSummaries != probedb.ConflictMerge {
+		return applyConflictPolicy(ctx, tx, "t_attestation_summaries", s.conflictPolicies.AttestationSummaries,
+			keys,
+			[]*column{
+				{name: "f_attester_buckets", value: attesterBuckets},
+				{name: "f_prober", value: summary.Prober},
+			},
+		)
+	}
+
+	var existingBuckets string
+	err := tx.QueryRowContext(ctx, `
+SELECT f_attester_buckets
+FROM t_attestation_summaries
+WHERE f_ip_addr = ?
+  AND f_source = ?
+  AND f_method = ?
+  AND f_slot = ?
+  AND f_committee_index = ?
+  AND f_beacon_block_root = ?
+  AND f_source_root = ?
+  AND f_target_root = ?
+`,
+		ipAddrString(summary.IPAddr),
+		summary.Source,
+		summary.Method,
+		summary.Slot,
+		summary.CommitteeIndex,
+		summary.BeaconBlockRoot,
+		summary.SourceRoot,
+		summary.TargetRoot,
+	).Scan(&existingBuckets)
+	if err != nil {
+		return probedb.ActionIgnored, errors.Wrap(err, "failed to obtain existing attester buckets")
+	}
+	existing := make([][]byte, 0)
+	if err := json.Unmarshal([]byte(existingBuckets), &existing); err != nil {
+		return probedb.ActionIgnored, errors.Wrap(err, "failed to unmarshal existing attester buckets")
+	}
+
+	merged, changed := probedb.MergeAttesterBuckets(existing, summary.AttesterBuckets)
+	if !changed {
+		return probedb.ActionIgnored, nil
+	}
+	mergedBuckets, err := json.Marshal(merged)
+	if err != nil {
+		return probedb.ActionIgnored, errors.Wrap(err, "failed to marshal merged attester buckets")
+	}
+
+	return updateRow(ctx, tx, "t_attestation_summaries", keys, []*column{{name: "f_attester_buckets", value: string(mergedBuckets)}}, "")
+}
+
+// AttestationSummaries obtains the attestation summaries for a filter.
+func (s *Service) AttestationSummaries(ctx context.Context, filter *probedb.AttestationSummaryFilter) ([]*probedb.AttestationSummary, error) {
+	attestationSummaries := make([]*probedb.AttestationSummary, 0)
+	if err := s.StreamAttestationSummaries(ctx, filter, func(attestationSummary *probedb.AttestationSummary) error {
+		attestationSummaries = append(attestationSummaries, attestationSummary)
+		return nil
+	}); err != nil {
+		return nil, err
+	}
+
+	return attestationSummaries, nil
+}
+
+// StreamAttestationSummaries calls the handler with each attestation summary for a filter.
+func (s *Service) StreamAttestationSummaries(ctx context.Context, filter *probedb.AttestationSummaryFilter, handler func(*probedb.AttestationSummary) error) error {
+	tx := s.tx(ctx)
+	if tx == nil {
+		ctx, cancel, err := s.BeginTx(ctx)
+		if err != nil {
+			return errors.Wrap(err, "failed to begin transaction")
+		}
+		tx = s.tx(ctx)
+		defer cancel()
+	}
+
+	direction, err := orderDirection(filter.Order)
+	if err != nil {
+		return err
+	}
+	cursor, err := probedb.ParseAttestationSummaryCursor(filter.Cursor)
+	if err != nil {
+		return err
+	}
+	conditions := filterConditions(filter.IPAddr, filter.Prober, filter.Sources, filter.Methods, filter.From, filter.To)
+	conditions.addCursor(cursor, filter.Order)
+	query := fmt.Sprintf(`
+SELECT f_ip_addr
+      ,f_prober
+      ,f_source
+      ,f_method
+      ,f_slot
+      ,f_committee_index
+      ,f_beacon_block_root
+      ,f_source_root
+      ,f_target_root
+      ,f_attester_buckets
+FROM t_attestation_summaries%s
+ORDER BY f_slot%s`, conditions.where(), direction)
+	logQuery(query, conditions.vals)
+
+	rows, err := tx.QueryContext(ctx, query, conditions.vals...)
+	if err != nil {
+		return err
+	}
+	defer rows.Close()
+
+	// IP addresses are stored as text, so cannot be ordered by the query.
+	batcher := newSlotBatcher(filter.Order, cursor, filter.Limit)
+	for rows.Next() {
+		if err := ctx.Err(); err != nil {
+			return err
+		}
+		attestationSummary := &probedb.AttestationSummary{}
+		var ipAddr string
+		var attesterBuckets string
+		err := rows.Scan(
+			&ipAddr,
+			&attestationSummary.Prober,
+			&attestationSummary.Source,
+			&attestationSummary.Method,
+			&attestationSummary.Slot,
+			&attestationSummary.CommitteeIndex,
+			&attestationSummary.BeaconBlockRoot,
+			&attestationSummary.SourceRoot,
+			&attestationSummary.TargetRoot,
+			&attesterBuckets,
+		)
+		if err != nil {
+			return errors.Wrap(err, "failed to scan row")
+		}
+		attestationSummary.IPAddr = parseIPAddr(ipAddr)
+		if err := json.Unmarshal([]byte(attesterBuckets), &attestationSummary.AttesterBuckets); err != nil {
+			return errors.Wrap(err, "failed to unmarshal attester buckets")
+		}
+		done, err := batcher.add(ctx, probedb.AttestationSummaryPosition(attestationSummary), func() error { return handler(attestationSummary) })
+		if err != nil {
+			return err
+		}
+		if done {
+			break
+		}
+	}
+	if err := rows.Err(); err != nil {
+		return err
+	}
+
+	return batcher.flush(ctx)
+}
@@ -0,0 +1,90 @@
+// Copyright © 2023 Weald Technology Trading.
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package sqlite_test
+
+import (
+	"context"
+	"testing"
+
+	"github.com/stretchr/testify/require"
+	"github.com/wealdtech/probed/services/probedb"
+)
+
+func TestAttestationSummaries(t *testing.T) {
+	ctx, cancel := context.WithCancel(context.Background())
+	defer cancel()
+	s := newService(ctx, t)
+
+	summaries := []*probedb.AttestationSummary{
+		{IPAddr: parseIP("1.2.3.4"), Prober: "prober1", Source: "Source 1", Method: "Method 1", Slot: 12345, CommitteeIndex: 1, BeaconBlockRoot: []byte{0x01}, SourceRoot: []byte{0x02}, TargetRoot: []byte{0x03}, AttesterBuckets: [][]byte{{0x01, 0x02}, {0x03}}},
+		{IPAddr: parseIP("1.2.3.4"), Prober: "prober1", Source: "Source 2", Method: "Method 1", Slot: 12346, CommitteeIndex: 1, BeaconBlockRoot: []byte{0x01}, SourceRoot: []byte{0x02}, TargetRoot: []byte{0x03}, AttesterBuckets: [][]byte{{0x04}}},
+	}
+
+	for _, summary := range summaries {
+		action, err := s.SetAttestationSummary(ctx, summary)
+		require.NoError(t, err)
+		require.Equal(t, probedb.ActionCreated, action)
+	}
+	action, err := s.SetAttestationSummary(ctx, summaries[1])
+	require.NoError(t, err)
+	require.Equal(t, probedb.ActionIgnored, action)
+
+	tests := []struct {
+		name   string
+		filter *probedb.AttestationSummaryFilter
+		res    []*probedb.AttestationSummary
+	}{
+		{
+			name:   "All",
+			filter: &probedb.AttestationSummaryFilter{},
+			res:    summaries,
+		},
+		{
+			name: "Source",
+			filter: &probedb.AttestationSummaryFilter{
+				Sources: []string{"Source 2"},
+			},
+			res: []*probedb.AttestationSummary{
+				summaries[1],
+			},
+		},
+		{
+			name: "From",
+			filter: &probedb.AttestationSummaryFilter{
+				From: slotPtr(12346),
+			},
+			res: []*probedb.AttestationSummary{
+				summaries[1],
+			},
+		},
+		{
+			name: "Latest",
+			filter: &probedb.AttestationSummaryFilter{
+				Order: probedb.OrderLatest,
+				Limit: 1,
+			},
+			res: []*probedb.AttestationSummary{
+				summaries[1],
+			},
+		},
+	}
+
+	for _, test := range tests {
+		t.Run(test.name, func(t *testing.T) {
+			res, err := s.AttestationSummaries(ctx, test.filter)
+			require.NoError(t, err)
+			require.Equal(t, test.res, res)
+		})
+	}
+}
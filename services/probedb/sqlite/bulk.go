@@ -0,0 +1,77 @@
+// Copyright © 2023 Weald Technology Trading.
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package sqlite
+
+import (
+	"context"
+	"database/sql"
+
+	"github.com/wealdtech/probed/services/probedb"
+)
+
+// SetBlockDelays sets multiple block delays.
+// Delays that already exist are subject to the conflict policy.
+func (s *Service) SetBlockDelays(ctx context.Context, delays []*probedb.Delay) error {
+	return s.withTx(ctx, func(tx *sql.Tx) error {
+		ctx := context.WithValue(ctx, &Tx{}, tx)
+		for _, delay := range delays {
+			if _, err := s.SetBlockDelay(ctx, delay); err != nil {
+				return err
+			}
+		}
+		return nil
+	})
+}
+
+// SetHeadDelays sets multiple head delays.
+// Delays that already exist are subject to the conflict policy.
+func (s *Service) SetHeadDelays(ctx context.Context, delays []*probedb.Delay) error {
+	return s.withTx(ctx, func(tx *sql.Tx) error {
+		ctx := context.WithValue(ctx, &Tx{}, tx)
+		for _, delay := range delays {
+			if _, err := s.SetHeadDelay(ctx, delay); err != nil {
+				return err
+			}
+		}
+		return nil
+	})
+}
+
+// SetAggregateAttestations sets multiple aggregate attestations.
+// Aggregate attestations that already exist are subject to the conflict policy.
+func (s *Service) SetAggregateAttestations(ctx context.Context, aggregateAttestations []*probedb.AggregateAttestation) error {
+	return s.withTx(ctx, func(tx *sql.Tx) error {
+		ctx := context.WithValue(ctx, &Tx{}, tx)
+		for _, aggregateAttestation := range aggregateAttestations {
+			if _, err := s.SetAggregateAttestation(ctx, aggregateAttestation); err != nil {
+				return err
+			}
+		}
+		return nil
+	})
+}
+
+// SetAttestationSummaries sets multiple attestation summaries.
+// Attestation summaries that already exist are subject to the conflict policy.
+func (s *Service) SetAttestationSummaries(ctx context.Context, summaries []*probedb.AttestationSummary) error {
+	return s.withTx(ctx, func(tx *sql.Tx) error {
+		ctx := context.WithValue(ctx, &Tx{}, tx)
+		for _, summary := range summaries {
+			if _, err := s.SetAttestationSummary(ctx, summary); err != nil {
+				return err
+			}
+		}
+		return nil
+	})
+}
@@ -0,0 +1,110 @@
+// Copyright © 2023 Weald Technology Trading.
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package sqlite
+
+import (
+	"context"
+	"database/sql"
+	"fmt"
+	"strings"
+
+	"github.com/wealdtech/probed/services/probedb"
+)
+
+// column is the name and value of a column.
+type column struct {
+	name  string
+	value interface{}
+}
+
+// applyConflictPolicy applies the conflict policy to the existing row with the given key,
+// replacing its values with the supplied values if required, and returns the action taken.
+func applyConflictPolicy(ctx context.Context,
+	tx *sql.Tx,
+	table string,
+	policy probedb.ConflictPolicy,
+	keys []*column,
+	values []*column,
+) (
+	probedb.Action,
+	error,
+) {
+	switch policy {
+	case probedb.ConflictKeepLatest:
+		return updateRow(ctx, tx, table, keys, values, "")
+	case probedb.ConflictKeepMinimumDelay:
+		return updateRow(ctx, tx, table, keys, values, "f_delay > ?", delayValue(values))
+	default:
+		return probedb.ActionIgnored, nil
+	}
+}
+
+// updateRow updates the row with the given key if it matches the optional condition,
+// returning ActionUpdated if the row was updated and ActionIgnored if not.
+func updateRow(ctx context.Context,
+	tx *sql.Tx,
+	table string,
+	keys []*column,
+	values []*column,
+	condition string,
+	conditionArgs ...interface{},
+) (
+	probedb.Action,
+	error,
+) {
+	sets := make([]string, 0, len(values))
+	args := make([]interface{}, 0, len(values)+len(keys)+len(conditionArgs))
+	for _, value := range values {
+		sets = append(sets, fmt.Sprintf("%s = ?", value.name))
+		args = append(args, value.value)
+	}
+	conditions := make([]string, 0, len(keys)+1)
+	for _, key := range keys {
+		conditions = append(conditions, fmt.Sprintf("%s = ?", key.name))
+		args = append(args, key.value)
+	}
+	if condition != "" {
+		conditions = append(conditions, condition)
+		args = append(args, conditionArgs...)
+	}
+
+	res, err := tx.ExecContext(ctx, fmt.Sprintf(`UPDATE %s SET %s WHERE %s`,
+		table,
+		strings.Join(sets, ","),
+		strings.Join(conditions, " AND "),
+	), args...)
+	if err != nil {
+		return probedb.ActionIgnored, err
+	}
+	rowsAffected, err := res.RowsAffected()
+	if err != nil {
+		return probedb.ActionIgnored, err
+	}
+	if rowsAffected == 0 {
+		return probedb.ActionIgnored, nil
+	}
+
+	return probedb.ActionUpdated, nil
+}
+
+// delayValue returns the value of the delay column.
+func delayValue(values []*column) interface{} {
+	for _, value := range values {
+		if value.name == "f_delay" {
+			return value.value
+		}
+	}
+
+	return nil
+}
@@ -0,0 +1,309 @@
+// Copyright © 2023 Weald Technology Trading.
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package sqlite
+
+import (
+	"context"
+	"database/sql"
+	"fmt"
+	"math"
+
+	"github.com/pkg/errors"
+	"github.com/wealdtech/probed/services/probedb"
+)
+
+// SetBlockDelay sets a block delay.
+// If a delay already exists for this block then the block delay conflict policy is applied.
+func (s *Service) SetBlockDelay(ctx context.Context, delay *probedb.Delay) (probedb.Action, error) {
+	return s.setDelay(ctx, "t_block_delays", delay, s.conflictPolicies.BlockDelays)
+}
+
+// BlockDelays obtains the block delays for a range of slots.
+func (s *Service) BlockDelays(ctx context.Context, filter *probedb.DelayFilter) ([]*probedb.Delay, error) {
+	return s.delays(ctx, "t_block_delays", filter)
+}
+
+// StreamBlockDelays calls the handler with each block delay for a filter.
+func (s *Service) StreamBlockDelays(ctx context.Context, filter *probedb.DelayFilter, handler func(*probedb.Delay) error) error {
+	return s.streamDelays(ctx, "t_block_delays", filter, handler)
+}
+
+// SetHeadDelay sets a head delay.
+// If a delay already exists for this head then the head delay conflict policy is applied.
+func (s *Service) SetHeadDelay(ctx context.Context, delay *probedb.Delay) (probedb.Action, error) {
+	return s.setDelay(ctx, "t_head_delays", delay, s.conflictPolicies.HeadDelays)
+}
+
+// HeadDelays obtains the head delays for a range of slots.
+func (s *Service) HeadDelays(ctx context.Context, filter *probedb.DelayFilter) ([]*probedb.Delay, error) {
+	return s.delays(ctx, "t_head_delays", filter)
+}
+
+// StreamHeadDelays calls the handler with each head delay for a filter.
+func (s *Service) StreamHeadDelays(ctx context.Context, filter *probedb.DelayFilter, handler func(*probedb.Delay) error) error {
+	return s.streamDelays(ctx, "t_head_delays", filter, handler)
+}
+
+// setDelay sets a delay in the given table.
+func (s *Service) setDelay(ctx context.Context, table string, delay *probedb.Delay, policy probedb.ConflictPolicy) (probedb.Action, error) {
+	action := probedb.ActionCreated
+	err := s.withTx(ctx, func(tx *sql.Tx) error {
+		res, err := tx.ExecContext(ctx, fmt.Sprintf(`
+INSERT INTO %s(f_ip_addr
+              ,f_source
+              ,f_method
+              ,f_slot
+              ,f_delay
+              ,f_prober
+              )
+VALUES(?,?,?,?,?,?)
+ON CONFLICT (f_ip_addr, f_source, f_method, f_slot) DO NOTHING
+`, table),
+			ipAddrString(delay.IPAddr),
+			delay.Source,
+			delay.Method,
+			delay.Slot,
+			delay.DelayMS,
+			delay.Prober,
+		)
+		if err != nil {
+			return err
+		}
+		rowsAffected, err := res.RowsAffected()
+		if err != nil {
+			return err
+		}
+		if rowsAffected == 0 {
+			action, err = applyConflictPolicy(ctx, tx, table, policy,
+				[]*column{
+					{name: "f_ip_addr", value: ipAddrString(delay.IPAddr)},
+					{name: "f_source", value: delay.Source},
+					{name: "f_method", value: delay.Method},
+					{name: "f_slot", value: delay.Slot},
+				},
+				[]*column{
+					{name: "f_delay", value: delay.DelayMS},
+					{name: "f_prober", value: delay.Prober},
+				},
+			)
+		}
+		return err
+	})
+
+	return action, err
+}
+
+// delays obtains delays from the given table.
+func (s *Service) delays(ctx context.Context, table string, filter *probedb.DelayFilter) ([]*probedb.Delay, error) {
+	delays := make([]*probedb.Delay, 0)
+	if err := s.streamDelays(ctx, table, filter, func(delay *probedb.Delay) error {
+		delays = append(delays, delay)
+		return nil
+	}); err != nil {
+		return nil, err
+	}
+
+	return delays, nil
+}
+
+// streamDelays calls the handler with each delay from the given table.
+func (s *Service) streamDelays(ctx context.Context, table string, filter *probedb.DelayFilter, handler func(*probedb.Delay) error) error {
+	tx := s.tx(ctx)
+	if tx == nil {
+		ctx, cancel, err := s.BeginTx(ctx)
+		if err != nil {
+			return errors.Wrap(err, "failed to begin transaction")
+		}
+		tx = s.tx(ctx)
+		defer cancel()
+	}
+
+	direction, err := orderDirection(filter.Order)
+	if err != nil {
+		return err
+	}
+	cursor, err := probedb.ParseDelayCursor(filter.Cursor)
+	if err != nil {
+		return err
+	}
+	conditions := filterConditions(filter.IPAddr, filter.Prober, filter.Sources, filter.Methods, filter.From, filter.To)
+	if cursor != nil && filter.Selection != probedb.SelectionAll {
+		// Results are one per slot, so the cursor can be applied by the query.
+		if filter.Order == probedb.OrderLatest {
+			conditions.add("f_slot < ?", cursor.Slot)
+		} else {
+			conditions.add("f_slot > ?", cursor.Slot)
+		}
+	} else {
+		conditions.addCursor(cursor, filter.Order)
+	}
+
+	var query string
+	switch filter.Selection {
+	case probedb.SelectionMinimum:
+		query = fmt.Sprintf(`
+SELECT f_slot
+      ,MIN(f_delay)
+FROM %s%s
+GROUP BY f_slot
+ORDER BY f_slot%s`, table, conditions.where(), direction)
+		if filter.Limit != 0 {
+			query += "\nLIMIT ?"
+			conditions.vals = append(conditions.vals, filter.Limit)
+		}
+	case probedb.SelectionMaximum:
+		query = fmt.Sprintf(`
+SELECT f_slot
+      ,MAX(f_delay)
+FROM %s%s
+GROUP BY f_slot
+ORDER BY f_slot%s`, table, conditions.where(), direction)
+		if filter.Limit != 0 {
+			query += "\nLIMIT ?"
+			conditions.vals = append(conditions.vals, filter.Limit)
+		}
+	case probedb.SelectionMedian:
+		// SQLite does not have a percentile function, so fetch all delays and calculate the median.
+		query = fmt.Sprintf(`
+SELECT f_slot
+      ,f_delay
+FROM %s%s
+ORDER BY f_slot%s
+        ,f_delay`, table, conditions.where(), direction)
+	case probedb.SelectionAll:
+		query = fmt.Sprintf(`
+SELECT f_ip_addr
+      ,f_prober
+      ,f_source
+      ,f_method
+      ,f_slot
+      ,f_delay
+FROM %s%s
+ORDER BY f_slot%s`, table, conditions.where(), direction)
+	default:
+		return errors.New("unhandled selection criteria")
+	}
+	logQuery(query, conditions.vals)
+
+	rows, err := tx.QueryContext(ctx, query, conditions.vals...)
+	if err != nil {
+		return err
+	}
+	defer rows.Close()
+
+	switch filter.Selection {
+	case probedb.SelectionMedian:
+		return streamMedianDelays(ctx, rows, filter.Limit, handler)
+	case probedb.SelectionAll:
+		// IP addresses are stored as text, so cannot be ordered by the query.
+		batcher := newSlotBatcher(filter.Order, cursor, filter.Limit)
+		for rows.Next() {
+			if err := ctx.Err(); err != nil {
+				return err
+			}
+			delay := &probedb.Delay{}
+			var ipAddr string
+			if err := rows.Scan(
+				&ipAddr,
+				&delay.Prober,
+				&delay.Source,
+				&delay.Method,
+				&delay.Slot,
+				&delay.DelayMS,
+			); err != nil {
+				return errors.Wrap(err, "failed to scan row")
+			}
+			delay.IPAddr = parseIPAddr(ipAddr)
+			done, err := batcher.add(ctx, probedb.DelayPosition(delay), func() error { return handler(delay) })
+			if err != nil {
+				return err
+			}
+			if done {
+				break
+			}
+		}
+		if err := rows.Err(); err != nil {
+			return err
+		}
+		return batcher.flush(ctx)
+	default:
+		for rows.Next() {
+			if err := ctx.Err(); err != nil {
+				return err
+			}
+			delay := &probedb.Delay{}
+			if err := rows.Scan(
+				&delay.Slot,
+				&delay.DelayMS,
+			); err != nil {
+				return errors.Wrap(err, "failed to scan row")
+			}
+			if err := handler(delay); err != nil {
+				return err
+			}
+		}
+		return rows.Err()
+	}
+}
+
+// streamMedianDelays calls the handler with the median delay for each slot
+// from rows of slots and delays, ordered by slot and delay.
+// The median of an even number of delays is the mean of the middle two,
+// rounded to the nearest integer in the same way as PostgreSQL.
+func streamMedianDelays(ctx context.Context, rows *sql.Rows, limit uint32, handler func(*probedb.Delay) error) error {
+	handled := uint32(0)
+	slot := uint32(0)
+	slotDelays := make([]uint32, 0)
+	handleSlot := func() error {
+		if len(slotDelays) == 0 {
+			return nil
+		}
+		median := slotDelays[len(slotDelays)/2]
+		if len(slotDelays)%2 == 0 {
+			median = uint32(math.RoundToEven((float64(slotDelays[len(slotDelays)/2-1]) + float64(median)) / 2))
+		}
+		handled++
+		return handler(&probedb.Delay{
+			Slot:    slot,
+			DelayMS: median,
+		})
+	}
+
+	for rows.Next() {
+		if err := ctx.Err(); err != nil {
+			return err
+		}
+		var rowSlot uint32
+		var delay uint32
+		if err := rows.Scan(&rowSlot, &delay); err != nil {
+			return errors.Wrap(err, "failed to scan row")
+		}
+		if rowSlot != slot {
+			if err := handleSlot(); err != nil {
+				return err
+			}
+			if limit != 0 && handled >= limit {
+				return nil
+			}
+			slot = rowSlot
+			slotDelays = slotDelays[:0]
+		}
+		slotDelays = append(slotDelays, delay)
+	}
+	if err := rows.Err(); err != nil {
+		return err
+	}
+
+	return handleSlot()
+}
@@ -0,0 +1,145 @@
+// Copyright © 2023 Weald Technology Trading.
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package sqlite_test
+
+import (
+	"context"
+	"testing"
+
+	"github.com/attestantio/go-eth2-client/spec/phase0"
+	"github.com/stretchr/testify/require"
+	"github.com/wealdtech/probed/services/probedb"
+)
+
+func slotPtr(in phase0.Slot) *phase0.Slot {
+	return &in
+}
+
+func TestSetBlockDelay(t *testing.T) {
+	ctx, cancel := context.WithCancel(context.Background())
+	defer cancel()
+	s := newService(ctx, t)
+
+	blockDelay := &probedb.Delay{
+		IPAddr:  parseIP("1.2.3.4"),
+		Source:  "Dummy client",
+		Method:  "test",
+		Slot:    12345,
+		DelayMS: 234,
+	}
+
+	// Set the block delay.
+	action, err := s.SetBlockDelay(ctx, blockDelay)
+	require.NoError(t, err)
+	require.Equal(t, probedb.ActionCreated, action)
+
+	// Attempt to overwrite; should be ignored but no error.
+	blockDelay.DelayMS = 345
+	action, err = s.SetBlockDelay(ctx, blockDelay)
+	require.NoError(t, err)
+	require.Equal(t, probedb.ActionIgnored, action)
+}
+
+func TestDelays(t *testing.T) {
+	ctx, cancel := context.WithCancel(context.Background())
+	defer cancel()
+	s := newService(ctx, t)
+
+	delays := []*probedb.Delay{
+		{IPAddr: parseIP("1.2.3.4"), Prober: "prober1", Source: "Source 1", Method: "Method 1", Slot: 1, DelayMS: 100},
+		{IPAddr: parseIP("1.2.3.4"), Prober: "prober1", Source: "Source 2", Method: "Method 1", Slot: 1, DelayMS: 200},
+		{IPAddr: parseIP("::1"), Prober: "prober2", Source: "Source 1", Method: "Method 2", Slot: 1, DelayMS: 400},
+		{IPAddr: parseIP("::1"), Prober: "prober2", Source: "Source 1", Method: "Method 2", Slot: 2, DelayMS: 50},
+		{IPAddr: parseIP("5.6.7.8"), Prober: "prober3", Source: "Source 1", Method: "Method 3", Slot: 3, DelayMS: 75},
+	}
+	for _, delay := range delays {
+		_, err := s.SetHeadDelay(ctx, delay)
+		require.NoError(t, err)
+	}
+
+	tests := []struct {
+		name   string
+		filter *probedb.DelayFilter
+		res    []*probedb.Delay
+		err    string
+	}{
+		{
+			name:   "SelectionInvalid",
+			filter: &probedb.DelayFilter{Selection: 99},
+			err:    "unhandled selection criteria",
+		},
+		{
+			name:   "All",
+			filter: &probedb.DelayFilter{Selection: probedb.SelectionAll},
+			res:    []*probedb.Delay{delays[0], delays[1], delays[2], delays[3], delays[4]},
+		},
+		{
+			name:   "Minimum",
+			filter: &probedb.DelayFilter{Selection: probedb.SelectionMinimum},
+			res:    []*probedb.Delay{{Slot: 1, DelayMS: 100}, {Slot: 2, DelayMS: 50}, {Slot: 3, DelayMS: 75}},
+		},
+		{
+			name:   "Maximum",
+			filter: &probedb.DelayFilter{Selection: probedb.SelectionMaximum},
+			res:    []*probedb.Delay{{Slot: 1, DelayMS: 400}, {Slot: 2, DelayMS: 50}, {Slot: 3, DelayMS: 75}},
+		},
+		{
+			name:   "Median",
+			filter: &probedb.DelayFilter{Selection: probedb.SelectionMedian},
+			res:    []*probedb.Delay{{Slot: 1, DelayMS: 200}, {Slot: 2, DelayMS: 50}, {Slot: 3, DelayMS: 75}},
+		},
+		{
+			name:   "MedianEven",
+			filter: &probedb.DelayFilter{Selection: probedb.SelectionMedian, Methods: []string{"Method 1"}},
+			res:    []*probedb.Delay{{Slot: 1, DelayMS: 150}},
+		},
+		{
+			name:   "IPAddr",
+			filter: &probedb.DelayFilter{Selection: probedb.SelectionAll, IPAddr: "::1"},
+			res:    []*probedb.Delay{delays[2], delays[3]},
+		},
+		{
+			name:   "Prober",
+			filter: &probedb.DelayFilter{Selection: probedb.SelectionAll, Prober: "prober1"},
+			res:    []*probedb.Delay{delays[0], delays[1]},
+		},
+		{
+			name:   "Sources",
+			filter: &probedb.DelayFilter{Selection: probedb.SelectionAll, Sources: []string{"Source 2"}},
+			res:    []*probedb.Delay{delays[1]},
+		},
+		{
+			name:   "Methods",
+			filter: &probedb.DelayFilter{Selection: probedb.SelectionAll, Methods: []string{"Method 2", "Method 3"}},
+			res:    []*probedb.Delay{delays[2], delays[3], delays[4]},
+		},
+		{
+			name:   "FromTo",
+			filter: &probedb.DelayFilter{Selection: probedb.SelectionAll, From: slotPtr(2), To: slotPtr(2)},
+			res:    []*probedb.Delay{delays[3]},
+		},
+	}
+
+	for _, test := range tests {
+		t.Run(test.name, func(t *testing.T) {
+			res, err := s.HeadDelays(ctx, test.filter)
+			if test.err != "" {
+				require.EqualError(t, err, test.err)
+			} else {
+				require.NoError(t, err)
+				require.Equal(t, test.res, res)
+			}
+		})
+	}
+}
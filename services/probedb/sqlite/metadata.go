@@ -0,0 +1,74 @@
+// Copyright © 2023 Weald Technology Trading.
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package sqlite
+
+import (
+	"context"
+	"database/sql"
+
+	"github.com/pkg/errors"
+)
+
+// SetMetadata sets a metadata key to a JSON value.
+func (s *Service) SetMetadata(ctx context.Context, key string, value []byte) error {
+	tx := s.tx(ctx)
+	if tx == nil {
+		return ErrNoTransaction
+	}
+
+	_, err := tx.ExecContext(ctx, `
+      INSERT INTO t_metadata(f_key
+                            ,f_value)
+      VALUES(?,?)
+      ON CONFLICT (f_key) DO
+      UPDATE
+      SET f_value = excluded.f_value`,
+		key,
+		string(value),
+	)
+
+	return err
+}
+
+// Metadata obtains the JSON value from a metadata key.
+func (s *Service) Metadata(ctx context.Context, key string) ([]byte, error) {
+	if !s.hasTx(ctx) {
+		var cancel context.CancelFunc
+		var err error
+		ctx, cancel, err = s.BeginTx(ctx)
+		if err != nil {
+			return nil, err
+		}
+		defer cancel()
+	}
+	tx := s.tx(ctx)
+
+	var res string
+	err := tx.QueryRowContext(ctx, `
+      SELECT f_value
+      FROM t_metadata
+      WHERE f_key = ?`,
+		key).Scan(
+		&res,
+	)
+
+	if err != nil {
+		if errors.Is(err, sql.ErrNoRows) {
+			return nil, nil
+		}
+		return nil, errors.Wrap(err, "failed to obtain metadata")
+	}
+
+	return []byte(res), nil
+}
@@ -0,0 +1,90 @@
+// Copyright © 2023 Weald Technology Trading.
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package sqlite
+
+import (
+	"errors"
+
+	"github.com/rs/zerolog"
+	"github.com/wealdtech/probed/services/probedb"
+)
+
+type parameters struct {
+	logLevel         zerolog.Level
+	path             string
+	allowNewerSchema bool
+	conflictPolicies probedb.ConflictPolicies
+}
+
+// Parameter is the interface for service parameters.
+type Parameter interface {
+	apply(*parameters)
+}
+
+type parameterFunc func(*parameters)
+
+func (f parameterFunc) apply(p *parameters) {
+	f(p)
+}
+
+// WithLogLevel sets the log level for the module.
+func WithLogLevel(logLevel zerolog.Level) Parameter {
+	return parameterFunc(func(p *parameters) {
+		p.logLevel = logLevel
+	})
+}
+
+// WithPath sets the path of the database file for this module.
+// The special path ":memory:" creates a database that is held in memory.
+func WithPath(path string) Parameter {
+	return parameterFunc(func(p *parameters) {
+		p.path = path
+	})
+}
+
+// WithAllowNewerSchema sets whether the service continues if the database schema is
+// newer than that known to this release, rather than refusing to start.
+func WithAllowNewerSchema(allow bool) Parameter {
+	return parameterFunc(func(p *parameters) {
+		p.allowNewerSchema = allow
+	})
+}
+
+// WithConflictPolicies sets the policies applied when a record has the same key as an existing record.
+func WithConflictPolicies(policies probedb.ConflictPolicies) Parameter {
+	return parameterFunc(func(p *parameters) {
+		p.conflictPolicies = policies
+	})
+}
+
+// parseAndCheckParameters parses and checks parameters to ensure that mandatory parameters are present and correct.
+func parseAndCheckParameters(params ...Parameter) (*parameters, error) {
+	parameters := parameters{
+		logLevel: zerolog.GlobalLevel(),
+	}
+	for _, p := range params {
+		if params != nil {
+			p.apply(&parameters)
+		}
+	}
+
+	if parameters.path == "" {
+		return nil, errors.New("no path specified")
+	}
+	if err := parameters.conflictPolicies.Check(); err != nil {
+		return nil, err
+	}
+
+	return &parameters, nil
+}
@@ -0,0 +1,78 @@
+// Copyright © 2023 Weald Technology Trading.
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package sqlite
+
+import (
+	"context"
+	"database/sql"
+	"fmt"
+
+	"github.com/attestantio/go-eth2-client/spec/phase0"
+)
+
+// PruneBlockDelays removes up to limit block delays for slots before the given slot,
+// returning the number of block delays removed.
+func (s *Service) PruneBlockDelays(ctx context.Context, before phase0.Slot, limit uint32) (uint32, error) {
+	return s.prune(ctx, "t_block_delays", before, limit)
+}
+
+// PruneHeadDelays removes up to limit head delays for slots before the given slot,
+// returning the number of head delays removed.
+func (s *Service) PruneHeadDelays(ctx context.Context, before phase0.Slot, limit uint32) (uint32, error) {
+	return s.prune(ctx, "t_head_delays", before, limit)
+}
+
+// PruneAggregateAttestations removes up to limit aggregate attestations for slots before the given slot,
+// returning the number of aggregate attestations removed.
+func (s *Service) PruneAggregateAttestations(ctx context.Context, before phase0.Slot, limit uint32) (uint32, error) {
+	return s.prune(ctx, "t_aggregate_attestations", before, limit)
+}
+
+// PruneAttestationSummaries removes up to limit attestation summaries for slots before the given slot,
+// returning the number of attestation summaries removed.
+func (s *Service) PruneAttestationSummaries(ctx context.Context, before phase0.Slot, limit uint32) (uint32, error) {
+	return s.prune(ctx, "t_attestation_summaries", before, limit)
+}
+
+// prune removes up to limit rows for slots before the given slot from the given table.
+// Deletion is bounded so that the database is not locked for long periods.
+func (s *Service) prune(ctx context.Context, table string, before phase0.Slot, limit uint32) (uint32, error) {
+	removed := uint32(0)
+	err := s.withTx(ctx, func(tx *sql.Tx) error {
+		res, err := tx.ExecContext(ctx, fmt.Sprintf(`
+DELETE FROM %s
+WHERE rowid IN (SELECT rowid
+                FROM %s
+                WHERE f_slot < ?
+                LIMIT ?)
+`, table, table),
+			uint64(before),
+			limit,
+		)
+		if err != nil {
+			return err
+		}
+		rowsAffected, err := res.RowsAffected()
+		if err != nil {
+			return err
+		}
+		removed = uint32(rowsAffected)
+		return nil
+	})
+	if err != nil {
+		return 0, err
+	}
+
+	return removed, nil
+}
@@ -0,0 +1,222 @@
+// Copyright © 2023 Weald Technology Trading.
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package sqlite
+
+import (
+	"context"
+	"fmt"
+	"net"
+	"sort"
+	"strings"
+
+	"github.com/attestantio/go-eth2-client/spec/phase0"
+	"github.com/pkg/errors"
+	"github.com/wealdtech/probed/services/probedb"
+)
+
+// conditions holds the conditions of a query, along with their values.
+type conditions struct {
+	clauses []string
+	vals    []interface{}
+}
+
+// add adds a clause with a single value.
+func (c *conditions) add(clause string, val interface{}) {
+	c.clauses = append(c.clauses, clause)
+	c.vals = append(c.vals, val)
+}
+
+// addIn adds a clause that matches the column against any of the values.
+func (c *conditions) addIn(column string, vals []string) {
+	placeholders := make([]string, len(vals))
+	for i := range vals {
+		placeholders[i] = "?"
+		c.vals = append(c.vals, vals[i])
+	}
+	c.clauses = append(c.clauses, fmt.Sprintf("%s IN (%s)", column, strings.Join(placeholders, ",")))
+}
+
+// where returns the WHERE clause for the conditions, or an empty string if there are none.
+func (c *conditions) where() string {
+	if len(c.clauses) == 0 {
+		return ""
+	}
+
+	return "\nWHERE " + strings.Join(c.clauses, "\n  AND ")
+}
+
+// filterConditions returns the conditions for the common filter fields.
+func filterConditions(ipAddr string,
+	prober string,
+	sources []string,
+	methods []string,
+	from *phase0.Slot,
+	to *phase0.Slot,
+) *conditions {
+	c := &conditions{
+		clauses: make([]string, 0),
+		vals:    make([]interface{}, 0),
+	}
+
+	if ipAddr != "" {
+		c.add("f_ip_addr = ?", ipAddrString(net.ParseIP(ipAddr)))
+	}
+	if prober != "" {
+		c.add("f_prober = ?", prober)
+	}
+	if len(sources) > 0 {
+		c.addIn("f_source", sources)
+	}
+	if len(methods) > 0 {
+		c.addIn("f_method", methods)
+	}
+	if from != nil {
+		c.add("f_slot >= ?", uint64(*from))
+	}
+	if to != nil {
+		c.add("f_slot <= ?", uint64(*to))
+	}
+
+	return c
+}
+
+// addCursor adds a clause that selects rows in or after the slot of the cursor,
+// if there is one.
+// Rows within the slot of the cursor must be further filtered once sorted.
+func (c *conditions) addCursor(cursor *probedb.Position, order probedb.Order) {
+	if cursor == nil {
+		return
+	}
+	if order == probedb.OrderLatest {
+		c.add("f_slot <= ?", cursor.Slot)
+	} else {
+		c.add("f_slot >= ?", cursor.Slot)
+	}
+}
+
+// batchedRow is a row held by a slot batcher.
+type batchedRow struct {
+	position *probedb.Position
+	handle   func() error
+}
+
+// slotBatcher batches rows that are read in slot order, handling the rows of
+// each slot in position order once all of the rows for the slot have been read.
+// This is required because IP addresses are stored as text, so the rows
+// within a slot cannot be ordered, or limited, by the query.
+type slotBatcher struct {
+	order   probedb.Order
+	cursor  *probedb.Position
+	limit   uint32
+	handled uint32
+	rows    []*batchedRow
+}
+
+// newSlotBatcher creates a slot batcher that handles rows after the cursor, up to the limit.
+func newSlotBatcher(order probedb.Order, cursor *probedb.Position, limit uint32) *slotBatcher {
+	return &slotBatcher{
+		order:  order,
+		cursor: cursor,
+		limit:  limit,
+		rows:   make([]*batchedRow, 0),
+	}
+}
+
+// add adds a row, handling the rows of the previous slot if the row starts a new slot.
+// It returns true if the limit has been reached, in which case no further rows are required.
+func (b *slotBatcher) add(ctx context.Context, position *probedb.Position, handle func() error) (bool, error) {
+	if len(b.rows) > 0 && position.Slot != b.rows[0].position.Slot {
+		if err := b.flush(ctx); err != nil {
+			return false, err
+		}
+		if b.full() {
+			return true, nil
+		}
+	}
+	b.rows = append(b.rows, &batchedRow{position: position, handle: handle})
+
+	return false, nil
+}
+
+// flush handles the rows of the current slot.
+func (b *slotBatcher) flush(ctx context.Context) error {
+	sort.Slice(b.rows, func(i, j int) bool {
+		return probedb.ComparePositions(b.order, b.rows[i].position, b.rows[j].position) < 0
+	})
+	for _, row := range b.rows {
+		if b.full() {
+			break
+		}
+		if b.cursor != nil && probedb.ComparePositions(b.order, row.position, b.cursor) <= 0 {
+			continue
+		}
+		if err := ctx.Err(); err != nil {
+			return err
+		}
+		if err := row.handle(); err != nil {
+			return err
+		}
+		b.handled++
+	}
+	b.rows = b.rows[:0]
+
+	return nil
+}
+
+// full returns true if the limit has been reached.
+func (b *slotBatcher) full() bool {
+	return b.limit != 0 && b.handled >= b.limit
+}
+
+// orderDirection returns the SQL direction for the order.
+func orderDirection(order probedb.Order) (string, error) {
+	switch order {
+	case probedb.OrderEarliest:
+		return "", nil
+	case probedb.OrderLatest:
+		return " DESC", nil
+	default:
+		return "", errors.New("no order specified")
+	}
+}
+
+// ipAddrString returns the canonical string representation of the IP address,
+// forcing it to be a V4 address if possible.
+func ipAddrString(ipAddr net.IP) string {
+	ip := ipAddr.To4()
+	if ip == nil {
+		ip = ipAddr
+	}
+	return ip.String()
+}
+
+// parseIPAddr parses an IP address held in the database.
+func parseIPAddr(input string) net.IP {
+	ip := net.ParseIP(input)
+	if ip4 := ip.To4(); ip4 != nil {
+		return ip4
+	}
+	return ip
+}
+
+// logQuery logs the query and its parameters at trace level.
+func logQuery(query string, vals []interface{}) {
+	if e := log.Trace(); e.Enabled() {
+		params := make([]string, len(vals))
+		for i := range vals {
+			params[i] = fmt.Sprintf("%v", vals[i])
+		}
+		log.Trace().Str("query", strings.ReplaceAll(query, "\n", " ")).Strs("params", params).Msg("SQL query")
+	}
+}
@@ -0,0 +1,77 @@
+// Copyright © 2023 Weald Technology Trading.
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package sqlite
+
+import (
+	"context"
+	"database/sql"
+	"fmt"
+
+	"github.com/pkg/errors"
+	"github.com/rs/zerolog"
+	zerologger "github.com/rs/zerolog/log"
+	"github.com/wealdtech/probed/services/probedb"
+	// Register the SQLite driver.
+	_ "modernc.org/sqlite"
+)
+
+// Service is a chain database service.
+type Service struct {
+	db               *sql.DB
+	allowNewerSchema bool
+	conflictPolicies probedb.ConflictPolicies
+}
+
+// module-wide log.
+var log zerolog.Logger
+
+// New creates a new service.
+func New(ctx context.Context, params ...Parameter) (*Service, error) {
+	parameters, err := parseAndCheckParameters(params...)
+	if err != nil {
+		return nil, errors.Wrap(err, "problem with parameters")
+	}
+
+	// Set logging.
+	log = zerologger.With().Str("service", "probedb").Str("impl", "sqlite").Logger().Level(parameters.logLevel)
+
+	db, err := sql.Open("sqlite", fmt.Sprintf("file:%s?_pragma=busy_timeout(5000)&_pragma=journal_mode(WAL)", parameters.path))
+	if err != nil {
+		return nil, errors.Wrap(err, "failed to open database")
+	}
+	// SQLite allows a single writer, so serialise all access through a single connection.
+	// This also ensures that an in-memory database is shared by all users.
+	db.SetMaxOpenConns(1)
+	db.SetConnMaxLifetime(0)
+	db.SetConnMaxIdleTime(0)
+	if err := db.PingContext(ctx); err != nil {
+		return nil, errors.Wrap(err, "failed to connect to database")
+	}
+
+	go func() {
+		<-ctx.Done()
+		log.Trace().Msg("Context done; closing database")
+		if err := db.Close(); err != nil {
+			log.Warn().Err(err).Msg("Failed to close database")
+		}
+	}()
+
+	s := &Service{
+		db:               db,
+		allowNewerSchema: parameters.allowNewerSchema,
+		conflictPolicies: parameters.conflictPolicies,
+	}
+
+	return s, nil
+}
@@ -0,0 +1,139 @@
+// Copyright © 2023 Weald Technology Trading.
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package sqlite_test
+
+import (
+	"context"
+	"net"
+	"path/filepath"
+	"testing"
+
+	"github.com/rs/zerolog"
+	"github.com/stretchr/testify/require"
+	"github.com/wealdtech/probed/services/probedb"
+	"github.com/wealdtech/probed/services/probedb/sqlite"
+)
+
+// newService creates a new upgraded service with a database in a temporary directory.
+func newService(ctx context.Context, t *testing.T, params ...sqlite.Parameter) *sqlite.Service {
+	t.Helper()
+
+	s, err := sqlite.New(ctx, append([]sqlite.Parameter{
+		sqlite.WithLogLevel(zerolog.Disabled),
+		sqlite.WithPath(filepath.Join(t.TempDir(), "probed.db")),
+	}, params...)...)
+	require.NoError(t, err)
+	require.NoError(t, s.Upgrade(ctx))
+
+	return s
+}
+
+func parseIP(input string) net.IP {
+	ipAddr := net.ParseIP(input)
+	ip := ipAddr.To4()
+	if ip == nil {
+		ip = ipAddr
+	}
+	return ip
+}
+
+func TestService(t *testing.T) {
+	tests := []struct {
+		name string
+		path string
+		err  string
+	}{
+		{
+			name: "PathMissing",
+			err:  "problem with parameters: no path specified",
+		},
+		{
+			name: "Memory",
+			path: ":memory:",
+		},
+		{
+			name: "Good",
+			path: filepath.Join(t.TempDir(), "probed.db"),
+		},
+	}
+
+	for _, test := range tests {
+		t.Run(test.name, func(t *testing.T) {
+			ctx, cancel := context.WithCancel(context.Background())
+			defer cancel()
+			_, err := sqlite.New(ctx,
+				sqlite.WithLogLevel(zerolog.Disabled),
+				sqlite.WithPath(test.path),
+			)
+			if test.err != "" {
+				require.EqualError(t, err, test.err)
+			} else {
+				require.NoError(t, err)
+			}
+		})
+	}
+}
+
+func TestInterfaces(t *testing.T) {
+	ctx, cancel := context.WithCancel(context.Background())
+	defer cancel()
+	s := newService(ctx, t)
+
+	require.Implements(t, (*probedb.Service)(nil), s)
+	require.Implements(t, (*probedb.BlockDelaysSetter)(nil), s)
+	require.Implements(t, (*probedb.BlockDelaysProvider)(nil), s)
+	require.Implements(t, (*probedb.BlockDelaysBulkSetter)(nil), s)
+	require.Implements(t, (*probedb.HeadDelaysSetter)(nil), s)
+	require.Implements(t, (*probedb.HeadDelaysProvider)(nil), s)
+	require.Implements(t, (*probedb.HeadDelaysBulkSetter)(nil), s)
+	require.Implements(t, (*probedb.AggregateAttestationsSetter)(nil), s)
+	require.Implements(t, (*probedb.AggregateAttestationsProvider)(nil), s)
+	require.Implements(t, (*probedb.AggregateAttestationsBulkSetter)(nil), s)
+	require.Implements(t, (*probedb.AttestationSummariesSetter)(nil), s)
+	require.Implements(t, (*probedb.AttestationSummariesProvider)(nil), s)
+	require.Implements(t, (*probedb.AttestationSummariesBulkSetter)(nil), s)
+	require.Implements(t, (*probedb.BlockDelaysPruner)(nil), s)
+	require.Implements(t, (*probedb.HeadDelaysPruner)(nil), s)
+	require.Implements(t, (*probedb.AggregateAttestationsPruner)(nil), s)
+	require.Implements(t, (*probedb.AttestationSummariesPruner)(nil), s)
+}
+
+func TestTransactions(t *testing.T) {
+	ctx, cancel := context.WithCancel(context.Background())
+	defer cancel()
+	s := newService(ctx, t)
+
+	delay := &probedb.Delay{IPAddr: parseIP("1.2.3.4"), Source: "Source 1", Method: "Method 1", Slot: 1, DelayMS: 100}
+
+	// Cancelled transaction should not store the delay.
+	txCtx, txCancel, err := s.BeginTx(ctx)
+	require.NoError(t, err)
+	_, err = s.SetBlockDelay(txCtx, delay)
+	require.NoError(t, err)
+	txCancel()
+	delays, err := s.BlockDelays(ctx, &probedb.DelayFilter{Selection: probedb.SelectionAll})
+	require.NoError(t, err)
+	require.Len(t, delays, 0)
+
+	// Committed transaction should store the delay.
+	txCtx, txCancel, err = s.BeginTx(ctx)
+	require.NoError(t, err)
+	_, err = s.SetBlockDelay(txCtx, delay)
+	require.NoError(t, err)
+	require.NoError(t, s.CommitTx(txCtx))
+	txCancel()
+	delays, err = s.BlockDelays(ctx, &probedb.DelayFilter{Selection: probedb.SelectionAll})
+	require.NoError(t, err)
+	require.Equal(t, []*probedb.Delay{delay}, delays)
+}
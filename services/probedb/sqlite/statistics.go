@@ -0,0 +1,102 @@
+// Copyright © 2023 Weald Technology Trading.
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package sqlite
+
+import (
+	"context"
+	"fmt"
+
+	"github.com/pkg/errors"
+	"github.com/wealdtech/probed/services/probedb"
+)
+
+// BlockDelayStatistics obtains the statistics of the block delays for each slot in a range.
+func (s *Service) BlockDelayStatistics(ctx context.Context, filter *probedb.DelayFilter) ([]*probedb.DelayStatistics, error) {
+	return s.delayStatistics(ctx, "t_block_delays", filter)
+}
+
+// HeadDelayStatistics obtains the statistics of the head delays for each slot in a range.
+func (s *Service) HeadDelayStatistics(ctx context.Context, filter *probedb.DelayFilter) ([]*probedb.DelayStatistics, error) {
+	return s.delayStatistics(ctx, "t_head_delays", filter)
+}
+
+// delayStatistics obtains statistics of the delays from the given table.
+// SQLite does not have percentile or standard deviation functions, so all delays
+// are fetched and then grouped and the statistics calculated.
+func (s *Service) delayStatistics(ctx context.Context, table string, filter *probedb.DelayFilter) ([]*probedb.DelayStatistics, error) {
+	if filter.Order > probedb.OrderLatest {
+		return nil, errors.New("no order specified")
+	}
+	if err := probedb.CheckStatistics(filter.Statistics); err != nil {
+		return nil, err
+	}
+	if err := probedb.CheckDimensions(filter.GroupBy); err != nil {
+		return nil, err
+	}
+	cursor, err := probedb.ParseDelayCursor(filter.Cursor)
+	if err != nil {
+		return nil, err
+	}
+
+	tx := s.tx(ctx)
+	if tx == nil {
+		ctx, cancel, err := s.BeginTx(ctx)
+		if err != nil {
+			return nil, errors.Wrap(err, "failed to begin transaction")
+		}
+		tx = s.tx(ctx)
+		defer cancel()
+	}
+
+	conditions := filterConditions(filter.IPAddr, filter.Prober, filter.Sources, filter.Methods, filter.From, filter.To)
+	query := fmt.Sprintf(`
+SELECT f_ip_addr
+      ,f_source
+      ,f_method
+      ,f_slot
+      ,f_delay
+FROM %s%s`, table, conditions.where())
+	logQuery(query, conditions.vals)
+
+	rows, err := tx.QueryContext(ctx, query, conditions.vals...)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	delays := make([]*probedb.Delay, 0)
+	for rows.Next() {
+		delay := &probedb.Delay{}
+		var ipAddr string
+		if err := rows.Scan(
+			&ipAddr,
+			&delay.Source,
+			&delay.Method,
+			&delay.Slot,
+			&delay.DelayMS,
+		); err != nil {
+			return nil, errors.Wrap(err, "failed to scan row")
+		}
+		delay.IPAddr = parseIPAddr(ipAddr)
+		delays = append(delays, delay)
+	}
+	if err := rows.Err(); err != nil {
+		return nil, err
+	}
+
+	statistics := probedb.CalculateGroupedStatistics(delays, filter)
+	start, end := probedb.Page(len(statistics), func(i int) *probedb.Position { return probedb.DelayStatisticsPosition(statistics[i]) }, filter.Order, cursor, filter.Limit)
+
+	return statistics[start:end], nil
+}
@@ -0,0 +1,102 @@
+// Copyright © 2023 Weald Technology Trading.
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package sqlite
+
+import (
+	"context"
+	"database/sql"
+
+	"github.com/pkg/errors"
+)
+
+var (
+	// ErrNoTransaction is returned when an attempt to carry out a mutation to the database
+	// is not inside a transaction.
+	ErrNoTransaction = errors.New("no transaction for action")
+)
+
+// Tx is a context tag for the database transaction.
+type Tx struct{}
+
+// BeginTx begins a transaction on the database.
+// The transaction can be rolled back by invoking the cancel function.
+func (s *Service) BeginTx(ctx context.Context) (context.Context, context.CancelFunc, error) {
+	ctx, cancel := context.WithCancel(ctx)
+	tx, err := s.db.BeginTx(ctx, nil)
+	if err != nil {
+		cancel()
+		return nil, nil, errors.Wrap(err, "failed to begin transaction")
+	}
+	ctx = context.WithValue(ctx, &Tx{}, tx)
+	return ctx, func() {
+		if err := tx.Rollback(); err != nil && !errors.Is(err, sql.ErrTxDone) {
+			log.Warn().Err(err).Msg("Failed to rollback transaction")
+		}
+		cancel()
+	}, nil
+}
+
+// hasTx returns true if the context has a transaction.
+func (s *Service) hasTx(ctx context.Context) bool {
+	return s.tx(ctx) != nil
+}
+
+// tx returns the transaction; nil if no transaction
+func (s *Service) tx(ctx context.Context) *sql.Tx {
+	if ctx == nil {
+		return nil
+	}
+
+	if tx, ok := ctx.Value(&Tx{}).(*sql.Tx); ok {
+		return tx
+	}
+	return nil
+}
+
+// CommitTx commits a transaction on the ops datastore.
+func (s *Service) CommitTx(ctx context.Context) error {
+	if ctx == nil {
+		return errors.New("no context")
+	}
+
+	tx, ok := ctx.Value(&Tx{}).(*sql.Tx)
+	if !ok {
+		return errors.New("no transaction")
+	}
+	return tx.Commit()
+}
+
+// withTx runs the function inside the transaction in the context, or inside
+// a local transaction that is committed on success if there is no such transaction.
+func (s *Service) withTx(ctx context.Context, fn func(tx *sql.Tx) error) error {
+	if tx := s.tx(ctx); tx != nil {
+		return fn(tx)
+	}
+
+	tx, err := s.db.BeginTx(ctx, nil)
+	if err != nil {
+		return err
+	}
+	if err := fn(tx); err != nil {
+		if err := tx.Rollback(); err != nil {
+			log.Warn().Err(err).Msg("Failed to rollback transaction")
+		}
+		return err
+	}
+	if err := tx.Commit(); err != nil {
+		return errors.Wrap(err, "failed to commit transaction")
+	}
+
+	return nil
+}
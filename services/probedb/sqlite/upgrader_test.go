@@ -0,0 +1,80 @@
+// Copyright © 2023 Weald Technology Trading.
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package sqlite_test
+
+import (
+	"context"
+	"path/filepath"
+	"testing"
+
+	"github.com/rs/zerolog"
+	"github.com/stretchr/testify/require"
+	"github.com/wealdtech/probed/services/probedb/sqlite"
+)
+
+func TestUpgrade(t *testing.T) {
+	ctx, cancel := context.WithCancel(context.Background())
+	defer cancel()
+
+	s, err := sqlite.New(ctx,
+		sqlite.WithLogLevel(zerolog.Disabled),
+		sqlite.WithPath(filepath.Join(t.TempDir(), "probed.db")),
+	)
+	require.NoError(t, err)
+
+	// Initial upgrade creates the database.
+	require.NoError(t, s.Upgrade(ctx))
+	metadata, err := s.Metadata(ctx, "schema")
+	require.NoError(t, err)
+	require.JSONEq(t, `{"version":2}`, string(metadata))
+
+	// Subsequent upgrade does nothing.
+	require.NoError(t, s.Upgrade(ctx))
+	metadata, err = s.Metadata(ctx, "schema")
+	require.NoError(t, err)
+	require.JSONEq(t, `{"version":2}`, string(metadata))
+}
+
+func TestUpgradeNewerSchema(t *testing.T) {
+	ctx, cancel := context.WithCancel(context.Background())
+	defer cancel()
+
+	path := filepath.Join(t.TempDir(), "probed.db")
+	s, err := sqlite.New(ctx,
+		sqlite.WithLogLevel(zerolog.Disabled),
+		sqlite.WithPath(path),
+	)
+	require.NoError(t, err)
+	require.NoError(t, s.Upgrade(ctx))
+
+	// Move the schema on beyond that known to this release.
+	txCtx, txCancel, err := s.BeginTx(ctx)
+	require.NoError(t, err)
+	require.NoError(t, s.SetMetadata(txCtx, "schema", []byte(`{"version":999}`)))
+	require.NoError(t, s.CommitTx(txCtx))
+	txCancel()
+
+	// Refuses to upgrade by default.
+	err = s.Upgrade(ctx)
+	require.ErrorIs(t, err, sqlite.ErrNewerSchema)
+
+	// Continues if allowed.
+	s, err = sqlite.New(ctx,
+		sqlite.WithLogLevel(zerolog.Disabled),
+		sqlite.WithPath(path),
+		sqlite.WithAllowNewerSchema(true),
+	)
+	require.NoError(t, err)
+	require.NoError(t, s.Upgrade(ctx))
+}
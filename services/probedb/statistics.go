@@ -0,0 +1,286 @@
+// Copyright © 2023 Weald Technology Trading.
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package probedb
+
+import (
+	"bytes"
+	"fmt"
+	"math"
+	"net"
+	"sort"
+
+	"github.com/pkg/errors"
+)
+
+// StatisticType is the type of a statistic calculated over delays.
+type StatisticType uint8
+
+const (
+	// StatisticCount is the number of delays.
+	StatisticCount StatisticType = iota
+	// StatisticMinimum is the minimum delay.
+	StatisticMinimum
+	// StatisticMaximum is the maximum delay.
+	StatisticMaximum
+	// StatisticMean is the arithmetic mean of the delays.
+	StatisticMean
+	// StatisticStdDev is the population standard deviation of the delays.
+	StatisticStdDev
+	// StatisticPercentile is a percentile of the delays, interpolated
+	// between the closest delays if required.
+	StatisticPercentile
+)
+
+// Statistic is a statistic calculated over the delays for each slot.
+type Statistic struct {
+	// Type is the type of the statistic.
+	Type StatisticType
+
+	// Percentile is the percentile to calculate, from 0 to 100.
+	// It is only used by StatisticPercentile.
+	Percentile float64
+}
+
+// String returns a string representation of the statistic, for example
+// "count", "mean" or "p95".
+func (s Statistic) String() string {
+	switch s.Type {
+	case StatisticCount:
+		return "count"
+	case StatisticMinimum:
+		return "minimum"
+	case StatisticMaximum:
+		return "maximum"
+	case StatisticMean:
+		return "mean"
+	case StatisticStdDev:
+		return "stddev"
+	case StatisticPercentile:
+		return fmt.Sprintf("p%g", s.Percentile)
+	default:
+		return "unknown"
+	}
+}
+
+// Dimension is a dimension by which delays are grouped.
+type Dimension uint8
+
+const (
+	// DimensionSlot groups delays by slot.
+	DimensionSlot Dimension = iota
+	// DimensionEpoch groups delays by epoch.
+	DimensionEpoch
+	// DimensionSource groups delays by source.
+	DimensionSource
+	// DimensionMethod groups delays by method.
+	DimensionMethod
+	// DimensionIPAddr groups delays by IP address.
+	DimensionIPAddr
+)
+
+// String returns a string representation of the dimension.
+func (d Dimension) String() string {
+	switch d {
+	case DimensionSlot:
+		return "slot"
+	case DimensionEpoch:
+		return "epoch"
+	case DimensionSource:
+		return "source"
+	case DimensionMethod:
+		return "method"
+	case DimensionIPAddr:
+		return "ip_addr"
+	default:
+		return "unknown"
+	}
+}
+
+// GroupingDimensions returns the dimensions by which the filter groups delays,
+// in the order by which grouped results are sorted: epoch, slot, method, IP
+// address and source.
+func GroupingDimensions(filter *DelayFilter) []Dimension {
+	if len(filter.GroupBy) == 0 {
+		return []Dimension{DimensionSlot}
+	}
+
+	dimensions := make([]Dimension, 0, len(filter.GroupBy))
+	for _, dimension := range []Dimension{DimensionEpoch, DimensionSlot, DimensionMethod, DimensionIPAddr, DimensionSource} {
+		for _, groupBy := range filter.GroupBy {
+			if groupBy == dimension {
+				dimensions = append(dimensions, dimension)
+				break
+			}
+		}
+	}
+
+	return dimensions
+}
+
+// SlotsPerEpoch returns the number of slots per epoch to use for the filter.
+func SlotsPerEpoch(filter *DelayFilter) uint32 {
+	if filter.SlotsPerEpoch == 0 {
+		return 32
+	}
+
+	return filter.SlotsPerEpoch
+}
+
+// CheckDimensions checks that the dimensions requested by a filter are valid.
+func CheckDimensions(dimensions []Dimension) error {
+	for _, dimension := range dimensions {
+		if dimension > DimensionIPAddr {
+			return errors.New("unhandled dimension")
+		}
+	}
+
+	return nil
+}
+
+// CheckStatistics checks that the statistics requested by a filter are valid.
+func CheckStatistics(statistics []Statistic) error {
+	if len(statistics) == 0 {
+		return errors.New("no statistics requested")
+	}
+	for _, statistic := range statistics {
+		switch statistic.Type {
+		case StatisticCount, StatisticMinimum, StatisticMaximum, StatisticMean, StatisticStdDev:
+		case StatisticPercentile:
+			if statistic.Percentile < 0 || statistic.Percentile > 100 || math.IsNaN(statistic.Percentile) {
+				return errors.New("percentile must be between 0 and 100")
+			}
+		default:
+			return errors.New("unhandled statistic")
+		}
+	}
+
+	return nil
+}
+
+// CalculateStatistics calculates the requested statistics over a set of delays,
+// returning the values in the order in which the statistics were requested.
+// Calculations match those of PostgreSQL's aggregate functions, for use by
+// databases that do not provide them natively.
+func CalculateStatistics(delays []uint32, statistics []Statistic) []float64 {
+	sorted := make([]float64, len(delays))
+	for i := range delays {
+		sorted[i] = float64(delays[i])
+	}
+	sort.Float64s(sorted)
+
+	values := make([]float64, len(statistics))
+	if len(sorted) == 0 {
+		return values
+	}
+
+	mean := 0.0
+	for _, delay := range sorted {
+		mean += delay
+	}
+	mean /= float64(len(sorted))
+
+	for i, statistic := range statistics {
+		switch statistic.Type {
+		case StatisticCount:
+			values[i] = float64(len(sorted))
+		case StatisticMinimum:
+			values[i] = sorted[0]
+		case StatisticMaximum:
+			values[i] = sorted[len(sorted)-1]
+		case StatisticMean:
+			values[i] = mean
+		case StatisticStdDev:
+			variance := 0.0
+			for _, delay := range sorted {
+				variance += (delay - mean) * (delay - mean)
+			}
+			values[i] = math.Sqrt(variance / float64(len(sorted)))
+		case StatisticPercentile:
+			position := statistic.Percentile / 100 * float64(len(sorted)-1)
+			lower := int(math.Floor(position))
+			upper := int(math.Ceil(position))
+			values[i] = sorted[lower] + (sorted[upper]-sorted[lower])*(position-float64(lower))
+		}
+	}
+
+	return values
+}
+
+// CalculateGroupedStatistics groups the delays by the dimensions of the filter
+// and calculates the statistics requested by the filter for each group.
+// Groups are returned in the order given by the filter, in the same way as they
+// would be by PostgreSQL, for use by databases that cannot group and calculate
+// statistics natively.
+func CalculateGroupedStatistics(delays []*Delay, filter *DelayFilter) []*DelayStatistics {
+	dimensions := GroupingDimensions(filter)
+	slotsPerEpoch := SlotsPerEpoch(filter)
+
+	groups := make(map[string]*DelayStatistics)
+	groupDelays := make(map[string][]uint32)
+	for _, delay := range delays {
+		group := &DelayStatistics{}
+		for _, dimension := range dimensions {
+			switch dimension {
+			case DimensionSlot:
+				group.Slot = delay.Slot
+			case DimensionEpoch:
+				group.Epoch = delay.Slot / slotsPerEpoch
+			case DimensionSource:
+				group.Source = delay.Source
+			case DimensionMethod:
+				group.Method = delay.Method
+			case DimensionIPAddr:
+				group.IPAddr = forceIPv4(delay.IPAddr)
+			}
+		}
+		key := fmt.Sprintf("%d/%d/%q/%q/%s", group.Slot, group.Epoch, group.Source, group.Method, group.IPAddr)
+		if _, exists := groups[key]; !exists {
+			groups[key] = group
+		}
+		groupDelays[key] = append(groupDelays[key], delay.DelayMS)
+	}
+
+	res := make([]*DelayStatistics, 0, len(groups))
+	for key, group := range groups {
+		group.Values = CalculateStatistics(groupDelays[key], filter.Statistics)
+		res = append(res, group)
+	}
+	sort.Slice(res, func(i, j int) bool {
+		return ComparePositions(filter.Order, DelayStatisticsPosition(res[i]), DelayStatisticsPosition(res[j])) < 0
+	})
+
+	return res
+}
+
+// compareIPAddrs compares IP addresses in the same way as PostgreSQL,
+// with IPv4 addresses sorting before IPv6 addresses.
+func compareIPAddrs(a net.IP, b net.IP) int {
+	a = forceIPv4(a)
+	b = forceIPv4(b)
+	if len(a) != len(b) {
+		if len(a) < len(b) {
+			return -1
+		}
+		return 1
+	}
+	return bytes.Compare(a, b)
+}
+
+// forceIPv4 returns the IPv4 form of an address if it has one.
+func forceIPv4(ip net.IP) net.IP {
+	if ipv4 := ip.To4(); ipv4 != nil {
+		return ipv4
+	}
+	return ip
+}
@@ -19,16 +19,35 @@ import (
 
 // Delay holds information about a delay.
 type Delay struct {
-	IPAddr  net.IP
+	IPAddr net.IP
+	// Prober is the authenticated identity of the prober that supplied the delay.
+	// It is empty if the prober was not authenticated.
+	Prober  string
 	Source  string
 	Method  string
 	Slot    uint32
 	DelayMS uint32
 }
 
+// DelayStatistics holds statistics about a group of delays.
+// Only the fields for the dimensions by which the delays were grouped are set.
+type DelayStatistics struct {
+	Slot   uint32
+	Epoch  uint32
+	Source string
+	Method string
+	IPAddr net.IP
+	// Values are the values of the statistics, in the order in which they
+	// were requested by the filter.
+	Values []float64
+}
+
 // AttestationSummary holds summary information about an attestation.
 type AttestationSummary struct {
-	IPAddr          net.IP
+	IPAddr net.IP
+	// Prober is the authenticated identity of the prober that supplied the summary.
+	// It is empty if the prober was not authenticated.
+	Prober          string
 	Source          string
 	Method          string
 	Slot            uint32
@@ -44,7 +63,10 @@ type AttestationSummary struct {
 
 // AggregateAttestation holds information about an aggregate attestation.
 type AggregateAttestation struct {
-	IPAddr          net.IP
+	IPAddr net.IP
+	// Prober is the authenticated identity of the prober that supplied the attestation.
+	// It is empty if the prober was not authenticated.
+	Prober          string
 	Source          string
 	Method          string
 	Slot            uint32
@@ -0,0 +1,118 @@
+// Copyright © 2023 Weald Technology Trading.
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package pruner
+
+import (
+	"context"
+	"time"
+
+	"github.com/pkg/errors"
+	"github.com/prometheus/client_golang/prometheus"
+	"github.com/wealdtech/probed/services/metrics"
+)
+
+var metricsNamespace = "probed_pruner"
+
+var (
+	pruneDuration  *prometheus.HistogramVec
+	removedRecords *prometheus.CounterVec
+	prunedSlot     *prometheus.GaugeVec
+
+	droppedPartitions *prometheus.CounterVec
+)
+
+func registerMetrics(ctx context.Context, monitor metrics.Service) error {
+	if pruneDuration != nil {
+		// Already registered.
+		return nil
+	}
+	if monitor == nil {
+		// No monitor.
+		return nil
+	}
+	if monitor.Presenter() == "prometheus" {
+		return registerPrometheusMetrics(ctx)
+	}
+	return nil
+}
+
+func registerPrometheusMetrics(ctx context.Context) error {
+	pruneDuration = prometheus.NewHistogramVec(prometheus.HistogramOpts{
+		Namespace: metricsNamespace,
+		Name:      "prune_duration_seconds",
+		Help:      "The time taken to prune the database.",
+		Buckets: []float64{
+			0.1, 0.2, 0.5,
+			1.0, 2.0, 5.0,
+			10.0, 20.0, 50.0,
+			100.0,
+		},
+	}, []string{"result"})
+	if err := prometheus.Register(pruneDuration); err != nil {
+		return errors.Wrap(err, "failed to register prune_duration_seconds")
+	}
+
+	removedRecords = prometheus.NewCounterVec(prometheus.CounterOpts{
+		Namespace: metricsNamespace,
+		Name:      "removed_records_total",
+		Help:      "The number of records removed from the database.",
+	}, []string{"type"})
+	if err := prometheus.Register(removedRecords); err != nil {
+		return errors.Wrap(err, "failed to register removed_records_total")
+	}
+
+	prunedSlot = prometheus.NewGaugeVec(prometheus.GaugeOpts{
+		Namespace: metricsNamespace,
+		Name:      "pruned_slot",
+		Help:      "The slot before which records have been pruned.",
+	}, []string{"type"})
+	if err := prometheus.Register(prunedSlot); err != nil {
+		return errors.Wrap(err, "failed to register pruned_slot")
+	}
+
+	droppedPartitions = prometheus.NewCounterVec(prometheus.CounterOpts{
+		Namespace: metricsNamespace,
+		Name:      "dropped_partitions_total",
+		Help:      "The number of partitions dropped from the database.",
+	}, []string{"type"})
+	if err := prometheus.Register(droppedPartitions); err != nil {
+		return errors.Wrap(err, "failed to register dropped_partitions_total")
+	}
+
+	return nil
+}
+
+func pruneCompleted(started time.Time, result string) {
+	if pruneDuration != nil {
+		pruneDuration.WithLabelValues(result).Observe(time.Since(started).Seconds())
+	}
+}
+
+func recordsRemoved(recordType string, count uint32) {
+	if removedRecords != nil {
+		removedRecords.WithLabelValues(recordType).Add(float64(count))
+	}
+}
+
+func setPrunedSlot(recordType string, slot uint64) {
+	if prunedSlot != nil {
+		prunedSlot.WithLabelValues(recordType).Set(float64(slot))
+	}
+}
+
+func partitionsDropped(recordType string, count uint32) {
+	if droppedPartitions != nil {
+		droppedPartitions.WithLabelValues(recordType).Add(float64(count))
+	}
+}
@@ -0,0 +1,213 @@
+// Copyright © 2023 Weald Technology Trading.
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package pruner
+
+import (
+	"errors"
+	"time"
+
+	"github.com/rs/zerolog"
+	"github.com/wealdtech/probed/services/metrics"
+	nullmetrics "github.com/wealdtech/probed/services/metrics/null"
+	"github.com/wealdtech/probed/services/probedb"
+)
+
+type parameters struct {
+	logLevel                       zerolog.Level
+	monitor                        metrics.Service
+	probeDB                        probedb.Service
+	interval                       time.Duration
+	batchSize                      uint32
+	genesisTime                    time.Time
+	slotDuration                   time.Duration
+	slotsPerEpoch                  uint64
+	partitionLead                  uint64
+	blockDelaysRetention           uint64
+	headDelaysRetention            uint64
+	aggregateAttestationsRetention uint64
+	attestationSummariesRetention  uint64
+}
+
+// Parameter is the interface for service parameters.
+type Parameter interface {
+	apply(*parameters)
+}
+
+type parameterFunc func(*parameters)
+
+func (f parameterFunc) apply(p *parameters) {
+	f(p)
+}
+
+// WithLogLevel sets the log level for the module.
+func WithLogLevel(logLevel zerolog.Level) Parameter {
+	return parameterFunc(func(p *parameters) {
+		p.logLevel = logLevel
+	})
+}
+
+// WithMonitor sets the monitor for the module.
+func WithMonitor(monitor metrics.Service) Parameter {
+	return parameterFunc(func(p *parameters) {
+		p.monitor = monitor
+	})
+}
+
+// WithProbeDB sets the probe database for the module.
+// This must support the pruner interfaces for any tables with a retention period.
+func WithProbeDB(probeDB probedb.Service) Parameter {
+	return parameterFunc(func(p *parameters) {
+		p.probeDB = probeDB
+	})
+}
+
+// WithInterval sets the interval between background pruning runs.
+// If 0 then pruning only happens when Prune is called.
+func WithInterval(interval time.Duration) Parameter {
+	return parameterFunc(func(p *parameters) {
+		p.interval = interval
+	})
+}
+
+// WithBatchSize sets the maximum number of records removed in a single deletion.
+func WithBatchSize(size uint32) Parameter {
+	return parameterFunc(func(p *parameters) {
+		p.batchSize = size
+	})
+}
+
+// WithGenesisTime sets the genesis time of the chain, used to calculate the current slot.
+func WithGenesisTime(genesisTime time.Time) Parameter {
+	return parameterFunc(func(p *parameters) {
+		p.genesisTime = genesisTime
+	})
+}
+
+// WithSlotDuration sets the duration of a slot of the chain.
+func WithSlotDuration(duration time.Duration) Parameter {
+	return parameterFunc(func(p *parameters) {
+		p.slotDuration = duration
+	})
+}
+
+// WithSlotsPerEpoch sets the number of slots in an epoch of the chain.
+func WithSlotsPerEpoch(slots uint64) Parameter {
+	return parameterFunc(func(p *parameters) {
+		p.slotsPerEpoch = slots
+	})
+}
+
+// WithPartitionLead sets the number of epochs ahead of the current epoch for
+// which partitions are created, if the probe database is partitioned.
+func WithPartitionLead(epochs uint64) Parameter {
+	return parameterFunc(func(p *parameters) {
+		p.partitionLead = epochs
+	})
+}
+
+// WithBlockDelaysRetention sets the number of epochs for which to retain block delays.
+// If 0 then block delays are retained forever.
+func WithBlockDelaysRetention(epochs uint64) Parameter {
+	return parameterFunc(func(p *parameters) {
+		p.blockDelaysRetention = epochs
+	})
+}
+
+// WithHeadDelaysRetention sets the number of epochs for which to retain head delays.
+// If 0 then head delays are retained forever.
+func WithHeadDelaysRetention(epochs uint64) Parameter {
+	return parameterFunc(func(p *parameters) {
+		p.headDelaysRetention = epochs
+	})
+}
+
+// WithAggregateAttestationsRetention sets the number of epochs for which to retain aggregate attestations.
+// If 0 then aggregate attestations are retained forever.
+func WithAggregateAttestationsRetention(epochs uint64) Parameter {
+	return parameterFunc(func(p *parameters) {
+		p.aggregateAttestationsRetention = epochs
+	})
+}
+
+// WithAttestationSummariesRetention sets the number of epochs for which to retain attestation summaries.
+// If 0 then attestation summaries are retained forever.
+func WithAttestationSummariesRetention(epochs uint64) Parameter {
+	return parameterFunc(func(p *parameters) {
+		p.attestationSummariesRetention = epochs
+	})
+}
+
+// parseAndCheckParameters parses and checks parameters to ensure that mandatory parameters are present and correct.
+func parseAndCheckParameters(params ...Parameter) (*parameters, error) {
+	parameters := parameters{
+		logLevel:  zerolog.GlobalLevel(),
+		monitor:   nullmetrics.New(),
+		interval:  time.Hour,
+		batchSize: 10000,
+		// Defaults are for mainnet.
+		genesisTime:   time.Unix(1606824023, 0),
+		slotDuration:  12 * time.Second,
+		slotsPerEpoch: 32,
+		partitionLead: 450,
+	}
+	for _, p := range params {
+		if params != nil {
+			p.apply(&parameters)
+		}
+	}
+
+	if parameters.monitor == nil {
+		return nil, errors.New("no monitor specified")
+	}
+	if parameters.probeDB == nil {
+		return nil, errors.New("no probe database specified")
+	}
+	if parameters.interval < 0 {
+		return nil, errors.New("interval cannot be negative")
+	}
+	if parameters.batchSize == 0 {
+		return nil, errors.New("batch size must be positive")
+	}
+	if parameters.genesisTime.IsZero() {
+		return nil, errors.New("no genesis time specified")
+	}
+	if parameters.slotDuration <= 0 {
+		return nil, errors.New("slot duration must be positive")
+	}
+	if parameters.slotsPerEpoch == 0 {
+		return nil, errors.New("slots per epoch must be positive")
+	}
+	if parameters.blockDelaysRetention > 0 {
+		if _, isPruner := parameters.probeDB.(probedb.BlockDelaysPruner); !isPruner {
+			return nil, errors.New("probe database does not support pruning of block delays")
+		}
+	}
+	if parameters.headDelaysRetention > 0 {
+		if _, isPruner := parameters.probeDB.(probedb.HeadDelaysPruner); !isPruner {
+			return nil, errors.New("probe database does not support pruning of head delays")
+		}
+	}
+	if parameters.aggregateAttestationsRetention > 0 {
+		if _, isPruner := parameters.probeDB.(probedb.AggregateAttestationsPruner); !isPruner {
+			return nil, errors.New("probe database does not support pruning of aggregate attestations")
+		}
+	}
+	if parameters.attestationSummariesRetention > 0 {
+		if _, isPruner := parameters.probeDB.(probedb.AttestationSummariesPruner); !isPruner {
+			return nil, errors.New("probe database does not support pruning of attestation summaries")
+		}
+	}
+
+	return &parameters, nil
+}
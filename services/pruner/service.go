@@ -0,0 +1,225 @@
+// Copyright © 2023 Weald Technology Trading.
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+// Package pruner provides a service that removes data from the probe
+// database once it is older than its retention period.
+package pruner
+
+import (
+	"context"
+	"time"
+
+	"github.com/attestantio/go-eth2-client/spec/phase0"
+	"github.com/pkg/errors"
+	"github.com/rs/zerolog"
+	zerologger "github.com/rs/zerolog/log"
+	"github.com/wealdtech/probed/services/probedb"
+)
+
+// Service is a pruner service.
+type Service struct {
+	interval      time.Duration
+	batchSize     uint32
+	genesisTime   time.Time
+	slotDuration  time.Duration
+	slotsPerEpoch uint64
+	partitionLead uint64
+	partitioner   probedb.Partitioner
+	policies      []*policy
+}
+
+// policy is the retention policy for a single type of record.
+type policy struct {
+	recordType string
+	// retention is the number of epochs for which records are retained.
+	retention uint64
+	prune     func(ctx context.Context, before phase0.Slot, limit uint32) (uint32, error)
+}
+
+// module-wide log.
+var log zerolog.Logger
+
+// New creates a new pruner service.
+// If an interval is specified the service prunes the database periodically
+// in the background, starting immediately.
+func New(ctx context.Context, params ...Parameter) (*Service, error) {
+	parameters, err := parseAndCheckParameters(params...)
+	if err != nil {
+		return nil, errors.Wrap(err, "problem with parameters")
+	}
+
+	// Set logging.
+	log = zerologger.With().Str("service", "pruner").Str("impl", "standard").Logger().Level(parameters.logLevel)
+
+	if err := registerMetrics(ctx, parameters.monitor); err != nil {
+		return nil, errors.New("failed to register metrics")
+	}
+
+	policies := make([]*policy, 0)
+	if parameters.blockDelaysRetention > 0 {
+		policies = append(policies, &policy{
+			recordType: "block_delays",
+			retention:  parameters.blockDelaysRetention,
+			prune:      parameters.probeDB.(probedb.BlockDelaysPruner).PruneBlockDelays,
+		})
+	}
+	if parameters.headDelaysRetention > 0 {
+		policies = append(policies, &policy{
+			recordType: "head_delays",
+			retention:  parameters.headDelaysRetention,
+			prune:      parameters.probeDB.(probedb.HeadDelaysPruner).PruneHeadDelays,
+		})
+	}
+	if parameters.aggregateAttestationsRetention > 0 {
+		policies = append(policies, &policy{
+			recordType: "aggregate_attestations",
+			retention:  parameters.aggregateAttestationsRetention,
+			prune:      parameters.probeDB.(probedb.AggregateAttestationsPruner).PruneAggregateAttestations,
+		})
+	}
+	if parameters.attestationSummariesRetention > 0 {
+		policies = append(policies, &policy{
+			recordType: "attestation_summaries",
+			retention:  parameters.attestationSummariesRetention,
+			prune:      parameters.probeDB.(probedb.AttestationSummariesPruner).PruneAttestationSummaries,
+		})
+	}
+
+	s := &Service{
+		interval:      parameters.interval,
+		batchSize:     parameters.batchSize,
+		genesisTime:   parameters.genesisTime,
+		slotDuration:  parameters.slotDuration,
+		slotsPerEpoch: parameters.slotsPerEpoch,
+		partitionLead: parameters.partitionLead,
+		policies:      policies,
+	}
+	if partitioner, isPartitioner := parameters.probeDB.(probedb.Partitioner); isPartitioner {
+		s.partitioner = partitioner
+	}
+
+	if len(policies) == 0 && s.partitioner == nil {
+		log.Debug().Msg("No retention periods configured; nothing to prune")
+		return s, nil
+	}
+
+	if s.interval > 0 {
+		go s.run(ctx)
+	}
+
+	return s, nil
+}
+
+// run prunes the database periodically until the context is done.
+func (s *Service) run(ctx context.Context) {
+	ticker := time.NewTicker(s.interval)
+	defer ticker.Stop()
+
+	for {
+		if err := s.Prune(ctx); err != nil {
+			log.Error().Err(err).Msg("Failed to prune database")
+		}
+
+		select {
+		case <-ctx.Done():
+			log.Debug().Msg("Context done; stopping pruner")
+			return
+		case <-ticker.C:
+		}
+	}
+}
+
+// Prune removes all records that are older than their retention period.
+// If the probe database is partitioned it also creates partitions ahead of
+// the current slot, and drops partitions that are entirely out of retention.
+func (s *Service) Prune(ctx context.Context) error {
+	started := time.Now()
+	currentSlot := s.currentSlot()
+
+	if s.partitioner != nil {
+		to := currentSlot + phase0.Slot(s.partitionLead*s.slotsPerEpoch)
+		if err := s.partitioner.CreatePartitions(ctx, currentSlot, to); err != nil {
+			pruneCompleted(started, "failed")
+			return errors.Wrap(err, "failed to create partitions")
+		}
+		log.Trace().Uint64("to", uint64(to)).Msg("Partitions created")
+	}
+
+	for _, policy := range s.policies {
+		retentionSlots := policy.retention * s.slotsPerEpoch
+		if uint64(currentSlot) <= retentionSlots {
+			log.Trace().Str("type", policy.recordType).Msg("No records older than retention period")
+			continue
+		}
+		before := currentSlot - phase0.Slot(retentionSlots)
+
+		if s.partitioner != nil {
+			dropped, err := s.partitioner.DropPartitions(ctx, policy.recordType, before)
+			if err != nil {
+				pruneCompleted(started, "failed")
+				return errors.Wrap(err, "failed to drop partitions of "+policy.recordType)
+			}
+			partitionsDropped(policy.recordType, dropped)
+			if dropped > 0 {
+				log.Info().Str("type", policy.recordType).Uint64("before", uint64(before)).Uint32("dropped", dropped).Msg("Dropped partitions")
+			}
+		}
+
+		// Remove any remaining records, for example those in partially expired partitions.
+		removed, err := s.prune(ctx, policy, before)
+		if err != nil {
+			pruneCompleted(started, "failed")
+			return errors.Wrap(err, "failed to prune "+policy.recordType)
+		}
+		setPrunedSlot(policy.recordType, uint64(before))
+		if removed > 0 {
+			log.Info().Str("type", policy.recordType).Uint64("before", uint64(before)).Uint64("removed", removed).Msg("Pruned records")
+		} else {
+			log.Trace().Str("type", policy.recordType).Uint64("before", uint64(before)).Msg("No records to prune")
+		}
+	}
+	pruneCompleted(started, "succeeded")
+
+	return nil
+}
+
+// prune removes the records before the given slot for a single policy,
+// in batches to avoid holding locks on the database for long periods.
+func (s *Service) prune(ctx context.Context, policy *policy, before phase0.Slot) (uint64, error) {
+	total := uint64(0)
+	for {
+		if ctx.Err() != nil {
+			return total, ctx.Err()
+		}
+
+		removed, err := policy.prune(ctx, before, s.batchSize)
+		if err != nil {
+			return total, err
+		}
+		recordsRemoved(policy.recordType, removed)
+		total += uint64(removed)
+		if removed < s.batchSize {
+			return total, nil
+		}
+		log.Trace().Str("type", policy.recordType).Uint32("removed", removed).Msg("Pruned batch")
+	}
+}
+
+// currentSlot returns the current slot of the chain.
+func (s *Service) currentSlot() phase0.Slot {
+	if time.Now().Before(s.genesisTime) {
+		return 0
+	}
+
+	return phase0.Slot(uint64(time.Since(s.genesisTime) / s.slotDuration))
+}
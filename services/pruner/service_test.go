@@ -0,0 +1,252 @@
+// Copyright © 2023 Weald Technology Trading.
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package pruner_test
+
+import (
+	"context"
+	"net"
+	"testing"
+	"time"
+
+	"github.com/attestantio/go-eth2-client/spec/phase0"
+	"github.com/rs/zerolog"
+	"github.com/stretchr/testify/require"
+	"github.com/wealdtech/probed/services/probedb"
+	memoryprobedb "github.com/wealdtech/probed/services/probedb/memory"
+	mockprobedb "github.com/wealdtech/probed/services/probedb/mock"
+	"github.com/wealdtech/probed/services/pruner"
+)
+
+// setterDB supports setting, but not pruning, block delays.
+type setterDB struct {
+	probedb.BlockDelaysSetter
+}
+
+func TestService(t *testing.T) {
+	ctx := context.Background()
+
+	tests := []struct {
+		name   string
+		params []pruner.Parameter
+		err    string
+	}{
+		{
+			name: "MonitorMissing",
+			params: []pruner.Parameter{
+				pruner.WithLogLevel(zerolog.Disabled),
+				pruner.WithMonitor(nil),
+				pruner.WithProbeDB(mockprobedb.New()),
+			},
+			err: "problem with parameters: no monitor specified",
+		},
+		{
+			name: "ProbeDBMissing",
+			params: []pruner.Parameter{
+				pruner.WithLogLevel(zerolog.Disabled),
+			},
+			err: "problem with parameters: no probe database specified",
+		},
+		{
+			name: "IntervalNegative",
+			params: []pruner.Parameter{
+				pruner.WithLogLevel(zerolog.Disabled),
+				pruner.WithProbeDB(mockprobedb.New()),
+				pruner.WithInterval(-1),
+			},
+			err: "problem with parameters: interval cannot be negative",
+		},
+		{
+			name: "BatchSizeZero",
+			params: []pruner.Parameter{
+				pruner.WithLogLevel(zerolog.Disabled),
+				pruner.WithProbeDB(mockprobedb.New()),
+				pruner.WithBatchSize(0),
+			},
+			err: "problem with parameters: batch size must be positive",
+		},
+		{
+			name: "GenesisTimeZero",
+			params: []pruner.Parameter{
+				pruner.WithLogLevel(zerolog.Disabled),
+				pruner.WithProbeDB(mockprobedb.New()),
+				pruner.WithGenesisTime(time.Time{}),
+			},
+			err: "problem with parameters: no genesis time specified",
+		},
+		{
+			name: "SlotDurationZero",
+			params: []pruner.Parameter{
+				pruner.WithLogLevel(zerolog.Disabled),
+				pruner.WithProbeDB(mockprobedb.New()),
+				pruner.WithSlotDuration(0),
+			},
+			err: "problem with parameters: slot duration must be positive",
+		},
+		{
+			name: "SlotsPerEpochZero",
+			params: []pruner.Parameter{
+				pruner.WithLogLevel(zerolog.Disabled),
+				pruner.WithProbeDB(mockprobedb.New()),
+				pruner.WithSlotsPerEpoch(0),
+			},
+			err: "problem with parameters: slots per epoch must be positive",
+		},
+		{
+			name: "ProbeDBNotPruner",
+			params: []pruner.Parameter{
+				pruner.WithLogLevel(zerolog.Disabled),
+				pruner.WithProbeDB(&setterDB{BlockDelaysSetter: mockprobedb.New()}),
+				pruner.WithBlockDelaysRetention(1),
+			},
+			err: "problem with parameters: probe database does not support pruning of block delays",
+		},
+		{
+			name: "NoRetention",
+			params: []pruner.Parameter{
+				pruner.WithLogLevel(zerolog.Disabled),
+				pruner.WithProbeDB(&setterDB{BlockDelaysSetter: mockprobedb.New()}),
+			},
+		},
+		{
+			name: "Good",
+			params: []pruner.Parameter{
+				pruner.WithLogLevel(zerolog.Disabled),
+				pruner.WithProbeDB(mockprobedb.New()),
+				pruner.WithInterval(0),
+				pruner.WithBlockDelaysRetention(1),
+				pruner.WithHeadDelaysRetention(1),
+				pruner.WithAggregateAttestationsRetention(1),
+				pruner.WithAttestationSummariesRetention(1),
+			},
+		},
+	}
+
+	for _, test := range tests {
+		t.Run(test.name, func(t *testing.T) {
+			_, err := pruner.New(ctx, test.params...)
+			if test.err != "" {
+				require.EqualError(t, err, test.err)
+			} else {
+				require.NoError(t, err)
+			}
+		})
+	}
+}
+
+func TestPrune(t *testing.T) {
+	ctx := context.Background()
+
+	probeDB, err := memoryprobedb.New(ctx, memoryprobedb.WithLogLevel(zerolog.Disabled))
+	require.NoError(t, err)
+
+	for _, slot := range []uint32{10, 20, 67, 68, 99} {
+		delay := &probedb.Delay{IPAddr: net.ParseIP("1.2.3.4").To4(), Source: "Source", Method: "Method", Slot: slot, DelayMS: 100}
+		_, err := probeDB.SetBlockDelay(ctx, delay)
+		require.NoError(t, err)
+		_, err = probeDB.SetHeadDelay(ctx, delay)
+		require.NoError(t, err)
+	}
+
+	// Current slot is 100, so with a retention of 1 epoch records before slot 68 are pruned.
+	s, err := pruner.New(ctx,
+		pruner.WithLogLevel(zerolog.Disabled),
+		pruner.WithProbeDB(probeDB),
+		pruner.WithInterval(0),
+		pruner.WithBatchSize(1),
+		pruner.WithGenesisTime(time.Now().Add(-1206*time.Second)),
+		pruner.WithSlotDuration(12*time.Second),
+		pruner.WithSlotsPerEpoch(32),
+		pruner.WithBlockDelaysRetention(1),
+	)
+	require.NoError(t, err)
+	require.NoError(t, s.Prune(ctx))
+
+	blockDelays, err := probeDB.BlockDelays(ctx, &probedb.DelayFilter{Selection: probedb.SelectionAll})
+	require.NoError(t, err)
+	require.Len(t, blockDelays, 2)
+	require.Equal(t, uint32(68), blockDelays[0].Slot)
+	require.Equal(t, uint32(99), blockDelays[1].Slot)
+
+	// Head delays have no retention period, so are untouched.
+	headDelays, err := probeDB.HeadDelays(ctx, &probedb.DelayFilter{Selection: probedb.SelectionAll})
+	require.NoError(t, err)
+	require.Len(t, headDelays, 5)
+}
+
+func TestPruneBeforeRetention(t *testing.T) {
+	ctx := context.Background()
+
+	probeDB, err := memoryprobedb.New(ctx, memoryprobedb.WithLogLevel(zerolog.Disabled))
+	require.NoError(t, err)
+	_, err = probeDB.SetBlockDelay(ctx, &probedb.Delay{IPAddr: net.ParseIP("1.2.3.4").To4(), Source: "Source", Method: "Method", Slot: 1, DelayMS: 100})
+	require.NoError(t, err)
+
+	// Current slot is 10, which is within the retention period.
+	s, err := pruner.New(ctx,
+		pruner.WithLogLevel(zerolog.Disabled),
+		pruner.WithProbeDB(probeDB),
+		pruner.WithInterval(0),
+		pruner.WithGenesisTime(time.Now().Add(-126*time.Second)),
+		pruner.WithBlockDelaysRetention(1),
+	)
+	require.NoError(t, err)
+	require.NoError(t, s.Prune(ctx))
+
+	blockDelays, err := probeDB.BlockDelays(ctx, &probedb.DelayFilter{Selection: probedb.SelectionAll})
+	require.NoError(t, err)
+	require.Len(t, blockDelays, 1)
+}
+
+// partitionedDB records calls to the partitioner functions.
+type partitionedDB struct {
+	*memoryprobedb.Service
+	created [][2]phase0.Slot
+	dropped map[string]phase0.Slot
+}
+
+func (p *partitionedDB) CreatePartitions(_ context.Context, from phase0.Slot, to phase0.Slot) error {
+	p.created = append(p.created, [2]phase0.Slot{from, to})
+	return nil
+}
+
+func (p *partitionedDB) DropPartitions(_ context.Context, table string, before phase0.Slot) (uint32, error) {
+	p.dropped[table] = before
+	return 1, nil
+}
+
+func TestPrunePartitioned(t *testing.T) {
+	ctx := context.Background()
+
+	memoryDB, err := memoryprobedb.New(ctx, memoryprobedb.WithLogLevel(zerolog.Disabled))
+	require.NoError(t, err)
+	probeDB := &partitionedDB{
+		Service: memoryDB,
+		dropped: make(map[string]phase0.Slot),
+	}
+
+	// Current slot is 100.
+	s, err := pruner.New(ctx,
+		pruner.WithLogLevel(zerolog.Disabled),
+		pruner.WithProbeDB(probeDB),
+		pruner.WithInterval(0),
+		pruner.WithGenesisTime(time.Now().Add(-1206*time.Second)),
+		pruner.WithPartitionLead(2),
+		pruner.WithHeadDelaysRetention(1),
+	)
+	require.NoError(t, err)
+	require.NoError(t, s.Prune(ctx))
+
+	require.Equal(t, [][2]phase0.Slot{{100, 164}}, probeDB.created)
+	require.Equal(t, map[string]phase0.Slot{"head_delays": 68}, probeDB.dropped)
+}
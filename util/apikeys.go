@@ -0,0 +1,48 @@
+// Copyright © 2023 Weald Technology Trading.
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package util
+
+import (
+	"context"
+	"fmt"
+	"strings"
+
+	"github.com/pkg/errors"
+	"github.com/spf13/viper"
+	majordomo "github.com/wealdtech/go-majordomo"
+)
+
+// FetchAPIKeys fetches the API keys held at the given configuration path.
+// The configuration is a map of prober name to majordomo location of the
+// prober's key, for example "direct:///secret" or "file:///keys/prober1".
+// The returned map is of key to prober name.
+func FetchAPIKeys(ctx context.Context, majordomo majordomo.Service, path string) (map[string]string, error) {
+	apiKeys := make(map[string]string)
+	for prober, location := range viper.GetStringMapString(path) {
+		data, err := majordomo.Fetch(ctx, location)
+		if err != nil {
+			return nil, errors.Wrap(err, fmt.Sprintf("failed to fetch API key for prober %s", prober))
+		}
+		key := strings.TrimSpace(string(data))
+		if key == "" {
+			return nil, errors.Errorf("empty API key for prober %s", prober)
+		}
+		if existing, exists := apiKeys[key]; exists {
+			return nil, errors.Errorf("API key for prober %s duplicates that for prober %s", prober, existing)
+		}
+		apiKeys[key] = prober
+	}
+
+	return apiKeys, nil
+}
@@ -20,18 +20,89 @@ import (
 	"github.com/pkg/errors"
 	"github.com/spf13/viper"
 	majordomo "github.com/wealdtech/go-majordomo"
+	"github.com/wealdtech/probed/services/metrics"
 	"github.com/wealdtech/probed/services/probedb"
+	bufferedprobedb "github.com/wealdtech/probed/services/probedb/buffered"
+	memoryprobedb "github.com/wealdtech/probed/services/probedb/memory"
 	postgresqlprobedb "github.com/wealdtech/probed/services/probedb/postgresql"
+	resilientprobedb "github.com/wealdtech/probed/services/probedb/resilient"
+	spooledprobedb "github.com/wealdtech/probed/services/probedb/spooled"
+	sqliteprobedb "github.com/wealdtech/probed/services/probedb/sqlite"
 )
 
-// InitProbeDB initialises the probe database.
-func InitProbeDB(ctx context.Context, majordomo majordomo.Service) (probedb.Service, error) {
+// InitProbeDB initialises the probe database of the configured type.
+func InitProbeDB(ctx context.Context, monitor metrics.Service, majordomo majordomo.Service) (probedb.Service, error) {
+	conflictPolicies, err := conflictPolicies()
+	if err != nil {
+		return nil, err
+	}
+
+	switch viper.GetString("probedb.type") {
+	case "", "postgresql":
+		return initPostgreSQLProbeDB(ctx, monitor, majordomo, conflictPolicies)
+	case "sqlite":
+		return initSQLiteProbeDB(ctx, conflictPolicies)
+	case "memory":
+		return memoryprobedb.New(ctx,
+			memoryprobedb.WithLogLevel(LogLevel("probedb")),
+			memoryprobedb.WithConflictPolicies(conflictPolicies),
+		)
+	default:
+		return nil, errors.Errorf("unknown probe database type %q", viper.GetString("probedb.type"))
+	}
+}
+
+// initPostgreSQLProbeDB initialises a PostgreSQL probe database.
+func initPostgreSQLProbeDB(ctx context.Context,
+	monitor metrics.Service,
+	majordomo majordomo.Service,
+	conflictPolicies probedb.ConflictPolicies,
+) (
+	probedb.Service,
+	error,
+) {
 	opts := []postgresqlprobedb.Parameter{
 		postgresqlprobedb.WithLogLevel(LogLevel("probedb")),
+		postgresqlprobedb.WithMonitor(monitor),
 		postgresqlprobedb.WithServer(viper.GetString("probedb.server")),
 		postgresqlprobedb.WithUser(viper.GetString("probedb.user")),
 		postgresqlprobedb.WithPassword(viper.GetString("probedb.password")),
 		postgresqlprobedb.WithPort(viper.GetInt32("probedb.port")),
+		postgresqlprobedb.WithAllowNewerSchema(viper.GetBool("probedb.allow-newer-schema")),
+		postgresqlprobedb.WithConflictPolicies(conflictPolicies),
+	}
+	if viper.GetString("probedb.replica.server") != "" {
+		opts = append(opts, postgresqlprobedb.WithReplicaServer(viper.GetString("probedb.replica.server")))
+	}
+	if viper.GetInt32("probedb.replica.port") != 0 {
+		opts = append(opts, postgresqlprobedb.WithReplicaPort(viper.GetInt32("probedb.replica.port")))
+	}
+	if viper.GetString("probedb.database") != "" {
+		opts = append(opts, postgresqlprobedb.WithDatabase(viper.GetString("probedb.database")))
+	}
+	if viper.GetString("probedb.ssl-mode") != "" {
+		opts = append(opts, postgresqlprobedb.WithSSLMode(viper.GetString("probedb.ssl-mode")))
+	}
+	if viper.GetInt32("probedb.max-connections") != 0 {
+		opts = append(opts, postgresqlprobedb.WithMaxConnections(viper.GetInt32("probedb.max-connections")))
+	}
+	if viper.GetInt32("probedb.min-connections") != 0 {
+		opts = append(opts, postgresqlprobedb.WithMinConnections(viper.GetInt32("probedb.min-connections")))
+	}
+	if viper.GetDuration("probedb.max-connection-lifetime") != 0 {
+		opts = append(opts, postgresqlprobedb.WithMaxConnectionLifetime(viper.GetDuration("probedb.max-connection-lifetime")))
+	}
+	if viper.GetDuration("probedb.max-connection-idle-time") != 0 {
+		opts = append(opts, postgresqlprobedb.WithMaxConnectionIdleTime(viper.GetDuration("probedb.max-connection-idle-time")))
+	}
+	if viper.GetDuration("probedb.statement-timeout") != 0 {
+		opts = append(opts, postgresqlprobedb.WithStatementTimeout(viper.GetDuration("probedb.statement-timeout")))
+	}
+	if viper.IsSet("probedb.application-name") {
+		opts = append(opts, postgresqlprobedb.WithApplicationName(viper.GetString("probedb.application-name")))
+	}
+	if viper.GetUint32("probedb.partition-size") != 0 {
+		opts = append(opts, postgresqlprobedb.WithPartitionSize(viper.GetUint32("probedb.partition-size")))
 	}
 
 	if viper.GetString("probedb.client-cert") != "" {
@@ -60,3 +131,121 @@ func InitProbeDB(ctx context.Context, majordomo majordomo.Service) (probedb.Serv
 
 	return postgresqlprobedb.New(ctx, opts...)
 }
+
+// initSQLiteProbeDB initialises a SQLite probe database.
+func initSQLiteProbeDB(ctx context.Context, conflictPolicies probedb.ConflictPolicies) (probedb.Service, error) {
+	path := viper.GetString("probedb.sqlite.path")
+	if path != "" && path != ":memory:" {
+		path = ResolvePath(path)
+	}
+
+	return sqliteprobedb.New(ctx,
+		sqliteprobedb.WithLogLevel(LogLevel("probedb")),
+		sqliteprobedb.WithPath(path),
+		sqliteprobedb.WithAllowNewerSchema(viper.GetBool("probedb.allow-newer-schema")),
+		sqliteprobedb.WithConflictPolicies(conflictPolicies),
+	)
+}
+
+// conflictPolicies obtains the configured conflict policy for each type of record.
+// Attestation summaries are merged by default, as probers can submit partial summaries.
+func conflictPolicies() (probedb.ConflictPolicies, error) {
+	policies := probedb.ConflictPolicies{
+		AttestationSummaries: probedb.ConflictMerge,
+	}
+	for key, policy := range map[string]*probedb.ConflictPolicy{
+		"probedb.conflict-policy.block-delays":           &policies.BlockDelays,
+		"probedb.conflict-policy.head-delays":            &policies.HeadDelays,
+		"probedb.conflict-policy.aggregate-attestations": &policies.AggregateAttestations,
+		"probedb.conflict-policy.attestation-summaries":  &policies.AttestationSummaries,
+	} {
+		if viper.GetString(key) == "" {
+			continue
+		}
+		var err error
+		*policy, err = probedb.ParseConflictPolicy(viper.GetString(key))
+		if err != nil {
+			return policies, errors.Wrapf(err, "invalid %s", key)
+		}
+	}
+
+	return policies, nil
+}
+
+// InitBufferedProbeDB initialises a buffer in front of the probe database.
+func InitBufferedProbeDB(ctx context.Context, monitor metrics.Service, probeDB probedb.Service) (probedb.Service, error) {
+	opts := []bufferedprobedb.Parameter{
+		bufferedprobedb.WithLogLevel(LogLevel("probedb.buffered")),
+		bufferedprobedb.WithMonitor(monitor),
+		bufferedprobedb.WithProbeDB(probeDB),
+	}
+	if viper.GetInt("probedb.buffered.queue-size") != 0 {
+		opts = append(opts, bufferedprobedb.WithQueueSize(viper.GetInt("probedb.buffered.queue-size")))
+	}
+	if viper.GetInt("probedb.buffered.flush-size") != 0 {
+		opts = append(opts, bufferedprobedb.WithFlushSize(viper.GetInt("probedb.buffered.flush-size")))
+	}
+	if viper.GetDuration("probedb.buffered.flush-interval") != 0 {
+		opts = append(opts, bufferedprobedb.WithFlushInterval(viper.GetDuration("probedb.buffered.flush-interval")))
+	}
+	if viper.GetDuration("probedb.buffered.enqueue-timeout") != 0 {
+		opts = append(opts, bufferedprobedb.WithEnqueueTimeout(viper.GetDuration("probedb.buffered.enqueue-timeout")))
+	}
+	if viper.IsSet("probedb.buffered.max-retries") {
+		opts = append(opts, bufferedprobedb.WithMaxRetries(viper.GetInt("probedb.buffered.max-retries")))
+	}
+	if viper.GetDuration("probedb.buffered.retry-backoff") != 0 {
+		opts = append(opts, bufferedprobedb.WithRetryBackoff(viper.GetDuration("probedb.buffered.retry-backoff")))
+	}
+
+	return bufferedprobedb.New(ctx, opts...)
+}
+
+// InitResilientProbeDB initialises timeouts, retries and a circuit breaker around calls to the probe database.
+func InitResilientProbeDB(ctx context.Context, monitor metrics.Service, probeDB probedb.Service) (probedb.Service, error) {
+	opts := []resilientprobedb.Parameter{
+		resilientprobedb.WithLogLevel(LogLevel("probedb.policy")),
+		resilientprobedb.WithMonitor(monitor),
+		resilientprobedb.WithProbeDB(probeDB),
+	}
+	if viper.GetDuration("probedb.policy.timeout") != 0 {
+		opts = append(opts, resilientprobedb.WithTimeout(viper.GetDuration("probedb.policy.timeout")))
+	}
+	if viper.IsSet("probedb.policy.max-retries") {
+		opts = append(opts, resilientprobedb.WithMaxRetries(viper.GetInt("probedb.policy.max-retries")))
+	}
+	if viper.GetDuration("probedb.policy.retry-backoff") != 0 {
+		opts = append(opts, resilientprobedb.WithRetryBackoff(viper.GetDuration("probedb.policy.retry-backoff")))
+	}
+	if viper.GetInt("probedb.policy.failure-threshold") != 0 {
+		opts = append(opts, resilientprobedb.WithFailureThreshold(viper.GetInt("probedb.policy.failure-threshold")))
+	}
+	if viper.GetDuration("probedb.policy.open-duration") != 0 {
+		opts = append(opts, resilientprobedb.WithOpenDuration(viper.GetDuration("probedb.policy.open-duration")))
+	}
+
+	return resilientprobedb.New(ctx, opts...)
+}
+
+// InitSpooledProbeDB initialises a spool in front of the probe database.
+func InitSpooledProbeDB(ctx context.Context, monitor metrics.Service, probeDB probedb.Service) (probedb.Service, error) {
+	opts := []spooledprobedb.Parameter{
+		spooledprobedb.WithLogLevel(LogLevel("probedb.spool")),
+		spooledprobedb.WithMonitor(monitor),
+		spooledprobedb.WithProbeDB(probeDB),
+	}
+	if viper.GetString("probedb.spool.dir") != "" {
+		opts = append(opts, spooledprobedb.WithDir(ResolvePath(viper.GetString("probedb.spool.dir"))))
+	}
+	if viper.GetInt64("probedb.spool.segment-size") != 0 {
+		opts = append(opts, spooledprobedb.WithSegmentSize(viper.GetInt64("probedb.spool.segment-size")))
+	}
+	if viper.GetInt64("probedb.spool.max-size") != 0 {
+		opts = append(opts, spooledprobedb.WithMaxSize(viper.GetInt64("probedb.spool.max-size")))
+	}
+	if viper.GetDuration("probedb.spool.replay-interval") != 0 {
+		opts = append(opts, spooledprobedb.WithReplayInterval(viper.GetDuration("probedb.spool.replay-interval")))
+	}
+
+	return spooledprobedb.New(ctx, opts...)
+}
@@ -0,0 +1,60 @@
+// Copyright © 2023 Weald Technology Trading.
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package util
+
+import (
+	"context"
+	"time"
+
+	"github.com/spf13/viper"
+	"github.com/wealdtech/probed/services/metrics"
+	"github.com/wealdtech/probed/services/probedb"
+	"github.com/wealdtech/probed/services/pruner"
+)
+
+// InitPruner initialises a pruner for the probe database.
+// If periodic is false then the pruner only prunes when explicitly asked to.
+func InitPruner(ctx context.Context, monitor metrics.Service, probeDB probedb.Service, periodic bool) (*pruner.Service, error) {
+	opts := []pruner.Parameter{
+		pruner.WithLogLevel(LogLevel("pruner")),
+		pruner.WithMonitor(monitor),
+		pruner.WithProbeDB(probeDB),
+		pruner.WithBlockDelaysRetention(viper.GetUint64("pruner.retention.block-delays")),
+		pruner.WithHeadDelaysRetention(viper.GetUint64("pruner.retention.head-delays")),
+		pruner.WithAggregateAttestationsRetention(viper.GetUint64("pruner.retention.aggregate-attestations")),
+		pruner.WithAttestationSummariesRetention(viper.GetUint64("pruner.retention.attestation-summaries")),
+	}
+	if !periodic {
+		opts = append(opts, pruner.WithInterval(0))
+	} else if viper.GetDuration("pruner.interval") != 0 {
+		opts = append(opts, pruner.WithInterval(viper.GetDuration("pruner.interval")))
+	}
+	if viper.GetUint32("pruner.batch-size") != 0 {
+		opts = append(opts, pruner.WithBatchSize(viper.GetUint32("pruner.batch-size")))
+	}
+	if viper.GetInt64("chain.genesis-time") != 0 {
+		opts = append(opts, pruner.WithGenesisTime(time.Unix(viper.GetInt64("chain.genesis-time"), 0)))
+	}
+	if viper.GetDuration("chain.slot-duration") != 0 {
+		opts = append(opts, pruner.WithSlotDuration(viper.GetDuration("chain.slot-duration")))
+	}
+	if viper.GetUint64("pruner.partition-lead") != 0 {
+		opts = append(opts, pruner.WithPartitionLead(viper.GetUint64("pruner.partition-lead")))
+	}
+	if viper.GetUint64("chain.slots-per-epoch") != 0 {
+		opts = append(opts, pruner.WithSlotsPerEpoch(viper.GetUint64("chain.slots-per-epoch")))
+	}
+
+	return pruner.New(ctx, opts...)
+}